@@ -10,8 +10,10 @@ import (
 )
 
 type Builder[K comparable, V any] struct {
-	ctx context.Context
-	cx  *CacheX[K, V]
+	ctx           context.Context
+	cx            *CacheX[K, V]
+	slidingConfig *SlidingConfig
+	schema        cache.Schema[V]
 }
 
 // NewBuilder NewBuilder
@@ -99,6 +101,107 @@ func (b *Builder[K, V]) SetIsSetDefault(isSetDefault bool) *Builder[K, V] {
 	return b
 }
 
+// SetReadErrorCallback 设置缓存读取错误回调，未设置时打印日志
+func (b *Builder[K, V]) SetReadErrorCallback(cb ReadErrorCallback) *Builder[K, V] {
+	b.cx.readErrorCallback = cb
+	return b
+}
+
+// SetCorruptCallback 设置缓存数据无法解码回调，无法解码的数据会从该层级删除
+func (b *Builder[K, V]) SetCorruptCallback(cb CorruptCallback) *Builder[K, V] {
+	b.cx.corruptCallback = cb
+	return b
+}
+
+// SetGetVersion 设置获取数据版本函数，设置后写入时拒绝比缓存中版本更旧的数据
+func (b *Builder[K, V]) SetGetVersion(fn GetVersion[V]) *Builder[K, V] {
+	b.cx.getVersion = fn
+	return b
+}
+
+// SetLease 设置租约，未命中时获取租约，Delete使租约失效，租约失效后回源结果不回填缓存
+//
+// ttl: 租约有效期，0为不使用租约
+//
+// wait: 租约被其他请求持有时等待回填的最大时间，超时后自行回源；允许降级且存在降级有效期内的旧数据时直接降级返回旧数据
+func (b *Builder[K, V]) SetLease(ttl time.Duration, wait time.Duration) *Builder[K, V] {
+	b.cx.leaseTTL = ttl
+	b.cx.leaseWait = wait
+	return b
+}
+
+// SetTombstone 设置墓碑删除，删除时写入墓碑，宽限期内拒绝删除前开始的回源写入，读取时墓碑视为未命中
+//
+// grace: 墓碑宽限期，0为直接删除
+func (b *Builder[K, V]) SetTombstone(grace time.Duration) *Builder[K, V] {
+	b.cx.tombstoneGrace = grace
+	return b
+}
+
+// SetLoadLock 设置分布式回源锁，基于支持Locker的缓存(如Redis)，持有锁的实例回源并回填，
+// 其他实例轮询缓存等待回填，超时后自行回源或降级
+//
+// ttl: 锁有效期，0为不加锁
+//
+// wait: 锁被其他实例持有时等待回填的最大时间
+func (b *Builder[K, V]) SetLoadLock(ttl time.Duration, wait time.Duration) *Builder[K, V] {
+	b.cx.loadLockTTL = ttl
+	b.cx.loadLockWait = wait
+	return b
+}
+
+// SetDeleteRetry 设置删除失败重试，失败的删除按层级排队并退避重试，配置文件时持久化到本地文件，重启后继续重试
+func (b *Builder[K, V]) SetDeleteRetry(cfg RetryConfig) *Builder[K, V] {
+	b.cx.retryConfig = &cfg
+	return b
+}
+
+// SetRetryGiveUpCallback 设置删除重试放弃回调
+func (b *Builder[K, V]) SetRetryGiveUpCallback(cb RetryGiveUpCallback) *Builder[K, V] {
+	b.cx.retryGiveUpCallback = cb
+	return b
+}
+
+// SetDoubleDelete 设置延迟双删，删除后间隔delay再次删除各层缓存，失败时按删除重试配置重试
+func (b *Builder[K, V]) SetDoubleDelete(delay time.Duration) *Builder[K, V] {
+	b.cx.doubleDeleteDelay = delay
+	return b
+}
+
+// SetSlidingExpiration 设置滑动过期，命中后延长各层级缓存存活时间，业务过期时间从最近一次访问开始计算，
+// 同一key按间隔限流；最近访问时间记录在本实例内存中，最多记录SlidingConfig.Size个key，
+// 被淘汰的key回退为按写入时间过期，淘汰次数见CacheX.SlidingStats
+func (b *Builder[K, V]) SetSlidingExpiration(cfg SlidingConfig) *Builder[K, V] {
+	b.slidingConfig = &cfg
+	return b
+}
+
+// SetSchemaVersion 设置缓存数据schema版本，缓存构造时通过SchemaOption设置，Build时检查版本及升级函数一致，
+// 不修改缓存实例；写入时记录在缓存数据中，读取时低于该版本且未注册升级函数、或高于该版本的数据视为未命中并回源刷新，
+// Redis、Memcached等共享缓存不覆盖更高版本实例写入的数据；LRUCache等进程内缓存不记录版本
+func (b *Builder[K, V]) SetSchemaVersion(version uint32) *Builder[K, V] {
+	b.schema.Version = version
+	return b
+}
+
+// RegisterMigration 注册schema版本from的缓存数据升级为当前版本的函数，读取时升级，不写回缓存
+func (b *Builder[K, V]) RegisterMigration(from uint32, fn cache.Migration[V]) *Builder[K, V] {
+	if b.schema.Migrations == nil {
+		b.schema.Migrations = make(map[uint32]cache.Migration[V])
+	}
+	b.schema.Migrations[from] = fn
+	return b
+}
+
+// SchemaOption 返回设置当前schema版本及已注册升级函数的缓存构造选项，需在SetSchemaVersion及RegisterMigration之后调用
+func (b *Builder[K, V]) SchemaOption() cache.Option {
+	schema := cache.Schema[V]{Version: b.schema.Version, Migrations: make(map[uint32]cache.Migration[V], len(b.schema.Migrations))}
+	for from, fn := range b.schema.Migrations {
+		schema.Migrations[from] = fn
+	}
+	return cache.WithSchema(schema)
+}
+
 // Build 设置并初始化缓存
 func (b *Builder[K, V]) Build() (*CacheX[K, V], error) {
 	// 设置logger
@@ -110,7 +213,74 @@ func (b *Builder[K, V]) Build() (*CacheX[K, V], error) {
 		b.cx.logger.Errorf(b.ctx, "GetDataKey not set")
 		return nil, fmt.Errorf("GetDataKey not set")
 	}
+	// 检查schema版本
+	if err := b.checkSchema(); err != nil {
+		b.cx.logger.Errorf(b.ctx, "check schema error: %v", err)
+		return nil, fmt.Errorf("check schema error: %w", err)
+	}
+	// 初始化删除重试队列
+	if b.cx.retryConfig != nil || b.cx.doubleDeleteDelay > 0 {
+		var cfg RetryConfig
+		if b.cx.retryConfig != nil {
+			cfg = *b.cx.retryConfig
+		}
+		cfg = cfg.withDefault()
+		if b.cx.retryConfig != nil {
+			b.cx.retryConfig = &cfg
+		}
+		q, err := b.cx.newRetryQueue(cfg)
+		if err != nil {
+			b.cx.logger.Errorf(b.ctx, "init delete retry queue error: %v", err)
+			return nil, fmt.Errorf("init delete retry queue error: %w", err)
+		}
+		b.cx.retry = q
+	}
+	// 初始化滑动过期
+	if b.slidingConfig != nil {
+		s, err := newSliding(b.slidingConfig.withDefault())
+		if err != nil {
+			b.cx.logger.Errorf(b.ctx, "init sliding expiration error: %v", err)
+			return nil, fmt.Errorf("init sliding expiration error: %w", err)
+		}
+		b.cx.sliding = s
+	}
 	// 初始化成功
 	b.cx.logger.Debugf(b.ctx, "cache %v check success", b.cx.name)
 	return b.cx, nil
 }
+
+// checkSchema 检查升级函数的版本低于当前版本，各缓存构造时设置的schema类型正确，
+// 设置schema版本时版本一致且包含Builder注册的全部升级函数
+func (b *Builder[K, V]) checkSchema() error {
+	for from := range b.schema.Migrations {
+		if from >= b.schema.Version {
+			return fmt.Errorf("invalid migration from schema %v to %v", from, b.schema.Version)
+		}
+	}
+	for level, c := range b.cx.caches {
+		versioner, ok := c.(cache.SchemaVersioner)
+		if !ok {
+			continue
+		}
+		info := versioner.SchemaInfo()
+		if info.Err != nil {
+			return fmt.Errorf("cache level %v: %w", level, info.Err)
+		}
+		if b.schema.Version == 0 {
+			continue
+		}
+		if info.Version != b.schema.Version {
+			return fmt.Errorf("cache level %v schema version %v, expect %v", level, info.Version, b.schema.Version)
+		}
+		registered := make(map[uint32]bool, len(info.Migrations))
+		for _, from := range info.Migrations {
+			registered[from] = true
+		}
+		for from := range b.schema.Migrations {
+			if !registered[from] {
+				return fmt.Errorf("cache level %v missing migration from schema %v", level, from)
+			}
+		}
+	}
+	return nil
+}
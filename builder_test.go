@@ -41,7 +41,16 @@ func TestBuilder(t *testing.T) {
 			SetDowngradeCallBack(downgradeCallBack).
 			SetMDowngradeCallBack(mDowngradeCallBack).
 			SetIsSetDefault(true).
+			SetReadErrorCallback(func(_ context.Context, _ string, _ int, _ error) {}).
+			SetGetVersion(func(_ string) int64 { return 0 }).
+			SetLease(time.Second, time.Millisecond).
+			SetTombstone(time.Minute).
+			SetLoadLock(time.Second, 100*time.Millisecond).
+			SetDeleteRetry(RetryConfig{MaxAttempts: 3}).
+			SetRetryGiveUpCallback(func(_ context.Context, _ string, _ int, _ []string, _ error) {}).
+			SetDoubleDelete(time.Second).
 			Build()
+		defer cx.retry.Close()
 
 		assert.Nil(t, err)
 		assert.Equal(tt, name, cx.name)
@@ -57,6 +66,17 @@ func TestBuilder(t *testing.T) {
 		assert.NotNil(tt, cx.downgradeCallback)
 		assert.NotNil(tt, cx.mDowngradeCallback)
 		assert.True(tt, cx.isSetDefault)
+		assert.NotNil(tt, cx.readErrorCallback)
+		assert.NotNil(tt, cx.getVersion)
+		assert.Equal(tt, time.Second, cx.leaseTTL)
+		assert.Equal(tt, time.Millisecond, cx.leaseWait)
+		assert.Equal(tt, time.Minute, cx.tombstoneGrace)
+		assert.Equal(tt, time.Second, cx.loadLockTTL)
+		assert.Equal(tt, 100*time.Millisecond, cx.loadLockWait)
+		assert.Equal(tt, RetryConfig{MaxAttempts: 3, Backoff: 100 * time.Millisecond, MaxBackoff: time.Minute}, *cx.retryConfig)
+		assert.NotNil(tt, cx.retryGiveUpCallback)
+		assert.Equal(tt, time.Second, cx.doubleDeleteDelay)
+		assert.NotNil(tt, cx.retry)
 	})
 
 	t.Run("not_set_logger", func(tt *testing.T) {
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// AsV2 将Cache转换为CacheV2，原生支持V2的缓存直接返回其实现，
+// 其他缓存通过适配器包装，读取不会返回错误，不支持EnvelopeGetter时Envelope只包含数据
+func AsV2[T any](c Cache[T]) CacheV2[T] {
+	if v, ok := c.(V2Provider[T]); ok {
+		return v.V2()
+	}
+	return &v2Adapter[T]{Cache: c}
+}
+
+// AsV1 将CacheV2转换为Cache，用于添加到CacheX，读取错误视为未命中
+func AsV1[T any](c CacheV2[T]) Cache[T] {
+	if v, ok := c.(*v2Adapter[T]); ok {
+		return v.Cache
+	}
+	return &v1Adapter[T]{CacheV2: c}
+}
+
+// v2Adapter Cache适配CacheV2
+type v2Adapter[T any] struct {
+	Cache[T]
+}
+
+func (a *v2Adapter[T]) Get(ctx context.Context, key string, expire time.Duration) (*Envelope[T], bool, error) {
+	if getter, ok := a.Cache.(EnvelopeGetter[T]); ok {
+		env, found := getter.GetEnvelope(ctx, key)
+		if !found || env.IsExpired(time.Now(), expire) {
+			return nil, false, nil
+		}
+		return env, true, nil
+	}
+	data, ok := a.Cache.Get(ctx, key, expire)
+	if !ok {
+		return nil, false, nil
+	}
+	return &Envelope[T]{Data: data}, true, nil
+}
+
+func (a *v2Adapter[T]) MGet(ctx context.Context, keys []string, expire time.Duration) (map[string]*Envelope[T], error) {
+	if getter, ok := a.Cache.(EnvelopeGetter[T]); ok {
+		now := time.Now()
+		envs := getter.MGetEnvelope(ctx, keys)
+		for key, env := range envs {
+			if env.IsExpired(now, expire) {
+				delete(envs, key)
+			}
+		}
+		return envs, nil
+	}
+	data := a.Cache.MGet(ctx, keys, expire)
+	envs := make(map[string]*Envelope[T], len(data))
+	for key, v := range data {
+		envs[key] = &Envelope[T]{Data: v}
+	}
+	return envs, nil
+}
+
+// v1Adapter CacheV2适配Cache
+type v1Adapter[T any] struct {
+	CacheV2[T]
+}
+
+func (a *v1Adapter[T]) Get(ctx context.Context, key string, expire time.Duration) (T, bool) {
+	var zero T
+	env, found, err := a.CacheV2.Get(ctx, key, expire)
+	if err != nil || !found {
+		return zero, false
+	}
+	return env.Value(time.Now(), 0)
+}
+
+func (a *v1Adapter[T]) MGet(ctx context.Context, keys []string, expire time.Duration) map[string]T {
+	result := make(map[string]T)
+	envs, err := a.CacheV2.MGet(ctx, keys, expire)
+	if err != nil {
+		return result
+	}
+	now := time.Now()
+	for key, env := range envs {
+		if data, ok := env.Value(now, 0); ok {
+			result[key] = data
+		}
+	}
+	return result
+}
+
+func (a *v1Adapter[T]) GetEnvelope(ctx context.Context, key string) (*Envelope[T], bool) {
+	env, found, err := a.CacheV2.Get(ctx, key, 0)
+	if err != nil || !found {
+		return nil, false
+	}
+	return env, true
+}
+
+func (a *v1Adapter[T]) MGetEnvelope(ctx context.Context, keys []string) map[string]*Envelope[T] {
+	envs, err := a.CacheV2.MGet(ctx, keys, 0)
+	if err != nil {
+		return make(map[string]*Envelope[T])
+	}
+	return envs
+}
+
+// V2 返回被适配的CacheV2
+func (a *v1Adapter[T]) V2() CacheV2[T] {
+	return a.CacheV2
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// errCacheV2 读取总是返回错误的CacheV2
+type errCacheV2[T any] struct {
+	CacheV2[T]
+	err error
+}
+
+func (e *errCacheV2[T]) Get(_ context.Context, _ string, _ time.Duration) (*Envelope[T], bool, error) {
+	return nil, false, e.err
+}
+
+func (e *errCacheV2[T]) MGet(_ context.Context, _ []string, _ time.Duration) (map[string]*Envelope[T], error) {
+	return nil, e.err
+}
+
+func TestAsV2(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("envelope getter", func(tt *testing.T) {
+		lc := NewLRUCache[string](10, time.Hour)
+		createTime := time.Now().Add(-time.Minute)
+		_ = lc.Set(ctx, "a", "v", createTime)
+		_ = lc.SetDefault(ctx, []string{"b"}, time.Now())
+		v2 := AsV2[string](lc)
+
+		env, found, err := v2.Get(ctx, "a", time.Hour)
+		assert.Nil(tt, err)
+		assert.True(tt, found)
+		assert.Equal(tt, &Envelope[string]{Data: "v", CreateAt: createTime.UnixMilli()}, env)
+		_, found, err = v2.Get(ctx, "a", time.Second)
+		assert.Nil(tt, err)
+		assert.False(tt, found)
+		env, found, _ = v2.Get(ctx, "b", time.Hour)
+		assert.True(tt, found)
+		assert.True(tt, env.Default)
+
+		envs, err := v2.MGet(ctx, []string{"a", "b", "c"}, time.Second)
+		assert.Nil(tt, err)
+		assert.Len(tt, envs, 1)
+		assert.True(tt, envs["b"].Default)
+	})
+
+	t.Run("plain cache", func(tt *testing.T) {
+		mocker := NewCacheMocker[string]().
+			MockGet(func(ctx context.Context, key string, expire time.Duration) (string, bool) {
+				return "v", key == "a"
+			}).
+			MockMGet(func(ctx context.Context, keys []string, expire time.Duration) map[string]string {
+				return map[string]string{"a": "v"}
+			})
+		v2 := AsV2[string](mocker)
+		env, found, err := v2.Get(ctx, "a", time.Hour)
+		assert.Nil(tt, err)
+		assert.True(tt, found)
+		assert.Equal(tt, &Envelope[string]{Data: "v"}, env)
+		_, found, _ = v2.Get(ctx, "b", time.Hour)
+		assert.False(tt, found)
+		envs, err := v2.MGet(ctx, []string{"a", "b"}, time.Hour)
+		assert.Nil(tt, err)
+		assert.Equal(tt, map[string]*Envelope[string]{"a": {Data: "v"}}, envs)
+		assert.Equal(tt, Cache[string](mocker), AsV1(v2))
+	})
+}
+
+func TestAsV1(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("round trip", func(tt *testing.T) {
+		v2 := AsV2[string](NewLRUCache[string](10, time.Hour))
+		v1 := AsV1(v2)
+		assert.Nil(tt, v1.Set(ctx, "a", "v", time.Now()))
+		_ = v1.SetDefault(ctx, []string{"b"}, time.Now())
+		got, ok := v1.Get(ctx, "a", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v", got)
+		_, ok = v1.Get(ctx, "b", time.Hour)
+		assert.False(tt, ok)
+		assert.Equal(tt, map[string]string{"a": "v"}, v1.MGet(ctx, []string{"a", "b"}, time.Hour))
+	})
+
+	t.Run("native v2", func(tt *testing.T) {
+		v2 := &errCacheV2[string]{CacheV2: AsV2[string](NewLRUCache[string](10, time.Hour)), err: errors.New("read error")}
+		v1 := AsV1[string](v2)
+		assert.Equal(tt, CacheV2[string](v2), AsV2(v1))
+
+		_, ok := v1.Get(ctx, "a", time.Hour)
+		assert.False(tt, ok)
+		assert.Empty(tt, v1.MGet(ctx, []string{"a"}, time.Hour))
+		getter := v1.(EnvelopeGetter[string])
+		_, ok = getter.GetEnvelope(ctx, "a")
+		assert.False(tt, ok)
+		assert.Empty(tt, getter.MGetEnvelope(ctx, []string{"a"}))
+	})
+
+	t.Run("envelope getter", func(tt *testing.T) {
+		lc := NewLRUCache[string](10, time.Hour)
+		_ = lc.Set(ctx, "a", "v", time.Now())
+		v2 := struct{ CacheV2[string] }{AsV2[string](lc)}
+		getter := AsV1[string](v2).(EnvelopeGetter[string])
+		env, ok := getter.GetEnvelope(ctx, "a")
+		assert.True(tt, ok)
+		assert.Equal(tt, "v", env.Data)
+		assert.Len(tt, getter.MGetEnvelope(ctx, []string{"a", "b"}), 1)
+	})
+}
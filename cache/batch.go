@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// 默认批量操作配置
+const (
+	defaultBatchSize        = 1000
+	defaultBatchParallelism = 4
+)
+
+// WithBatch 设置批量操作分批，仅RedisCache及RedisHashCache生效，MGet、MSet、SetDefault及MDelete按size个key分批，
+// 每批一个Pipeline，最多parallelism批并发执行；部分批次失败时返回BatchError，其他批次的结果正常返回或写入
+//
+// size: 每批key数量，不大于0时为1000
+// parallelism: 最大并发批数，不大于0时为4
+func WithBatch(size int, parallelism int) Option {
+	return func(o *options) {
+		o.batchSize = size
+		o.batchParallelism = parallelism
+	}
+}
+
+// BatchError 批量操作部分批次失败，Keys为失败批次的key，Err为各批次错误
+type BatchError struct {
+	Keys []string
+	Err  error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch failed, %v keys: %v", len(e.Keys), e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// batching 批量操作分批配置，零值使用默认配置
+type batching struct {
+	size        int
+	parallelism int
+}
+
+// newBatching 由构造选项创建分批配置
+func newBatching(opts *options) batching {
+	return batching{size: opts.batchSize, parallelism: opts.batchParallelism}
+}
+
+// withDefault 未设置的配置项使用默认值
+func (b batching) withDefault() batching {
+	if b.size <= 0 {
+		b.size = defaultBatchSize
+	}
+	if b.parallelism <= 0 {
+		b.parallelism = defaultBatchParallelism
+	}
+	return b
+}
+
+// run 按批执行fn，只有一批时在当前goroutine执行，汇总失败批次的key及错误
+func (b batching) run(ctx context.Context, keys []string, fn func(ctx context.Context, keys []string) error) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	b = b.withDefault()
+	if len(keys) <= b.size {
+		if err := fn(ctx, keys); err != nil {
+			return &BatchError{Keys: keys, Err: err}
+		}
+		return nil
+	}
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+		errs   []error
+	)
+	sem := make(chan struct{}, b.parallelism)
+	for start := 0; start < len(keys); start += b.size {
+		batch := keys[start:min(start+b.size, len(keys))]
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := fn(ctx, batch); err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				failed = append(failed, batch...)
+				errs = append(errs, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		return nil
+	}
+	return &BatchError{Keys: failed, Err: errors.Join(errs...)}
+}
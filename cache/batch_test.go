@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatching(t *testing.T) {
+	ctx := context.Background()
+	keys := []string{"a", "b", "c", "d", "e"}
+
+	t.Run("split", func(tt *testing.T) {
+		var (
+			mu       sync.Mutex
+			batches  [][]string
+			running  atomic.Int32
+			peak     atomic.Int32
+			parallel = make(chan struct{})
+			once     sync.Once
+		)
+		err := batching{size: 2, parallelism: 2}.run(ctx, keys, func(ctx context.Context, keys []string) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			// 两个批次同时执行后再返回
+			if n == 2 {
+				once.Do(func() { close(parallel) })
+			}
+			select {
+			case <-parallel:
+			case <-time.After(time.Second):
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			batches = append(batches, keys)
+			return nil
+		})
+		assert.Nil(tt, err)
+		sort.Slice(batches, func(i, j int) bool { return batches[i][0] < batches[j][0] })
+		assert.Equal(tt, [][]string{{"a", "b"}, {"c", "d"}, {"e"}}, batches)
+		assert.Equal(tt, int32(2), peak.Load())
+	})
+
+	t.Run("partial failure", func(tt *testing.T) {
+		var done atomic.Int32
+		err := batching{size: 2}.run(ctx, keys, func(ctx context.Context, keys []string) error {
+			if keys[0] == "c" {
+				return errors.New("unit_test")
+			}
+			done.Add(1)
+			return nil
+		})
+		var batch *BatchError
+		assert.ErrorAs(tt, err, &batch)
+		assert.Equal(tt, []string{"c", "d"}, batch.Keys)
+		assert.Equal(tt, "batch failed, 2 keys: unit_test", batch.Error())
+		assert.Equal(tt, int32(2), done.Load())
+	})
+
+	t.Run("single batch", func(tt *testing.T) {
+		calls := 0
+		err := batching{}.run(ctx, keys, func(ctx context.Context, keys []string) error {
+			calls++
+			return errors.New("unit_test")
+		})
+		var batch *BatchError
+		assert.ErrorAs(tt, err, &batch)
+		assert.Equal(tt, keys, batch.Keys)
+		assert.Equal(tt, 1, calls)
+		assert.Nil(tt, batching{}.run(ctx, nil, func(ctx context.Context, keys []string) error {
+			return errors.New("unit_test")
+		}))
+	})
+}
+
+// failingHook 包含指定key的命令及Pipeline返回错误，记录每个Pipeline的命令数
+type failingHook struct {
+	key   string
+	mu    sync.Mutex
+	sizes []int
+}
+
+func (h *failingHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h *failingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if h.fail([]redis.Cmder{cmd}) {
+			return cmd.Err()
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *failingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		h.mu.Lock()
+		h.sizes = append(h.sizes, len(cmds))
+		h.mu.Unlock()
+		if h.fail(cmds) {
+			return cmds[0].Err()
+		}
+		return next(ctx, cmds)
+	}
+}
+
+// fail 命令包含指定key时设置错误
+func (h *failingHook) fail(cmds []redis.Cmder) bool {
+	for _, cmd := range cmds {
+		for _, arg := range cmd.Args() {
+			if h.key != "" && arg == h.key {
+				for _, cmd := range cmds {
+					cmd.SetErr(errors.New("unit_test"))
+				}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestRedisCache_batch(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	hook := &failingHook{}
+	client.AddHook(hook)
+	rc := NewRedisCacheWithClient[string](client, time.Minute, WithBatch(2, 2))
+	kvs := map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5"}
+	keys := []string{"a", "b", "c", "d", "e"}
+
+	t.Run("mset", func(tt *testing.T) {
+		assert.Nil(tt, rc.MSet(ctx, kvs, time.Now()))
+		sort.Ints(hook.sizes)
+		assert.Equal(tt, []int{1, 2, 2}, hook.sizes)
+		assert.Equal(tt, kvs, rc.MGet(ctx, keys, 0))
+	})
+
+	t.Run("partial failure", func(tt *testing.T) {
+		hook.key = "c"
+		defer func() { hook.key = "" }()
+		envs, err := rc.V2().MGet(ctx, []string{"a", "b", "c", "d", "e"}, 0)
+		var batch *BatchError
+		assert.ErrorAs(tt, err, &batch)
+		assert.Equal(tt, []string{"c", "d"}, batch.Keys)
+		assert.Equal(tt, []string{"a", "b", "e"}, keysOf(envs))
+
+		mr.Set("a", "invalid")
+		envs, err = rc.V2().MGet(ctx, []string{"a", "b", "c", "d", "e"}, 0)
+		var corrupt *CorruptError
+		assert.ErrorAs(tt, err, &batch)
+		assert.ErrorAs(tt, err, &corrupt)
+		assert.Equal(tt, []string{"b", "e"}, keysOf(envs))
+
+		err = rc.SetDefault(ctx, []string{"x", "y", "c"}, time.Now())
+		assert.ErrorAs(tt, err, &batch)
+		assert.Equal(tt, []string{"c"}, batch.Keys)
+		assert.True(tt, mr.Exists("x"))
+
+		err = rc.MSetWithVersion(ctx, map[string]string{"v1": "1", "v2": "2", "c": "3"}, map[string]int64{"v1": 1, "v2": 1, "c": 1}, time.Now())
+		assert.ErrorAs(tt, err, &batch)
+		assert.Contains(tt, batch.Keys, "c")
+		for _, key := range []string{"v1", "v2"} {
+			assert.Equal(tt, !slices.Contains(batch.Keys, key), mr.Exists(key), key)
+		}
+
+		err = rc.MDelete(ctx, keys)
+		assert.ErrorAs(tt, err, &batch)
+		assert.Equal(tt, []string{"c", "d"}, batch.Keys)
+		assert.False(tt, mr.Exists("a"))
+		assert.True(tt, mr.Exists("c"))
+		assert.False(tt, mr.Exists("e"))
+	})
+}
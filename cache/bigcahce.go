@@ -4,56 +4,96 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/allegro/bigcache/v3"
 
+	"github.com/kakkk/cachex/internal/model"
 	"github.com/kakkk/cachex/internal/utils"
 )
 
 type BigCache[T any] struct {
-	cache *bigcache.BigCache
+	cache  *bigcache.BigCache
+	enc    encoder[T]
+	leases leaseTable
+	locks  keyLock
 }
 
 // NewBigCache returns a newly initialize BigCache implement Cache with ttl,
 // the bigcache config use bigcache.DefaultConfig
-func NewBigCache[T any](ttl time.Duration) *BigCache[T] {
+//
+// opts: options, e.g. WithCodec
+func NewBigCache[T any](ttl time.Duration, opts ...Option) *BigCache[T] {
 	c, _ := bigcache.New(context.Background(), bigcache.DefaultConfig(ttl))
 	return &BigCache[T]{
 		cache: c,
+		enc:   newEncoder[T](newOptions(opts)),
 	}
 }
 
 // NewBigCacheWithConfig returns a newly initialize BigCache implement Cache with bigcache config,
 //
 // cfg: bigcache.Config
-func NewBigCacheWithConfig[T any](cfg bigcache.Config) (*BigCache[T], error) {
+//
+// opts: options, e.g. WithCodec
+func NewBigCacheWithConfig[T any](cfg bigcache.Config, opts ...Option) (*BigCache[T], error) {
+	enc := newEncoder[T](newOptions(opts))
+	if enc.schemaErr != nil {
+		return nil, enc.schemaErr
+	}
 	c, err := bigcache.New(context.Background(), cfg)
 	if err != nil {
 		return nil, err
 	}
 	return &BigCache[T]{
 		cache: c,
+		enc:   enc,
 	}, nil
 }
 
-func (bc *BigCache[T]) Get(_ context.Context, key string, expire time.Duration) (T, bool) {
+func (bc *BigCache[T]) Get(ctx context.Context, key string, expire time.Duration) (T, bool) {
 	var zero T
-	val, err := bc.cache.Get(key)
-	if err != nil {
+	env, ok := bc.GetEnvelope(ctx, key)
+	if !ok {
 		return zero, false
 	}
-	data, err := utils.UnmarshalData[T](val)
+	return env.Value(time.Now(), expire)
+}
+
+func (bc *BigCache[T]) GetEnvelope(_ context.Context, key string) (*Envelope[T], bool) {
+	val, err := bc.cache.Get(key)
 	if err != nil {
-		return zero, false
+		return nil, false
 	}
-	if utils.IsExpired(data.CreateAt, time.Now(), expire) {
-		return zero, false
+	env, err := bc.enc.unmarshalEnvelope(key, val)
+	return env, err == nil
+}
+
+// V2 返回解码失败时返回CorruptError的CacheV2实现
+func (bc *BigCache[T]) V2() CacheV2[T] {
+	return &bytesCacheV2[T]{Cache: bc, enc: bc.enc, get: bc.getRaw}
+}
+
+// SchemaInfo 构造时通过WithSchema设置的schema
+func (bc *BigCache[T]) SchemaInfo() SchemaInfo {
+	return bc.enc.schemaInfo()
+}
+
+// getRaw 读取原始数据
+func (bc *BigCache[T]) getRaw(key string) ([]byte, bool, error) {
+	val, err := bc.cache.Get(key)
+	if errors.Is(err, bigcache.ErrEntryNotFound) {
+		return nil, false, nil
 	}
-	if data.IsDefault() {
-		return zero, false
+	if err != nil {
+		return nil, false, err
 	}
-	return data.Data, true
+	return val, true, nil
+}
+
+func (bc *BigCache[T]) MGetEnvelope(ctx context.Context, keys []string) map[string]*Envelope[T] {
+	return mGetEnvelope(ctx, keys, bc.GetEnvelope)
 }
 
 func (bc *BigCache[T]) MGet(ctx context.Context, keys []string, expire time.Duration) map[string]T {
@@ -69,12 +109,9 @@ func (bc *BigCache[T]) MGet(ctx context.Context, keys []string, expire time.Dura
 }
 
 func (bc *BigCache[T]) Set(_ context.Context, key string, data T, createTime time.Time) error {
-	createAt := utils.ConvertTimestamp(createTime)
-	val, err := utils.MarshalData(data, createAt)
-	if err != nil {
-		return fmt.Errorf("marshal error: %v", err)
-	}
-	return bc.cache.Set(key, val)
+	unlock := bc.locks.lock(key)
+	defer unlock()
+	return bc.set(key, data, utils.ConvertTimestamp(createTime), 0)
 }
 
 func (bc *BigCache[T]) MSet(ctx context.Context, kvs map[string]T, createTime time.Time) error {
@@ -90,14 +127,19 @@ func (bc *BigCache[T]) MSet(ctx context.Context, kvs map[string]T, createTime ti
 	return nil
 }
 
+// SetDefault 写入空值，已存在更新的数据或宽限期内的墓碑时跳过
 func (bc *BigCache[T]) SetDefault(_ context.Context, keys []string, createTime time.Time) error {
 	var errs []error
-	val := utils.NewDefaultDataWithMarshal[T](utils.ConvertTimestamp(createTime))
+	createAt := utils.ConvertTimestamp(createTime)
+	val := bc.enc.marshalDefault(createAt)
 	for _, key := range keys {
-		err := bc.cache.Set(key, val)
-		if err != nil {
-			errs = append(errs, err)
+		unlock := bc.locks.lock(key)
+		if current, ok := bc.currentMeta(key); !ok || !skipDefault(current, createAt, utils.ConvertTimestamp(time.Now())) {
+			if err := bc.cache.Set(key, val); err != nil {
+				errs = append(errs, err)
+			}
 		}
+		unlock()
 	}
 	if len(errs) > 0 {
 		return errors.Join(errs...)
@@ -106,7 +148,12 @@ func (bc *BigCache[T]) SetDefault(_ context.Context, keys []string, createTime t
 }
 
 func (bc *BigCache[T]) Delete(_ context.Context, key string) error {
-	err := bc.cache.Delete(key)
+	var err error
+	bc.leases.invalidate([]string{key}, func() {
+		unlock := bc.locks.lock(key)
+		err = bc.cache.Delete(key)
+		unlock()
+	})
 	if err != nil {
 		if errors.Is(err, bigcache.ErrEntryNotFound) {
 			return nil
@@ -130,6 +177,142 @@ func (bc *BigCache[T]) MDelete(ctx context.Context, keys []string) error {
 	return nil
 }
 
+func (bc *BigCache[T]) AcquireLease(_ context.Context, key string, ttl time.Duration) (int64, bool, error) {
+	token, ok := bc.leases.acquire(key, ttl)
+	return token, ok, nil
+}
+
+// SetWithLease 消耗租约后在租约锁内按版本条件写入，与Delete、SetTombstone互斥
+func (bc *BigCache[T]) SetWithLease(ctx context.Context, key string, data T, createTime time.Time, token int64, version int64) (bool, error) {
+	return bc.leases.consume(key, token, func() error {
+		return bc.SetWithVersion(ctx, key, data, createTime, version)
+	})
+}
+
+func (bc *BigCache[T]) ReleaseLease(_ context.Context, key string, token int64) error {
+	bc.leases.release(key, token)
+	return nil
+}
+
+func (bc *BigCache[T]) SetWithVersion(_ context.Context, key string, data T, createTime time.Time, version int64) error {
+	unlock := bc.locks.lock(key)
+	defer unlock()
+	createAt := utils.ConvertTimestamp(createTime)
+	if current, ok := bc.currentMeta(key); ok {
+		if err := checkWrite(current, createAt, version, utils.ConvertTimestamp(time.Now())); err != nil {
+			return newRejectedError(err, []string{key})
+		}
+	}
+	return bc.set(key, data, createAt, version)
+}
+
+func (bc *BigCache[T]) MSetWithVersion(ctx context.Context, kvs map[string]T, versions map[string]int64, createTime time.Time) error {
+	return mSetWithVersion(kvs, versions, func(key string, data T, version int64) error {
+		return bc.SetWithVersion(ctx, key, data, createTime, version)
+	})
+}
+
+func (bc *BigCache[T]) Update(_ context.Context, key string, fn UpdateFunc[T], createTime time.Time) (T, error) {
+	bc.leases.invalidate([]string{key}, func() {})
+	return update(&bc.locks, key, func() (*model.CacheData[T], bool) {
+		val, err := bc.cache.Get(key)
+		if err != nil {
+			return nil, false
+		}
+		current, err := bc.enc.unmarshal(key, val)
+		return current, err == nil
+	}, func(data T, version int64) error {
+		return bc.set(key, data, utils.ConvertTimestamp(createTime), version)
+	}, fn)
+}
+
+// set 编码并写入数据，需持有key锁
+func (bc *BigCache[T]) set(key string, data T, createAt int64, version int64) error {
+	val, err := bc.enc.marshalData(key, data, createAt, version)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	return bc.cache.Set(key, val)
+}
+
+func (bc *BigCache[T]) SetTombstone(_ context.Context, keys []string, createTime time.Time, grace time.Duration) error {
+	var errs []error
+	createAt, expireAt := utils.ConvertTimestamp(createTime), tombstoneExpireAt(createTime, grace)
+	bc.leases.invalidate(keys, func() {
+		for _, key := range keys {
+			unlock := bc.locks.lock(key)
+			var version int64
+			if current, ok := bc.currentMeta(key); ok {
+				version = current.Version
+			}
+			err := bc.cache.Set(key, bc.enc.marshalTombstone(createAt, expireAt, version))
+			unlock()
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// currentMeta 读取当前数据的元信息，不存在或无法解码时返回false
+func (bc *BigCache[T]) currentMeta(key string) (*model.CacheMeta, bool) {
+	val, err := bc.cache.Get(key)
+	if err != nil {
+		return nil, false
+	}
+	current, err := bc.enc.unmarshalMeta(val)
+	return current, err == nil
+}
+
+func (bc *BigCache[T]) Close() error {
+	return bc.cache.Close()
+}
+
+// Touch BigCache过期时间全局固定，重新写入以重置为缓存ttl，墓碑视为不存在
+func (bc *BigCache[T]) Touch(_ context.Context, key string, _ time.Duration) (bool, error) {
+	unlock := bc.locks.lock(key)
+	defer unlock()
+	val, err := bc.cache.Get(key)
+	if errors.Is(err, bigcache.ErrEntryNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if current, err := bc.enc.unmarshalMeta(val); err == nil && current.Tombstone == 1 {
+		return false, nil
+	}
+	if err = bc.cache.Set(key, val); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (bc *BigCache[T]) Scan(_ context.Context, prefix string, fn func(key string) bool) error {
+	it := bc.cache.Iterator()
+	for it.SetNext() {
+		entry, err := it.Value()
+		if err != nil {
+			return err
+		}
+		if key := entry.Key(); strings.HasPrefix(key, prefix) && !fn(key) {
+			break
+		}
+	}
+	return nil
+}
+
+func (bc *BigCache[T]) Stats(_ context.Context) (Stats, error) {
+	stats := bc.cache.Stats()
+	return Stats{
+		Entries:     int64(bc.cache.Len()),
+		Hits:        stats.Hits,
+		Misses:      stats.Misses,
+		Compression: bc.enc.comp.stats(),
+	}, nil
+}
+
 func (bc *BigCache[T]) Ping(_ context.Context) (string, error) {
 	if bc.cache != nil {
 		return "PONG", nil
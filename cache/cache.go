@@ -15,3 +15,22 @@ type Cache[T any] interface {
 	MDelete(ctx context.Context, keys []string) error
 	Ping(ctx context.Context) (string, error)
 }
+
+// CacheV2 区分未命中与后端错误的缓存接口，读取返回完整Envelope，
+// found为false表示未命中，err不为nil表示后端错误，返回的Envelope已按expire过滤，可能为空值或墓碑；
+// 数据无法解码时err为*CorruptError，MGet部分批次失败时err为*BatchError，MGet同时返回其他已解码的数据
+type CacheV2[T any] interface {
+	Get(ctx context.Context, key string, expire time.Duration) (env *Envelope[T], found bool, err error)
+	MGet(ctx context.Context, keys []string, expire time.Duration) (envs map[string]*Envelope[T], err error)
+	Set(ctx context.Context, key string, data T, createTime time.Time) error
+	MSet(ctx context.Context, kvs map[string]T, createTime time.Time) error
+	SetDefault(ctx context.Context, keys []string, createTime time.Time) error
+	Delete(ctx context.Context, key string) error
+	MDelete(ctx context.Context, keys []string) error
+	Ping(ctx context.Context) (string, error)
+}
+
+// V2Provider 原生提供CacheV2实现的缓存
+type V2Provider[T any] interface {
+	V2() CacheV2[T]
+}
@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Closer 可关闭的缓存，关闭后释放资源
+type Closer interface {
+	Close() error
+}
+
+// TTLReader 查询key剩余存活时间
+type TTLReader interface {
+	// TTL 查询剩余存活时间，ok为false表示key不存在，ttl为0表示不过期
+	TTL(ctx context.Context, key string) (ttl time.Duration, ok bool, err error)
+}
+
+// Toucher 延长key存活时间
+type Toucher interface {
+	// Touch 将key存活时间设置为ttl，返回false表示key不存在；ttl小于等于0或过期时间全局固定的缓存重置为缓存默认过期时间；
+	// 墓碑视为不存在，返回false且不延长宽限期
+	Touch(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// Scanner 遍历缓存key
+type Scanner interface {
+	// Scan 遍历前缀为prefix的key，包含空值及墓碑，fn返回false时停止遍历
+	Scan(ctx context.Context, prefix string, fn func(key string) bool) error
+}
+
+// Stats 缓存统计，不支持的统计项为0
+type Stats struct {
+	Entries   int64 // 条目数
+	Hits      int64 // 命中次数
+	Misses    int64 // 未命中次数
+	Evictions int64 // 淘汰次数
+
+	Compression CompressionStats // 压缩统计，未设置压缩时为零值
+}
+
+// StatsProvider 提供缓存统计
+type StatsProvider interface {
+	Stats(ctx context.Context) (Stats, error)
+}
@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapability(t *testing.T) {
+	ctx := context.Background()
+	ttl := 30 * time.Minute
+	mr := miniredis.RunT(t)
+	disk, err := NewDiskCache[string](filepath.Join(t.TempDir(), "cache.db"), ttl)
+	assert.Nil(t, err)
+	caches := map[string]Cache[string]{
+		"lru":       NewLRUCache[string](10, ttl),
+		"freecache": NewFreeCache[string](1024*1024, ttl),
+		"bigcache":  NewBigCache[string](ttl),
+		"redis":     &RedisCache[string]{client: redis.NewClient(&redis.Options{Addr: mr.Addr()}), ttl: ttl},
+		"disk":      disk,
+	}
+	for name, c := range caches {
+		t.Run(name, func(tt *testing.T) {
+			_ = c.Set(ctx, "user:1", "a", time.Now())
+			_ = c.Set(ctx, "user:2", "b", time.Now())
+			_ = c.Set(ctx, "item:1", "c", time.Now())
+
+			var keys []string
+			err := c.(Scanner).Scan(ctx, "user:", func(key string) bool {
+				keys = append(keys, key)
+				return true
+			})
+			assert.Nil(tt, err)
+			sort.Strings(keys)
+			assert.Equal(tt, []string{"user:1", "user:2"}, keys)
+			n := 0
+			_ = c.(Scanner).Scan(ctx, "", func(key string) bool {
+				n++
+				return false
+			})
+			assert.Equal(tt, 1, n)
+
+			stats, err := c.(StatsProvider).Stats(ctx)
+			assert.Nil(tt, err)
+			assert.Equal(tt, int64(3), stats.Entries)
+
+			touched, err := c.(Toucher).Touch(ctx, "user:1", time.Hour)
+			assert.Nil(tt, err)
+			assert.True(tt, touched)
+			touched, err = c.(Toucher).Touch(ctx, "missing", time.Hour)
+			assert.Nil(tt, err)
+			assert.False(tt, touched)
+			got, ok := c.Get(ctx, "user:1", time.Hour)
+			assert.True(tt, ok)
+			assert.Equal(tt, "a", got)
+
+			if reader, ok := c.(TTLReader); ok {
+				remain, ok, err := reader.TTL(ctx, "user:2")
+				assert.Nil(tt, err)
+				assert.True(tt, ok)
+				assert.Greater(tt, remain, 20*time.Minute)
+				assert.LessOrEqual(tt, remain, ttl+10*time.Minute)
+				_, ok, err = reader.TTL(ctx, "missing")
+				assert.Nil(tt, err)
+				assert.False(tt, ok)
+			}
+
+			if closer, ok := c.(Closer); ok {
+				assert.Nil(tt, closer.Close())
+			}
+		})
+	}
+}
+
+func TestLRUCache_TTL(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("no expire", func(tt *testing.T) {
+		lc := NewLRUCache[string](10, 0)
+		_ = lc.Set(ctx, "k", "v", time.Now())
+		ttl, ok, err := lc.TTL(ctx, "k")
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		assert.Equal(tt, time.Duration(0), ttl)
+	})
+
+	t.Run("tombstone", func(tt *testing.T) {
+		lc := NewLRUCache[string](10, time.Hour)
+		_ = lc.SetTombstone(ctx, []string{"k"}, time.Now(), time.Minute)
+		ttl, ok, _ := lc.TTL(ctx, "k")
+		assert.True(tt, ok)
+		assert.LessOrEqual(tt, ttl, time.Minute)
+		touched, _ := lc.Touch(ctx, "k", time.Hour)
+		assert.False(tt, touched)
+	})
+
+	t.Run("touch reset ttl", func(tt *testing.T) {
+		lc := NewLRUCache[string](10, time.Hour)
+		_ = lc.Set(ctx, "k", "v", time.Now())
+		data, _ := lc.cache.Peek("k")
+		data.ExpireAt = time.Now().Add(time.Minute).UnixMilli()
+		ttl, _, _ := lc.TTL(ctx, "k")
+		assert.LessOrEqual(tt, ttl, time.Minute)
+		_, _ = lc.Touch(ctx, "k", time.Minute)
+		ttl, _, _ = lc.TTL(ctx, "k")
+		assert.Greater(tt, ttl, 59*time.Minute)
+	})
+}
+
+func TestRedisCache_Capability(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rc := &RedisCache[string]{client: redis.NewClient(&redis.Options{Addr: mr.Addr()}), ttl: 30 * time.Minute}
+
+	t.Run("scan skip related keys", func(tt *testing.T) {
+		_ = rc.Set(ctx, "scan*1", "v", time.Now())
+		_ = rc.Set(ctx, "scanx1", "v", time.Now())
+		_, _, _ = rc.AcquireLease(ctx, "scan*1", time.Minute)
+		_, _, _ = rc.Lock(ctx, "scan*1", time.Minute)
+		var keys []string
+		err := rc.Scan(ctx, "", func(key string) bool {
+			keys = append(keys, key)
+			return true
+		})
+		assert.Nil(tt, err)
+		sort.Strings(keys)
+		assert.Equal(tt, []string{"scan*1", "scanx1"}, keys)
+
+		keys = nil
+		_ = rc.Scan(ctx, "scan*", func(key string) bool {
+			keys = append(keys, key)
+			return true
+		})
+		assert.Equal(tt, []string{"scan*1"}, keys)
+	})
+
+	t.Run("ttl without expire", func(tt *testing.T) {
+		mr.Set("persist", "v")
+		ttl, ok, err := rc.TTL(ctx, "persist")
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		assert.Equal(tt, time.Duration(0), ttl)
+	})
+
+	t.Run("touch default ttl", func(tt *testing.T) {
+		_ = rc.Set(ctx, "touch", "v", time.Now())
+		mr.SetTTL("touch", time.Minute)
+		ok, err := rc.Touch(ctx, "touch", 0)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		assert.Equal(tt, 30*time.Minute, mr.TTL("touch"))
+
+		noExpire := &RedisCache[string]{client: rc.client}
+		ok, err = noExpire.Touch(ctx, "touch", 0)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		assert.Equal(tt, time.Duration(0), mr.TTL("touch"))
+		ok, err = noExpire.Touch(ctx, "missing", 0)
+		assert.Nil(tt, err)
+		assert.False(tt, ok)
+	})
+
+	t.Run("touch related keys", func(tt *testing.T) {
+		assert.Nil(tt, rc.SetWithVersion(ctx, "touch:v", "v", time.Now(), 1))
+		mr.Set(tombstoneKey("touch:v"), "1")
+		ok, err := rc.Touch(ctx, "touch:v", time.Hour)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		assert.Equal(tt, time.Hour, mr.TTL("touch:v"))
+		assert.Equal(tt, time.Hour, mr.TTL(versionKey("touch:v")))
+		assert.Equal(tt, time.Hour, mr.TTL(tombstoneKey("touch:v")))
+	})
+
+	t.Run("parse info stats", func(tt *testing.T) {
+		var stats Stats
+		parseInfoStats("# Stats\r\nkeyspace_hits:10\r\nkeyspace_misses:3\r\nevicted_keys:2\r\ninvalid\r\nfoo:bar\r\n", &stats)
+		assert.Equal(tt, Stats{Hits: 10, Misses: 3, Evictions: 2}, stats)
+	})
+
+	t.Run("redis_error", func(tt *testing.T) {
+		mr.SetError("unit_test")
+		defer mr.SetError("")
+		_, _, err := rc.TTL(ctx, "k")
+		assert.NotNil(tt, err)
+		_, err = rc.Touch(ctx, "k", time.Minute)
+		assert.NotNil(tt, err)
+		err = rc.Scan(ctx, "", func(key string) bool { return true })
+		assert.NotNil(tt, err)
+		_, err = rc.Stats(ctx)
+		assert.NotNil(tt, err)
+	})
+}
+
+func TestRedisCache_Close(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+
+	t.Run("caller client", func(tt *testing.T) {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		defer client.Close()
+		rc := NewRedisCacheWithClient[string](client, time.Minute)
+		assert.Nil(tt, rc.Close())
+		assert.Nil(tt, client.Ping(ctx).Err())
+	})
+
+	t.Run("owned client", func(tt *testing.T) {
+		rc := NewRedisCacheWithOptions[string](&redis.Options{Addr: mr.Addr()}, time.Minute)
+		assert.Nil(tt, rc.Close())
+		assert.ErrorIs(tt, rc.client.Ping(ctx).Err(), redis.ErrClosed)
+	})
+}
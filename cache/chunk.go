@@ -0,0 +1,296 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 分片清单格式：magic(1) | 分片数:数据长度:crc32(十六进制)
+//
+// 分片key与原key处于同一hash slot，写入、删除及延长过期时间前读取旧分片清单，
+// 新旧分片key均在脚本KEYS中声明，满足Redis Cluster的脚本约定
+const manifestMagic byte = 0xCF
+
+// manifestMaxLen 分片清单最大长度，读取旧分片数时只读取value前缀
+const manifestMaxLen = 64
+
+// defaultChunkSize 默认分片大小
+const defaultChunkSize = 512 * 1024
+
+// chunkLua 分片脚本函数，set_value写入数据，KEYS[kfrom]起为分片key，ARGV[afrom]起为分片，
+// 分片key多于分片时删除多余的旧分片
+const chunkLua = `
+local function put(key, val, ttl)
+	if ttl > 0 then
+		redis.call('SET', key, val, 'PX', ttl)
+	else
+		redis.call('SET', key, val)
+	end
+end
+local function set_value(key, val, ttl, kfrom, afrom)
+	local n = #ARGV - afrom + 1
+	for i = 0, #KEYS - kfrom do
+		if i < n then
+			put(KEYS[kfrom + i], ARGV[afrom + i], ttl)
+		else
+			redis.call('DEL', KEYS[kfrom + i])
+		end
+	end
+	put(key, val, ttl)
+end
+`
+
+var (
+	// setScript 写入数据及分片，KEYS[2]起为分片key
+	setScript = redis.NewScript(chunkLua + `
+set_value(KEYS[1], ARGV[1], tonumber(ARGV[2]), 2, 3)
+return 1
+`)
+	// touchScript 数据存在时延长KEYS中数据、版本、墓碑及分片key的过期时间，ttl为0时不过期；
+	// 数据为墓碑时视为不存在，不延长宽限期
+	touchScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local head = redis.call('GETRANGE', KEYS[1], 0, 2)
+if #head == 3 and string.byte(head, 1) == 206 and math.floor(string.byte(head, 3) / 2) % 2 == 1 then
+	return 0
+end
+for _, key in ipairs(KEYS) do
+	if tonumber(ARGV[1]) > 0 then
+		redis.call('PEXPIRE', key, ARGV[1])
+	else
+		redis.call('PERSIST', key)
+	end
+end
+return 1
+`)
+)
+
+// WithChunking 设置大value分片，仅RedisCache生效，编码后数据超过threshold字节时按chunkSize拆分为多个分片key，
+// 原key保存分片清单；读取时校验长度及校验和，分片部分过期或缺失视为未命中。
+// 读取始终支持分片数据，写入同一key的实例需一致开启，否则删除时不清理分片；
+// 写入及删除前读取旧分片数，期间被并发写入的更多旧分片不清理，随过期时间删除
+//
+// threshold: 分片阈值，不大于0时与chunkSize一致
+// chunkSize: 分片大小，不大于0时为512KB
+func WithChunking(threshold int, chunkSize int) Option {
+	return func(o *options) {
+		o.chunking = true
+		o.chunkThreshold = threshold
+		o.chunkSize = chunkSize
+	}
+}
+
+// chunking 分片配置
+type chunking struct {
+	threshold int
+	size      int
+}
+
+// newChunking 由构造选项创建分片配置，未设置分片时返回nil
+func newChunking(opts *options) *chunking {
+	if !opts.chunking {
+		return nil
+	}
+	c := &chunking{threshold: opts.chunkThreshold, size: opts.chunkSize}
+	if c.size <= 0 {
+		c.size = defaultChunkSize
+	}
+	if c.threshold <= 0 {
+		c.threshold = c.size
+	}
+	return c
+}
+
+// split 超过阈值时拆分数据，返回写入原key的数据、分片key及各分片，
+// 分片key覆盖新分片及old个旧分片，多余的旧分片由脚本删除
+func (c *chunking) split(key string, val []byte, old int) ([]byte, []string, []any) {
+	var chunks []any
+	if c != nil && len(val) > c.threshold {
+		for start := 0; start < len(val); start += c.size {
+			chunks = append(chunks, val[start:min(start+c.size, len(val))])
+		}
+		m := manifest{count: len(chunks), size: len(val), sum: crc32.ChecksumIEEE(val)}
+		val = m.marshal()
+	}
+	return val, chunkKeys(key, max(len(chunks), old)), chunks
+}
+
+// manifest 分片清单
+type manifest struct {
+	count int
+	size  int
+	sum   uint32
+}
+
+// marshal 编码分片清单
+func (m manifest) marshal() []byte {
+	return append([]byte{manifestMagic}, fmt.Sprintf("%d:%d:%08x", m.count, m.size, m.sum)...)
+}
+
+// parseManifest 解析分片清单，不是分片清单或无法解析时返回false
+func parseManifest(val []byte) (manifest, bool) {
+	if len(val) == 0 || val[0] != manifestMagic {
+		return manifest{}, false
+	}
+	parts := strings.Split(string(val[1:]), ":")
+	if len(parts) != 3 {
+		return manifest{}, false
+	}
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count <= 0 {
+		return manifest{}, false
+	}
+	size, err := strconv.Atoi(parts[1])
+	if err != nil || size < 0 {
+		return manifest{}, false
+	}
+	sum, err := strconv.ParseUint(parts[2], 16, 32)
+	if err != nil {
+		return manifest{}, false
+	}
+	return manifest{count: count, size: size, sum: uint32(sum)}, true
+}
+
+// keys 分片key
+func (m manifest) keys(key string) []string {
+	return chunkKeys(key, m.count)
+}
+
+// join 拼接分片，分片缺失、长度或校验和不一致时返回false，如分片部分过期或读取期间被覆盖
+func (m manifest) join(values []any) ([]byte, bool) {
+	var buf bytes.Buffer
+	buf.Grow(m.size)
+	for _, value := range values {
+		chunk, ok := value.(string)
+		if !ok {
+			return nil, false
+		}
+		buf.WriteString(chunk)
+	}
+	if buf.Len() != m.size || crc32.ChecksumIEEE(buf.Bytes()) != m.sum {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// chunkPrefix 分片key前缀，分片key为前缀加序号
+func chunkPrefix(key string) string {
+	return relatedKey(key, ":chunk:")
+}
+
+// chunkKeys 前n个分片key
+func chunkKeys(key string, n int) []string {
+	prefix := chunkPrefix(key)
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = prefix + strconv.Itoa(i)
+	}
+	return keys
+}
+
+// isChunkKey 是否为分片key
+func isChunkKey(key string) bool {
+	i := strings.LastIndex(key, ":chunk:")
+	if i < 0 || !strings.Contains(key[:i], "}") {
+		return false
+	}
+	_, err := strconv.Atoi(key[i+len(":chunk:"):])
+	return err == nil
+}
+
+// evalScript 执行脚本，Pipeline中使用EVAL避免NOSCRIPT
+func evalScript(ctx context.Context, c redis.Scripter, script *redis.Script, keys []string, args ...any) *redis.Cmd {
+	if _, ok := c.(redis.Pipeliner); ok {
+		return script.Eval(ctx, c, keys, args...)
+	}
+	return script.Run(ctx, c, keys, args...)
+}
+
+// setCmd 写入数据，存在新分片或old个旧分片时使用脚本写入分片并删除旧数据多余的分片
+func (rc *RedisCache[T]) setCmd(ctx context.Context, c redis.Cmdable, key string, val []byte, ttl time.Duration, old int) redis.Cmder {
+	val, keys, chunks := rc.chunk.split(key, val, old)
+	if len(keys) == 0 {
+		return c.Set(ctx, key, val, ttl)
+	}
+	return evalScript(ctx, c, setScript, append([]string{key}, keys...), append([]any{val, ttl.Milliseconds()}, chunks...)...)
+}
+
+// deleteCmd 删除数据、old个旧分片及关联key
+func (rc *RedisCache[T]) deleteCmd(ctx context.Context, c redis.Cmdable, key string, old int) *redis.IntCmd {
+	keys := append([]string{key, leaseKey(key), versionKey(key), tombstoneKey(key)}, chunkKeys(key, old)...)
+	return c.Del(ctx, keys...)
+}
+
+// chunkCounts 读取各key旧分片清单中的分片数，只读取value前缀，未开启分片时返回nil
+func (rc *RedisCache[T]) chunkCounts(ctx context.Context, keys []string) (map[string]int, error) {
+	if rc.chunk == nil || len(keys) == 0 {
+		return nil, nil
+	}
+	pipe := rc.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.GetRange(ctx, key, 0, manifestMaxLen-1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(keys))
+	for i, key := range keys {
+		if m, ok := parseManifest([]byte(cmds[i].Val())); ok {
+			counts[key] = m.count
+		}
+	}
+	return counts, nil
+}
+
+// assemble 读取分片并拼接，分片缺失或校验失败时视为未命中，不是分片清单时原样返回
+func (rc *RedisCache[T]) assemble(ctx context.Context, c redis.StringCmdable, key string, val []byte) ([]byte, bool, error) {
+	m, ok := parseManifest(val)
+	if !ok {
+		return val, true, nil
+	}
+	values, err := c.MGet(ctx, m.keys(key)...).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	val, ok = m.join(values)
+	return val, ok, nil
+}
+
+// mAssemble 批量读取分片并拼接，分片缺失或校验失败的key从vals中移除
+func (rc *RedisCache[T]) mAssemble(ctx context.Context, vals map[string][]byte) error {
+	manifests := make(map[string]manifest)
+	for key, val := range vals {
+		if m, ok := parseManifest(val); ok {
+			manifests[key] = m
+		}
+	}
+	if len(manifests) == 0 {
+		return nil
+	}
+	pipe := rc.client.Pipeline()
+	cmds := make(map[string]*redis.SliceCmd, len(manifests))
+	for key, m := range manifests {
+		cmds[key] = pipe.MGet(ctx, m.keys(key)...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	for key, m := range manifests {
+		if val, ok := m.join(cmds[key].Val()); ok {
+			vals[key] = val
+		} else {
+			delete(vals, key)
+		}
+	}
+	return nil
+}
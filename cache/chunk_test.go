@@ -0,0 +1,220 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifest(t *testing.T) {
+	t.Run("split", func(tt *testing.T) {
+		c := newChunking(&options{chunking: true, chunkThreshold: 8, chunkSize: 4})
+		val, keys, chunks := c.split("k", []byte("0123456789"), 0)
+		assert.Equal(tt, []string{"{k}:chunk:0", "{k}:chunk:1", "{k}:chunk:2"}, keys)
+		assert.Equal(tt, []any{[]byte("0123"), []byte("4567"), []byte("89")}, chunks)
+		m, ok := parseManifest(val)
+		assert.True(tt, ok)
+		assert.Equal(tt, 3, m.count)
+		assert.Equal(tt, []string{"{k}:chunk:0", "{k}:chunk:1", "{k}:chunk:2"}, m.keys("k"))
+		joined, ok := m.join([]any{"0123", "4567", "89"})
+		assert.True(tt, ok)
+		assert.Equal(tt, []byte("0123456789"), joined)
+
+		_, ok = m.join([]any{"0123", nil, "89"})
+		assert.False(tt, ok)
+		_, ok = m.join([]any{"0123", "4568", "89"})
+		assert.False(tt, ok)
+
+		// 旧分片key一并声明，由脚本删除
+		val, keys, chunks = c.split("k", []byte("01234567"), 2)
+		assert.Equal(tt, []byte("01234567"), val)
+		assert.Equal(tt, []string{"{k}:chunk:0", "{k}:chunk:1"}, keys)
+		assert.Empty(tt, chunks)
+
+		val, keys, _ = (*chunking)(nil).split("k", []byte("0123456789"), 0)
+		assert.Equal(tt, []byte("0123456789"), val)
+		assert.Empty(tt, keys)
+	})
+
+	t.Run("default", func(tt *testing.T) {
+		assert.Nil(tt, newChunking(&options{}))
+		assert.Equal(tt, &chunking{threshold: defaultChunkSize, size: defaultChunkSize}, newChunking(&options{chunking: true}))
+	})
+
+	t.Run("invalid", func(tt *testing.T) {
+		for _, val := range []string{"", "{}", "\xcf", "\xcf1:2", "\xcfa:1:0", "\xcf0:1:0", "\xcf1:-1:0", "\xcf1:1:x"} {
+			_, ok := parseManifest([]byte(val))
+			assert.False(tt, ok, val)
+		}
+	})
+
+	t.Run("chunk key", func(tt *testing.T) {
+		assert.True(tt, isChunkKey("{k}:chunk:0"))
+		assert.True(tt, isChunkKey("{user}:1:chunk:12"))
+		assert.False(tt, isChunkKey("k:chunk:0"))
+		assert.False(tt, isChunkKey("{k}:chunk:x"))
+	})
+}
+
+func TestRedisCache_chunking(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	rc := NewRedisCacheWithClient[string](client, time.Minute, WithChunking(64, 32))
+	large := strings.Repeat("large value ", 20)
+
+	t.Run("get", func(tt *testing.T) {
+		assert.Nil(tt, rc.Set(ctx, "k", large, time.Now()))
+		assert.Equal(tt, manifestMagic, []byte(mustGet(tt, mr, "k"))[0])
+		assert.True(tt, mr.Exists("{k}:chunk:0"))
+		assert.Greater(tt, mr.TTL("{k}:chunk:0"), 59*time.Second)
+		got, ok := rc.Get(ctx, "k", 0)
+		assert.True(tt, ok)
+		assert.Equal(tt, large, got)
+
+		// 未开启分片的实例可以读取
+		got, ok = NewRedisCacheWithClient[string](client, time.Minute).Get(ctx, "k", 0)
+		assert.True(tt, ok)
+		assert.Equal(tt, large, got)
+	})
+
+	t.Run("mget", func(tt *testing.T) {
+		assert.Nil(tt, rc.MSet(ctx, map[string]string{"a": large, "b": "small"}, time.Now()))
+		assert.True(tt, mr.Exists("{a}:chunk:0"))
+		assert.False(tt, mr.Exists("{b}:chunk:0"))
+		got := rc.MGet(ctx, []string{"a", "b", "missing"}, 0)
+		assert.Equal(tt, map[string]string{"a": large, "b": "small"}, got)
+	})
+
+	t.Run("partial expired", func(tt *testing.T) {
+		assert.Nil(tt, rc.Set(ctx, "k", large, time.Now()))
+		mr.Del("{k}:chunk:1")
+		_, ok := rc.Get(ctx, "k", 0)
+		assert.False(tt, ok)
+		_, found, err := rc.V2().Get(ctx, "k", 0)
+		assert.Nil(tt, err)
+		assert.False(tt, found)
+		envs, err := rc.V2().MGet(ctx, []string{"k"}, 0)
+		assert.Nil(tt, err)
+		assert.Empty(tt, envs)
+	})
+
+	t.Run("checksum mismatch", func(tt *testing.T) {
+		assert.Nil(tt, rc.Set(ctx, "k", large, time.Now()))
+		chunk := []byte(mustGet(tt, mr, "{k}:chunk:1"))
+		chunk[0]++
+		mr.Set("{k}:chunk:1", string(chunk))
+		_, ok := rc.Get(ctx, "k", 0)
+		assert.False(tt, ok)
+	})
+
+	t.Run("invalid manifest", func(tt *testing.T) {
+		mr.Set("bad", "\xcfinvalid")
+		_, _, err := rc.V2().Get(ctx, "bad", 0)
+		var corrupt *CorruptError
+		assert.ErrorAs(tt, err, &corrupt)
+	})
+
+	t.Run("overwrite", func(tt *testing.T) {
+		assert.Nil(tt, rc.Set(ctx, "k", large, time.Now()))
+		n := chunkCount(mr, "k")
+		assert.Nil(tt, rc.Set(ctx, "k", large[:100], time.Now()))
+		assert.Less(tt, chunkCount(mr, "k"), n)
+		got, _ := rc.Get(ctx, "k", 0)
+		assert.Equal(tt, large[:100], got)
+		assert.Nil(tt, rc.SetDefault(ctx, []string{"k"}, time.Now()))
+		assert.Equal(tt, 0, chunkCount(mr, "k"))
+	})
+
+	t.Run("delete", func(tt *testing.T) {
+		assert.Nil(tt, rc.MSet(ctx, map[string]string{"a": large, "b": large}, time.Now()))
+		counts, err := rc.chunkCounts(ctx, []string{"a", "b", "missing"})
+		assert.Nil(tt, err)
+		assert.Equal(tt, map[string]int{"a": chunkCount(mr, "a"), "b": chunkCount(mr, "b")}, counts)
+		assert.Nil(tt, rc.Delete(ctx, "a"))
+		assert.Nil(tt, rc.MDelete(ctx, []string{"b"}))
+		assert.False(tt, mr.Exists("a"))
+		assert.Equal(tt, 0, chunkCount(mr, "a"))
+		assert.Equal(tt, 0, chunkCount(mr, "b"))
+	})
+
+	t.Run("touch", func(tt *testing.T) {
+		assert.Nil(tt, rc.Set(ctx, "k", large, time.Now()))
+		ok, err := rc.Touch(ctx, "k", time.Hour)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		assert.Equal(tt, time.Hour, mr.TTL("k"))
+		assert.Equal(tt, time.Hour, mr.TTL("{k}:chunk:0"))
+		ok, err = rc.Touch(ctx, "missing", time.Hour)
+		assert.Nil(tt, err)
+		assert.False(tt, ok)
+
+		noExpire := NewRedisCacheWithClient[string](client, 0, WithChunking(64, 32))
+		ok, err = noExpire.Touch(ctx, "k", 0)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		assert.Equal(tt, time.Duration(0), mr.TTL("{k}:chunk:0"))
+	})
+
+	t.Run("versioned and lease", func(tt *testing.T) {
+		assert.Nil(tt, rc.SetWithVersion(ctx, "v", large, time.Now(), 1))
+		got, ok := rc.Get(ctx, "v", 0)
+		assert.True(tt, ok)
+		assert.Equal(tt, large, got)
+		assert.Nil(tt, rc.MSetWithVersion(ctx, map[string]string{"v": "small"}, map[string]int64{"v": 2}, time.Now()))
+		assert.Equal(tt, 0, chunkCount(mr, "v"))
+
+		token, ok, _ := rc.AcquireLease(ctx, "l", time.Minute)
+		assert.True(tt, ok)
+		ok, err := rc.SetWithLease(ctx, "l", large, time.Now(), token, 0)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		got, _ = rc.Get(ctx, "l", 0)
+		assert.Equal(tt, large, got)
+	})
+
+	t.Run("update", func(tt *testing.T) {
+		assert.Nil(tt, rc.Set(ctx, "u", large, time.Now()))
+		got, err := rc.Update(ctx, "u", func(old string, found bool) (string, error) {
+			assert.True(tt, found)
+			return old + "!", nil
+		}, time.Now())
+		assert.Nil(tt, err)
+		assert.Equal(tt, large+"!", got)
+		got, _ = rc.Get(ctx, "u", 0)
+		assert.Equal(tt, large+"!", got)
+	})
+
+	t.Run("scan skip chunks", func(tt *testing.T) {
+		mr.FlushAll()
+		assert.Nil(tt, rc.Set(ctx, "k", large, time.Now()))
+		var keys []string
+		assert.Nil(tt, rc.Scan(ctx, "", func(key string) bool {
+			keys = append(keys, key)
+			return true
+		}))
+		assert.Equal(tt, []string{"k"}, keys)
+	})
+}
+
+func mustGet(tb testing.TB, mr *miniredis.Miniredis, key string) string {
+	val, err := mr.Get(key)
+	assert.Nil(tb, err)
+	return val
+}
+
+// chunkCount 分片key数量
+func chunkCount(mr *miniredis.Miniredis, key string) int {
+	n := 0
+	for _, k := range mr.Keys() {
+		if strings.HasPrefix(k, chunkPrefix(key)) {
+			n++
+		}
+	}
+	return n
+}
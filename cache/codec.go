@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kakkk/cachex/internal/json"
+)
+
+// ErrCodecMismatch 缓存数据的编码与当前Codec不一致
+var ErrCodecMismatch = errors.New("codec mismatch")
+
+// Codec 缓存数据编解码，Name记录在缓存数据中用于检测编码不一致，不同实现的Name需唯一
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	// JSONCodec JSON编码，默认编码，兼容未记录编码的旧数据
+	JSONCodec Codec = jsonCodec{}
+	// GobCodec gob编码
+	GobCodec Codec = gobCodec{}
+	// MsgpackCodec msgpack编码
+	MsgpackCodec Codec = msgpackCodec{}
+	// ProtobufCodec protobuf编码，数据类型需实现proto.Message
+	ProtobufCodec Codec = protobufCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) { return msgpack.Marshal(v) }
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error { return msgpack.Unmarshal(data, v) }
+
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string { return "protobuf" }
+
+func (protobufCodec) Marshal(v any) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec: %T is not proto.Message", v)
+	}
+	return proto.Marshal(msg)
+}
+
+// Unmarshal v为proto.Message或指向proto.Message指针的指针，后者为nil时创建新消息
+func (protobufCodec) Unmarshal(data []byte, v any) error {
+	if msg, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, msg)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Pointer {
+		return fmt.Errorf("protobuf codec: %T is not proto.Message", v)
+	}
+	elem := rv.Elem()
+	if elem.IsNil() {
+		elem.Set(reflect.New(elem.Type().Elem()))
+	}
+	msg, ok := elem.Interface().(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf codec: %T is not proto.Message", v)
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+// Option 缓存构造选项
+type Option func(o *options)
+
+type options struct {
+	codec               Codec
+	compressor          Compressor
+	compressThreshold   int
+	keyring             *Keyring
+	bindKey             bool
+	chunking            bool
+	chunkThreshold      int
+	chunkSize           int
+	batchSize           int
+	batchParallelism    int
+	hashBucket          HashBucket
+	diskMaxBytes        int64
+	diskCompactInterval time.Duration
+	schema              any
+}
+
+// WithCodec 设置缓存数据编码，默认JSONCodec
+func WithCodec(codec Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+// newOptions 应用构造选项
+func newOptions(opts []Option) *options {
+	o := &options{codec: JSONCodec}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type codecTestData struct {
+	ID   int64
+	Name string
+	Tags []string
+}
+
+func TestCodec(t *testing.T) {
+	data := codecTestData{ID: 1, Name: "test", Tags: []string{"a", "b"}}
+	for _, codec := range []Codec{JSONCodec, GobCodec, MsgpackCodec} {
+		t.Run(codec.Name(), func(tt *testing.T) {
+			bytes, err := codec.Marshal(data)
+			assert.Nil(tt, err)
+			var got codecTestData
+			assert.Nil(tt, codec.Unmarshal(bytes, &got))
+			assert.Equal(tt, data, got)
+		})
+	}
+
+	t.Run("protobuf", func(tt *testing.T) {
+		bytes, err := ProtobufCodec.Marshal(wrapperspb.String("test"))
+		assert.Nil(tt, err)
+
+		var got *wrapperspb.StringValue
+		assert.Nil(tt, ProtobufCodec.Unmarshal(bytes, &got))
+		assert.Equal(tt, "test", got.GetValue())
+
+		msg := &wrapperspb.StringValue{}
+		assert.Nil(tt, ProtobufCodec.Unmarshal(bytes, msg))
+		assert.Equal(tt, "test", msg.GetValue())
+	})
+
+	t.Run("protobuf not message", func(tt *testing.T) {
+		_, err := ProtobufCodec.Marshal(data)
+		assert.NotNil(tt, err)
+		var s string
+		assert.NotNil(tt, ProtobufCodec.Unmarshal(nil, &s))
+		var p *string
+		assert.NotNil(tt, ProtobufCodec.Unmarshal(nil, &p))
+		assert.NotNil(tt, ProtobufCodec.Unmarshal(nil, nil))
+	})
+}
+
+func TestCodec_backend(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	caches := map[string]Cache[codecTestData]{
+		"redis":     NewRedisCacheWithClient[codecTestData](client, time.Minute, WithCodec(MsgpackCodec)),
+		"freecache": NewFreeCache[codecTestData](1024*1024, time.Minute, WithCodec(GobCodec)),
+		"bigcache":  NewBigCache[codecTestData](time.Minute, WithCodec(MsgpackCodec)),
+	}
+	data := codecTestData{ID: 1, Name: "test"}
+	for name, c := range caches {
+		t.Run(name, func(tt *testing.T) {
+			assert.Nil(tt, c.Set(ctx, "k", data, time.Now()))
+			got, ok := c.Get(ctx, "k", time.Minute)
+			assert.True(tt, ok)
+			assert.Equal(tt, data, got)
+
+			assert.Nil(tt, c.MSet(ctx, map[string]codecTestData{"a": data}, time.Now()))
+			assert.Equal(tt, map[string]codecTestData{"a": data}, c.MGet(ctx, []string{"a", "b"}, time.Minute))
+
+			assert.Nil(tt, c.SetDefault(ctx, []string{"d"}, time.Now()))
+			env, ok := c.(EnvelopeGetter[codecTestData]).GetEnvelope(ctx, "d")
+			assert.True(tt, ok)
+			assert.True(tt, env.Default)
+
+			env, ok = c.(EnvelopeGetter[codecTestData]).GetEnvelope(ctx, "k")
+			assert.True(tt, ok)
+			assert.Equal(tt, data, env.Data)
+		})
+	}
+
+	t.Run("record codec", func(tt *testing.T) {
+		val, _ := mr.Get("k")
+		raw, err := decodeBinary([]byte(val))
+		assert.Nil(tt, err)
+		assert.Equal(tt, "msgpack", raw.codec)
+		val, _ = mr.Get("d")
+		raw, err = decodeBinary([]byte(val))
+		assert.Nil(tt, err)
+		assert.Empty(tt, raw.codec)
+	})
+
+	t.Run("protobuf", func(tt *testing.T) {
+		rc := NewRedisCacheWithClient[*wrapperspb.StringValue](client, time.Minute, WithCodec(ProtobufCodec))
+		assert.Nil(tt, rc.Set(ctx, "pb", wrapperspb.String("test"), time.Now()))
+		got, ok := rc.Get(ctx, "pb", time.Minute)
+		assert.True(tt, ok)
+		assert.True(tt, proto.Equal(wrapperspb.String("test"), got))
+	})
+}
+
+func TestCodec_mismatch(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	jsonCache := NewRedisCacheWithClient[codecTestData](client, time.Minute)
+	msgpackCache := NewRedisCacheWithClient[codecTestData](client, time.Minute, WithCodec(MsgpackCodec))
+	data := codecTestData{ID: 1, Name: "test"}
+
+	t.Run("legacy json", func(tt *testing.T) {
+		mr.Set("legacy", `{"c":1017072000000,"d":{"ID":1,"Name":"test","Tags":null},"z":0}`)
+		got, ok := jsonCache.Get(ctx, "legacy", 0)
+		assert.True(tt, ok)
+		assert.Equal(tt, data, got)
+	})
+
+	t.Run("json read by msgpack", func(tt *testing.T) {
+		assert.Nil(tt, jsonCache.Set(ctx, "k", data, time.Now()))
+		_, ok := msgpackCache.Get(ctx, "k", 0)
+		assert.False(tt, ok)
+		_, found, err := AsV2[codecTestData](msgpackCache).Get(ctx, "k", 0)
+		assert.ErrorIs(tt, err, ErrCodecMismatch)
+		assert.False(tt, found)
+		envs, err := AsV2[codecTestData](msgpackCache).MGet(ctx, []string{"k"}, 0)
+		assert.ErrorIs(tt, err, ErrCodecMismatch)
+		assert.Empty(tt, envs)
+	})
+
+	t.Run("msgpack read by json", func(tt *testing.T) {
+		assert.Nil(tt, msgpackCache.Set(ctx, "k", data, time.Now()))
+		_, ok := jsonCache.Get(ctx, "k", 0)
+		assert.False(tt, ok)
+		_, _, err := AsV2[codecTestData](jsonCache).Get(ctx, "k", 0)
+		assert.ErrorIs(tt, err, ErrCodecMismatch)
+	})
+
+	t.Run("default readable by any codec", func(tt *testing.T) {
+		assert.Nil(tt, jsonCache.SetDefault(ctx, []string{"d"}, time.Now()))
+		env, found, err := AsV2[codecTestData](msgpackCache).Get(ctx, "d", 0)
+		assert.Nil(tt, err)
+		assert.True(tt, found)
+		assert.True(tt, env.Default)
+	})
+}
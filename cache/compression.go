@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressor 缓存数据压缩，ID记录在缓存数据中用于解压，不同实现的ID需唯一且不为0
+type Compressor interface {
+	ID() byte
+	Name() string
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+var (
+	// SnappyCompressor snappy压缩，速度快，压缩率较低
+	SnappyCompressor Compressor = snappyCompressor{}
+	// ZstdCompressor zstd压缩，压缩率与速度均衡
+	ZstdCompressor Compressor = &zstdCompressor{}
+	// GzipCompressor gzip压缩，压缩率较高，速度较慢
+	GzipCompressor Compressor = gzipCompressor{}
+)
+
+// compressors 内置压缩算法，按ID查找以解压其他算法压缩的数据
+var compressors = map[byte]Compressor{
+	SnappyCompressor.ID(): SnappyCompressor,
+	ZstdCompressor.ID():   ZstdCompressor,
+	GzipCompressor.ID():   GzipCompressor,
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) ID() byte { return 1 }
+
+func (snappyCompressor) Name() string { return "snappy" }
+
+func (snappyCompressor) Compress(src []byte) ([]byte, error) { return snappy.Encode(nil, src), nil }
+
+func (snappyCompressor) Decompress(src []byte) ([]byte, error) { return snappy.Decode(nil, src) }
+
+// zstdCompressor 共享编解码器，EncodeAll、DecodeAll并发安全
+type zstdCompressor struct {
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	err     error
+}
+
+func (z *zstdCompressor) ID() byte { return 2 }
+
+func (z *zstdCompressor) Name() string { return "zstd" }
+
+func (z *zstdCompressor) init() error {
+	z.once.Do(func() {
+		if z.encoder, z.err = zstd.NewWriter(nil); z.err != nil {
+			return
+		}
+		z.decoder, z.err = zstd.NewReader(nil)
+	})
+	return z.err
+}
+
+func (z *zstdCompressor) Compress(src []byte) ([]byte, error) {
+	if err := z.init(); err != nil {
+		return nil, err
+	}
+	return z.encoder.EncodeAll(src, nil), nil
+}
+
+func (z *zstdCompressor) Decompress(src []byte) ([]byte, error) {
+	if err := z.init(); err != nil {
+		return nil, err
+	}
+	return z.decoder.DecodeAll(src, nil)
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) ID() byte { return 3 }
+
+func (gzipCompressor) Name() string { return "gzip" }
+
+func (gzipCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// WithCompression 设置压缩，编码后数据不小于threshold字节时压缩，压缩后未变小时不压缩
+func WithCompression(compressor Compressor, threshold int) Option {
+	return func(o *options) {
+		o.compressor = compressor
+		o.compressThreshold = threshold
+	}
+}
+
+// CompressionStats 压缩统计
+type CompressionStats struct {
+	Compressed      int64         // 压缩写入的数据数
+	RawBytes        int64         // 压缩前字节数
+	CompressedBytes int64         // 压缩后字节数
+	CompressTime    time.Duration // 压缩耗时
+	Decompressed    int64         // 解压读取的数据数
+	DecompressTime  time.Duration // 解压耗时
+}
+
+// Ratio 压缩率，压缩后字节数/压缩前字节数，未压缩时为0
+func (s CompressionStats) Ratio() float64 {
+	if s.RawBytes == 0 {
+		return 0
+	}
+	return float64(s.CompressedBytes) / float64(s.RawBytes)
+}
+
+// compression 压缩配置及统计
+type compression struct {
+	compressor Compressor
+	threshold  int
+
+	compressed      atomic.Int64
+	rawBytes        atomic.Int64
+	compressedBytes atomic.Int64
+	compressTime    atomic.Int64
+	decompressed    atomic.Int64
+	decompressTime  atomic.Int64
+}
+
+// newCompression 由构造选项创建压缩配置，未设置压缩时返回nil
+func newCompression(opts *options) *compression {
+	if opts.compressor == nil {
+		return nil
+	}
+	return &compression{compressor: opts.compressor, threshold: opts.compressThreshold}
+}
+
+// compress 压缩数据，未达到阈值或压缩后未变小时返回false
+func (c *compression) compress(payload []byte) ([]byte, bool, error) {
+	if c == nil || len(payload) < c.threshold {
+		return payload, false, nil
+	}
+	start := time.Now()
+	compressed, err := c.compressor.Compress(payload)
+	if err != nil {
+		return nil, false, err
+	}
+	c.compressTime.Add(int64(time.Since(start)))
+	if len(compressed) >= len(payload) {
+		return payload, false, nil
+	}
+	c.compressed.Add(1)
+	c.rawBytes.Add(int64(len(payload)))
+	c.compressedBytes.Add(int64(len(compressed)))
+	return compressed, true, nil
+}
+
+// decompress 按压缩算法ID解压数据，优先使用配置的压缩算法
+func (c *compression) decompress(id byte, payload []byte) ([]byte, error) {
+	compressor, ok := compressors[id]
+	if c != nil && c.compressor.ID() == id {
+		compressor, ok = c.compressor, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown compressor: %v", id)
+	}
+	start := time.Now()
+	raw, err := compressor.Decompress(payload)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		c.decompressed.Add(1)
+		c.decompressTime.Add(int64(time.Since(start)))
+	}
+	return raw, nil
+}
+
+// stats 获取压缩统计
+func (c *compression) stats() CompressionStats {
+	if c == nil {
+		return CompressionStats{}
+	}
+	return CompressionStats{
+		Compressed:      c.compressed.Load(),
+		RawBytes:        c.rawBytes.Load(),
+		CompressedBytes: c.compressedBytes.Load(),
+		CompressTime:    time.Duration(c.compressTime.Load()),
+		Decompressed:    c.decompressed.Load(),
+		DecompressTime:  time.Duration(c.decompressTime.Load()),
+	}
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressor(t *testing.T) {
+	src := []byte(strings.Repeat("compression", 100))
+	ids := map[byte]bool{}
+	for _, c := range []Compressor{SnappyCompressor, ZstdCompressor, GzipCompressor} {
+		t.Run(c.Name(), func(tt *testing.T) {
+			compressed, err := c.Compress(src)
+			assert.Nil(tt, err)
+			assert.Less(tt, len(compressed), len(src))
+			got, err := c.Decompress(compressed)
+			assert.Nil(tt, err)
+			assert.Equal(tt, src, got)
+			_, err = c.Decompress([]byte("invalid"))
+			assert.NotNil(tt, err)
+		})
+		assert.NotZero(t, c.ID())
+		assert.False(t, ids[c.ID()])
+		ids[c.ID()] = true
+	}
+}
+
+func TestEncoder_compression(t *testing.T) {
+	large := strings.Repeat("compression", 100)
+	enc := newEncoder[string](newOptions([]Option{WithCompression(ZstdCompressor, 256)}))
+
+	t.Run("above threshold", func(tt *testing.T) {
+		val, err := enc.marshalData("k", large, 1017072000000, 2)
+		assert.Nil(tt, err)
+		assert.Less(tt, len(val), len(large))
+		raw, err := decodeBinary(val)
+		assert.Nil(tt, err)
+		assert.Equal(tt, ZstdCompressor.ID(), raw.compressor)
+
+		got, err := enc.unmarshal("k", val)
+		assert.Nil(tt, err)
+		assert.Equal(tt, large, got.Data)
+		meta, err := enc.unmarshalMeta(val)
+		assert.Nil(tt, err)
+		assert.Equal(tt, int64(2), meta.Version)
+	})
+
+	t.Run("below threshold", func(tt *testing.T) {
+		val, err := enc.marshalData("k", "small", 1017072000000, 0)
+		assert.Nil(tt, err)
+		raw, _ := decodeBinary(val)
+		assert.Zero(tt, raw.compressor)
+	})
+
+	t.Run("incompressible", func(tt *testing.T) {
+		random := make([]byte, 1024)
+		_, _ = rand.Read(random)
+		bytesEnc := newEncoder[[]byte](newOptions([]Option{WithCompression(SnappyCompressor, 0)}))
+		val, err := bytesEnc.marshalData("k", random, 1017072000000, 0)
+		assert.Nil(tt, err)
+		raw, _ := decodeBinary(val)
+		assert.Zero(tt, raw.compressor)
+	})
+
+	t.Run("mixed compressors", func(tt *testing.T) {
+		snappyEnc := newEncoder[string](newOptions([]Option{WithCompression(SnappyCompressor, 0)}))
+		val, err := snappyEnc.marshalData("k", large, 1017072000000, 0)
+		assert.Nil(tt, err)
+		for _, reader := range []encoder[string]{enc, {}} {
+			got, err := reader.unmarshal("k", val)
+			assert.Nil(tt, err)
+			assert.Equal(tt, large, got.Data)
+		}
+	})
+
+	t.Run("invalid compressed data", func(tt *testing.T) {
+		val, _ := enc.marshalData("k", large, 1017072000000, 0)
+		raw, _ := decodeBinary(val)
+		offset := len(val) - len(raw.payload)
+		corrupted := append(append([]byte{}, val[:offset]...), "invalid"...)
+		_, err := enc.unmarshal("k", corrupted)
+		assert.NotNil(tt, err)
+
+		unknown := []byte{envelopeMagic, envelopeFormatVersion, flagCompressed, 0, 99, 0}
+		_, err = enc.unmarshal("k", unknown)
+		assert.NotNil(tt, err)
+		_, err = enc.unmarshal("k", []byte{envelopeMagic, envelopeFormatVersion, flagCompressed, 0})
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("stats", func(tt *testing.T) {
+		stats := enc.comp.stats()
+		assert.Greater(tt, stats.Compressed, int64(0))
+		assert.Greater(tt, stats.Decompressed, int64(0))
+		assert.Greater(tt, stats.RawBytes, stats.CompressedBytes)
+		assert.Greater(tt, stats.CompressTime, time.Duration(0))
+		assert.Greater(tt, stats.Ratio(), 0.0)
+		assert.Less(tt, stats.Ratio(), 1.0)
+		assert.Zero(tt, CompressionStats{}.Ratio())
+	})
+}
+
+func TestCompression_backend(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	large := strings.Repeat("compression", 100)
+	caches := map[string]Cache[string]{
+		"redis":     NewRedisCacheWithClient[string](redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Minute, WithCompression(ZstdCompressor, 256)),
+		"freecache": NewFreeCache[string](1024*1024, time.Minute, WithCompression(SnappyCompressor, 256)),
+		"bigcache":  NewBigCache[string](time.Minute, WithCompression(GzipCompressor, 256)),
+	}
+	for name, c := range caches {
+		t.Run(name, func(tt *testing.T) {
+			assert.Nil(tt, c.MSet(ctx, map[string]string{"large": large, "small": "small"}, time.Now()))
+			assert.Equal(tt, map[string]string{"large": large, "small": "small"}, c.MGet(ctx, []string{"large", "small"}, 0))
+			stats, err := c.(StatsProvider).Stats(ctx)
+			assert.Nil(tt, err)
+			assert.Equal(tt, int64(1), stats.Compression.Compressed)
+			assert.Equal(tt, int64(1), stats.Compression.Decompressed)
+			assert.Less(tt, stats.Compression.Ratio(), 1.0)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CorruptError 缓存数据无法解码，CacheV2读取时与已解码的数据一同返回，
+// Entries为无法解码的key及原始数据，Errors为对应的解码错误
+type CorruptError struct {
+	Entries map[string][]byte
+	Errors  map[string]error
+}
+
+// newCorruptError 创建CorruptError
+func newCorruptError() *CorruptError {
+	return &CorruptError{
+		Entries: make(map[string][]byte),
+		Errors:  make(map[string]error),
+	}
+}
+
+// add 记录无法解码的数据
+func (e *CorruptError) add(key string, raw []byte, err error) *CorruptError {
+	if e == nil {
+		e = newCorruptError()
+	}
+	e.Entries[key], e.Errors[key] = raw, err
+	return e
+}
+
+// errorOrNil 没有无法解码的数据时返回nil
+func (e *CorruptError) errorOrNil() error {
+	if e == nil || len(e.Entries) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *CorruptError) Error() string {
+	keys := make([]string, 0, len(e.Errors))
+	for key := range e.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	msgs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		msgs = append(msgs, fmt.Sprintf("%v: %v", key, e.Errors[key]))
+	}
+	return fmt.Sprintf("corrupt cache data: [%v]", strings.Join(msgs, ", "))
+}
+
+// Unwrap 返回各key的解码错误，用于errors.Is判断如ErrCodecMismatch
+func (e *CorruptError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// IsRecoverable 解码错误是否可能由其他实例的配置不同引起，如编码不一致、密钥未知，此类数据不应删除
+func IsRecoverable(err error) bool {
+	return errors.Is(err, ErrCodecMismatch) || errors.Is(err, ErrUnknownKey) || errors.Is(err, ErrNoKeyring)
+}
+
+// decodeEntry 解码原始数据，过期及schema版本不一致视为未命中，解码失败时记录到corrupt
+func decodeEntry[T any](enc encoder[T], key string, val []byte, now time.Time, expire time.Duration, corrupt *CorruptError) (*Envelope[T], *CorruptError) {
+	env, err := enc.unmarshalEnvelope(key, val)
+	if isSchemaMismatch(err) {
+		return nil, corrupt
+	}
+	if err != nil {
+		return nil, corrupt.add(key, val, err)
+	}
+	if env.IsExpired(now, expire) {
+		return nil, corrupt
+	}
+	return env, corrupt
+}
+
+// bytesCacheV2 字节型本地缓存的CacheV2实现，解码失败返回CorruptError
+type bytesCacheV2[T any] struct {
+	Cache[T]
+	enc encoder[T]
+	get func(key string) (val []byte, found bool, err error)
+}
+
+func (b *bytesCacheV2[T]) Get(_ context.Context, key string, expire time.Duration) (*Envelope[T], bool, error) {
+	val, found, err := b.get(key)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	env, corrupt := decodeEntry(b.enc, key, val, time.Now(), expire, nil)
+	return env, env != nil, corrupt.errorOrNil()
+}
+
+func (b *bytesCacheV2[T]) MGet(_ context.Context, keys []string, expire time.Duration) (map[string]*Envelope[T], error) {
+	now := time.Now()
+	result := make(map[string]*Envelope[T], len(keys))
+	var corrupt *CorruptError
+	for _, key := range keys {
+		val, found, err := b.get(key)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		var env *Envelope[T]
+		if env, corrupt = decodeEntry(b.enc, key, val, now, expire, corrupt); env != nil {
+			result[key] = env
+		}
+	}
+	return result, corrupt.errorOrNil()
+}
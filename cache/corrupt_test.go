@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorruptError(t *testing.T) {
+	t.Run("nil", func(tt *testing.T) {
+		var e *CorruptError
+		assert.Nil(tt, e.errorOrNil())
+		assert.Nil(tt, newCorruptError().errorOrNil())
+	})
+
+	t.Run("error", func(tt *testing.T) {
+		e := newCorruptError().add("b", []byte("2"), errors.New("bad")).add("a", []byte("1"), ErrCodecMismatch)
+		assert.Equal(tt, "corrupt cache data: [a: codec mismatch, b: bad]", e.Error())
+		assert.ErrorIs(tt, e.errorOrNil(), ErrCodecMismatch)
+		assert.Equal(tt, []string{"a", "b"}, keysOf(e.Entries))
+	})
+
+	t.Run("recoverable", func(tt *testing.T) {
+		assert.True(tt, IsRecoverable(ErrCodecMismatch))
+		assert.True(tt, IsRecoverable(ErrUnknownKey))
+		assert.True(tt, IsRecoverable(ErrNoKeyring))
+		assert.False(tt, IsRecoverable(errors.New("bad")))
+	})
+}
+
+func TestBytesCacheV2(t *testing.T) {
+	ctx := context.Background()
+	fc := NewFreeCache[string](1024*1024, time.Hour)
+	bc := NewBigCache[string](time.Hour)
+	_ = fc.cache.Set([]byte("c"), []byte("invalid"), 0)
+	_ = bc.cache.Set("c", []byte("invalid"))
+	caches := map[string]Cache[string]{"freecache": fc, "bigcache": bc}
+	for name, c := range caches {
+		t.Run(name, func(tt *testing.T) {
+			v2 := AsV2[string](c)
+			_ = c.Set(ctx, "a", "v", time.Now())
+
+			env, found, err := v2.Get(ctx, "a", time.Hour)
+			assert.Nil(tt, err)
+			assert.True(tt, found)
+			assert.Equal(tt, "v", env.Data)
+			_, found, err = v2.Get(ctx, "missing", time.Hour)
+			assert.Nil(tt, err)
+			assert.False(tt, found)
+			_, found, err = v2.Get(ctx, "c", time.Hour)
+			var corrupt *CorruptError
+			assert.ErrorAs(tt, err, &corrupt)
+			assert.False(tt, found)
+
+			envs, err := v2.MGet(ctx, []string{"a", "c", "missing"}, time.Hour)
+			assert.ErrorAs(tt, err, &corrupt)
+			assert.Equal(tt, []byte("invalid"), corrupt.Entries["c"])
+			assert.Len(tt, envs, 1)
+			assert.Equal(tt, "v", envs["a"].Data)
+		})
+	}
+}
+
+func keysOf[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
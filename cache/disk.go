@@ -0,0 +1,585 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/kakkk/cachex/internal/utils"
+)
+
+const (
+	// defaultCompactInterval 默认过期数据清理间隔
+	defaultCompactInterval = time.Minute
+	// compactBatch 每个事务清理的过期数据数量
+	compactBatch = 1000
+	// diskNoExpire 不过期数据的过期时间
+	diskNoExpire = math.MaxInt64
+)
+
+var (
+	diskDataBucket   = []byte("data")   // key -> 8字节过期时间 + 缓存数据
+	diskExpiryBucket = []byte("expiry") // 8字节过期时间 + key -> nil，按过期时间排序
+	diskMetaBucket   = []byte("meta")   // 统计信息
+	diskSizeKey      = []byte("size")   // 数据总字节数
+	diskCountKey     = []byte("count")  // 条目数
+)
+
+// WithDiskLimit 设置DiskCache数据大小上限，超过时按过期时间从早到晚淘汰，不过期的数据最后淘汰，
+// 不大于0时不限制；大小按key及数据字节数计算，不含bbolt页及索引开销
+func WithDiskLimit(maxBytes int64) Option {
+	return func(o *options) {
+		o.diskMaxBytes = maxBytes
+	}
+}
+
+// WithDiskCompaction 设置DiskCache后台清理过期数据的间隔，默认1分钟，小于0时不清理，
+// 清理后的空闲页由后续写入复用，文件大小不会缩小
+func WithDiskCompaction(interval time.Duration) Option {
+	return func(o *options) {
+		o.diskCompactInterval = interval
+	}
+}
+
+// DiskCache 使用bbolt保存数据的本地持久化缓存，重启后数据保留，容量可大于内存，
+// 适合作为内存缓存与Redis之间的一级；每次写入为一个fsync的事务，进程崩溃不会写入部分数据
+type DiskCache[T any] struct {
+	db      *bolt.DB
+	ttl     time.Duration
+	maxSize int64
+	enc     encoder[T]
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+
+	now       func() time.Time // 当前时间，测试中替换
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewDiskCache returns a newly initialize DiskCache implement Cache by file path and ttl,
+// the file is created if not exists and locked until Close
+//
+// path: bbolt database file path
+// ttl: entry expire ttl, if ttl set 0, cache will not expire
+// opts: options, e.g. WithCodec, WithDiskLimit, WithDiskCompaction
+func NewDiskCache[T any](path string, ttl time.Duration, opts ...Option) (*DiskCache[T], error) {
+	o := newOptions(opts)
+	enc := newEncoder[T](o)
+	if enc.schemaErr != nil {
+		return nil, enc.schemaErr
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{diskDataBucket, diskExpiryBucket, diskMetaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	dc := &DiskCache[T]{
+		db:      db,
+		ttl:     ttl,
+		maxSize: o.diskMaxBytes,
+		enc:     enc,
+		now:     time.Now,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	interval := o.diskCompactInterval
+	if interval == 0 {
+		interval = defaultCompactInterval
+	}
+	if interval > 0 {
+		go dc.runCompaction(interval)
+	} else {
+		close(dc.done)
+	}
+	return dc, nil
+}
+
+func (dc *DiskCache[T]) Get(ctx context.Context, key string, expire time.Duration) (T, bool) {
+	var zero T
+	env, found, err := dc.V2().Get(ctx, key, expire)
+	if err != nil || !found {
+		return zero, false
+	}
+	return env.Value(dc.now(), expire)
+}
+
+func (dc *DiskCache[T]) MGet(ctx context.Context, keys []string, expire time.Duration) map[string]T {
+	now := dc.now()
+	envs, _ := dc.V2().MGet(ctx, keys, expire)
+	result := make(map[string]T, len(envs))
+	for key, env := range envs {
+		if data, ok := env.Value(now, expire); ok {
+			result[key] = data
+		}
+	}
+	return result
+}
+
+// V2 返回区分未命中与磁盘错误的CacheV2实现
+func (dc *DiskCache[T]) V2() CacheV2[T] {
+	return &diskCacheV2[T]{DiskCache: dc}
+}
+
+// SchemaInfo 构造时通过WithSchema设置的schema
+func (dc *DiskCache[T]) SchemaInfo() SchemaInfo {
+	return dc.enc.schemaInfo()
+}
+
+func (dc *DiskCache[T]) Set(ctx context.Context, key string, data T, createTime time.Time) error {
+	return dc.MSet(ctx, map[string]T{key: data}, createTime)
+}
+
+// MSet 在一个事务中写入，任一key失败时全部不写入
+func (dc *DiskCache[T]) MSet(_ context.Context, kvs map[string]T, createTime time.Time) error {
+	createAt := utils.ConvertTimestamp(createTime)
+	expireAt := dc.expireAt(dc.ttl)
+	return dc.update(func(t *diskTx) error {
+		for k, v := range kvs {
+			val, err := dc.enc.marshalData(k, v, createAt, 0)
+			if err != nil {
+				return fmt.Errorf("marshal error: %v", err)
+			}
+			if err = t.put(k, val, expireAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetDefault 在一个事务中写入空值，已存在更新的数据或宽限期内的墓碑时跳过
+func (dc *DiskCache[T]) SetDefault(_ context.Context, keys []string, createTime time.Time) error {
+	createAt := utils.ConvertTimestamp(createTime)
+	val := dc.enc.marshalDefault(createAt)
+	expireAt := dc.expireAt(dc.ttl)
+	return dc.update(func(t *diskTx) error {
+		now := dc.now()
+		for _, key := range keys {
+			if current, _, ok := t.get(key, now); ok {
+				if meta, err := dc.enc.unmarshalMeta(current); err == nil && skipDefault(meta, createAt, utils.ConvertTimestamp(now)) {
+					continue
+				}
+			}
+			if err := t.put(key, val, expireAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (dc *DiskCache[T]) SetWithVersion(ctx context.Context, key string, data T, createTime time.Time, version int64) error {
+	return dc.MSetWithVersion(ctx, map[string]T{key: data}, map[string]int64{key: version}, createTime)
+}
+
+// MSetWithVersion 在一个事务中逐个条件写入，被拒绝的key不影响其他key
+func (dc *DiskCache[T]) MSetWithVersion(_ context.Context, kvs map[string]T, versions map[string]int64, createTime time.Time) error {
+	createAt := utils.ConvertTimestamp(createTime)
+	expireAt := dc.expireAt(dc.ttl)
+	var rejected error
+	err := dc.update(func(t *diskTx) error {
+		rejected = mSetWithVersion(kvs, versions, func(key string, data T, version int64) error {
+			if val, _, ok := t.get(key, dc.now()); ok {
+				if current, err := dc.enc.unmarshalMeta(val); err == nil {
+					if err := checkWrite(current, createAt, version, utils.ConvertTimestamp(dc.now())); err != nil {
+						return newRejectedError(err, []string{key})
+					}
+				}
+			}
+			val, err := dc.enc.marshalData(key, data, createAt, version)
+			if err != nil {
+				return fmt.Errorf("marshal error: %v", err)
+			}
+			return t.put(key, val, expireAt)
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return rejected
+}
+
+func (dc *DiskCache[T]) SetTombstone(_ context.Context, keys []string, createTime time.Time, grace time.Duration) error {
+	createAt, expireAt := utils.ConvertTimestamp(createTime), tombstoneExpireAt(createTime, grace)
+	return dc.update(func(t *diskTx) error {
+		now := dc.now()
+		for _, key := range keys {
+			var version int64
+			if val, _, ok := t.get(key, now); ok {
+				if current, err := dc.enc.unmarshalMeta(val); err == nil {
+					version = current.Version
+				}
+			}
+			if err := t.put(key, dc.enc.marshalTombstone(createAt, expireAt, version), expireAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (dc *DiskCache[T]) Delete(ctx context.Context, key string) error {
+	return dc.MDelete(ctx, []string{key})
+}
+
+func (dc *DiskCache[T]) MDelete(_ context.Context, keys []string) error {
+	return dc.update(func(t *diskTx) error {
+		for _, key := range keys {
+			t.remove(key)
+		}
+		return nil
+	})
+}
+
+func (dc *DiskCache[T]) TTL(_ context.Context, key string) (time.Duration, bool, error) {
+	var (
+		expireAt int64
+		found    bool
+	)
+	now := dc.now()
+	err := dc.db.View(func(tx *bolt.Tx) error {
+		_, expireAt, found = readDiskTx(tx).get(key, now)
+		return nil
+	})
+	if err != nil || !found {
+		return 0, false, err
+	}
+	if expireAt == diskNoExpire {
+		return 0, true, nil
+	}
+	return time.UnixMilli(expireAt).Sub(now), true, nil
+}
+
+// Touch 重新设置过期时间，墓碑视为不存在且不延长
+func (dc *DiskCache[T]) Touch(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		ttl = dc.ttl
+	}
+	var touched bool
+	err := dc.update(func(t *diskTx) error {
+		val, _, ok := t.get(key, dc.now())
+		if !ok {
+			return nil
+		}
+		if meta, err := dc.enc.unmarshalMeta(val); err == nil && meta.Tombstone == 1 {
+			return nil
+		}
+		touched = true
+		return t.put(key, bytes.Clone(val), dc.expireAt(ttl))
+	})
+	return touched, err
+}
+
+// Scan 按key顺序遍历，每批在一个只读事务中读取，fn在事务外调用
+func (dc *DiskCache[T]) Scan(_ context.Context, prefix string, fn func(key string) bool) error {
+	var last []byte // 上一批最后一个key
+	for {
+		var keys []string
+		err := dc.db.View(func(tx *bolt.Tx) error {
+			now := utils.ConvertTimestamp(dc.now())
+			c := tx.Bucket(diskDataBucket).Cursor()
+			k, v := c.Seek([]byte(prefix))
+			if last != nil {
+				k, v = c.Seek(last)
+				if bytes.Equal(k, last) {
+					k, v = c.Next()
+				}
+			}
+			for ; k != nil && bytes.HasPrefix(k, []byte(prefix)) && len(keys) < scanCount; k, v = c.Next() {
+				if recordExpireAt(v) > now {
+					keys = append(keys, string(k))
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if !fn(key) {
+				return nil
+			}
+		}
+		if len(keys) < scanCount {
+			return nil
+		}
+		last = []byte(keys[len(keys)-1])
+	}
+}
+
+// Stats 条目数包含未清理的过期数据
+func (dc *DiskCache[T]) Stats(_ context.Context) (Stats, error) {
+	var entries int64
+	err := dc.db.View(func(tx *bolt.Tx) error {
+		entries = readDiskTx(tx).count
+		return nil
+	})
+	return Stats{
+		Entries:     entries,
+		Hits:        dc.hits.Load(),
+		Misses:      dc.misses.Load(),
+		Evictions:   dc.evictions.Load(),
+		Compression: dc.enc.comp.stats(),
+	}, err
+}
+
+func (dc *DiskCache[T]) Ping(_ context.Context) (string, error) {
+	if dc.db == nil {
+		return "", errors.New("disk cache not set")
+	}
+	return "PONG", nil
+}
+
+// Close 停止后台清理并关闭数据库文件
+func (dc *DiskCache[T]) Close() error {
+	var err error
+	dc.closeOnce.Do(func() {
+		close(dc.stop)
+		<-dc.done
+		err = dc.db.Close()
+	})
+	return err
+}
+
+// compact 清理已过期的数据，返回清理数量
+func (dc *DiskCache[T]) compact(now time.Time) (int, error) {
+	total := 0
+	for {
+		n := 0
+		err := dc.db.Update(func(tx *bolt.Tx) error {
+			t := readDiskTx(tx)
+			n = t.removeExpired(utils.ConvertTimestamp(now), compactBatch)
+			return t.commit()
+		})
+		total += n
+		if err != nil || n < compactBatch {
+			return total, err
+		}
+	}
+}
+
+// runCompaction 定时清理过期数据
+func (dc *DiskCache[T]) runCompaction(interval time.Duration) {
+	defer close(dc.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-dc.stop:
+			return
+		case <-ticker.C:
+			_, _ = dc.compact(dc.now())
+		}
+	}
+}
+
+// update 在读写事务中执行fn，超过大小上限时淘汰数据
+func (dc *DiskCache[T]) update(fn func(t *diskTx) error) error {
+	return dc.db.Update(func(tx *bolt.Tx) error {
+		t := readDiskTx(tx)
+		if err := fn(t); err != nil {
+			return err
+		}
+		if dc.maxSize > 0 && t.size > dc.maxSize {
+			dc.evictions.Add(int64(t.evict(dc.maxSize)))
+		}
+		return t.commit()
+	})
+}
+
+// expireAt 由ttl计算过期时间，ttl为0时不过期
+func (dc *DiskCache[T]) expireAt(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return diskNoExpire
+	}
+	return utils.ConvertTimestamp(dc.now().Add(ttl))
+}
+
+// diskTx 事务内的bucket及统计信息，写入后需调用commit保存统计信息
+type diskTx struct {
+	data   *bolt.Bucket
+	expiry *bolt.Bucket
+	meta   *bolt.Bucket
+	size   int64
+	count  int64
+}
+
+// readDiskTx 读取事务内的bucket及统计信息
+func readDiskTx(tx *bolt.Tx) *diskTx {
+	t := &diskTx{
+		data:   tx.Bucket(diskDataBucket),
+		expiry: tx.Bucket(diskExpiryBucket),
+		meta:   tx.Bucket(diskMetaBucket),
+	}
+	if v := t.meta.Get(diskSizeKey); len(v) == 8 {
+		t.size = int64(binary.BigEndian.Uint64(v))
+	}
+	if v := t.meta.Get(diskCountKey); len(v) == 8 {
+		t.count = int64(binary.BigEndian.Uint64(v))
+	}
+	return t
+}
+
+// get 读取未过期的数据，返回的数据只在事务内有效
+func (t *diskTx) get(key string, now time.Time) (val []byte, expireAt int64, ok bool) {
+	record := t.data.Get([]byte(key))
+	if len(record) < 8 {
+		return nil, 0, false
+	}
+	expireAt = recordExpireAt(record)
+	if expireAt <= utils.ConvertTimestamp(now) {
+		return nil, 0, false
+	}
+	return record[8:], expireAt, true
+}
+
+// put 写入数据并更新过期索引
+func (t *diskTx) put(key string, val []byte, expireAt int64) error {
+	t.remove(key)
+	record := make([]byte, 8+len(val))
+	binary.BigEndian.PutUint64(record, uint64(expireAt))
+	copy(record[8:], val)
+	if err := t.data.Put([]byte(key), record); err != nil {
+		return err
+	}
+	if err := t.expiry.Put(expiryKey(expireAt, key), nil); err != nil {
+		return err
+	}
+	t.size += int64(len(key) + len(record))
+	t.count++
+	return nil
+}
+
+// remove 删除数据及过期索引
+func (t *diskTx) remove(key string) {
+	record := t.data.Get([]byte(key))
+	if record == nil {
+		return
+	}
+	_ = t.expiry.Delete(expiryKey(recordExpireAt(record), key))
+	t.size -= int64(len(key) + len(record))
+	t.count--
+	_ = t.data.Delete([]byte(key))
+}
+
+// removeExpired 按过期时间顺序删除不晚于now的数据，最多limit个
+func (t *diskTx) removeExpired(now int64, limit int) int {
+	keys := t.oldest(limit, func(expireAt int64) bool {
+		return expireAt <= now
+	})
+	for _, key := range keys {
+		t.remove(key)
+	}
+	return len(keys)
+}
+
+// evict 按过期时间顺序淘汰数据直到不超过maxSize
+func (t *diskTx) evict(maxSize int64) int {
+	n := 0
+	for t.size > maxSize {
+		keys := t.oldest(1, func(int64) bool { return true })
+		if len(keys) == 0 {
+			break
+		}
+		t.remove(keys[0])
+		n++
+	}
+	return n
+}
+
+// oldest 按过期时间顺序返回满足match的最多limit个key
+func (t *diskTx) oldest(limit int, match func(expireAt int64) bool) []string {
+	var keys []string
+	c := t.expiry.Cursor()
+	for k, _ := c.First(); k != nil && len(keys) < limit; k, _ = c.Next() {
+		if !match(int64(binary.BigEndian.Uint64(k))) {
+			break
+		}
+		keys = append(keys, string(k[8:]))
+	}
+	return keys
+}
+
+// commit 保存统计信息，bbolt在事务提交前引用写入的value，每个value使用独立的切片
+func (t *diskTx) commit() error {
+	if err := t.meta.Put(diskSizeKey, binary.BigEndian.AppendUint64(nil, uint64(t.size))); err != nil {
+		return err
+	}
+	return t.meta.Put(diskCountKey, binary.BigEndian.AppendUint64(nil, uint64(t.count)))
+}
+
+// recordExpireAt 数据的过期时间
+func recordExpireAt(record []byte) int64 {
+	return int64(binary.BigEndian.Uint64(record))
+}
+
+// expiryKey 过期索引key
+func expiryKey(expireAt int64, key string) []byte {
+	k := make([]byte, 8+len(key))
+	binary.BigEndian.PutUint64(k, uint64(expireAt))
+	copy(k[8:], key)
+	return k
+}
+
+// diskCacheV2 DiskCache的CacheV2实现，解码失败返回CorruptError，其他错误返回
+type diskCacheV2[T any] struct {
+	*DiskCache[T]
+}
+
+func (d *diskCacheV2[T]) Get(ctx context.Context, key string, expire time.Duration) (*Envelope[T], bool, error) {
+	envs, err := d.MGet(ctx, []string{key}, expire)
+	env, found := envs[key]
+	return env, found, err
+}
+
+// MGet 在一个只读事务中读取
+func (d *diskCacheV2[T]) MGet(_ context.Context, keys []string, expire time.Duration) (map[string]*Envelope[T], error) {
+	now := d.now()
+	raw := make(map[string][]byte, len(keys))
+	err := d.db.View(func(tx *bolt.Tx) error {
+		t := readDiskTx(tx)
+		for _, key := range keys {
+			if val, _, ok := t.get(key, now); ok {
+				raw[key] = bytes.Clone(val)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.hits.Add(int64(len(raw)))
+	d.misses.Add(int64(len(keys) - len(raw)))
+	result := make(map[string]*Envelope[T], len(raw))
+	var corrupt *CorruptError
+	for key, val := range raw {
+		var env *Envelope[T]
+		if env, corrupt = decodeEntry(d.enc, key, val, now, expire, corrupt); env != nil {
+			result[key] = env
+		}
+	}
+	return result, corrupt.errorOrNil()
+}
@@ -0,0 +1,283 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestDiskCache(t *testing.T, ttl time.Duration, opts ...Option) (*DiskCache[string], string) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	dc, err := NewDiskCache[string](path, ttl, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = dc.Close() })
+	return dc, path
+}
+
+func TestNewDiskCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reopen", func(tt *testing.T) {
+		dc, path := newTestDiskCache(tt, time.Hour)
+		assert.Nil(tt, dc.MSet(ctx, map[string]string{"a": "1", "b": "2"}, time.Now()))
+		assert.Nil(tt, dc.Close())
+		assert.Nil(tt, dc.Close())
+
+		dc, err := NewDiskCache[string](path, time.Hour)
+		assert.Nil(tt, err)
+		defer dc.Close()
+		assert.Equal(tt, map[string]string{"a": "1", "b": "2"}, dc.MGet(ctx, []string{"a", "b"}, time.Hour))
+		stats, err := dc.Stats(ctx)
+		assert.Nil(tt, err)
+		assert.Equal(tt, int64(2), stats.Entries)
+	})
+
+	t.Run("invalid path", func(tt *testing.T) {
+		_, err := NewDiskCache[string](filepath.Join(tt.TempDir(), "missing", "cache.db"), time.Hour)
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("ping", func(tt *testing.T) {
+		dc, _ := newTestDiskCache(tt, time.Hour)
+		pong, err := dc.Ping(ctx)
+		assert.Nil(tt, err)
+		assert.Equal(tt, "PONG", pong)
+		_, err = (&DiskCache[string]{}).Ping(ctx)
+		assert.NotNil(tt, err)
+	})
+}
+
+func TestDiskCache(t *testing.T) {
+	ctx := context.Background()
+	dc, _ := newTestDiskCache(t, time.Hour)
+
+	t.Run("set and get", func(tt *testing.T) {
+		assert.Nil(tt, dc.Set(ctx, "k1", "v1", time.Now()))
+		got, ok := dc.Get(ctx, "k1", time.Minute)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v1", got)
+		_, ok = dc.Get(ctx, "missing", time.Minute)
+		assert.False(tt, ok)
+
+		_ = dc.Set(ctx, "old", "v", time.Now().Add(-2*time.Minute))
+		_, ok = dc.Get(ctx, "old", time.Minute)
+		assert.False(tt, ok)
+		assert.Equal(tt, map[string]string{"k1": "v1"}, dc.MGet(ctx, []string{"k1", "old", "missing"}, time.Minute))
+	})
+
+	t.Run("set default", func(tt *testing.T) {
+		assert.Nil(tt, dc.SetDefault(ctx, []string{"d1"}, time.Now()))
+		env, found, err := dc.V2().Get(ctx, "d1", time.Minute)
+		assert.Nil(tt, err)
+		assert.True(tt, found)
+		assert.True(tt, env.Default)
+		_, ok := dc.Get(ctx, "d1", time.Minute)
+		assert.False(tt, ok)
+	})
+
+	t.Run("set with version", func(tt *testing.T) {
+		now := time.Now()
+		assert.Nil(tt, dc.SetWithVersion(ctx, "v1", "a", now, 2))
+		assert.ErrorIs(tt, dc.SetWithVersion(ctx, "v1", "b", now, 1), ErrStaleVersion)
+		err := dc.MSetWithVersion(ctx, map[string]string{"v1": "c", "v2": "d"}, map[string]int64{"v1": 1, "v2": 1}, now)
+		assert.ErrorIs(tt, err, ErrStaleVersion)
+		assert.Equal(tt, map[string]string{"v1": "a", "v2": "d"}, dc.MGet(ctx, []string{"v1", "v2"}, time.Minute))
+	})
+
+	t.Run("tombstone", func(tt *testing.T) {
+		now := time.Now()
+		assert.Nil(tt, dc.SetTombstone(ctx, []string{"t1"}, now, time.Minute))
+		_, ok := dc.Get(ctx, "t1", time.Minute)
+		assert.False(tt, ok)
+		assert.ErrorIs(tt, dc.SetWithVersion(ctx, "t1", "a", now.Add(-time.Second), 1), ErrTombstoned)
+		ttl, ok, err := dc.TTL(ctx, "t1")
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		assert.LessOrEqual(tt, ttl, time.Minute)
+		touched, err := dc.Touch(ctx, "t1", time.Hour)
+		assert.Nil(tt, err)
+		assert.False(tt, touched)
+		assert.Nil(tt, dc.SetWithVersion(ctx, "t1", "b", now.Add(time.Second), 1))
+
+		assert.Nil(tt, dc.SetTombstone(ctx, []string{"t2"}, now, time.Minute))
+		assert.Nil(tt, dc.SetDefault(ctx, []string{"t2", "t3"}, now.Add(time.Millisecond)))
+		env, found, err := dc.V2().Get(ctx, "t2", time.Minute)
+		assert.Nil(tt, err)
+		assert.True(tt, found)
+		assert.True(tt, env.Tombstone)
+		env, found, err = dc.V2().Get(ctx, "t3", time.Minute)
+		assert.Nil(tt, err)
+		assert.True(tt, found)
+		assert.True(tt, env.Default)
+		assert.Nil(tt, dc.SetDefault(ctx, []string{"t1"}, now))
+		got, ok := dc.Get(ctx, "t1", time.Minute)
+		assert.True(tt, ok)
+		assert.Equal(tt, "b", got)
+	})
+
+	t.Run("delete", func(tt *testing.T) {
+		_ = dc.MSet(ctx, map[string]string{"x1": "v", "x2": "v", "x3": "v"}, time.Now())
+		before, _ := dc.Stats(ctx)
+		assert.Nil(tt, dc.Delete(ctx, "x1"))
+		assert.Nil(tt, dc.MDelete(ctx, []string{"x2", "x3", "missing"}))
+		assert.Empty(tt, dc.MGet(ctx, []string{"x1", "x2", "x3"}, time.Minute))
+		after, _ := dc.Stats(ctx)
+		assert.Equal(tt, before.Entries-3, after.Entries)
+	})
+
+	t.Run("corrupt", func(tt *testing.T) {
+		err := dc.db.Update(func(tx *bolt.Tx) error {
+			return readDiskTx(tx).put("bad", []byte("bad"), diskNoExpire)
+		})
+		assert.Nil(tt, err)
+		envs, err := dc.V2().MGet(ctx, []string{"bad", "k1"}, time.Minute)
+		var corrupt *CorruptError
+		assert.ErrorAs(tt, err, &corrupt)
+		assert.Equal(tt, []string{"bad"}, keysOf(corrupt.Entries))
+		assert.Equal(tt, "v1", envs["k1"].Data)
+	})
+
+	t.Run("stats", func(tt *testing.T) {
+		stats, err := dc.Stats(ctx)
+		assert.Nil(tt, err)
+		assert.Greater(tt, stats.Hits, int64(0))
+		assert.Greater(tt, stats.Misses, int64(0))
+	})
+
+	t.Run("closed", func(tt *testing.T) {
+		closed, _ := newTestDiskCache(tt, time.Hour)
+		_ = closed.Close()
+		_, _, err := closed.V2().Get(ctx, "k", time.Minute)
+		assert.True(tt, errors.Is(err, bolt.ErrDatabaseNotOpen))
+		assert.NotNil(tt, closed.Set(ctx, "k", "v", time.Now()))
+	})
+}
+
+func TestDiskCache_Expire(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ttl and touch", func(tt *testing.T) {
+		dc, _ := newTestDiskCache(tt, 0)
+		_ = dc.Set(ctx, "k", "v", time.Now())
+		ttl, ok, err := dc.TTL(ctx, "k")
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		assert.Equal(tt, time.Duration(0), ttl)
+
+		touched, err := dc.Touch(ctx, "k", time.Minute)
+		assert.Nil(tt, err)
+		assert.True(tt, touched)
+		ttl, _, _ = dc.TTL(ctx, "k")
+		assert.Greater(tt, ttl, 59*time.Second)
+		got, _ := dc.Get(ctx, "k", 0)
+		assert.Equal(tt, "v", got)
+
+		touched, _ = dc.Touch(ctx, "k", 0)
+		assert.True(tt, touched)
+		ttl, _, _ = dc.TTL(ctx, "k")
+		assert.Equal(tt, time.Duration(0), ttl)
+
+		touched, _ = dc.Touch(ctx, "missing", time.Minute)
+		assert.False(tt, touched)
+		_, ok, _ = dc.TTL(ctx, "missing")
+		assert.False(tt, ok)
+	})
+
+	t.Run("compact", func(tt *testing.T) {
+		dc, _ := newTestDiskCache(tt, 20*time.Millisecond, WithDiskCompaction(-1))
+		now := time.Now()
+		dc.now = func() time.Time { return now }
+		kvs := make(map[string]string)
+		for i := 0; i < compactBatch+10; i++ {
+			kvs["k"+strconv.Itoa(i)] = "v"
+		}
+		_ = dc.MSet(ctx, kvs, now)
+		now = now.Add(20 * time.Millisecond)
+		_, ok := dc.Get(ctx, "k1", 0)
+		assert.False(tt, ok)
+		_, ok, _ = dc.TTL(ctx, "k1")
+		assert.False(tt, ok)
+
+		n, err := dc.compact(now)
+		assert.Nil(tt, err)
+		assert.Equal(tt, compactBatch+10, n)
+		stats, _ := dc.Stats(ctx)
+		assert.Equal(tt, int64(0), stats.Entries)
+		assert.Equal(tt, int64(0), stats.Evictions)
+	})
+
+	t.Run("background compaction", func(tt *testing.T) {
+		dc, _ := newTestDiskCache(tt, 10*time.Millisecond, WithDiskCompaction(10*time.Millisecond))
+		_ = dc.Set(ctx, "k", "v", time.Now())
+		assert.Eventually(tt, func() bool {
+			stats, _ := dc.Stats(ctx)
+			return stats.Entries == 0
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("size limit", func(tt *testing.T) {
+		dc, _ := newTestDiskCache(tt, time.Hour, WithDiskLimit(512))
+		now := time.Now()
+		dc.now = func() time.Time { return now }
+		for i := 0; i < 50; i++ {
+			_ = dc.Set(ctx, "k"+strconv.Itoa(i), "value", now)
+			now = now.Add(time.Millisecond)
+		}
+		stats, _ := dc.Stats(ctx)
+		assert.Greater(tt, stats.Evictions, int64(0))
+		assert.Equal(tt, int64(50)-stats.Evictions, stats.Entries)
+		var size int64
+		_ = dc.db.View(func(tx *bolt.Tx) error {
+			size = int64(binary.BigEndian.Uint64(tx.Bucket(diskMetaBucket).Get(diskSizeKey)))
+			return nil
+		})
+		assert.LessOrEqual(tt, size, int64(512))
+		// 先淘汰最早过期的数据
+		_, ok := dc.Get(ctx, "k0", time.Hour)
+		assert.False(tt, ok)
+		_, ok = dc.Get(ctx, "k49", time.Hour)
+		assert.True(tt, ok)
+	})
+}
+
+func TestDiskCache_Scan(t *testing.T) {
+	ctx := context.Background()
+	dc, _ := newTestDiskCache(t, time.Hour)
+	kvs := make(map[string]string)
+	for i := 0; i < 2*scanCount+10; i++ {
+		kvs["user:"+strconv.Itoa(i)] = "v"
+	}
+	kvs["user:"] = "v"
+	kvs["item:1"] = "v"
+	_ = dc.MSet(ctx, kvs, time.Now())
+
+	t.Run("prefix", func(tt *testing.T) {
+		seen := make(map[string]bool)
+		err := dc.Scan(ctx, "user:", func(key string) bool {
+			assert.False(tt, seen[key])
+			seen[key] = true
+			return true
+		})
+		assert.Nil(tt, err)
+		assert.Len(tt, seen, 2*scanCount+11)
+		assert.False(tt, seen["item:1"])
+	})
+
+	t.Run("stop", func(tt *testing.T) {
+		n := 0
+		_ = dc.Scan(ctx, "", func(key string) bool {
+			n++
+			return n < scanCount+5
+		})
+		assert.Equal(tt, scanCount+5, n)
+	})
+}
@@ -0,0 +1,347 @@
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/kakkk/cachex/internal/json"
+	"github.com/kakkk/cachex/internal/model"
+)
+
+// 二进制信封格式：
+//
+//	magic(1) | format version(1) | flags(1) | createAt(varint) | [version(varint)] | [expireAt(varint)] |
+//	[schema(uvarint)] | [compressor id(1)] | [key id(uvarint)] | codec name length(1) | codec name | payload
+//
+// 加密时payload为nonce及密文，头部作为认证数据
+//
+// 不以magic开头的数据按旧JSON信封解码
+const (
+	envelopeMagic         byte = 0xCE
+	envelopeFormatVersion byte = 1
+)
+
+// 二进制信封标记位
+const (
+	flagDefault    byte = 1 << iota // 空值
+	flagTombstone                   // 墓碑
+	flagVersion                     // 包含数据版本
+	flagExpireAt                    // 包含过期时间
+	flagCompressed                  // 数据已压缩
+	flagEncrypted                   // 数据已加密
+	flagKeyBound                    // 缓存key参与认证
+	flagSchema                      // 包含schema版本
+)
+
+// maxCodecNameLen 编码名称最大长度
+const maxCodecNameLen = 255
+
+var errInvalidEnvelope = errors.New("invalid envelope")
+
+// encoder 按Codec编解码缓存数据，写入二进制信封，读取兼容旧JSON信封
+type encoder[T any] struct {
+	codec     Codec
+	comp      *compression
+	crypt     *encryption
+	schema    Schema[T]
+	schemaErr error // WithSchema的类型与缓存数据类型不一致
+}
+
+// newEncoder 由构造选项创建encoder
+func newEncoder[T any](opts *options) encoder[T] {
+	enc := encoder[T]{codec: opts.codec, comp: newCompression(opts), crypt: newEncryption(opts)}
+	if opts.schema != nil {
+		var ok bool
+		if enc.schema, ok = opts.schema.(Schema[T]); !ok {
+			enc.schemaErr = fmt.Errorf("%w: %T, expect %T", ErrSchemaType, opts.schema, enc.schema)
+		}
+	}
+	return enc
+}
+
+// schemaInfo 构造时设置的schema及配置错误
+func (e encoder[T]) schemaInfo() SchemaInfo {
+	info := e.schema.info()
+	info.Err = e.schemaErr
+	return info
+}
+
+// rawEnvelope 解码后的信封，payload为编码、压缩及加密后的数据
+type rawEnvelope struct {
+	meta       *model.CacheMeta
+	header     []byte // 二进制信封头部
+	flags      byte
+	codec      string
+	compressor byte   // 压缩算法ID，0为未压缩
+	keyID      uint32 // 加密密钥ID
+	schema     uint32 // schema版本，0为未记录
+	payload    []byte
+}
+
+// getCodec 获取Codec，未设置时使用JSONCodec
+func (e encoder[T]) getCodec() Codec {
+	if e.codec == nil {
+		return JSONCodec
+	}
+	return e.codec
+}
+
+// marshal 编码缓存数据，key用于绑定加密数据
+func (e encoder[T]) marshal(key string, data *model.CacheData[T]) ([]byte, error) {
+	var name string
+	var payload []byte
+	var schema uint32
+	if !data.IsDefault() && !data.IsTombstone() {
+		schema = e.schema.Version
+		codec := e.getCodec()
+		if name = codec.Name(); len(name) > maxCodecNameLen {
+			return nil, fmt.Errorf("codec name too long: %v", name)
+		}
+		var err error
+		if payload, err = codec.Marshal(data.Data); err != nil {
+			return nil, err
+		}
+	}
+	payload, compressed, err := e.comp.compress(payload)
+	if err != nil {
+		return nil, err
+	}
+	var flags byte
+	if data.IsDefault() {
+		flags |= flagDefault
+	}
+	if data.IsTombstone() {
+		flags |= flagTombstone
+	}
+	if data.Version != 0 {
+		flags |= flagVersion
+	}
+	if data.ExpireAt != 0 {
+		flags |= flagExpireAt
+	}
+	if schema != 0 {
+		flags |= flagSchema
+	}
+	if compressed {
+		flags |= flagCompressed
+	}
+	encrypted := e.crypt != nil && len(payload) > 0
+	if encrypted {
+		flags |= flagEncrypted
+		if e.crypt.bindKey {
+			flags |= flagKeyBound
+		}
+	}
+	val := make([]byte, 0, 5+4*binary.MaxVarintLen64+len(name)+len(payload))
+	val = append(val, envelopeMagic, envelopeFormatVersion, flags)
+	val = binary.AppendVarint(val, data.CreateAt)
+	if data.Version != 0 {
+		val = binary.AppendVarint(val, data.Version)
+	}
+	if data.ExpireAt != 0 {
+		val = binary.AppendVarint(val, data.ExpireAt)
+	}
+	if schema != 0 {
+		val = binary.AppendUvarint(val, uint64(schema))
+	}
+	if compressed {
+		val = append(val, e.comp.compressor.ID())
+	}
+	if encrypted {
+		val = binary.AppendUvarint(val, uint64(e.crypt.keyID()))
+	}
+	val = append(val, byte(len(name)))
+	val = append(val, name...)
+	if encrypted {
+		if payload, err = e.crypt.seal(key, val, payload, e.crypt.bindKey); err != nil {
+			return nil, err
+		}
+	}
+	return append(val, payload...), nil
+}
+
+// marshalData 编码数据
+func (e encoder[T]) marshalData(key string, data T, createAt int64, version int64) ([]byte, error) {
+	return e.marshal(key, &model.CacheData[T]{
+		CreateAt: createAt,
+		Data:     data,
+		Version:  version,
+	})
+}
+
+// marshalDefault 编码空值
+func (e encoder[T]) marshalDefault(createAt int64) []byte {
+	val, _ := e.marshal("", &model.CacheData[T]{
+		CreateAt: createAt,
+		Default:  1,
+	})
+	return val
+}
+
+// marshalTombstone 编码墓碑，version为被删除数据的版本
+func (e encoder[T]) marshalTombstone(createAt int64, expireAt int64, version int64) []byte {
+	val, _ := e.marshal("", &model.CacheData[T]{
+		CreateAt:  createAt,
+		Version:   version,
+		Tombstone: 1,
+		ExpireAt:  expireAt,
+	})
+	return val
+}
+
+// unmarshal 解码缓存数据，编码不一致时返回ErrCodecMismatch，schema版本不一致且无法升级时返回
+// ErrSchemaOutdated或ErrSchemaNewer，key用于校验绑定的加密数据
+func (e encoder[T]) unmarshal(key string, val []byte) (*model.CacheData[T], error) {
+	raw, err := decode(val)
+	if err != nil {
+		return nil, err
+	}
+	meta := raw.meta
+	data := &model.CacheData[T]{
+		CreateAt:  meta.CreateAt,
+		Default:   meta.Default,
+		Version:   meta.Version,
+		Tombstone: meta.Tombstone,
+		ExpireAt:  meta.ExpireAt,
+	}
+	if data.IsDefault() || data.IsTombstone() {
+		return data, nil
+	}
+	codec := e.getCodec()
+	if raw.codec != codec.Name() {
+		return nil, fmt.Errorf("%w: stored %v, expect %v", ErrCodecMismatch, raw.codec, codec.Name())
+	}
+	payload := raw.payload
+	if raw.flags&flagEncrypted != 0 {
+		if payload, err = e.crypt.open(raw.keyID, key, raw.header, payload, raw.flags&flagKeyBound != 0); err != nil {
+			return nil, err
+		}
+	}
+	if raw.compressor != 0 {
+		if payload, err = e.comp.decompress(raw.compressor, payload); err != nil {
+			return nil, err
+		}
+	}
+	decode := func(v any) error { return codec.Unmarshal(payload, v) }
+	if err = e.schema.migrate(raw.schema, decode, &data.Data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// unmarshalMeta 解码缓存元数据，不解码数据
+func (e encoder[T]) unmarshalMeta(val []byte) (*model.CacheMeta, error) {
+	raw, err := decode(val)
+	if err != nil {
+		return nil, err
+	}
+	return raw.meta, nil
+}
+
+// unmarshalEnvelope 解码缓存数据为Envelope
+func (e encoder[T]) unmarshalEnvelope(key string, val []byte) (*Envelope[T], error) {
+	data, err := e.unmarshal(key, val)
+	if err != nil {
+		return nil, err
+	}
+	return newEnvelope(data), nil
+}
+
+// decode 解码信封，不解码及解压数据
+func decode(val []byte) (*rawEnvelope, error) {
+	if len(val) == 0 || val[0] != envelopeMagic {
+		return decodeJSON(val)
+	}
+	return decodeBinary(val)
+}
+
+// decodeBinary 解码二进制信封
+func decodeBinary(val []byte) (*rawEnvelope, error) {
+	if len(val) < 3 {
+		return nil, errInvalidEnvelope
+	}
+	if val[1] != envelopeFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %v", errInvalidEnvelope, val[1])
+	}
+	flags, rest := val[2], val[3:]
+	meta := &model.CacheMeta{}
+	if flags&flagDefault != 0 {
+		meta.Default = 1
+	}
+	if flags&flagTombstone != 0 {
+		meta.Tombstone = 1
+	}
+	var ok bool
+	if meta.CreateAt, rest, ok = readVarint(rest); !ok {
+		return nil, errInvalidEnvelope
+	}
+	if flags&flagVersion != 0 {
+		if meta.Version, rest, ok = readVarint(rest); !ok {
+			return nil, errInvalidEnvelope
+		}
+	}
+	if flags&flagExpireAt != 0 {
+		if meta.ExpireAt, rest, ok = readVarint(rest); !ok {
+			return nil, errInvalidEnvelope
+		}
+	}
+	raw := &rawEnvelope{meta: meta, flags: flags}
+	if flags&flagSchema != 0 {
+		schema, n := binary.Uvarint(rest)
+		if n <= 0 || schema > math.MaxUint32 {
+			return nil, errInvalidEnvelope
+		}
+		raw.schema, rest = uint32(schema), rest[n:]
+		meta.Schema = raw.schema
+	}
+	if flags&flagCompressed != 0 {
+		if len(rest) < 1 || rest[0] == 0 {
+			return nil, errInvalidEnvelope
+		}
+		raw.compressor, rest = rest[0], rest[1:]
+	}
+	if flags&flagEncrypted != 0 {
+		keyID, n := binary.Uvarint(rest)
+		if n <= 0 || keyID > math.MaxUint32 {
+			return nil, errInvalidEnvelope
+		}
+		raw.keyID, rest = uint32(keyID), rest[n:]
+	}
+	if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+		return nil, errInvalidEnvelope
+	}
+	nameLen := int(rest[0])
+	headerLen := len(val) - len(rest) + 1 + nameLen
+	raw.header, raw.codec, raw.payload = val[:headerLen], string(rest[1:1+nameLen]), rest[1+nameLen:]
+	return raw, nil
+}
+
+// readVarint 读取varint
+func readVarint(val []byte) (int64, []byte, bool) {
+	v, n := binary.Varint(val)
+	if n <= 0 {
+		return 0, nil, false
+	}
+	return v, val[n:], true
+}
+
+// decodeJSON 解码旧JSON信封，未记录编码名称的数据为JSON编码
+func decodeJSON(val []byte) (*rawEnvelope, error) {
+	raw := &model.RawCacheData{}
+	if err := json.Unmarshal(val, raw); err != nil {
+		return nil, err
+	}
+	meta := &model.CacheMeta{
+		CreateAt:  raw.CreateAt,
+		Default:   raw.Default,
+		Version:   raw.Version,
+		Tombstone: raw.Tombstone,
+		ExpireAt:  raw.ExpireAt,
+	}
+	if raw.Codec == "" {
+		return &rawEnvelope{meta: meta, codec: JSONCodec.Name(), payload: raw.Data}, nil
+	}
+	return &rawEnvelope{meta: meta, codec: raw.Codec, payload: raw.Payload}, nil
+}
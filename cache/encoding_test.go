@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kakkk/cachex/internal/json"
+	"github.com/kakkk/cachex/internal/model"
+	"github.com/kakkk/cachex/internal/utils"
+)
+
+func TestEncoder(t *testing.T) {
+	enc := encoder[codecTestData]{}
+	data := codecTestData{ID: 1, Name: "test", Tags: []string{"a"}}
+
+	t.Run("binary", func(tt *testing.T) {
+		val, err := enc.marshalData("k", data, 1017072000000, 3)
+		assert.Nil(tt, err)
+		assert.Equal(tt, envelopeMagic, val[0])
+		assert.Equal(tt, envelopeFormatVersion, val[1])
+		got, err := enc.unmarshal("k", val)
+		assert.Nil(tt, err)
+		assert.Equal(tt, &model.CacheData[codecTestData]{CreateAt: 1017072000000, Data: data, Version: 3}, got)
+
+		meta, err := enc.unmarshalMeta(val)
+		assert.Nil(tt, err)
+		assert.Equal(tt, &model.CacheMeta{CreateAt: 1017072000000, Version: 3}, meta)
+	})
+
+	t.Run("default and tombstone", func(tt *testing.T) {
+		got, err := enc.unmarshal("k", enc.marshalDefault(1017072000000))
+		assert.Nil(tt, err)
+		assert.True(tt, got.IsDefault())
+		assert.Equal(tt, int64(1017072000000), got.CreateAt)
+
+		meta, err := enc.unmarshalMeta(enc.marshalTombstone(1017072000000, 1017072060000, 0))
+		assert.Nil(tt, err)
+		assert.Equal(tt, &model.CacheMeta{CreateAt: 1017072000000, Tombstone: 1, ExpireAt: 1017072060000}, meta)
+	})
+
+	t.Run("legacy json", func(tt *testing.T) {
+		val, _ := utils.MarshalVersionedData(data, 1017072000000, 3)
+		got, err := enc.unmarshal("k", val)
+		assert.Nil(tt, err)
+		assert.Equal(tt, &model.CacheData[codecTestData]{CreateAt: 1017072000000, Data: data, Version: 3}, got)
+
+		got, err = enc.unmarshal("k", utils.NewTombstoneDataWithMarshal[codecTestData](1017072000000, 1017072060000))
+		assert.Nil(tt, err)
+		assert.True(tt, got.IsTombstone())
+		assert.Equal(tt, int64(1017072060000), got.ExpireAt)
+	})
+
+	t.Run("legacy json with codec", func(tt *testing.T) {
+		msgpackEnc := encoder[codecTestData]{codec: MsgpackCodec}
+		val := legacyMarshal(tt, MsgpackCodec, data)
+		got, err := msgpackEnc.unmarshal("k", val)
+		assert.Nil(tt, err)
+		assert.Equal(tt, data, got.Data)
+		_, err = enc.unmarshal("k", val)
+		assert.ErrorIs(tt, err, ErrCodecMismatch)
+	})
+
+	t.Run("invalid", func(tt *testing.T) {
+		valid, _ := enc.marshalData("k", data, 1017072000000, 3)
+		for name, val := range map[string][]byte{
+			"empty":          {},
+			"short":          {envelopeMagic, envelopeFormatVersion},
+			"format version": {envelopeMagic, 9, 0, 0, 0},
+			"create at":      {envelopeMagic, envelopeFormatVersion, 0},
+			"version":        {envelopeMagic, envelopeFormatVersion, flagVersion, 2},
+			"expire at":      {envelopeMagic, envelopeFormatVersion, flagExpireAt, 2},
+			"codec name":     {envelopeMagic, envelopeFormatVersion, 0, 2, 5, 'j'},
+			"payload":        valid[:len(valid)-1],
+		} {
+			_, err := enc.unmarshal("k", val)
+			assert.NotNil(tt, err, name)
+		}
+	})
+
+	t.Run("codec name too long", func(tt *testing.T) {
+		long := encoder[string]{codec: namedCodec{Codec: JSONCodec, name: string(make([]byte, 256))}}
+		_, err := long.marshalData("k", "v", 0, 0)
+		assert.NotNil(tt, err)
+	})
+}
+
+type namedCodec struct {
+	Codec
+	name string
+}
+
+func (c namedCodec) Name() string { return c.name }
+
+// legacyMarshal 旧JSON信封编码
+func legacyMarshal(tb testing.TB, codec Codec, data codecTestData) []byte {
+	if codec.Name() == JSONCodec.Name() {
+		val, err := utils.MarshalData(data, 1017072000000)
+		assert.Nil(tb, err)
+		return val
+	}
+	payload, err := codec.Marshal(data)
+	assert.Nil(tb, err)
+	val, err := json.Marshal(&model.RawCacheData{CreateAt: 1017072000000, Codec: codec.Name(), Payload: payload})
+	assert.Nil(tb, err)
+	return val
+}
+
+func benchmarkData() codecTestData {
+	tags := make([]string, 20)
+	for i := range tags {
+		tags[i] = "tag"
+	}
+	return codecTestData{ID: 1017072000000, Name: "benchmark", Tags: tags}
+}
+
+func BenchmarkEnvelope_Marshal(b *testing.B) {
+	data := benchmarkData()
+	for _, codec := range []Codec{JSONCodec, MsgpackCodec} {
+		b.Run("legacy/"+codec.Name(), func(b *testing.B) {
+			b.ReportAllocs()
+			b.ReportMetric(float64(len(legacyMarshal(b, codec, data))), "envelope-bytes")
+			for i := 0; i < b.N; i++ {
+				legacyMarshal(b, codec, data)
+			}
+		})
+		b.Run("binary/"+codec.Name(), func(b *testing.B) {
+			enc := encoder[codecTestData]{codec: codec}
+			val, _ := enc.marshalData("k", data, 1017072000000, 0)
+			b.ReportAllocs()
+			b.ReportMetric(float64(len(val)), "envelope-bytes")
+			for i := 0; i < b.N; i++ {
+				_, _ = enc.marshalData("k", data, 1017072000000, 0)
+			}
+		})
+	}
+}
+
+func BenchmarkEnvelope_Unmarshal(b *testing.B) {
+	data := benchmarkData()
+	for _, codec := range []Codec{JSONCodec, MsgpackCodec} {
+		enc := encoder[codecTestData]{codec: codec}
+		b.Run("legacy/"+codec.Name(), func(b *testing.B) {
+			val := legacyMarshal(b, codec, data)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _ = enc.unmarshal("k", val)
+			}
+		})
+		b.Run("binary/"+codec.Name(), func(b *testing.B) {
+			val, _ := enc.marshalData("k", data, 1017072000000, 0)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _ = enc.unmarshal("k", val)
+			}
+		})
+	}
+}
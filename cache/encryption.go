@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnknownKey 加密数据的密钥ID不在密钥环中
+	ErrUnknownKey = errors.New("unknown encryption key")
+	// ErrNoKeyring 数据已加密但未设置密钥环
+	ErrNoKeyring = errors.New("encrypted data without keyring")
+)
+
+// EncryptionKey AES密钥，Key长度为16、24或32字节，分别对应AES-128、AES-192、AES-256
+type EncryptionKey struct {
+	ID  uint32
+	Key []byte
+}
+
+// Keyring 密钥环，使用当前密钥加密，按数据中记录的密钥ID选择解密密钥；
+// 轮换密钥时将新密钥设为当前密钥，旧密钥保留在密钥环中直到旧数据过期
+type Keyring struct {
+	current uint32
+	aeads   map[uint32]cipher.AEAD
+}
+
+// NewKeyring returns a newly initialize Keyring with current key for encryption and old keys for decryption
+func NewKeyring(current EncryptionKey, old ...EncryptionKey) (*Keyring, error) {
+	kr := &Keyring{
+		current: current.ID,
+		aeads:   make(map[uint32]cipher.AEAD, len(old)+1),
+	}
+	for _, key := range append([]EncryptionKey{current}, old...) {
+		if _, ok := kr.aeads[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate encryption key id: %v", key.ID)
+		}
+		block, err := aes.NewCipher(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %v: %w", key.ID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %v: %w", key.ID, err)
+		}
+		kr.aeads[key.ID] = aead
+	}
+	return kr, nil
+}
+
+// WithEncryption 设置AES-GCM加密，bindKey为true时缓存key参与认证，数据不能被复制到其他key下读取
+func WithEncryption(keyring *Keyring, bindKey bool) Option {
+	return func(o *options) {
+		o.keyring = keyring
+		o.bindKey = bindKey
+	}
+}
+
+// encryption 加密配置
+type encryption struct {
+	keyring *Keyring
+	bindKey bool
+}
+
+// newEncryption 由构造选项创建加密配置，未设置密钥环时返回nil
+func newEncryption(opts *options) *encryption {
+	if opts.keyring == nil {
+		return nil
+	}
+	return &encryption{keyring: opts.keyring, bindKey: opts.bindKey}
+}
+
+// keyID 当前加密密钥ID
+func (e *encryption) keyID() uint32 {
+	return e.keyring.current
+}
+
+// seal 使用当前密钥加密，返回nonce及密文
+func (e *encryption) seal(key string, header []byte, payload []byte, bindKey bool) ([]byte, error) {
+	aead := e.keyring.aeads[e.keyring.current]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(payload)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, payload, additionalData(key, header, bindKey)), nil
+}
+
+// open 按密钥ID解密
+func (e *encryption) open(keyID uint32, key string, header []byte, sealed []byte, bindKey bool) ([]byte, error) {
+	if e == nil {
+		return nil, ErrNoKeyring
+	}
+	aead, ok := e.keyring.aeads[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownKey, keyID)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errInvalidEnvelope
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData(key, header, bindKey))
+}
+
+// additionalData 认证数据，包含信封头部，bindKey时追加缓存key
+func additionalData(key string, header []byte, bindKey bool) []byte {
+	if !bindKey {
+		return header
+	}
+	aad := make([]byte, 0, len(header)+len(key))
+	aad = append(aad, header...)
+	return append(aad, key...)
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testKey1 = EncryptionKey{ID: 1, Key: bytes.Repeat([]byte{1}, 32)}
+	testKey2 = EncryptionKey{ID: 2, Key: bytes.Repeat([]byte{2}, 16)}
+)
+
+func newEncryptedEncoder(tb testing.TB, bindKey bool, current EncryptionKey, old ...EncryptionKey) encoder[string] {
+	keyring, err := NewKeyring(current, old...)
+	assert.Nil(tb, err)
+	return newEncoder[string](newOptions([]Option{WithEncryption(keyring, bindKey)}))
+}
+
+func TestNewKeyring(t *testing.T) {
+	t.Run("invalid key size", func(tt *testing.T) {
+		_, err := NewKeyring(EncryptionKey{ID: 1, Key: []byte("short")})
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("duplicate id", func(tt *testing.T) {
+		_, err := NewKeyring(testKey1, EncryptionKey{ID: 1, Key: testKey2.Key})
+		assert.NotNil(tt, err)
+	})
+}
+
+func TestEncoder_encryption(t *testing.T) {
+	enc := newEncryptedEncoder(t, false, testKey1)
+
+	t.Run("round trip", func(tt *testing.T) {
+		val, err := enc.marshalData("k", "secret-pii", 1017072000000, 3)
+		assert.Nil(tt, err)
+		assert.NotContains(tt, string(val), "secret-pii")
+		got, err := enc.unmarshal("k", val)
+		assert.Nil(tt, err)
+		assert.Equal(tt, "secret-pii", got.Data)
+		meta, err := enc.unmarshalMeta(val)
+		assert.Nil(tt, err)
+		assert.Equal(tt, int64(3), meta.Version)
+
+		// 每次加密使用不同nonce
+		other, _ := enc.marshalData("k", "secret-pii", 1017072000000, 3)
+		assert.NotEqual(tt, val, other)
+	})
+
+	t.Run("default not encrypted", func(tt *testing.T) {
+		raw, err := decodeBinary(enc.marshalDefault(1017072000000))
+		assert.Nil(tt, err)
+		assert.Zero(tt, raw.flags&flagEncrypted)
+	})
+
+	t.Run("key rotation", func(tt *testing.T) {
+		old, _ := enc.marshalData("k", "v1", 1017072000000, 0)
+		rotated := newEncryptedEncoder(tt, false, testKey2, testKey1)
+		got, err := rotated.unmarshal("k", old)
+		assert.Nil(tt, err)
+		assert.Equal(tt, "v1", got.Data)
+
+		val, _ := rotated.marshalData("k", "v2", 1017072000000, 0)
+		raw, _ := decodeBinary(val)
+		assert.Equal(tt, testKey2.ID, raw.keyID)
+		_, err = enc.unmarshal("k", val)
+		assert.ErrorIs(tt, err, ErrUnknownKey)
+	})
+
+	t.Run("bind key", func(tt *testing.T) {
+		bound := newEncryptedEncoder(tt, true, testKey1)
+		val, _ := bound.marshalData("user:1", "v", 1017072000000, 0)
+		got, err := bound.unmarshal("user:1", val)
+		assert.Nil(tt, err)
+		assert.Equal(tt, "v", got.Data)
+		_, err = bound.unmarshal("user:2", val)
+		assert.NotNil(tt, err)
+		// 读取方未开启绑定时按数据中的标记校验
+		_, err = enc.unmarshal("user:2", val)
+		assert.NotNil(tt, err)
+
+		unbound, _ := enc.marshalData("user:1", "v", 1017072000000, 0)
+		_, err = enc.unmarshal("user:2", unbound)
+		assert.Nil(tt, err)
+	})
+
+	t.Run("tampered", func(tt *testing.T) {
+		val, _ := enc.marshalData("k", "v", 1017072000000, 0)
+		header := append([]byte{}, val...)
+		header[3]++
+		_, err := enc.unmarshal("k", header)
+		assert.NotNil(tt, err)
+		payload := append([]byte{}, val...)
+		payload[len(payload)-1]++
+		_, err = enc.unmarshal("k", payload)
+		assert.NotNil(tt, err)
+		raw, _ := decodeBinary(val)
+		_, err = enc.unmarshal("k", val[:len(raw.header)+4])
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("no keyring", func(tt *testing.T) {
+		val, _ := enc.marshalData("k", "v", 1017072000000, 0)
+		_, err := encoder[string]{}.unmarshal("k", val)
+		assert.ErrorIs(tt, err, ErrNoKeyring)
+	})
+
+	t.Run("with compression", func(tt *testing.T) {
+		keyring, _ := NewKeyring(testKey1)
+		both := newEncoder[string](newOptions([]Option{WithCompression(ZstdCompressor, 0), WithEncryption(keyring, true)}))
+		large := strings.Repeat("secret-pii", 100)
+		val, err := both.marshalData("k", large, 1017072000000, 0)
+		assert.Nil(tt, err)
+		assert.Less(tt, len(val), len(large))
+		got, err := both.unmarshal("k", val)
+		assert.Nil(tt, err)
+		assert.Equal(tt, large, got.Data)
+	})
+}
+
+func TestEncryption_redis(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	keyring, _ := NewKeyring(testKey1)
+	rc := NewRedisCacheWithClient[string](redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Minute, WithEncryption(keyring, true))
+
+	assert.Nil(t, rc.MSet(ctx, map[string]string{"user:1": "alice@example.com"}, time.Now()))
+	val, _ := mr.Get("user:1")
+	assert.NotContains(t, val, "alice")
+	assert.Equal(t, map[string]string{"user:1": "alice@example.com"}, rc.MGet(ctx, []string{"user:1"}, 0))
+
+	mr.Set("user:2", val)
+	_, ok := rc.Get(ctx, "user:2", 0)
+	assert.False(t, ok)
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/kakkk/cachex/internal/model"
+	"github.com/kakkk/cachex/internal/utils"
+)
+
+// Envelope 缓存数据及元信息
+type Envelope[T any] struct {
+	Data      T
+	CreateAt  int64 // 写入时间戳，毫秒
+	Version   int64 // 数据版本，0为无版本
+	Default   bool  // 是否为空值
+	Tombstone bool  // 是否为墓碑
+}
+
+// IsExpired 是否已超过业务过期时间，expire小于等于0不过期
+func (e *Envelope[T]) IsExpired(now time.Time, expire time.Duration) bool {
+	return utils.IsExpired(e.CreateAt, now, expire)
+}
+
+// Value 获取有效数据，过期、空值及墓碑视为未命中
+func (e *Envelope[T]) Value(now time.Time, expire time.Duration) (T, bool) {
+	var zero T
+	if e.IsExpired(now, expire) || e.Default || e.Tombstone {
+		return zero, false
+	}
+	return e.Data, true
+}
+
+// EnvelopeGetter 读取完整缓存数据，不做业务过期、空值及墓碑过滤
+type EnvelopeGetter[T any] interface {
+	GetEnvelope(ctx context.Context, key string) (*Envelope[T], bool)
+	MGetEnvelope(ctx context.Context, keys []string) map[string]*Envelope[T]
+}
+
+// newEnvelope 由缓存数据生成Envelope
+func newEnvelope[T any](data *model.CacheData[T]) *Envelope[T] {
+	return &Envelope[T]{
+		Data:      data.Data,
+		CreateAt:  data.CreateAt,
+		Version:   data.Version,
+		Default:   data.IsDefault(),
+		Tombstone: data.IsTombstone(),
+	}
+}
+
+// mGetEnvelope 逐个读取Envelope
+func mGetEnvelope[T any](ctx context.Context, keys []string, get func(ctx context.Context, key string) (*Envelope[T], bool)) map[string]*Envelope[T] {
+	result := make(map[string]*Envelope[T])
+	for _, key := range keys {
+		if env, ok := get(ctx, key); ok {
+			result[key] = env
+		}
+	}
+	return result
+}
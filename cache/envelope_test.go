@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelope_Value(t *testing.T) {
+	now := time.Now()
+	createAt := now.Add(-time.Minute).UnixMilli()
+
+	t.Run("valid", func(tt *testing.T) {
+		env := &Envelope[string]{Data: "v", CreateAt: createAt}
+		got, ok := env.Value(now, time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v", got)
+		assert.False(tt, env.IsExpired(now, 0))
+	})
+
+	t.Run("expired", func(tt *testing.T) {
+		env := &Envelope[string]{Data: "v", CreateAt: createAt}
+		assert.True(tt, env.IsExpired(now, time.Second))
+		_, ok := env.Value(now, time.Second)
+		assert.False(tt, ok)
+	})
+
+	t.Run("default and tombstone", func(tt *testing.T) {
+		_, ok := (&Envelope[string]{CreateAt: createAt, Default: true}).Value(now, 0)
+		assert.False(tt, ok)
+		_, ok = (&Envelope[string]{CreateAt: createAt, Tombstone: true}).Value(now, 0)
+		assert.False(tt, ok)
+	})
+}
+
+func TestGetEnvelope(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	caches := map[string]Cache[string]{
+		"lru":       NewLRUCache[string](10, 30*time.Minute),
+		"freecache": NewFreeCache[string](1024*1024, 30*time.Minute),
+		"bigcache":  NewBigCache[string](30 * time.Minute),
+		"redis":     &RedisCache[string]{client: redis.NewClient(&redis.Options{Addr: mr.Addr()}), ttl: 30 * time.Minute},
+	}
+	for name, c := range caches {
+		t.Run(name, func(tt *testing.T) {
+			getter := c.(EnvelopeGetter[string])
+			createTime := time.Now().Add(-time.Minute)
+			_ = c.(VersionedSetter[string]).SetWithVersion(ctx, "data", "v", createTime, 3)
+			_ = c.SetDefault(ctx, []string{"default"}, createTime)
+			_ = c.(Tombstoner).SetTombstone(ctx, []string{"tombstone"}, createTime, time.Minute)
+
+			env, ok := getter.GetEnvelope(ctx, "data")
+			assert.True(tt, ok)
+			assert.Equal(tt, &Envelope[string]{Data: "v", CreateAt: createTime.UnixMilli(), Version: 3}, env)
+			env, ok = getter.GetEnvelope(ctx, "default")
+			assert.True(tt, ok)
+			assert.True(tt, env.Default)
+			env, ok = getter.GetEnvelope(ctx, "tombstone")
+			assert.True(tt, ok)
+			assert.True(tt, env.Tombstone)
+			_, ok = getter.GetEnvelope(ctx, "missing")
+			assert.False(tt, ok)
+
+			envs := getter.MGetEnvelope(ctx, []string{"data", "default", "missing"})
+			assert.Len(tt, envs, 2)
+			assert.Equal(tt, "v", envs["data"].Data)
+			assert.True(tt, envs["default"].Default)
+		})
+	}
+
+	t.Run("redis_error", func(tt *testing.T) {
+		mr.SetError("unit_test")
+		defer mr.SetError("")
+		getter := caches["redis"].(EnvelopeGetter[string])
+		_, ok := getter.GetEnvelope(ctx, "data")
+		assert.False(tt, ok)
+		assert.Empty(tt, getter.MGetEnvelope(ctx, []string{"data"}))
+	})
+}
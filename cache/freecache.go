@@ -4,16 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/coocood/freecache"
 
+	"github.com/kakkk/cachex/internal/model"
 	"github.com/kakkk/cachex/internal/utils"
 )
 
 type FreeCache[T any] struct {
-	cache *freecache.Cache
-	ttl   time.Duration
+	cache  *freecache.Cache
+	ttl    time.Duration
+	enc    encoder[T]
+	leases leaseTable
+	locks  keyLock
 }
 
 // NewFreeCache returns a newly initialize FreeCache implement Cache by size and ttl
@@ -21,30 +27,68 @@ type FreeCache[T any] struct {
 // size: size in bytes, e.g. 100*1024*1024 is 100 MB
 //
 // ttl: cache expire ttl, if ttl set 0, cache will not expire
-func NewFreeCache[T any](size int, ttl time.Duration) *FreeCache[T] {
+//
+// opts: options, e.g. WithCodec
+func NewFreeCache[T any](size int, ttl time.Duration, opts ...Option) *FreeCache[T] {
 	return &FreeCache[T]{
 		cache: freecache.NewCache(size),
 		ttl:   ttl,
+		enc:   newEncoder[T](newOptions(opts)),
 	}
 }
 
-func (fc *FreeCache[T]) Get(_ context.Context, key string, expire time.Duration) (T, bool) {
+func (fc *FreeCache[T]) Get(ctx context.Context, key string, expire time.Duration) (T, bool) {
 	var zero T
+	env, ok := fc.GetEnvelope(ctx, key)
+	if !ok {
+		return zero, false
+	}
+	return env.Value(time.Now(), expire)
+}
+
+func (fc *FreeCache[T]) GetEnvelope(_ context.Context, key string) (*Envelope[T], bool) {
 	val, err := fc.cache.Get([]byte(key))
 	if err != nil {
-		return zero, false
+		return nil, false
 	}
-	data, err := utils.UnmarshalData[T](val)
+	env, err := fc.enc.unmarshalEnvelope(key, val)
+	return env, err == nil
+}
+
+// V2 返回解码失败时返回CorruptError的CacheV2实现
+func (fc *FreeCache[T]) V2() CacheV2[T] {
+	return &bytesCacheV2[T]{Cache: fc, enc: fc.enc, get: fc.getRaw}
+}
+
+// SchemaInfo 构造时通过WithSchema设置的schema
+func (fc *FreeCache[T]) SchemaInfo() SchemaInfo {
+	return fc.enc.schemaInfo()
+}
+
+// currentMeta 读取当前数据的元信息，不存在或无法解码时返回false
+func (fc *FreeCache[T]) currentMeta(key string) (*model.CacheMeta, bool) {
+	val, err := fc.cache.Get([]byte(key))
 	if err != nil {
-		return zero, false
+		return nil, false
 	}
-	if utils.IsExpired(data.CreateAt, time.Now(), expire) {
-		return zero, false
+	current, err := fc.enc.unmarshalMeta(val)
+	return current, err == nil
+}
+
+// getRaw 读取原始数据
+func (fc *FreeCache[T]) getRaw(key string) ([]byte, bool, error) {
+	val, err := fc.cache.Get([]byte(key))
+	if errors.Is(err, freecache.ErrNotFound) {
+		return nil, false, nil
 	}
-	if data.IsDefault() {
-		return zero, false
+	if err != nil {
+		return nil, false, err
 	}
-	return data.Data, true
+	return val, true, nil
+}
+
+func (fc *FreeCache[T]) MGetEnvelope(ctx context.Context, keys []string) map[string]*Envelope[T] {
+	return mGetEnvelope(ctx, keys, fc.GetEnvelope)
 }
 
 func (fc *FreeCache[T]) MGet(ctx context.Context, keys []string, expire time.Duration) map[string]T {
@@ -60,12 +104,9 @@ func (fc *FreeCache[T]) MGet(ctx context.Context, keys []string, expire time.Dur
 }
 
 func (fc *FreeCache[T]) Set(_ context.Context, key string, data T, createTime time.Time) error {
-	createAt := utils.ConvertTimestamp(createTime)
-	val, err := utils.MarshalData(data, createAt)
-	if err != nil {
-		return fmt.Errorf("marshal error: %v", err)
-	}
-	return fc.cache.Set([]byte(key), val, int(fc.ttl.Seconds()))
+	unlock := fc.locks.lock(key)
+	defer unlock()
+	return fc.set(key, data, utils.ConvertTimestamp(createTime), 0)
 }
 
 func (fc *FreeCache[T]) MSet(ctx context.Context, kvs map[string]T, createTime time.Time) error {
@@ -81,14 +122,19 @@ func (fc *FreeCache[T]) MSet(ctx context.Context, kvs map[string]T, createTime t
 	return nil
 }
 
+// SetDefault 写入空值，已存在更新的数据或宽限期内的墓碑时跳过
 func (fc *FreeCache[T]) SetDefault(_ context.Context, keys []string, createTime time.Time) error {
 	var errs []error
-	val := utils.NewDefaultDataWithMarshal[T](utils.ConvertTimestamp(createTime))
+	createAt := utils.ConvertTimestamp(createTime)
+	val := fc.enc.marshalDefault(createAt)
 	for _, key := range keys {
-		err := fc.cache.Set([]byte(key), val, int(fc.ttl.Seconds()))
-		if err != nil {
-			errs = append(errs, err)
+		unlock := fc.locks.lock(key)
+		if current, ok := fc.currentMeta(key); !ok || !skipDefault(current, createAt, utils.ConvertTimestamp(time.Now())) {
+			if err := fc.cache.Set([]byte(key), val, int(fc.ttl.Seconds())); err != nil {
+				errs = append(errs, err)
+			}
 		}
+		unlock()
 	}
 	if len(errs) > 0 {
 		return errors.Join(errs...)
@@ -96,18 +142,157 @@ func (fc *FreeCache[T]) SetDefault(_ context.Context, keys []string, createTime
 	return nil
 }
 
-func (fc *FreeCache[T]) Delete(_ context.Context, key string) error {
-	fc.cache.Del([]byte(key))
-	return nil
+func (fc *FreeCache[T]) Delete(ctx context.Context, key string) error {
+	return fc.MDelete(ctx, []string{key})
 }
 
 func (fc *FreeCache[T]) MDelete(_ context.Context, keys []string) error {
-	for _, key := range keys {
-		fc.cache.Del([]byte(key))
+	fc.leases.invalidate(keys, func() {
+		for _, key := range keys {
+			unlock := fc.locks.lock(key)
+			fc.cache.Del([]byte(key))
+			unlock()
+		}
+	})
+	return nil
+}
+
+func (fc *FreeCache[T]) AcquireLease(_ context.Context, key string, ttl time.Duration) (int64, bool, error) {
+	token, ok := fc.leases.acquire(key, ttl)
+	return token, ok, nil
+}
+
+// SetWithLease 消耗租约后在租约锁内按版本条件写入，与Delete、SetTombstone互斥
+func (fc *FreeCache[T]) SetWithLease(ctx context.Context, key string, data T, createTime time.Time, token int64, version int64) (bool, error) {
+	return fc.leases.consume(key, token, func() error {
+		return fc.SetWithVersion(ctx, key, data, createTime, version)
+	})
+}
+
+func (fc *FreeCache[T]) ReleaseLease(_ context.Context, key string, token int64) error {
+	fc.leases.release(key, token)
+	return nil
+}
+
+func (fc *FreeCache[T]) SetWithVersion(_ context.Context, key string, data T, createTime time.Time, version int64) error {
+	unlock := fc.locks.lock(key)
+	defer unlock()
+	createAt := utils.ConvertTimestamp(createTime)
+	if current, ok := fc.currentMeta(key); ok {
+		if err := checkWrite(current, createAt, version, utils.ConvertTimestamp(time.Now())); err != nil {
+			return newRejectedError(err, []string{key})
+		}
+	}
+	return fc.set(key, data, createAt, version)
+}
+
+func (fc *FreeCache[T]) MSetWithVersion(ctx context.Context, kvs map[string]T, versions map[string]int64, createTime time.Time) error {
+	return mSetWithVersion(kvs, versions, func(key string, data T, version int64) error {
+		return fc.SetWithVersion(ctx, key, data, createTime, version)
+	})
+}
+
+func (fc *FreeCache[T]) Update(_ context.Context, key string, fn UpdateFunc[T], createTime time.Time) (T, error) {
+	fc.leases.invalidate([]string{key}, func() {})
+	return update(&fc.locks, key, func() (*model.CacheData[T], bool) {
+		val, err := fc.cache.Get([]byte(key))
+		if err != nil {
+			return nil, false
+		}
+		current, err := fc.enc.unmarshal(key, val)
+		return current, err == nil
+	}, func(data T, version int64) error {
+		return fc.set(key, data, utils.ConvertTimestamp(createTime), version)
+	}, fn)
+}
+
+// set 编码并写入数据，需持有key锁
+func (fc *FreeCache[T]) set(key string, data T, createAt int64, version int64) error {
+	val, err := fc.enc.marshalData(key, data, createAt, version)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	return fc.cache.Set([]byte(key), val, int(fc.ttl.Seconds()))
+}
+
+func (fc *FreeCache[T]) SetTombstone(_ context.Context, keys []string, createTime time.Time, grace time.Duration) error {
+	var errs []error
+	createAt, expireAt := utils.ConvertTimestamp(createTime), tombstoneExpireAt(createTime, grace)
+	expireSeconds := int(math.Ceil(grace.Seconds()))
+	fc.leases.invalidate(keys, func() {
+		for _, key := range keys {
+			unlock := fc.locks.lock(key)
+			var version int64
+			if current, ok := fc.currentMeta(key); ok {
+				version = current.Version
+			}
+			err := fc.cache.Set([]byte(key), fc.enc.marshalTombstone(createAt, expireAt, version), expireSeconds)
+			unlock()
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// Close 清空缓存，FreeCache没有后台goroutine，清空后释放数据占用
+func (fc *FreeCache[T]) Close() error {
+	fc.cache.Clear()
+	return nil
+}
+
+func (fc *FreeCache[T]) TTL(_ context.Context, key string) (time.Duration, bool, error) {
+	ttl, err := fc.cache.TTL([]byte(key))
+	if errors.Is(err, freecache.ErrNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return time.Duration(ttl) * time.Second, true, nil
+}
+
+// Touch 重新设置过期时间，墓碑视为不存在且不延长
+func (fc *FreeCache[T]) Touch(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		ttl = fc.ttl
+	}
+	unlock := fc.locks.lock(key)
+	defer unlock()
+	if current, ok := fc.currentMeta(key); ok && current.Tombstone == 1 {
+		return false, nil
+	}
+	err := fc.cache.Touch([]byte(key), int(math.Ceil(ttl.Seconds())))
+	if errors.Is(err, freecache.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (fc *FreeCache[T]) Scan(_ context.Context, prefix string, fn func(key string) bool) error {
+	it := fc.cache.NewIterator()
+	for entry := it.Next(); entry != nil; entry = it.Next() {
+		if key := string(entry.Key); strings.HasPrefix(key, prefix) && !fn(key) {
+			break
+		}
 	}
 	return nil
 }
 
+func (fc *FreeCache[T]) Stats(_ context.Context) (Stats, error) {
+	return Stats{
+		Entries:     fc.cache.EntryCount(),
+		Hits:        fc.cache.HitCount(),
+		Misses:      fc.cache.MissCount(),
+		Evictions:   fc.cache.EvacuateCount(),
+		Compression: fc.enc.comp.stats(),
+	}, nil
+}
+
 func (fc *FreeCache[T]) Ping(_ context.Context) (string, error) {
 	if fc.cache != nil {
 		return "PONG", nil
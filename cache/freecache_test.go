@@ -2,6 +2,8 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
@@ -101,8 +103,8 @@ func TestFreeCache_Set(t *testing.T) {
 		err := fc.Set(ctx, "success", "success", now)
 		assert.Nil(tt, err)
 		val, _ := c.Get([]byte("success"))
-		want, _ := utils.MarshalData("success", now.UnixMilli())
-		assert.JSONEq(tt, string(want), string(val))
+		want, _ := fc.enc.marshalData("success", "success", now.UnixMilli(), 0)
+		assert.Equal(tt, string(want), string(val))
 	})
 
 	t.Run("free_cache_error", func(tt *testing.T) {
@@ -138,9 +140,9 @@ func TestFreeCache_MSet(t *testing.T) {
 		err := fc.MSet(ctx, kvs, now)
 		assert.Nil(tt, err)
 		for k, v := range kvs {
-			want, _ := utils.MarshalData(v, now.UnixMilli())
+			want, _ := fc.enc.marshalData(k, v, now.UnixMilli(), 0)
 			val, _ := c.Get([]byte(k))
-			assert.JSONEq(tt, string(want), string(val))
+			assert.Equal(tt, string(want), string(val))
 		}
 	})
 
@@ -170,13 +172,13 @@ func TestFreeCache_MSetDefault(t *testing.T) {
 	now := time.Now()
 	err := fc.SetDefault(ctx, []string{"default_1", "default_2"}, now)
 	assert.Nil(t, err)
-	want := utils.NewDefaultDataWithMarshal[string](utils.ConvertTimestamp(now))
+	want := fc.enc.marshalDefault(utils.ConvertTimestamp(now))
 	got, err := c.Get([]byte("default_1"))
 	assert.Nil(t, err)
-	assert.JSONEq(t, string(want), string(got))
+	assert.Equal(t, string(want), string(got))
 	got, err = c.Get([]byte("default_2"))
 	assert.Nil(t, err)
-	assert.JSONEq(t, string(want), string(got))
+	assert.Equal(t, string(want), string(got))
 }
 
 func TestFreeCache_Delete(t *testing.T) {
@@ -233,3 +235,223 @@ func TestFreeCache_Ping(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, "", pong)
 }
+
+func TestFreeCache_Lease(t *testing.T) {
+	ctx := context.Background()
+	expire := 20 * time.Minute
+	fc := NewFreeCache[string](1024*1024, 30*time.Minute)
+
+	t.Run("set with lease", func(tt *testing.T) {
+		token, ok, err := fc.AcquireLease(ctx, "set_with_lease", time.Second)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		_, ok, _ = fc.AcquireLease(ctx, "set_with_lease", time.Second)
+		assert.False(tt, ok)
+
+		set, err := fc.SetWithLease(ctx, "set_with_lease", "value", time.Now(), token, 0)
+		assert.Nil(tt, err)
+		assert.True(tt, set)
+		got, ok := fc.Get(ctx, "set_with_lease", expire)
+		assert.True(tt, ok)
+		assert.Equal(tt, "value", got)
+	})
+
+	t.Run("delete invalidate lease", func(tt *testing.T) {
+		token, _, _ := fc.AcquireLease(ctx, "delete_invalidate", time.Second)
+		_ = fc.MDelete(ctx, []string{"delete_invalidate"})
+		set, err := fc.SetWithLease(ctx, "delete_invalidate", "stale", time.Now(), token, 0)
+		assert.Nil(tt, err)
+		assert.False(tt, set)
+		_, ok := fc.Get(ctx, "delete_invalidate", expire)
+		assert.False(tt, ok)
+	})
+
+	t.Run("release lease", func(tt *testing.T) {
+		token, _, _ := fc.AcquireLease(ctx, "release_lease", time.Second)
+		err := fc.ReleaseLease(ctx, "release_lease", token)
+		assert.Nil(tt, err)
+		_, ok, _ := fc.AcquireLease(ctx, "release_lease", time.Second)
+		assert.True(tt, ok)
+	})
+}
+
+func TestFreeCache_SetWithVersion(t *testing.T) {
+	ctx := context.Background()
+	expire := 20 * time.Minute
+	fc := NewFreeCache[string](1024*1024, 30*time.Minute)
+
+	t.Run("set with version", func(tt *testing.T) {
+		err := fc.SetWithVersion(ctx, "set_with_version", "v2", time.Now(), 2)
+		assert.Nil(tt, err)
+		err = fc.SetWithVersion(ctx, "set_with_version", "v1", time.Now(), 1)
+		assert.True(tt, errors.Is(err, ErrStaleVersion))
+		got, _ := fc.Get(ctx, "set_with_version", expire)
+		assert.Equal(tt, "v2", got)
+		err = fc.SetWithVersion(ctx, "set_with_version", "v3", time.Now(), 3)
+		assert.Nil(tt, err)
+		got, _ = fc.Get(ctx, "set_with_version", expire)
+		assert.Equal(tt, "v3", got)
+	})
+
+	t.Run("mset with version", func(tt *testing.T) {
+		_ = fc.SetWithVersion(ctx, "mset_1", "v2", time.Now(), 2)
+		err := fc.MSetWithVersion(ctx,
+			map[string]string{"mset_1": "v1", "mset_2": "v1"},
+			map[string]int64{"mset_1": 1, "mset_2": 1},
+			time.Now(),
+		)
+		assert.True(tt, errors.Is(err, ErrStaleVersion))
+		got, _ := fc.Get(ctx, "mset_1", expire)
+		assert.Equal(tt, "v2", got)
+		got, _ = fc.Get(ctx, "mset_2", expire)
+		assert.Equal(tt, "v1", got)
+	})
+}
+
+func TestFreeCache_SetTombstone(t *testing.T) {
+	ctx := context.Background()
+	expire := 20 * time.Minute
+	fc := NewFreeCache[string](1024*1024, 30*time.Minute)
+
+	t.Run("tombstone read as miss", func(tt *testing.T) {
+		_ = fc.Set(ctx, "tombstone_miss", "value", time.Now())
+		err := fc.SetTombstone(ctx, []string{"tombstone_miss"}, time.Now(), time.Minute)
+		assert.Nil(tt, err)
+		got, ok := fc.Get(ctx, "tombstone_miss", expire)
+		assert.False(tt, ok)
+		assert.Equal(tt, "", got)
+		assert.Empty(tt, fc.MGet(ctx, []string{"tombstone_miss"}, expire))
+	})
+
+	t.Run("reject write started before tombstone", func(tt *testing.T) {
+		start := time.Now().Add(-time.Second)
+		err := fc.SetTombstone(ctx, []string{"tombstone_reject"}, time.Now(), time.Minute)
+		assert.Nil(tt, err)
+		err = fc.SetWithVersion(ctx, "tombstone_reject", "stale", start, 0)
+		assert.True(tt, errors.Is(err, ErrTombstoned))
+		err = fc.MSetWithVersion(ctx, map[string]string{"tombstone_reject": "stale"}, nil, start)
+		assert.True(tt, errors.Is(err, ErrTombstoned))
+		_, ok := fc.Get(ctx, "tombstone_reject", expire)
+		assert.False(tt, ok)
+
+		err = fc.SetWithVersion(ctx, "tombstone_reject", "fresh", time.Now().Add(time.Millisecond), 0)
+		assert.Nil(tt, err)
+		got, ok := fc.Get(ctx, "tombstone_reject", expire)
+		assert.True(tt, ok)
+		assert.Equal(tt, "fresh", got)
+	})
+
+	t.Run("set default keep tombstone", func(tt *testing.T) {
+		_ = fc.SetTombstone(ctx, []string{"tombstone_default"}, time.Now(), time.Minute)
+		err := fc.SetDefault(ctx, []string{"tombstone_default"}, time.Now().Add(time.Millisecond))
+		assert.Nil(tt, err)
+		env, ok := fc.GetEnvelope(ctx, "tombstone_default")
+		assert.True(tt, ok)
+		assert.True(tt, env.Tombstone)
+
+		_ = fc.Set(ctx, "newer_default", "value", time.Now())
+		err = fc.SetDefault(ctx, []string{"newer_default"}, time.Now().Add(-time.Second))
+		assert.Nil(tt, err)
+		got, ok := fc.Get(ctx, "newer_default", expire)
+		assert.True(tt, ok)
+		assert.Equal(tt, "value", got)
+	})
+
+	t.Run("tombstone invalidate lease", func(tt *testing.T) {
+		token, _, _ := fc.AcquireLease(ctx, "tombstone_lease", time.Second)
+		_ = fc.SetTombstone(ctx, []string{"tombstone_lease"}, time.Now(), time.Minute)
+		set, err := fc.SetWithLease(ctx, "tombstone_lease", "stale", time.Now(), token, 0)
+		assert.Nil(tt, err)
+		assert.False(tt, set)
+	})
+}
+
+func TestFreeCache_Update(t *testing.T) {
+	ctx := context.Background()
+	expire := 20 * time.Minute
+	fc := NewFreeCache[string](1024*1024, 30*time.Minute)
+
+	t.Run("update missing and existing", func(tt *testing.T) {
+		got, err := fc.Update(ctx, "update", func(old string, found bool) (string, error) {
+			assert.False(tt, found)
+			return "a", nil
+		}, time.Now())
+		assert.Nil(tt, err)
+		assert.Equal(tt, "a", got)
+		got, err = fc.Update(ctx, "update", func(old string, found bool) (string, error) {
+			assert.True(tt, found)
+			return old + "b", nil
+		}, time.Now())
+		assert.Nil(tt, err)
+		assert.Equal(tt, "ab", got)
+		got, _ = fc.Get(ctx, "update", expire)
+		assert.Equal(tt, "ab", got)
+	})
+
+	t.Run("fn error", func(tt *testing.T) {
+		_ = fc.Set(ctx, "update_error", "a", time.Now())
+		_, err := fc.Update(ctx, "update_error", func(old string, found bool) (string, error) {
+			return "b", errors.New("fn error")
+		}, time.Now())
+		assert.EqualError(tt, err, "fn error")
+		got, _ := fc.Get(ctx, "update_error", expire)
+		assert.Equal(tt, "a", got)
+	})
+
+	t.Run("reject during tombstone grace", func(tt *testing.T) {
+		_ = fc.SetTombstone(ctx, []string{"update_tombstone"}, time.Now(), time.Minute)
+		_, err := fc.Update(ctx, "update_tombstone", func(old string, found bool) (string, error) {
+			tt.Fatal("should not call fn")
+			return "a", nil
+		}, time.Now())
+		assert.True(tt, errors.Is(err, ErrTombstoned))
+	})
+
+	t.Run("keep version and invalidate lease", func(tt *testing.T) {
+		_ = fc.SetWithVersion(ctx, "update_version", "a", time.Now(), 5)
+		token, _, _ := fc.AcquireLease(ctx, "update_version", time.Second)
+		_, err := fc.Update(ctx, "update_version", func(old string, found bool) (string, error) {
+			return old + "b", nil
+		}, time.Now())
+		assert.Nil(tt, err)
+		err = fc.SetWithVersion(ctx, "update_version", "stale", time.Now(), 4)
+		assert.True(tt, errors.Is(err, ErrStaleVersion))
+		set, err := fc.SetWithLease(ctx, "update_version", "stale", time.Now(), token, 0)
+		assert.Nil(tt, err)
+		assert.False(tt, set)
+		got, _ := fc.Get(ctx, "update_version", expire)
+		assert.Equal(tt, "ab", got)
+	})
+
+	t.Run("concurrent", func(tt *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := fc.Update(ctx, "update_concurrent", func(old string, found bool) (string, error) {
+					return old + "x", nil
+				}, time.Now())
+				assert.Nil(tt, err)
+			}()
+		}
+		wg.Wait()
+		got, _ := fc.Get(ctx, "update_concurrent", expire)
+		assert.Equal(tt, 20, len(got))
+	})
+}
+
+func TestFreeCache_Close(t *testing.T) {
+	ctx := context.Background()
+	fc := NewFreeCache[string](1024*1024, 30*time.Minute)
+	_ = fc.Set(ctx, "k", "v", time.Now())
+	var c Cache[string] = fc
+	closer, ok := c.(Closer)
+	assert.True(t, ok)
+	assert.Nil(t, closer.Close())
+	_, ok = fc.Get(ctx, "k", time.Hour)
+	assert.False(t, ok)
+	stats, err := fc.Stats(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), stats.Entries)
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Leaser 租约，未命中时获取key的租约，Delete会使未完成的租约失效，
+// 只有租约仍然有效时回填写入才会生效，避免删除后旧数据被回填
+type Leaser[T any] interface {
+	// AcquireLease 获取租约，ok为false表示租约已被其他请求持有
+	AcquireLease(ctx context.Context, key string, ttl time.Duration) (token int64, ok bool, err error)
+	// SetWithLease 持有租约按版本条件写入，租约已失效时不写入并返回false；
+	// 与VersionedSetter一致，宽限期内的墓碑或更新版本拒绝写入，返回false及ErrTombstoned或ErrStaleVersion
+	SetWithLease(ctx context.Context, key string, data T, createTime time.Time, token int64, version int64) (bool, error)
+	// ReleaseLease 释放租约
+	ReleaseLease(ctx context.Context, key string, token int64) error
+}
+
+// leaseSweepThreshold 租约数量超过该值时清理过期租约
+const leaseSweepThreshold = 1024
+
+type lease struct {
+	token    int64
+	expireAt time.Time
+}
+
+// leaseTable 本地缓存租约表，零值可用
+type leaseTable struct {
+	mu        sync.Mutex
+	leases    map[string]lease
+	nextSweep int
+	now       func() time.Time // 当前时间，nil时使用time.Now
+}
+
+// clock 当前时间
+func (lt *leaseTable) clock() time.Time {
+	if lt.now != nil {
+		return lt.now()
+	}
+	return time.Now()
+}
+
+// acquire 获取租约
+func (lt *leaseTable) acquire(key string, ttl time.Duration) (int64, bool) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	now := lt.clock()
+	if lt.leases == nil {
+		lt.leases = make(map[string]lease)
+	}
+	if l, ok := lt.leases[key]; ok && now.Before(l.expireAt) {
+		return 0, false
+	}
+	lt.sweep(now)
+	token := newLeaseToken()
+	lt.leases[key] = lease{token: token, expireAt: now.Add(ttl)}
+	return token, true
+}
+
+// consume 租约有效时执行fn并消耗租约，fn与invalidate互斥
+func (lt *leaseTable) consume(key string, token int64, fn func() error) (bool, error) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	l, ok := lt.leases[key]
+	if !ok || l.token != token || !lt.clock().Before(l.expireAt) {
+		return false, nil
+	}
+	delete(lt.leases, key)
+	if err := fn(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// release 释放租约
+func (lt *leaseTable) release(key string, token int64) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if l, ok := lt.leases[key]; ok && l.token == token {
+		delete(lt.leases, key)
+	}
+}
+
+// invalidate 使租约失效并执行fn
+func (lt *leaseTable) invalidate(keys []string, fn func()) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	for _, key := range keys {
+		delete(lt.leases, key)
+	}
+	fn()
+}
+
+// sweep 清理过期租约
+func (lt *leaseTable) sweep(now time.Time) {
+	if len(lt.leases) < lt.nextSweep || len(lt.leases) < leaseSweepThreshold {
+		return
+	}
+	for key, l := range lt.leases {
+		if !now.Before(l.expireAt) {
+			delete(lt.leases, key)
+		}
+	}
+	lt.nextSweep = 2 * len(lt.leases)
+}
+
+// newLeaseToken 生成非0租约token
+func newLeaseToken() int64 {
+	for {
+		if token := rand.Int63(); token != 0 {
+			return token
+		}
+	}
+}
+
+// relatedKey 按hashTag规则生成与key处于同一hash slot的关联key：key包含hash tag时直接追加后缀，
+// 不含'}'时以整个key作为hash tag；包含'}'但无hash tag的key无法整体作为hash tag，
+// 使用与其slot相同的slotTag作为hash tag，Ring按hash tag分片时此类关联key可能位于其他节点
+func relatedKey(key string, suffix string) string {
+	if hashTag(key) != key {
+		return key + suffix
+	}
+	if !strings.Contains(key, "}") {
+		return "{" + key + "}" + suffix
+	}
+	return "{" + slotTag(keySlot(key)) + "}" + key + suffix
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaseTable(t *testing.T) {
+	t.Run("acquire", func(tt *testing.T) {
+		lt := &leaseTable{}
+		token, ok := lt.acquire("k", time.Minute)
+		assert.True(tt, ok)
+		assert.NotZero(tt, token)
+		_, ok = lt.acquire("k", time.Minute)
+		assert.False(tt, ok)
+	})
+
+	t.Run("acquire expired", func(tt *testing.T) {
+		now := time.Now()
+		lt := &leaseTable{now: func() time.Time { return now }}
+		token, ok := lt.acquire("k", time.Millisecond)
+		assert.True(tt, ok)
+		_, ok = lt.acquire("k", time.Minute)
+		assert.False(tt, ok)
+		now = now.Add(time.Millisecond)
+		ok, _ = lt.consume("k", token, func() error { return nil })
+		assert.False(tt, ok)
+		_, ok = lt.acquire("k", time.Minute)
+		assert.True(tt, ok)
+	})
+
+	t.Run("consume", func(tt *testing.T) {
+		lt := &leaseTable{}
+		token, _ := lt.acquire("k", time.Minute)
+		called := 0
+		fn := func() error {
+			called++
+			return nil
+		}
+		ok, err := lt.consume("k", token+1, fn)
+		assert.False(tt, ok)
+		assert.Nil(tt, err)
+		ok, err = lt.consume("k", token, fn)
+		assert.True(tt, ok)
+		assert.Nil(tt, err)
+		ok, err = lt.consume("k", token, fn)
+		assert.False(tt, ok)
+		assert.Nil(tt, err)
+		assert.Equal(tt, 1, called)
+	})
+
+	t.Run("consume error", func(tt *testing.T) {
+		lt := &leaseTable{}
+		token, _ := lt.acquire("k", time.Minute)
+		ok, err := lt.consume("k", token, func() error { return errors.New("unit_test") })
+		assert.False(tt, ok)
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("release", func(tt *testing.T) {
+		lt := &leaseTable{}
+		token, _ := lt.acquire("k", time.Minute)
+		lt.release("k", token+1)
+		_, ok := lt.acquire("k", time.Minute)
+		assert.False(tt, ok)
+		lt.release("k", token)
+		_, ok = lt.acquire("k", time.Minute)
+		assert.True(tt, ok)
+	})
+
+	t.Run("invalidate", func(tt *testing.T) {
+		lt := &leaseTable{}
+		token, _ := lt.acquire("k", time.Minute)
+		called := false
+		lt.invalidate([]string{"k"}, func() { called = true })
+		assert.True(tt, called)
+		ok, err := lt.consume("k", token, func() error { return nil })
+		assert.False(tt, ok)
+		assert.Nil(tt, err)
+	})
+
+	t.Run("sweep", func(tt *testing.T) {
+		now := time.Now()
+		lt := &leaseTable{now: func() time.Time { return now }}
+		for i := 0; i < leaseSweepThreshold; i++ {
+			lt.acquire(string(rune(i)), time.Millisecond)
+		}
+		now = now.Add(time.Millisecond)
+		lt.acquire("k", time.Minute)
+		assert.Equal(tt, 1, len(lt.leases))
+	})
+}
+
+func TestLeaser_versioned(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	caches := map[string]Cache[string]{
+		"lru":       NewLRUCache[string](10, time.Minute),
+		"freecache": NewFreeCache[string](1024*1024, time.Minute),
+		"bigcache":  NewBigCache[string](time.Minute),
+		"redis":     NewRedisCacheWithClient[string](client, time.Minute),
+	}
+	for name, c := range caches {
+		leaser, setter := c.(Leaser[string]), c.(VersionedSetter[string])
+		t.Run(name, func(tt *testing.T) {
+			// 回源期间写入更新版本，回填被拒绝
+			start := time.Now()
+			token, ok, err := leaser.AcquireLease(ctx, "version", time.Minute)
+			assert.Nil(tt, err)
+			assert.True(tt, ok)
+			assert.Nil(tt, setter.SetWithVersion(ctx, "version", "new", time.Now(), 2))
+			set, err := leaser.SetWithLease(ctx, "version", "old", start, token, 1)
+			assert.False(tt, set)
+			assert.ErrorIs(tt, err, ErrStaleVersion)
+			got, _ := c.Get(ctx, "version", time.Minute)
+			assert.Equal(tt, "new", got)
+
+			// 回源开始后删除写入墓碑，之后获取的租约回填被拒绝
+			start = time.Now().Add(-time.Second)
+			assert.Nil(tt, c.(Tombstoner).SetTombstone(ctx, []string{"tombstone"}, time.Now(), time.Minute))
+			token, ok, err = leaser.AcquireLease(ctx, "tombstone", time.Minute)
+			assert.Nil(tt, err)
+			assert.True(tt, ok)
+			set, err = leaser.SetWithLease(ctx, "tombstone", "old", start, token, 0)
+			assert.False(tt, set)
+			assert.ErrorIs(tt, err, ErrTombstoned)
+			_, ok = c.Get(ctx, "tombstone", time.Minute)
+			assert.False(tt, ok)
+
+			// 不存在墓碑及更新版本时写入版本
+			token, _, _ = leaser.AcquireLease(ctx, "fresh", time.Minute)
+			set, err = leaser.SetWithLease(ctx, "fresh", "v", time.Now(), token, 3)
+			assert.True(tt, set)
+			assert.Nil(tt, err)
+			assert.ErrorIs(tt, setter.SetWithVersion(ctx, "fresh", "old", time.Now(), 2), ErrStaleVersion)
+		})
+	}
+}
+
+func TestRelatedKey(t *testing.T) {
+	assert.Equal(t, "{k}:lease", relatedKey("k", ":lease"))
+	assert.Equal(t, "a{b}c:lease", relatedKey("a{b}c", ":lease"))
+	assert.Equal(t, "{a{b}:lease", relatedKey("a{b", ":lease"))
+	assert.Equal(t, "{"+slotTag(keySlot("a{}c"))+"}a{}c:lease", relatedKey("a{}c", ":lease"))
+
+	t.Run("same slot", func(tt *testing.T) {
+		for _, key := range []string{"k", "x}y", "a{}b", "{}a", "}", "{", "a{b", "a{b}c", "x{a}{b}", "{{a}}", "a}{b}"} {
+			for _, related := range []string{leaseKey(key), versionKey(key), tombstoneKey(key), lockKey(key), chunkPrefix(key) + "0"} {
+				assert.Equal(tt, keySlot(key), keySlot(related), "%v %v", key, related)
+				assert.True(tt, isRelatedKey(related) || isChunkKey(related), related)
+			}
+		}
+	})
+
+	t.Run("slot tag", func(tt *testing.T) {
+		for slot := 0; slot < clusterSlots; slot++ {
+			tag := slotTag(slot)
+			assert.NotContains(tt, tag, "{")
+			assert.NotContains(tt, tag, "}")
+			assert.Equal(tt, slot, keySlot(tag))
+		}
+	})
+}
@@ -0,0 +1,14 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Locker 分布式锁，用于多实例间回源互斥，锁只用于减少并发回源，不保证强一致
+type Locker interface {
+	// Lock 加锁，ok为false表示锁已被其他实例持有
+	Lock(ctx context.Context, key string, ttl time.Duration) (token int64, ok bool, err error)
+	// Unlock 解锁，只有token与持有者一致时才会释放
+	Unlock(ctx context.Context, key string, token int64) error
+}
@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/golang-lru/v2/expirable"
@@ -12,29 +13,39 @@ import (
 )
 
 type LRUCache[T any] struct {
-	cache *expirable.LRU[string, *model.CacheData[T]]
+	cache  *expirable.LRU[string, *model.CacheData[T]]
+	ttl    time.Duration
+	leases leaseTable
+	locks  keyLock
 }
 
 // NewLRUCache returns a newly initialize LRUCache implement Cache with ttl and size
 func NewLRUCache[T any](size int, ttl time.Duration) *LRUCache[T] {
 	return &LRUCache[T]{
 		cache: expirable.NewLRU[string, *model.CacheData[T]](size, nil, ttl),
+		ttl:   ttl,
 	}
 }
 
-func (lc *LRUCache[T]) Get(_ context.Context, key string, expire time.Duration) (T, bool) {
+func (lc *LRUCache[T]) Get(ctx context.Context, key string, expire time.Duration) (T, bool) {
 	var zero T
-	data, ok := lc.cache.Get(key)
+	env, ok := lc.GetEnvelope(ctx, key)
 	if !ok {
 		return zero, false
 	}
-	if utils.IsExpired(data.CreateAt, time.Now(), expire) {
-		return zero, false
-	}
-	if data.IsDefault() {
-		return zero, false
+	return env.Value(time.Now(), expire)
+}
+
+func (lc *LRUCache[T]) GetEnvelope(_ context.Context, key string) (*Envelope[T], bool) {
+	data, ok := lc.cache.Get(key)
+	if !ok {
+		return nil, false
 	}
-	return data.Data, true
+	return newEnvelope(data), true
+}
+
+func (lc *LRUCache[T]) MGetEnvelope(ctx context.Context, keys []string) map[string]*Envelope[T] {
+	return mGetEnvelope(ctx, keys, lc.GetEnvelope)
 }
 
 func (lc *LRUCache[T]) MGet(ctx context.Context, keys []string, expire time.Duration) map[string]T {
@@ -50,9 +61,9 @@ func (lc *LRUCache[T]) MGet(ctx context.Context, keys []string, expire time.Dura
 }
 
 func (lc *LRUCache[T]) Set(_ context.Context, key string, data T, createTime time.Time) error {
-	createAt := utils.ConvertTimestamp(createTime)
-	val := utils.NewData(data, createAt)
-	lc.cache.Add(key, val)
+	unlock := lc.locks.lock(key)
+	defer unlock()
+	lc.add(key, utils.NewData(data, utils.ConvertTimestamp(createTime)))
 	return nil
 }
 
@@ -63,16 +74,25 @@ func (lc *LRUCache[T]) MSet(ctx context.Context, kvs map[string]T, createTime ti
 	return nil
 }
 
-func (lc *LRUCache[T]) SetDefault(ctx context.Context, keys []string, createTime time.Time) error {
-	val := utils.NewDefaultData[T](utils.ConvertTimestamp(createTime))
+// SetDefault 写入空值，已存在更新的数据或宽限期内的墓碑时跳过
+func (lc *LRUCache[T]) SetDefault(_ context.Context, keys []string, createTime time.Time) error {
+	createAt := utils.ConvertTimestamp(createTime)
 	for _, key := range keys {
-		lc.cache.Add(key, val)
+		unlock := lc.locks.lock(key)
+		if current, ok := lc.cache.Peek(key); !ok || !skipDefault(current.Meta(), createAt, utils.ConvertTimestamp(time.Now())) {
+			lc.add(key, utils.NewDefaultData[T](createAt))
+		}
+		unlock()
 	}
 	return nil
 }
 
 func (lc *LRUCache[T]) Delete(_ context.Context, key string) error {
-	lc.cache.Remove(key)
+	lc.leases.invalidate([]string{key}, func() {
+		unlock := lc.locks.lock(key)
+		lc.cache.Remove(key)
+		unlock()
+	})
 	return nil
 }
 
@@ -83,6 +103,123 @@ func (lc *LRUCache[T]) MDelete(ctx context.Context, keys []string) error {
 	return nil
 }
 
+func (lc *LRUCache[T]) AcquireLease(_ context.Context, key string, ttl time.Duration) (int64, bool, error) {
+	token, ok := lc.leases.acquire(key, ttl)
+	return token, ok, nil
+}
+
+// SetWithLease 消耗租约后在租约锁内按版本条件写入，与Delete、SetTombstone互斥
+func (lc *LRUCache[T]) SetWithLease(ctx context.Context, key string, data T, createTime time.Time, token int64, version int64) (bool, error) {
+	return lc.leases.consume(key, token, func() error {
+		return lc.SetWithVersion(ctx, key, data, createTime, version)
+	})
+}
+
+func (lc *LRUCache[T]) ReleaseLease(_ context.Context, key string, token int64) error {
+	lc.leases.release(key, token)
+	return nil
+}
+
+func (lc *LRUCache[T]) SetWithVersion(_ context.Context, key string, data T, createTime time.Time, version int64) error {
+	unlock := lc.locks.lock(key)
+	defer unlock()
+	createAt := utils.ConvertTimestamp(createTime)
+	if current, ok := lc.cache.Peek(key); ok {
+		if err := checkWrite(current.Meta(), createAt, version, utils.ConvertTimestamp(time.Now())); err != nil {
+			return newRejectedError(err, []string{key})
+		}
+	}
+	lc.add(key, utils.NewVersionedData(data, createAt, version))
+	return nil
+}
+
+func (lc *LRUCache[T]) MSetWithVersion(ctx context.Context, kvs map[string]T, versions map[string]int64, createTime time.Time) error {
+	return mSetWithVersion(kvs, versions, func(key string, data T, version int64) error {
+		return lc.SetWithVersion(ctx, key, data, createTime, version)
+	})
+}
+
+func (lc *LRUCache[T]) Update(_ context.Context, key string, fn UpdateFunc[T], createTime time.Time) (T, error) {
+	lc.leases.invalidate([]string{key}, func() {})
+	return update(&lc.locks, key, func() (*model.CacheData[T], bool) {
+		return lc.cache.Peek(key)
+	}, func(data T, version int64) error {
+		lc.add(key, utils.NewVersionedData(data, utils.ConvertTimestamp(createTime), version))
+		return nil
+	}, fn)
+}
+
+func (lc *LRUCache[T]) SetTombstone(_ context.Context, keys []string, createTime time.Time, grace time.Duration) error {
+	createAt, expireAt := utils.ConvertTimestamp(createTime), tombstoneExpireAt(createTime, grace)
+	lc.leases.invalidate(keys, func() {
+		for _, key := range keys {
+			unlock := lc.locks.lock(key)
+			val := utils.NewTombstoneData[T](createAt, expireAt)
+			if current, ok := lc.cache.Peek(key); ok {
+				val.Version = current.Version
+			}
+			lc.cache.Add(key, val)
+			unlock()
+		}
+	})
+	return nil
+}
+
+// Close 清空缓存；golang-lru v2的expirable LRU未提供停止接口，ttl大于0时其过期清理goroutine在Close后仍继续运行
+func (lc *LRUCache[T]) Close() error {
+	lc.cache.Purge()
+	return nil
+}
+
+func (lc *LRUCache[T]) TTL(_ context.Context, key string) (time.Duration, bool, error) {
+	data, ok := lc.cache.Peek(key)
+	if !ok {
+		return 0, false, nil
+	}
+	if data.ExpireAt == 0 {
+		return 0, true, nil
+	}
+	ttl := time.Duration(data.ExpireAt-time.Now().UnixMilli()) * time.Millisecond
+	if ttl <= 0 {
+		return 0, false, nil
+	}
+	return ttl, true, nil
+}
+
+// Touch LRU过期时间全局固定，重置为缓存ttl，墓碑视为不存在
+func (lc *LRUCache[T]) Touch(_ context.Context, key string, _ time.Duration) (bool, error) {
+	unlock := lc.locks.lock(key)
+	defer unlock()
+	data, ok := lc.cache.Peek(key)
+	if !ok || data.IsTombstone() {
+		return false, nil
+	}
+	touched := *data
+	lc.add(key, &touched)
+	return true, nil
+}
+
+func (lc *LRUCache[T]) Scan(_ context.Context, prefix string, fn func(key string) bool) error {
+	for _, key := range lc.cache.Keys() {
+		if strings.HasPrefix(key, prefix) && !fn(key) {
+			break
+		}
+	}
+	return nil
+}
+
+func (lc *LRUCache[T]) Stats(_ context.Context) (Stats, error) {
+	return Stats{Entries: int64(lc.cache.Len())}, nil
+}
+
+// add 写入数据并记录过期时间，墓碑保留宽限期截止时间，需持有key锁
+func (lc *LRUCache[T]) add(key string, data *model.CacheData[T]) {
+	if !data.IsTombstone() && lc.ttl > 0 {
+		data.ExpireAt = time.Now().Add(lc.ttl).UnixMilli()
+	}
+	lc.cache.Add(key, data)
+}
+
 func (lc *LRUCache[T]) Ping(_ context.Context) (string, error) {
 	if lc.cache != nil {
 		return "PONG", nil
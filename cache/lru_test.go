@@ -2,6 +2,8 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
@@ -199,3 +201,208 @@ func TestLRUCache_Ping(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, "", pong)
 }
+
+func TestLRUCache_Lease(t *testing.T) {
+	ctx := context.Background()
+	expire := 20 * time.Minute
+	lc := NewLRUCache[string](10, 30*time.Minute)
+
+	t.Run("set with lease", func(tt *testing.T) {
+		token, ok, err := lc.AcquireLease(ctx, "set_with_lease", time.Second)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		_, ok, _ = lc.AcquireLease(ctx, "set_with_lease", time.Second)
+		assert.False(tt, ok)
+
+		set, err := lc.SetWithLease(ctx, "set_with_lease", "value", time.Now(), token, 0)
+		assert.Nil(tt, err)
+		assert.True(tt, set)
+		got, ok := lc.Get(ctx, "set_with_lease", expire)
+		assert.True(tt, ok)
+		assert.Equal(tt, "value", got)
+	})
+
+	t.Run("delete invalidate lease", func(tt *testing.T) {
+		token, _, _ := lc.AcquireLease(ctx, "delete_invalidate", time.Second)
+		_ = lc.Delete(ctx, "delete_invalidate")
+		set, err := lc.SetWithLease(ctx, "delete_invalidate", "stale", time.Now(), token, 0)
+		assert.Nil(tt, err)
+		assert.False(tt, set)
+		_, ok := lc.Get(ctx, "delete_invalidate", expire)
+		assert.False(tt, ok)
+	})
+
+	t.Run("release lease", func(tt *testing.T) {
+		token, _, _ := lc.AcquireLease(ctx, "release_lease", time.Second)
+		err := lc.ReleaseLease(ctx, "release_lease", token)
+		assert.Nil(tt, err)
+		_, ok, _ := lc.AcquireLease(ctx, "release_lease", time.Second)
+		assert.True(tt, ok)
+	})
+}
+
+func TestLRUCache_SetWithVersion(t *testing.T) {
+	ctx := context.Background()
+	expire := 20 * time.Minute
+	lc := NewLRUCache[string](10, 30*time.Minute)
+
+	t.Run("set with version", func(tt *testing.T) {
+		err := lc.SetWithVersion(ctx, "set_with_version", "v2", time.Now(), 2)
+		assert.Nil(tt, err)
+		err = lc.SetWithVersion(ctx, "set_with_version", "v1", time.Now(), 1)
+		assert.True(tt, errors.Is(err, ErrStaleVersion))
+		got, _ := lc.Get(ctx, "set_with_version", expire)
+		assert.Equal(tt, "v2", got)
+		err = lc.SetWithVersion(ctx, "set_with_version", "v3", time.Now(), 3)
+		assert.Nil(tt, err)
+		got, _ = lc.Get(ctx, "set_with_version", expire)
+		assert.Equal(tt, "v3", got)
+	})
+
+	t.Run("mset with version", func(tt *testing.T) {
+		_ = lc.SetWithVersion(ctx, "mset_1", "v2", time.Now(), 2)
+		err := lc.MSetWithVersion(ctx,
+			map[string]string{"mset_1": "v1", "mset_2": "v1"},
+			map[string]int64{"mset_1": 1, "mset_2": 1},
+			time.Now(),
+		)
+		assert.True(tt, errors.Is(err, ErrStaleVersion))
+		got, _ := lc.Get(ctx, "mset_1", expire)
+		assert.Equal(tt, "v2", got)
+		got, _ = lc.Get(ctx, "mset_2", expire)
+		assert.Equal(tt, "v1", got)
+	})
+}
+
+func TestLRUCache_SetTombstone(t *testing.T) {
+	ctx := context.Background()
+	expire := 20 * time.Minute
+	lc := NewLRUCache[string](10, 30*time.Minute)
+
+	t.Run("tombstone read as miss", func(tt *testing.T) {
+		_ = lc.Set(ctx, "tombstone_miss", "value", time.Now())
+		err := lc.SetTombstone(ctx, []string{"tombstone_miss"}, time.Now(), time.Minute)
+		assert.Nil(tt, err)
+		got, ok := lc.Get(ctx, "tombstone_miss", expire)
+		assert.False(tt, ok)
+		assert.Equal(tt, "", got)
+		assert.Empty(tt, lc.MGet(ctx, []string{"tombstone_miss"}, expire))
+	})
+
+	t.Run("reject write started before tombstone", func(tt *testing.T) {
+		start := time.Now().Add(-time.Second)
+		err := lc.SetTombstone(ctx, []string{"tombstone_reject"}, time.Now(), time.Minute)
+		assert.Nil(tt, err)
+		err = lc.SetWithVersion(ctx, "tombstone_reject", "stale", start, 0)
+		assert.True(tt, errors.Is(err, ErrTombstoned))
+		err = lc.MSetWithVersion(ctx, map[string]string{"tombstone_reject": "stale"}, nil, start)
+		assert.True(tt, errors.Is(err, ErrTombstoned))
+		_, ok := lc.Get(ctx, "tombstone_reject", expire)
+		assert.False(tt, ok)
+
+		err = lc.SetWithVersion(ctx, "tombstone_reject", "fresh", time.Now().Add(time.Millisecond), 0)
+		assert.Nil(tt, err)
+		got, ok := lc.Get(ctx, "tombstone_reject", expire)
+		assert.True(tt, ok)
+		assert.Equal(tt, "fresh", got)
+	})
+
+	t.Run("set default keep tombstone", func(tt *testing.T) {
+		_ = lc.SetTombstone(ctx, []string{"tombstone_default"}, time.Now(), time.Minute)
+		err := lc.SetDefault(ctx, []string{"tombstone_default"}, time.Now().Add(time.Millisecond))
+		assert.Nil(tt, err)
+		env, ok := lc.GetEnvelope(ctx, "tombstone_default")
+		assert.True(tt, ok)
+		assert.True(tt, env.Tombstone)
+
+		_ = lc.Set(ctx, "newer_default", "value", time.Now())
+		err = lc.SetDefault(ctx, []string{"newer_default"}, time.Now().Add(-time.Second))
+		assert.Nil(tt, err)
+		got, ok := lc.Get(ctx, "newer_default", expire)
+		assert.True(tt, ok)
+		assert.Equal(tt, "value", got)
+	})
+
+	t.Run("tombstone invalidate lease", func(tt *testing.T) {
+		token, _, _ := lc.AcquireLease(ctx, "tombstone_lease", time.Second)
+		_ = lc.SetTombstone(ctx, []string{"tombstone_lease"}, time.Now(), time.Minute)
+		set, err := lc.SetWithLease(ctx, "tombstone_lease", "stale", time.Now(), token, 0)
+		assert.Nil(tt, err)
+		assert.False(tt, set)
+	})
+}
+
+func TestLRUCache_Update(t *testing.T) {
+	ctx := context.Background()
+	expire := 20 * time.Minute
+	lc := NewLRUCache[string](10, 30*time.Minute)
+
+	t.Run("update missing and existing", func(tt *testing.T) {
+		got, err := lc.Update(ctx, "update", func(old string, found bool) (string, error) {
+			assert.False(tt, found)
+			return "a", nil
+		}, time.Now())
+		assert.Nil(tt, err)
+		assert.Equal(tt, "a", got)
+		got, err = lc.Update(ctx, "update", func(old string, found bool) (string, error) {
+			assert.True(tt, found)
+			return old + "b", nil
+		}, time.Now())
+		assert.Nil(tt, err)
+		assert.Equal(tt, "ab", got)
+		got, _ = lc.Get(ctx, "update", expire)
+		assert.Equal(tt, "ab", got)
+	})
+
+	t.Run("fn error", func(tt *testing.T) {
+		_ = lc.Set(ctx, "update_error", "a", time.Now())
+		_, err := lc.Update(ctx, "update_error", func(old string, found bool) (string, error) {
+			return "b", errors.New("fn error")
+		}, time.Now())
+		assert.EqualError(tt, err, "fn error")
+		got, _ := lc.Get(ctx, "update_error", expire)
+		assert.Equal(tt, "a", got)
+	})
+
+	t.Run("reject during tombstone grace", func(tt *testing.T) {
+		_ = lc.SetTombstone(ctx, []string{"update_tombstone"}, time.Now(), time.Minute)
+		_, err := lc.Update(ctx, "update_tombstone", func(old string, found bool) (string, error) {
+			tt.Fatal("should not call fn")
+			return "a", nil
+		}, time.Now())
+		assert.True(tt, errors.Is(err, ErrTombstoned))
+	})
+
+	t.Run("keep version and invalidate lease", func(tt *testing.T) {
+		_ = lc.SetWithVersion(ctx, "update_version", "a", time.Now(), 5)
+		token, _, _ := lc.AcquireLease(ctx, "update_version", time.Second)
+		_, err := lc.Update(ctx, "update_version", func(old string, found bool) (string, error) {
+			return old + "b", nil
+		}, time.Now())
+		assert.Nil(tt, err)
+		err = lc.SetWithVersion(ctx, "update_version", "stale", time.Now(), 4)
+		assert.True(tt, errors.Is(err, ErrStaleVersion))
+		set, err := lc.SetWithLease(ctx, "update_version", "stale", time.Now(), token, 0)
+		assert.Nil(tt, err)
+		assert.False(tt, set)
+		got, _ := lc.Get(ctx, "update_version", expire)
+		assert.Equal(tt, "ab", got)
+	})
+
+	t.Run("concurrent", func(tt *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := lc.Update(ctx, "update_concurrent", func(old string, found bool) (string, error) {
+					return old + "x", nil
+				}, time.Now())
+				assert.Nil(tt, err)
+			}()
+		}
+		wg.Wait()
+		got, _ := lc.Get(ctx, "update_concurrent", expire)
+		assert.Equal(tt, 20, len(got))
+	})
+}
@@ -0,0 +1,420 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+
+	"github.com/kakkk/cachex/internal/model"
+	"github.com/kakkk/cachex/internal/utils"
+)
+
+const (
+	// memcachedCASRetries CAS冲突时的最大重试次数
+	memcachedCASRetries = 10
+	// memcachedMaxRelative memcached相对过期时间上限，超过时按unix时间戳设置
+	memcachedMaxRelative = 30 * 24 * time.Hour
+)
+
+// errSkipWrite 当前数据更新，跳过写入
+var errSkipWrite = errors.New("skip write")
+
+// MemcachedCache 使用memcached保存数据，key需符合memcached限制：不超过250字节且不含空白及控制字符，
+// 单个value受服务端item大小限制（默认1MB）；SetDefault及条件写入基于CAS，不覆盖并发写入的更新数据
+type MemcachedCache[T any] struct {
+	client   *memcache.Client
+	ttl      time.Duration
+	owned    bool                    // client由MemcachedCache创建，Close时关闭
+	selector memcache.ServerSelector // key的节点分布，用于按节点并行批量操作，nil为未知
+	enc      encoder[T]
+}
+
+// NewMemcachedCache returns a newly initialize MemcachedCache implement Cache by servers and ttl,
+// keys are distributed across servers by consistent hashing
+//
+// servers: memcached server addresses, host:port or unix socket path
+// ttl: memcached expire ttl, if ttl set 0, cache will not expire
+// opts: options, e.g. WithCodec
+func NewMemcachedCache[T any](servers []string, ttl time.Duration, opts ...Option) (*MemcachedCache[T], error) {
+	ring, err := newHashRing(servers)
+	if err != nil {
+		return nil, err
+	}
+	mc := NewMemcachedCacheWithClient[T](memcache.NewFromSelector(ring), ttl, opts...)
+	if mc.enc.schemaErr != nil {
+		return nil, mc.enc.schemaErr
+	}
+	mc.owned, mc.selector = true, ring
+	return mc, nil
+}
+
+// NewMemcachedCacheWithClient returns a newly initialize MemcachedCache implement Cache by client and ttl,
+// the server of each key is unknown, so batch operations run serially and a failed MGet reports all keys
+//
+// client: memcached client, need github.com/bradfitz/gomemcache/memcache *memcache.Client
+// ttl: memcached expire ttl, if ttl set 0, cache will not expire
+// opts: options, e.g. WithCodec
+func NewMemcachedCacheWithClient[T any](client *memcache.Client, ttl time.Duration, opts ...Option) *MemcachedCache[T] {
+	return &MemcachedCache[T]{
+		client: client,
+		ttl:    ttl,
+		enc:    newEncoder[T](newOptions(opts)),
+	}
+}
+
+func (mc *MemcachedCache[T]) Get(ctx context.Context, key string, expire time.Duration) (T, bool) {
+	var zero T
+	env, found, err := mc.V2().Get(ctx, key, expire)
+	if err != nil || !found {
+		return zero, false
+	}
+	return env.Value(time.Now(), expire)
+}
+
+func (mc *MemcachedCache[T]) MGet(ctx context.Context, keys []string, expire time.Duration) map[string]T {
+	now := time.Now()
+	envs, _ := mc.V2().MGet(ctx, keys, expire)
+	result := make(map[string]T, len(envs))
+	for key, env := range envs {
+		if data, ok := env.Value(now, expire); ok {
+			result[key] = data
+		}
+	}
+	return result
+}
+
+// V2 返回区分未命中与memcached错误的CacheV2实现
+func (mc *MemcachedCache[T]) V2() CacheV2[T] {
+	return &memcachedCacheV2[T]{MemcachedCache: mc}
+}
+
+// SchemaInfo 构造时通过WithSchema设置的schema
+func (mc *MemcachedCache[T]) SchemaInfo() SchemaInfo {
+	return mc.enc.schemaInfo()
+}
+
+// Set 基于CAS写入，已存在更高schema版本的数据时不写入，返回ErrSchemaNewer
+func (mc *MemcachedCache[T]) Set(_ context.Context, key string, data T, createTime time.Time) error {
+	val, err := mc.enc.marshalData(key, data, utils.ConvertTimestamp(createTime), 0)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	err = mc.casWrite(key, val, memcachedExpiration(mc.ttl), func(current *model.CacheMeta) error {
+		return checkSchema(current, mc.enc.schema.Version)
+	})
+	if errors.Is(err, ErrSchemaNewer) {
+		return newRejectedError(ErrSchemaNewer, []string{key})
+	}
+	return err
+}
+
+// MSet 按节点并行逐个写入，部分key失败时返回BatchError，其他key正常写入，已存在更高schema版本数据的keys汇总为ErrSchemaNewer
+func (mc *MemcachedCache[T]) MSet(ctx context.Context, kvs map[string]T, createTime time.Time) error {
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	var (
+		mu       sync.Mutex
+		rejected []string
+	)
+	err := mc.mEach(keys, func(key string) error {
+		err := mc.Set(ctx, key, kvs[key], createTime)
+		if errors.Is(err, ErrSchemaNewer) {
+			mu.Lock()
+			rejected = append(rejected, key)
+			mu.Unlock()
+			return nil
+		}
+		return err
+	})
+	return errors.Join(err, newRejectedError(ErrSchemaNewer, rejected))
+}
+
+// SetDefault 按节点并行基于CAS写入空值，已存在更新的数据或宽限期内的墓碑时跳过
+func (mc *MemcachedCache[T]) SetDefault(_ context.Context, keys []string, createTime time.Time) error {
+	createAt := utils.ConvertTimestamp(createTime)
+	val := mc.enc.marshalDefault(createAt)
+	return mc.mEach(keys, func(key string) error {
+		err := mc.casWrite(key, val, memcachedExpiration(mc.ttl), func(current *model.CacheMeta) error {
+			if skipDefault(current, createAt, utils.ConvertTimestamp(time.Now())) {
+				return errSkipWrite
+			}
+			return nil
+		})
+		if errors.Is(err, errSkipWrite) {
+			return nil
+		}
+		return err
+	})
+}
+
+// SetWithVersion 基于CAS的条件写入，CAS冲突时重新读取并检查
+func (mc *MemcachedCache[T]) SetWithVersion(_ context.Context, key string, data T, createTime time.Time, version int64) error {
+	createAt := utils.ConvertTimestamp(createTime)
+	val, err := mc.enc.marshalData(key, data, createAt, version)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	err = mc.casWrite(key, val, memcachedExpiration(mc.ttl), func(current *model.CacheMeta) error {
+		if err := checkWrite(current, createAt, version, utils.ConvertTimestamp(time.Now())); err != nil {
+			return err
+		}
+		return checkSchema(current, mc.enc.schema.Version)
+	})
+	if errors.Is(err, ErrStaleVersion) || errors.Is(err, ErrTombstoned) || errors.Is(err, ErrSchemaNewer) {
+		return newRejectedError(err, []string{key})
+	}
+	return err
+}
+
+func (mc *MemcachedCache[T]) MSetWithVersion(ctx context.Context, kvs map[string]T, versions map[string]int64, createTime time.Time) error {
+	return mSetWithVersion(kvs, versions, func(key string, data T, version int64) error {
+		return mc.SetWithVersion(ctx, key, data, createTime, version)
+	})
+}
+
+// SetTombstone 按节点并行基于CAS写入墓碑并保留当前版本，部分key失败时返回BatchError
+func (mc *MemcachedCache[T]) SetTombstone(_ context.Context, keys []string, createTime time.Time, grace time.Duration) error {
+	createAt, expireAt := utils.ConvertTimestamp(createTime), tombstoneExpireAt(createTime, grace)
+	expiration := memcachedExpiration(grace)
+	return mc.mEach(keys, func(key string) error {
+		return mc.casUpdate(key, expiration, func(current *model.CacheMeta) ([]byte, error) {
+			var version int64
+			if current != nil {
+				version = current.Version
+			}
+			return mc.enc.marshalTombstone(createAt, expireAt, version), nil
+		})
+	})
+}
+
+func (mc *MemcachedCache[T]) Delete(_ context.Context, key string) error {
+	if err := mc.client.Delete(key); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		return err
+	}
+	return nil
+}
+
+// MDelete 按节点并行逐个删除，部分key失败时返回BatchError，其他key正常删除
+func (mc *MemcachedCache[T]) MDelete(ctx context.Context, keys []string) error {
+	return mc.mEach(keys, func(key string) error {
+		return mc.Delete(ctx, key)
+	})
+}
+
+// Touch 重新设置过期时间，墓碑视为不存在且不延长；读取与延长之间被并发写入的墓碑仍会被延长
+func (mc *MemcachedCache[T]) Touch(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		ttl = mc.ttl
+	}
+	item, err := mc.client.Get(key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if current, err := mc.enc.unmarshalMeta(item.Value); err == nil && current.Tombstone == 1 {
+		return false, nil
+	}
+	err = mc.client.Touch(key, memcachedExpiration(ttl))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (mc *MemcachedCache[T]) Ping(_ context.Context) (string, error) {
+	if mc.client == nil {
+		return "", errors.New("memcached client not set")
+	}
+	if err := mc.client.Ping(); err != nil {
+		return "", err
+	}
+	return "PONG", nil
+}
+
+// Close 关闭由NewMemcachedCache创建的client的空闲连接，调用方传入的client由调用方关闭
+func (mc *MemcachedCache[T]) Close() error {
+	if !mc.owned {
+		return nil
+	}
+	return mc.client.Close()
+}
+
+// casWrite 读取当前数据，check通过后以CAS写入，key不存在时使用add，冲突时重试；当前数据无法解码时直接覆盖
+func (mc *MemcachedCache[T]) casWrite(key string, val []byte, expiration int32, check func(current *model.CacheMeta) error) error {
+	return mc.casUpdate(key, expiration, func(current *model.CacheMeta) ([]byte, error) {
+		if current != nil {
+			if err := check(current); err != nil {
+				return nil, err
+			}
+		}
+		return val, nil
+	})
+}
+
+// casUpdate 读取当前数据，按当前数据生成写入值后以CAS写入，key不存在或当前数据无法解码时current为nil，冲突时重试
+func (mc *MemcachedCache[T]) casUpdate(key string, expiration int32, build func(current *model.CacheMeta) ([]byte, error)) error {
+	for i := 0; i < memcachedCASRetries; i++ {
+		item, err := mc.client.Get(key)
+		switch {
+		case errors.Is(err, memcache.ErrCacheMiss):
+			val, buildErr := build(nil)
+			if buildErr != nil {
+				return buildErr
+			}
+			err = mc.client.Add(&memcache.Item{Key: key, Value: val, Expiration: expiration})
+		case err != nil:
+			return err
+		default:
+			current, decodeErr := mc.enc.unmarshalMeta(item.Value)
+			if decodeErr != nil {
+				current = nil
+			}
+			val, buildErr := build(current)
+			if buildErr != nil {
+				return buildErr
+			}
+			item.Value, item.Expiration = val, expiration
+			err = mc.client.CompareAndSwap(item)
+		}
+		if !isCASConflict(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: retried %v times", memcache.ErrCASConflict, memcachedCASRetries)
+}
+
+// isCASConflict add或cas期间key被其他写入修改、写入或删除
+func isCASConflict(err error) bool {
+	return errors.Is(err, memcache.ErrCASConflict) || errors.Is(err, memcache.ErrNotStored) || errors.Is(err, memcache.ErrCacheMiss)
+}
+
+// memcachedExpiration 转换为memcached过期时间，不足1秒按1秒，超过30天时使用unix时间戳
+func memcachedExpiration(ttl time.Duration) int32 {
+	if ttl <= 0 {
+		return 0
+	}
+	if ttl > memcachedMaxRelative {
+		return int32(time.Now().Add(ttl).Unix())
+	}
+	return int32(math.Ceil(ttl.Seconds()))
+}
+
+// groupByServer 按节点分组key，节点分布未知时为一组，选择节点失败的key为一组
+func (mc *MemcachedCache[T]) groupByServer(keys []string) [][]string {
+	if mc.selector == nil {
+		return [][]string{keys}
+	}
+	servers := make(map[string][]string)
+	for _, key := range keys {
+		var server string
+		if addr, err := mc.selector.PickServer(key); err == nil {
+			server = addr.String()
+		}
+		servers[server] = append(servers[server], key)
+	}
+	groups := make([][]string, 0, len(servers))
+	for _, group := range servers {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// mEach 按节点并行处理key，同一节点内逐个处理，汇总失败的key为BatchError
+func (mc *MemcachedCache[T]) mEach(keys []string, fn func(key string) error) error {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+		errs   []error
+	)
+	for _, group := range mc.groupByServer(keys) {
+		wg.Add(1)
+		go func(group []string) {
+			defer wg.Done()
+			for _, key := range group {
+				if err := fn(key); err != nil {
+					mu.Lock()
+					failed = append(failed, key)
+					errs = append(errs, fmt.Errorf("%v: %w", key, err))
+					mu.Unlock()
+				}
+			}
+		}(group)
+	}
+	wg.Wait()
+	if len(failed) == 0 {
+		return nil
+	}
+	return &BatchError{Keys: failed, Err: errors.Join(errs...)}
+}
+
+// memcachedCacheV2 MemcachedCache的CacheV2实现，ErrCacheMiss视为未命中，解码失败返回CorruptError，其他错误返回
+type memcachedCacheV2[T any] struct {
+	*MemcachedCache[T]
+}
+
+func (m *memcachedCacheV2[T]) Get(_ context.Context, key string, expire time.Duration) (*Envelope[T], bool, error) {
+	item, err := m.client.Get(key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	env, corrupt := decodeEntry(m.enc, key, item.Value, time.Now(), expire, nil)
+	return env, env != nil, corrupt.errorOrNil()
+}
+
+// MGet 按节点并发读取，部分节点失败时返回BatchError及其他节点的数据，BatchError.Keys为失败节点上的key
+func (m *memcachedCacheV2[T]) MGet(_ context.Context, keys []string, expire time.Duration) (map[string]*Envelope[T], error) {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+		errs   []error
+	)
+	items := make(map[string]*memcache.Item, len(keys))
+	for _, group := range m.groupByServer(keys) {
+		wg.Add(1)
+		go func(group []string) {
+			defer wg.Done()
+			got, err := m.client.GetMulti(group)
+			mu.Lock()
+			defer mu.Unlock()
+			for key, item := range got {
+				items[key] = item
+			}
+			if err != nil {
+				failed = append(failed, group...)
+				errs = append(errs, err)
+			}
+		}(group)
+	}
+	wg.Wait()
+	var err error
+	if len(failed) != 0 {
+		err = &BatchError{Keys: failed, Err: errors.Join(errs...)}
+	}
+	now := time.Now()
+	result := make(map[string]*Envelope[T], len(items))
+	var corrupt *CorruptError
+	for key, item := range items {
+		var env *Envelope[T]
+		if env, corrupt = decodeEntry(m.enc, key, item.Value, now, expire, corrupt); env != nil {
+			result[key] = env
+		}
+	}
+	if err == nil {
+		return result, corrupt.errorOrNil()
+	}
+	return result, errors.Join(err, corrupt.errorOrNil())
+}
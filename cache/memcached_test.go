@@ -0,0 +1,407 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMemcached 进程内的memcached文本协议服务端
+type fakeMemcached struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	items map[string]*fakeItem
+	cas   uint64
+	down  atomic.Bool      // 为true时收到命令直接断开连接
+	onCAS func(key string) // 处理cas命令前调用，用于模拟并发写入
+}
+
+type fakeItem struct {
+	value   []byte
+	flags   uint32
+	exptime int32
+	cas     uint64
+}
+
+func newFakeMemcached(t *testing.T) *fakeMemcached {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeMemcached{ln: ln, items: make(map[string]*fakeItem)}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeMemcached) addr() string {
+	return f.ln.Addr().String()
+}
+
+// get 读取item
+func (f *fakeMemcached) get(key string) (*fakeItem, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	item, ok := f.items[key]
+	return item, ok
+}
+
+// set 写入item并分配cas
+func (f *fakeMemcached) set(key string, value []byte, exptime int32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cas++
+	f.items[key] = &fakeItem{value: value, exptime: exptime, cas: f.cas}
+}
+
+func (f *fakeMemcached) serve(conn net.Conn) {
+	defer conn.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil || f.down.Load() {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		if err = f.exec(rw, args); err != nil {
+			return
+		}
+		if err = rw.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeMemcached) exec(rw *bufio.ReadWriter, args []string) error {
+	switch args[0] {
+	case "get", "gets":
+		f.mu.Lock()
+		for _, key := range args[1:] {
+			if item, ok := f.items[key]; ok {
+				fmt.Fprintf(rw, "VALUE %s %d %d %d\r\n%s\r\n", key, item.flags, len(item.value), item.cas, item.value)
+			}
+		}
+		f.mu.Unlock()
+		_, err := rw.WriteString("END\r\n")
+		return err
+	case "set", "add", "replace", "cas":
+		return f.store(rw, args)
+	case "delete":
+		f.mu.Lock()
+		_, ok := f.items[args[1]]
+		delete(f.items, args[1])
+		f.mu.Unlock()
+		return reply(rw, ok, "DELETED", "NOT_FOUND")
+	case "touch":
+		exptime, _ := strconv.Atoi(args[2])
+		f.mu.Lock()
+		item, ok := f.items[args[1]]
+		if ok {
+			item.exptime = int32(exptime)
+		}
+		f.mu.Unlock()
+		return reply(rw, ok, "TOUCHED", "NOT_FOUND")
+	case "version":
+		_, err := rw.WriteString("VERSION fake\r\n")
+		return err
+	}
+	_, err := rw.WriteString("ERROR\r\n")
+	return err
+}
+
+// store 处理存储命令：<cmd> <key> <flags> <exptime> <bytes> [cas]
+func (f *fakeMemcached) store(rw *bufio.ReadWriter, args []string) error {
+	key := args[1]
+	flags, _ := strconv.ParseUint(args[2], 10, 32)
+	exptime, _ := strconv.Atoi(args[3])
+	size, _ := strconv.Atoi(args[4])
+	value := make([]byte, size+2)
+	if _, err := io.ReadFull(rw, value); err != nil {
+		return err
+	}
+	if args[0] == "cas" && f.onCAS != nil {
+		f.onCAS(key)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	current, exists := f.items[key]
+	result := "STORED"
+	switch {
+	case args[0] == "add" && exists, args[0] == "replace" && !exists:
+		result = "NOT_STORED"
+	case args[0] == "cas" && !exists:
+		result = "NOT_FOUND"
+	case args[0] == "cas" && args[5] != strconv.FormatUint(current.cas, 10):
+		result = "EXISTS"
+	default:
+		f.cas++
+		f.items[key] = &fakeItem{value: value[:size], flags: uint32(flags), exptime: int32(exptime), cas: f.cas}
+	}
+	_, err := rw.WriteString(result + "\r\n")
+	return err
+}
+
+func reply(rw *bufio.ReadWriter, ok bool, success string, fail string) error {
+	if !ok {
+		success = fail
+	}
+	_, err := rw.WriteString(success + "\r\n")
+	return err
+}
+
+func TestNewMemcachedCache(t *testing.T) {
+	t.Run("servers", func(tt *testing.T) {
+		f := newFakeMemcached(tt)
+		mc, err := NewMemcachedCache[string]([]string{f.addr()}, time.Minute)
+		assert.Nil(tt, err)
+		pong, err := mc.Ping(context.Background())
+		assert.Nil(tt, err)
+		assert.Equal(tt, "PONG", pong)
+		assert.Nil(tt, mc.Close())
+	})
+
+	t.Run("invalid server", func(tt *testing.T) {
+		_, err := NewMemcachedCache[string]([]string{"invalid:port:x"}, time.Minute)
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("nil client", func(tt *testing.T) {
+		_, err := (&MemcachedCache[string]{}).Ping(context.Background())
+		assert.NotNil(tt, err)
+		assert.Nil(tt, (&MemcachedCache[string]{}).Close())
+	})
+}
+
+func TestMemcachedCache(t *testing.T) {
+	ctx := context.Background()
+	f1, f2 := newFakeMemcached(t), newFakeMemcached(t)
+	mc, _ := NewMemcachedCache[string]([]string{f1.addr(), f2.addr()}, time.Minute)
+	// item 读取任意节点上的item
+	item := func(key string) *fakeItem {
+		if it, ok := f1.get(key); ok {
+			return it
+		}
+		it, _ := f2.get(key)
+		return it
+	}
+
+	t.Run("set and get", func(tt *testing.T) {
+		kvs := make(map[string]string)
+		keys := make([]string, 0, 20)
+		for i := 0; i < 20; i++ {
+			key := "k" + strconv.Itoa(i)
+			kvs[key] = "v" + strconv.Itoa(i)
+			keys = append(keys, key)
+		}
+		assert.Nil(tt, mc.MSet(ctx, kvs, time.Now()))
+		assert.NotEmpty(tt, f1.items)
+		assert.NotEmpty(tt, f2.items)
+		assert.Equal(tt, int32(60), item("k1").exptime)
+
+		got, ok := mc.Get(ctx, "k1", time.Minute)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v1", got)
+		_, ok = mc.Get(ctx, "missing", time.Minute)
+		assert.False(tt, ok)
+		assert.Equal(tt, kvs, mc.MGet(ctx, append(keys, "missing"), time.Minute))
+
+		assert.Nil(tt, mc.Set(ctx, "old", "v", time.Now().Add(-2*time.Minute)))
+		_, ok = mc.Get(ctx, "old", time.Minute)
+		assert.False(tt, ok)
+	})
+
+	t.Run("set default", func(tt *testing.T) {
+		now := time.Now()
+		assert.Nil(tt, mc.SetDefault(ctx, []string{"d1"}, now))
+		env, found, err := mc.V2().Get(ctx, "d1", time.Minute)
+		assert.Nil(tt, err)
+		assert.True(tt, found)
+		assert.True(tt, env.Default)
+
+		// 不覆盖更新的数据
+		_ = mc.Set(ctx, "d2", "new", now.Add(time.Second))
+		assert.Nil(tt, mc.SetDefault(ctx, []string{"d2"}, now))
+		got, ok := mc.Get(ctx, "d2", time.Minute)
+		assert.True(tt, ok)
+		assert.Equal(tt, "new", got)
+
+		// 覆盖旧数据
+		_ = mc.Set(ctx, "d3", "old", now.Add(-time.Second))
+		assert.Nil(tt, mc.SetDefault(ctx, []string{"d3"}, now))
+		_, ok = mc.Get(ctx, "d3", time.Minute)
+		assert.False(tt, ok)
+	})
+
+	t.Run("set with version", func(tt *testing.T) {
+		now := time.Now()
+		assert.Nil(tt, mc.SetWithVersion(ctx, "v1", "a", now, 2))
+		err := mc.SetWithVersion(ctx, "v1", "b", now, 1)
+		assert.ErrorIs(tt, err, ErrStaleVersion)
+		assert.Nil(tt, mc.SetWithVersion(ctx, "v1", "c", now, 3))
+		got, _ := mc.Get(ctx, "v1", time.Minute)
+		assert.Equal(tt, "c", got)
+
+		err = mc.MSetWithVersion(ctx, map[string]string{"v1": "d", "v2": "e"}, map[string]int64{"v1": 1, "v2": 1}, now)
+		assert.ErrorIs(tt, err, ErrStaleVersion)
+		assert.ErrorContains(tt, err, "[v1]")
+		got, _ = mc.Get(ctx, "v2", time.Minute)
+		assert.Equal(tt, "e", got)
+	})
+
+	t.Run("tombstone", func(tt *testing.T) {
+		now := time.Now()
+		assert.Nil(tt, mc.SetTombstone(ctx, []string{"t1"}, now, 10*time.Second))
+		assert.Equal(tt, int32(10), item("t1").exptime)
+		_, ok := mc.Get(ctx, "t1", time.Minute)
+		assert.False(tt, ok)
+		err := mc.SetWithVersion(ctx, "t1", "a", now.Add(-time.Second), 1)
+		assert.ErrorIs(tt, err, ErrTombstoned)
+		assert.Nil(tt, mc.SetDefault(ctx, []string{"t1"}, now.Add(time.Second)))
+		env, found, _ := mc.V2().Get(ctx, "t1", time.Minute)
+		assert.True(tt, found)
+		assert.True(tt, env.Tombstone)
+		assert.Nil(tt, mc.SetWithVersion(ctx, "t1", "b", now.Add(time.Second), 1))
+	})
+
+	t.Run("cas conflict", func(tt *testing.T) {
+		now := time.Now()
+		_ = mc.SetWithVersion(ctx, "c1", "a", now, 1)
+		var conflicts atomic.Int32
+		onCAS := func(key string) {
+			// 第一次cas前并发写入更新版本
+			if conflicts.Add(1) == 1 {
+				val, _ := mc.enc.marshalData(key, "b", now.UnixMilli(), 5)
+				f1.set(key, val, 0)
+				f2.set(key, val, 0)
+			}
+		}
+		f1.onCAS, f2.onCAS = onCAS, onCAS
+		defer func() { f1.onCAS, f2.onCAS = nil, nil }()
+		err := mc.SetWithVersion(ctx, "c1", "c", now, 3)
+		assert.ErrorIs(tt, err, ErrStaleVersion)
+		assert.Equal(tt, int32(1), conflicts.Load())
+		got, _ := mc.Get(ctx, "c1", time.Minute)
+		assert.Equal(tt, "b", got)
+
+		err = mc.SetWithVersion(ctx, "c1", "d", now, 6)
+		assert.Nil(tt, err)
+	})
+
+	t.Run("cas retry exhausted", func(tt *testing.T) {
+		_ = mc.Set(ctx, "c2", "a", time.Now())
+		onCAS := func(key string) {
+			val, _ := mc.enc.marshalData(key, "b", time.Now().UnixMilli(), 0)
+			f1.set(key, val, 0)
+			f2.set(key, val, 0)
+		}
+		f1.onCAS, f2.onCAS = onCAS, onCAS
+		defer func() { f1.onCAS, f2.onCAS = nil, nil }()
+		err := mc.SetWithVersion(ctx, "c2", "c", time.Now(), 1)
+		assert.ErrorIs(tt, err, memcache.ErrCASConflict)
+	})
+
+	t.Run("delete", func(tt *testing.T) {
+		_ = mc.MSet(ctx, map[string]string{"x1": "v", "x2": "v", "x3": "v"}, time.Now())
+		assert.Nil(tt, mc.Delete(ctx, "x1"))
+		assert.Nil(tt, mc.Delete(ctx, "x1"))
+		assert.Nil(tt, mc.MDelete(ctx, []string{"x2", "x3", "missing"}))
+		assert.Empty(tt, mc.MGet(ctx, []string{"x1", "x2", "x3"}, time.Minute))
+	})
+
+	t.Run("touch", func(tt *testing.T) {
+		_ = mc.Set(ctx, "touch", "v", time.Now())
+		ok, err := mc.Touch(ctx, "touch", time.Hour)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		assert.Equal(tt, int32(3600), item("touch").exptime)
+		ok, err = mc.Touch(ctx, "touch", 0)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		assert.Equal(tt, int32(60), item("touch").exptime)
+		ok, err = mc.Touch(ctx, "missing", time.Hour)
+		assert.Nil(tt, err)
+		assert.False(tt, ok)
+	})
+
+	t.Run("corrupt", func(tt *testing.T) {
+		f1.set("bad", []byte("bad"), 0)
+		f2.set("bad", []byte("bad"), 0)
+		_, _, err := mc.V2().Get(ctx, "bad", time.Minute)
+		var corrupt *CorruptError
+		assert.ErrorAs(tt, err, &corrupt)
+		_ = mc.Set(ctx, "good", "v", time.Now())
+		envs, err := mc.V2().MGet(ctx, []string{"bad", "good"}, time.Minute)
+		assert.ErrorAs(tt, err, &corrupt)
+		assert.Equal(tt, "v", envs["good"].Data)
+	})
+
+	t.Run("server down", func(tt *testing.T) {
+		keys := make([]string, 0, 20)
+		for i := 0; i < 20; i++ {
+			keys = append(keys, "k"+strconv.Itoa(i))
+		}
+		f1.down.Store(true)
+		defer f1.down.Store(false)
+		_, err := mc.Ping(ctx)
+		assert.NotNil(tt, err)
+
+		envs, err := mc.V2().MGet(ctx, keys, time.Minute)
+		var batch *BatchError
+		assert.True(tt, errors.As(err, &batch))
+		assert.NotEmpty(tt, envs)
+		assert.Equal(tt, len(keys)-len(envs), len(batch.Keys))
+		for _, key := range batch.Keys {
+			assert.Nil(tt, envs[key])
+		}
+
+		failed := append([]string(nil), batch.Keys...)
+		sort.Strings(failed)
+
+		kvs := make(map[string]string, len(keys))
+		for _, key := range keys {
+			kvs[key] = "v"
+		}
+		err = mc.MSet(ctx, kvs, time.Now())
+		assert.True(tt, errors.As(err, &batch))
+		sort.Strings(batch.Keys)
+		assert.Equal(tt, failed, batch.Keys)
+
+		err = mc.MDelete(ctx, keys)
+		assert.True(tt, errors.As(err, &batch))
+		assert.Equal(tt, len(keys)-len(envs), len(batch.Keys))
+		for _, key := range batch.Keys {
+			assert.Nil(tt, envs[key])
+		}
+	})
+}
+
+func TestMemcachedExpiration(t *testing.T) {
+	assert.Equal(t, int32(0), memcachedExpiration(0))
+	assert.Equal(t, int32(1), memcachedExpiration(100*time.Millisecond))
+	assert.Equal(t, int32(60), memcachedExpiration(time.Minute))
+	assert.InDelta(t, time.Now().Add(60*24*time.Hour).Unix(), memcachedExpiration(60*24*time.Hour), 1)
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -11,124 +14,699 @@ import (
 	"github.com/kakkk/cachex/internal/utils"
 )
 
+// scanCount SCAN每批数量
+const scanCount = 100
+
+// versionLua 条件写入脚本函数，版本按非负整数字符串比较避免精度丢失；
+// check_write在宽限期内存在更新的墓碑时返回-1，已存在更新版本时返回0，否则返回1，set_version写入非0版本
+const versionLua = `
+local function newer(a, b)
+	if #a ~= #b then
+		return #a > #b
+	end
+	return a > b
+end
+local function check_write(version_key, tombstone_key, version, create_at)
+	local tombstone = redis.call('GET', tombstone_key)
+	if tombstone and tonumber(tombstone) > tonumber(create_at) then
+		return -1
+	end
+	local current = redis.call('GET', version_key)
+	if version ~= '0' and current and newer(current, version) then
+		return 0
+	end
+	return 1
+end
+local function set_version(version_key, version, ttl)
+	if version == '0' then
+		return
+	end
+	if tonumber(ttl) > 0 then
+		redis.call('SET', version_key, version, 'PX', ttl)
+	else
+		redis.call('SET', version_key, version)
+	end
+end
+`
+
+// schemaLua schema检查脚本函数，newer_schema解析二进制信封头部中的schema版本，
+// 高于schema时返回true；stored_head读取数据前缀，分片数据读取第一个分片
+const schemaLua = `
+local function newer_schema(head, schema)
+	if not head or #head < 3 or string.byte(head, 1) ~= 206 then
+		return false
+	end
+	local flags, pos = string.byte(head, 3), 4
+	local function varint()
+		local v, mul = 0, 1
+		while pos <= #head do
+			local b = string.byte(head, pos)
+			pos = pos + 1
+			v = v + (b % 128) * mul
+			if b < 128 then
+				break
+			end
+			mul = mul * 128
+		end
+		return v
+	end
+	varint()
+	if math.floor(flags / 4) % 2 == 1 then
+		varint()
+	end
+	if math.floor(flags / 8) % 2 == 1 then
+		varint()
+	end
+	if math.floor(flags / 128) % 2 == 0 then
+		return false
+	end
+	return varint() > tonumber(schema)
+end
+local function stored_head(key, chunk)
+	local head = redis.call('GETRANGE', key, 0, 63)
+	if string.byte(head, 1) == 207 and chunk then
+		head = redis.call('GETRANGE', chunk, 0, 63)
+	end
+	return head
+end
+`
+
+var (
+	// acquireLeaseScript 获取租约
+	acquireLeaseScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 1
+end
+return 0
+`)
+	// setWithLeaseScript 租约有效时消耗租约并条件写入，租约失效返回2，已存在更高schema版本的数据时返回-2，
+	// KEYS为数据、租约、版本、墓碑及分片key，ARGV为token、数据、过期时间、版本、写入时间、schema版本及分片
+	setWithLeaseScript = redis.NewScript(chunkLua + versionLua + schemaLua + `
+if redis.call('GET', KEYS[2]) ~= ARGV[1] then
+	return 2
+end
+redis.call('DEL', KEYS[2])
+local res = check_write(KEYS[3], KEYS[4], ARGV[4], ARGV[5])
+if res ~= 1 then
+	return res
+end
+if newer_schema(stored_head(KEYS[1], KEYS[5]), ARGV[6]) then
+	return -2
+end
+set_value(KEYS[1], ARGV[2], tonumber(ARGV[3]), 5, 7)
+set_version(KEYS[3], ARGV[4], ARGV[3])
+return 1
+`)
+	// setWithVersionScript 条件写入，已存在更高schema版本的数据时返回-2，
+	// KEYS为数据、版本、墓碑及分片key，ARGV为版本、数据、过期时间、写入时间、schema版本及分片
+	setWithVersionScript = redis.NewScript(chunkLua + versionLua + schemaLua + `
+local res = check_write(KEYS[2], KEYS[3], ARGV[1], ARGV[4])
+if res ~= 1 then
+	return res
+end
+if newer_schema(stored_head(KEYS[1], KEYS[4]), ARGV[5]) then
+	return -2
+end
+set_value(KEYS[1], ARGV[2], tonumber(ARGV[3]), 4, 6)
+set_version(KEYS[2], ARGV[1], ARGV[3])
+return 1
+`)
+	// setDataScript 不存在更高schema版本的数据时写入，否则返回-2，
+	// KEYS为数据及分片key，ARGV为数据、过期时间、schema版本及分片
+	setDataScript = redis.NewScript(chunkLua + schemaLua + `
+if newer_schema(stored_head(KEYS[1], KEYS[2]), ARGV[3]) then
+	return -2
+end
+set_value(KEYS[1], ARGV[1], tonumber(ARGV[2]), 2, 4)
+return 1
+`)
+	// setDefaultScript 不存在墓碑时写入空值，宽限期内的墓碑保留不覆盖
+	setDefaultScript = redis.NewScript(chunkLua + `
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+set_value(KEYS[1], ARGV[1], tonumber(ARGV[2]), 3, 3)
+return 1
+`)
+	// compareAndDeleteScript 值与token一致时删除，用于释放租约和解锁
+	compareAndDeleteScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+)
+
 type RedisCache[T any] struct {
-	client *redis.Client
+	client redis.UniversalClient
 	ttl    time.Duration
+	owned  bool // client由RedisCache创建，Close时关闭
+	enc    encoder[T]
+	chunk  *chunking // 大value分片，nil为不分片
+	batch  batching  // 批量操作分批
 }
 
 // NewRedisCacheWithClient returns a newly initialize RedisCache implement Cache by client and ttl
 //
 // client: redis client, need github.com/redis/go-redis/v9 *redis.Client
 // ttl: redis expire ttl, if ttl set 0, cache will not expire
-func NewRedisCacheWithClient[T any](client *redis.Client, ttl time.Duration) *RedisCache[T] {
+// opts: options, e.g. WithCodec
+func NewRedisCacheWithClient[T any](client *redis.Client, ttl time.Duration, opts ...Option) *RedisCache[T] {
+	return NewRedisCacheWithUniversalClient[T](client, ttl, opts...)
+}
+
+// NewRedisCacheWithUniversalClient returns a newly initialize RedisCache implement Cache by universal client and ttl
+//
+// client: redis universal client, e.g. *redis.Client, *redis.ClusterClient, *redis.Ring or sentinel failover client
+// ttl: redis expire ttl, if ttl set 0, cache will not expire
+// opts: options, e.g. WithCodec
+func NewRedisCacheWithUniversalClient[T any](client redis.UniversalClient, ttl time.Duration, opts ...Option) *RedisCache[T] {
+	o := newOptions(opts)
 	return &RedisCache[T]{
 		client: client,
 		ttl:    ttl,
+		enc:    newEncoder[T](o),
+		chunk:  newChunking(o),
+		batch:  newBatching(o),
 	}
 }
 
+// NewRedisCacheWithUniversalOptions returns a newly initialize RedisCache implement Cache by universal options and ttl
+//
+// options: redis universal options, MasterName for sentinel, multiple Addrs for cluster
+// ttl: redis expire ttl, if ttl set 0, cache will not expire
+// opts: options, e.g. WithCodec
+func NewRedisCacheWithUniversalOptions[T any](options *redis.UniversalOptions, ttl time.Duration, opts ...Option) *RedisCache[T] {
+	rc := NewRedisCacheWithUniversalClient[T](redis.NewUniversalClient(options), ttl, opts...)
+	rc.owned = true
+	return rc
+}
+
 // NewRedisCacheWithOptions returns a newly initialize RedisCache implement Cache by redis options and ttl
 //
 // options: redis options, need github.com/redis/go-redis/v9 *redis.Options
 // ttl: redis expire ttl, if ttl set 0, cache will not expire
-func NewRedisCacheWithOptions[T any](options *redis.Options, ttl time.Duration) *RedisCache[T] {
-	return &RedisCache[T]{
-		client: redis.NewClient(options),
-		ttl:    ttl,
-	}
+// opts: options, e.g. WithCodec
+func NewRedisCacheWithOptions[T any](options *redis.Options, ttl time.Duration, opts ...Option) *RedisCache[T] {
+	rc := NewRedisCacheWithUniversalClient[T](redis.NewClient(options), ttl, opts...)
+	rc.owned = true
+	return rc
 }
 
 func (rc *RedisCache[T]) Get(ctx context.Context, key string, expire time.Duration) (T, bool) {
 	var zero T
-	val, err := rc.client.Get(ctx, key).Result()
-	if err != nil {
+	env, ok := rc.GetEnvelope(ctx, key)
+	if !ok {
 		return zero, false
 	}
-	data, err := utils.UnmarshalData[T]([]byte(val))
-	if err != nil {
-		return zero, false
+	return env.Value(time.Now(), expire)
+}
+
+func (rc *RedisCache[T]) MGet(ctx context.Context, keys []string, expire time.Duration) map[string]T {
+	now := time.Now()
+	envs := rc.MGetEnvelope(ctx, keys)
+	result := make(map[string]T, len(envs))
+	for key, env := range envs {
+		if data, ok := env.Value(now, expire); ok {
+			result[key] = data
+		}
 	}
-	if utils.IsExpired(data.CreateAt, time.Now(), expire) {
-		return zero, false
+	return result
+}
+
+func (rc *RedisCache[T]) GetEnvelope(ctx context.Context, key string) (*Envelope[T], bool) {
+	env, found, err := rc.V2().Get(ctx, key, 0)
+	if err != nil {
+		return nil, false
 	}
-	if data.IsDefault() {
-		return zero, false
+	return env, found
+}
+
+func (rc *RedisCache[T]) MGetEnvelope(ctx context.Context, keys []string) map[string]*Envelope[T] {
+	envs, _ := rc.V2().MGet(ctx, keys, 0)
+	if envs == nil {
+		return make(map[string]*Envelope[T])
 	}
-	return data.Data, true
+	return envs
 }
 
-func (rc *RedisCache[T]) MGet(ctx context.Context, keys []string, expire time.Duration) map[string]T {
-	now := time.Now()
-	values, err := rc.client.MGet(ctx, keys...).Result()
+// V2 返回区分未命中与Redis错误的CacheV2实现
+func (rc *RedisCache[T]) V2() CacheV2[T] {
+	return &redisCacheV2[T]{RedisCache: rc}
+}
+
+// SchemaInfo 构造时通过WithSchema设置的schema
+func (rc *RedisCache[T]) SchemaInfo() SchemaInfo {
+	return rc.enc.schemaInfo()
+}
+
+// Set 已存在更高schema版本的数据时不写入，返回ErrSchemaNewer
+func (rc *RedisCache[T]) Set(ctx context.Context, key string, data T, createTime time.Time) error {
+	createAt := utils.ConvertTimestamp(createTime)
+	val, err := rc.enc.marshalData(key, data, createAt, 0)
 	if err != nil {
-		return make(map[string]T)
+		return fmt.Errorf("marshal error: %v", err)
 	}
-	result := make(map[string]T, len(keys))
-	for i, key := range keys {
-		val, ok := values[i].(string)
-		if !ok {
-			continue
+	counts, err := rc.chunkCounts(ctx, []string{key})
+	if err != nil {
+		return err
+	}
+	res, err := rc.evalSetData(ctx, rc.client, key, val, counts[key]).Int64()
+	if err != nil {
+		return err
+	}
+	return newRejectedError(setWithVersionResult(res), []string{key})
+}
+
+// MSet 分批写入，部分批次失败时返回BatchError，其他批次正常写入，已存在更高schema版本数据的keys汇总为ErrSchemaNewer
+func (rc *RedisCache[T]) MSet(ctx context.Context, kvs map[string]T, createTime time.Time) error {
+	createAt := utils.ConvertTimestamp(createTime)
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	var (
+		mu       sync.Mutex
+		rejected []string
+	)
+	err := rc.batch.run(ctx, keys, func(ctx context.Context, keys []string) error {
+		counts, err := rc.chunkCounts(ctx, keys)
+		if err != nil {
+			return err
+		}
+		pipe := rc.client.Pipeline()
+		cmds := make(map[string]*redis.Cmd, len(keys))
+		for _, k := range keys {
+			val, err := rc.enc.marshalData(k, kvs[k], createAt, 0)
+			if err != nil {
+				return fmt.Errorf("marshal error: %v", err)
+			}
+			cmds[k] = rc.evalSetData(ctx, pipe, k, val, counts[k])
+		}
+		if _, err = pipe.Exec(ctx); err != nil {
+			return err
 		}
-		data, err := utils.UnmarshalData[T]([]byte(val))
+		mu.Lock()
+		defer mu.Unlock()
+		for k, cmd := range cmds {
+			if res, _ := cmd.Int64(); setWithVersionResult(res) != nil {
+				rejected = append(rejected, k)
+			}
+		}
+		return nil
+	})
+	return errors.Join(err, newRejectedError(ErrSchemaNewer, rejected))
+}
+
+// SetDefault 分批写入空值，宽限期内的墓碑不覆盖，部分批次失败时返回BatchError，其他批次正常写入
+func (rc *RedisCache[T]) SetDefault(ctx context.Context, keys []string, createTime time.Time) error {
+	val := rc.enc.marshalDefault(utils.ConvertTimestamp(createTime))
+	return rc.batch.run(ctx, keys, func(ctx context.Context, keys []string) error {
+		counts, err := rc.chunkCounts(ctx, keys)
 		if err != nil {
-			continue
+			return err
 		}
-		if utils.IsExpired(data.CreateAt, now, expire) {
-			continue
+		pipe := rc.client.Pipeline()
+		for _, key := range keys {
+			ttl := rc.ttl + utils.GetRandomTTL()
+			scriptKeys := append([]string{key, tombstoneKey(key)}, chunkKeys(key, counts[key])...)
+			evalScript(ctx, pipe, setDefaultScript, scriptKeys, val, ttl.Milliseconds())
 		}
-		if data.IsDefault() {
-			continue
+		_, err = pipe.Exec(ctx)
+		return err
+	})
+}
+
+func (rc *RedisCache[T]) Delete(ctx context.Context, key string) error {
+	counts, err := rc.chunkCounts(ctx, []string{key})
+	if err != nil {
+		return err
+	}
+	return rc.deleteCmd(ctx, rc.client, key, counts[key]).Err()
+}
+
+// MDelete 分批删除，部分批次失败时返回BatchError，其他批次正常删除
+func (rc *RedisCache[T]) MDelete(ctx context.Context, keys []string) error {
+	return rc.batch.run(ctx, keys, rc.mDelete)
+}
+
+// mDelete 删除一批key
+func (rc *RedisCache[T]) mDelete(ctx context.Context, keys []string) error {
+	if rc.chunk != nil {
+		counts, err := rc.chunkCounts(ctx, keys)
+		if err != nil {
+			return err
+		}
+		pipe := rc.client.Pipeline()
+		for _, key := range keys {
+			rc.deleteCmd(ctx, pipe, key, counts[key])
 		}
-		result[key] = data.Data
+		_, err = pipe.Exec(ctx)
+		return err
 	}
-	return result
+	groups := rc.groupKeys(keys)
+	if len(groups) == 1 {
+		return rc.client.Del(ctx, deleteKeys(keys)...).Err()
+	}
+	// 跨分片时每个分组一条DEL，由Pipeline按节点并行执行
+	pipe := rc.client.Pipeline()
+	for _, group := range groups {
+		pipe.Del(ctx, deleteKeys(group)...)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
-func (rc *RedisCache[T]) Set(ctx context.Context, key string, data T, createTime time.Time) error {
+// deleteKeys 删除时需要删除的key及关联key
+func deleteKeys(keys []string) []string {
+	delKeys := make([]string, 0, 4*len(keys))
+	for _, key := range keys {
+		delKeys = append(delKeys, key, leaseKey(key), versionKey(key), tombstoneKey(key))
+	}
+	return delKeys
+}
+
+func (rc *RedisCache[T]) AcquireLease(ctx context.Context, key string, ttl time.Duration) (int64, bool, error) {
+	token := newLeaseToken()
+	ok, err := acquireLeaseScript.Run(ctx, rc.client, []string{leaseKey(key)}, token, max(ttl.Milliseconds(), 1)).Bool()
+	if err != nil {
+		return 0, false, err
+	}
+	if !ok {
+		return 0, false, nil
+	}
+	return token, true, nil
+}
+
+// SetWithLease 在同一脚本中校验租约、墓碑、版本及schema版本后写入，被拒绝时返回false及ErrTombstoned、
+// ErrStaleVersion或ErrSchemaNewer
+func (rc *RedisCache[T]) SetWithLease(ctx context.Context, key string, data T, createTime time.Time, token int64, version int64) (bool, error) {
 	createAt := utils.ConvertTimestamp(createTime)
-	val, err := utils.MarshalData(data, createAt)
+	val, err := rc.enc.marshalData(key, data, createAt, version)
+	if err != nil {
+		return false, fmt.Errorf("marshal error: %v", err)
+	}
+	counts, err := rc.chunkCounts(ctx, []string{key})
+	if err != nil {
+		return false, err
+	}
+	ttl := rc.ttl + utils.GetRandomTTL()
+	val, chunkKeys, chunks := rc.chunk.split(key, val, counts[key])
+	keys := append([]string{key, leaseKey(key), versionKey(key), tombstoneKey(key)}, chunkKeys...)
+	args := append([]any{strconv.FormatInt(token, 10), val, ttl.Milliseconds(), strconv.FormatInt(version, 10), createAt, rc.enc.schema.Version}, chunks...)
+	res, err := setWithLeaseScript.Run(ctx, rc.client, keys, args...).Int64()
+	if err != nil {
+		return false, err
+	}
+	if res == 2 {
+		return false, nil
+	}
+	if err = setWithVersionResult(res); err != nil {
+		return false, newRejectedError(err, []string{key})
+	}
+	return true, nil
+}
+
+func (rc *RedisCache[T]) ReleaseLease(ctx context.Context, key string, token int64) error {
+	return compareAndDeleteScript.Run(ctx, rc.client, []string{leaseKey(key)}, strconv.FormatInt(token, 10)).Err()
+}
+
+func (rc *RedisCache[T]) Lock(ctx context.Context, key string, ttl time.Duration) (int64, bool, error) {
+	token := newLeaseToken()
+	ok, err := rc.client.SetNX(ctx, lockKey(key), token, max(ttl, time.Millisecond)).Result()
+	if err != nil {
+		return 0, false, err
+	}
+	if !ok {
+		return 0, false, nil
+	}
+	return token, true, nil
+}
+
+func (rc *RedisCache[T]) Unlock(ctx context.Context, key string, token int64) error {
+	return compareAndDeleteScript.Run(ctx, rc.client, []string{lockKey(key)}, strconv.FormatInt(token, 10)).Err()
+}
+
+func (rc *RedisCache[T]) SetWithVersion(ctx context.Context, key string, data T, createTime time.Time, version int64) error {
+	createAt := utils.ConvertTimestamp(createTime)
+	val, err := rc.enc.marshalData(key, data, createAt, version)
 	if err != nil {
 		return fmt.Errorf("marshal error: %v", err)
 	}
-	return rc.client.Set(ctx, key, val, rc.ttl+utils.GetRandomTTL()).Err()
+	counts, err := rc.chunkCounts(ctx, []string{key})
+	if err != nil {
+		return err
+	}
+	res, err := rc.evalSetWithVersion(ctx, rc.client, key, val, createAt, version, counts[key]).Int64()
+	if err != nil {
+		return err
+	}
+	return newRejectedError(setWithVersionResult(res), []string{key})
 }
 
-func (rc *RedisCache[T]) MSet(ctx context.Context, kvs map[string]T, createTime time.Time) error {
-	pipe := rc.client.Pipeline()
+// MSetWithVersion 分批条件写入，部分批次失败时返回BatchError，其他批次正常写入并汇总被拒绝写入的keys
+func (rc *RedisCache[T]) MSetWithVersion(ctx context.Context, kvs map[string]T, versions map[string]int64, createTime time.Time) error {
 	createAt := utils.ConvertTimestamp(createTime)
-	for k, v := range kvs {
-		val, err := utils.MarshalData(v, createAt)
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	var mu sync.Mutex
+	results := make(map[string]int64, len(kvs))
+	err := rc.batch.run(ctx, keys, func(ctx context.Context, keys []string) error {
+		counts, err := rc.chunkCounts(ctx, keys)
 		if err != nil {
-			return fmt.Errorf("marshal error: %v", err)
+			return err
+		}
+		pipe := rc.client.Pipeline()
+		cmds := make(map[string]*redis.Cmd, len(keys))
+		for _, k := range keys {
+			val, err := rc.enc.marshalData(k, kvs[k], createAt, versions[k])
+			if err != nil {
+				return fmt.Errorf("marshal error: %v", err)
+			}
+			cmds[k] = rc.evalSetWithVersion(ctx, pipe, k, val, createAt, versions[k], counts[k])
 		}
-		pipe.Set(ctx, k, val, rc.ttl+utils.GetRandomTTL())
+		if _, err = pipe.Exec(ctx); err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for k, cmd := range cmds {
+			results[k], _ = cmd.Int64()
+		}
+		return nil
+	})
+	written := make(map[string]T, len(results))
+	for k := range results {
+		written[k] = kvs[k]
 	}
-	_, err := pipe.Exec(ctx)
-	if err != nil {
-		return err
+	return errors.Join(err, mSetWithVersion(written, versions, func(key string, _ T, _ int64) error {
+		return setWithVersionResult(results[key])
+	}))
+}
+
+// Update 同时WATCH数据、版本及墓碑key，墓碑存在时返回ErrTombstoned，已存在更高schema版本的数据时返回ErrSchemaNewer，
+// 写入时保留版本key中的版本并使租约失效
+func (rc *RedisCache[T]) Update(ctx context.Context, key string, fn UpdateFunc[T], createTime time.Time) (T, error) {
+	var zero T
+	createAt := utils.ConvertTimestamp(createTime)
+	for i := 0; i < maxUpdateRetries; i++ {
+		var data T
+		err := rc.client.Watch(ctx, func(tx *redis.Tx) error {
+			var (
+				old   T
+				found bool
+			)
+			tombstoned, err := tx.Exists(ctx, tombstoneKey(key)).Result()
+			if err != nil {
+				return err
+			}
+			if tombstoned > 0 {
+				return ErrTombstoned
+			}
+			version, err := tx.Get(ctx, versionKey(key)).Int64()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return err
+			}
+			val, err := tx.Get(ctx, key).Bytes()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return err
+			}
+			var chunks int
+			if m, ok := parseManifest(val); ok {
+				chunks = m.count
+			}
+			if err == nil {
+				var ok bool
+				if val, ok, err = rc.assemble(ctx, tx, key, val); err != nil {
+					return err
+				}
+				current, err := rc.enc.unmarshal(key, val)
+				if ok && errors.Is(err, ErrSchemaNewer) {
+					return newRejectedError(ErrSchemaNewer, []string{key})
+				}
+				if ok && err == nil && !current.IsDefault() && !current.IsTombstone() {
+					old, found = current.Data, true
+				}
+			}
+			if data, err = fn(old, found); err != nil {
+				return err
+			}
+			newVal, err := rc.enc.marshalData(key, data, createAt, version)
+			if err != nil {
+				return fmt.Errorf("marshal error: %v", err)
+			}
+			ttl := rc.ttl + utils.GetRandomTTL()
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				rc.setCmd(ctx, pipe, key, newVal, ttl, chunks)
+				if version != 0 {
+					pipe.Set(ctx, versionKey(key), version, ttl)
+				}
+				pipe.Del(ctx, leaseKey(key))
+				return nil
+			})
+			return err
+		}, key, versionKey(key), tombstoneKey(key))
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			return zero, err
+		}
+		return data, nil
 	}
-	return nil
+	return zero, ErrUpdateConflict
 }
 
-func (rc *RedisCache[T]) SetDefault(ctx context.Context, keys []string, createTime time.Time) error {
+func (rc *RedisCache[T]) SetTombstone(ctx context.Context, keys []string, createTime time.Time, grace time.Duration) error {
+	counts, err := rc.chunkCounts(ctx, keys)
+	if err != nil {
+		return err
+	}
 	pipe := rc.client.Pipeline()
-	val := utils.NewDefaultDataWithMarshal[T](utils.ConvertTimestamp(createTime))
+	createAt := utils.ConvertTimestamp(createTime)
+	// 版本保存在版本key中，墓碑不覆盖版本key
+	val := rc.enc.marshalTombstone(createAt, tombstoneExpireAt(createTime, grace), 0)
 	for _, key := range keys {
-		pipe.Set(ctx, key, val, rc.ttl+utils.GetRandomTTL())
+		pipe.Set(ctx, tombstoneKey(key), createAt, grace)
+		rc.setCmd(ctx, pipe, key, val, grace, counts[key])
+		pipe.Del(ctx, leaseKey(key))
 	}
-	_, err := pipe.Exec(ctx)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// evalSetWithVersion 执行条件写入脚本，old为旧分片数
+func (rc *RedisCache[T]) evalSetWithVersion(ctx context.Context, c redis.Scripter, key string, val []byte, createAt int64, version int64, old int) *redis.Cmd {
+	ttl := rc.ttl + utils.GetRandomTTL()
+	val, chunkKeys, chunks := rc.chunk.split(key, val, old)
+	keys := append([]string{key, versionKey(key), tombstoneKey(key)}, chunkKeys...)
+	args := append([]any{strconv.FormatInt(version, 10), val, ttl.Milliseconds(), createAt, rc.enc.schema.Version}, chunks...)
+	return evalScript(ctx, c, setWithVersionScript, keys, args...)
+}
+
+// evalSetData 执行写入数据脚本，已存在更高schema版本的数据时不写入，old为旧分片数
+func (rc *RedisCache[T]) evalSetData(ctx context.Context, c redis.Scripter, key string, val []byte, old int) *redis.Cmd {
+	ttl := rc.ttl + utils.GetRandomTTL()
+	val, chunkKeys, chunks := rc.chunk.split(key, val, old)
+	args := append([]any{val, ttl.Milliseconds(), rc.enc.schema.Version}, chunks...)
+	return evalScript(ctx, c, setDataScript, append([]string{key}, chunkKeys...), args...)
+}
+
+// Close 关闭由NewRedisCacheWithOptions创建的client，调用方传入的client由调用方关闭
+func (rc *RedisCache[T]) Close() error {
+	if !rc.owned {
+		return nil
+	}
+	return rc.client.Close()
+}
+
+func (rc *RedisCache[T]) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	ttl, err := rc.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, false, err
+	}
+	// -2: key不存在, -1: 不过期
+	switch ttl {
+	case -2:
+		return 0, false, nil
+	case -1:
+		return 0, true, nil
+	}
+	return ttl, true, nil
+}
+
+// Touch 在同一脚本中延长数据、分片、版本及墓碑key的过期时间，保持关联key与数据同时过期，墓碑视为不存在
+func (rc *RedisCache[T]) Touch(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		ttl = rc.ttl
+	}
+	counts, err := rc.chunkCounts(ctx, []string{key})
+	if err != nil {
+		return false, err
+	}
+	keys := append([]string{key, versionKey(key), tombstoneKey(key)}, chunkKeys(key, counts[key])...)
+	return touchScript.Run(ctx, rc.client, keys, max(ttl.Milliseconds(), 0)).Bool()
+}
+
+// Scan 使用SCAN依次遍历各主节点，跳过租约、版本、墓碑、回源锁及分片等关联key
+func (rc *RedisCache[T]) Scan(ctx context.Context, prefix string, fn func(key string) bool) error {
+	nodes, err := rc.nodes(ctx)
 	if err != nil {
 		return err
 	}
+	match := escapePattern(prefix) + "*"
+	for _, node := range nodes {
+		stopped, err := scanNode(ctx, node, match, fn)
+		if err != nil || stopped {
+			return err
+		}
+	}
 	return nil
 }
 
-func (rc *RedisCache[T]) Delete(ctx context.Context, key string) error {
-	return rc.client.Del(ctx, key).Err()
+// scanNode 遍历单个节点，fn返回false时stopped为true
+func scanNode(ctx context.Context, node redis.UniversalClient, match string, fn func(key string) bool) (stopped bool, err error) {
+	var cursor uint64
+	for {
+		keys, next, err := node.Scan(ctx, cursor, match, scanCount).Result()
+		if err != nil {
+			return false, err
+		}
+		for _, key := range keys {
+			if isRelatedKey(key) || isChunkKey(key) {
+				continue
+			}
+			if !fn(key) {
+				return true, nil
+			}
+		}
+		if next == 0 {
+			return false, nil
+		}
+		cursor = next
+	}
 }
 
-func (rc *RedisCache[T]) MDelete(ctx context.Context, keys []string) error {
-	return rc.client.Del(ctx, keys...).Err()
+// Stats 条目数为各主节点DBSIZE之和，命中统计来自各主节点INFO stats，INFO不可用时为0
+func (rc *RedisCache[T]) Stats(ctx context.Context) (Stats, error) {
+	nodes, err := rc.nodes(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+	stats := Stats{Compression: rc.enc.comp.stats()}
+	for _, node := range nodes {
+		size, err := node.DBSize(ctx).Result()
+		if err != nil {
+			return Stats{}, err
+		}
+		stats.Entries += size
+		if info, err := node.Info(ctx, "stats").Result(); err == nil {
+			parseInfoStats(info, &stats)
+		}
+	}
+	return stats, nil
 }
 
 func (rc *RedisCache[T]) Ping(ctx context.Context) (string, error) {
@@ -137,3 +715,144 @@ func (rc *RedisCache[T]) Ping(ctx context.Context) (string, error) {
 	}
 	return rc.client.Ping(ctx).Result()
 }
+
+// leaseKey 租约key
+func leaseKey(key string) string {
+	return relatedKey(key, ":lease")
+}
+
+// redisCacheV2 RedisCache的CacheV2实现，redis.Nil视为未命中，解码失败返回CorruptError，其他错误返回
+type redisCacheV2[T any] struct {
+	*RedisCache[T]
+}
+
+func (r *redisCacheV2[T]) Get(ctx context.Context, key string, expire time.Duration) (*Envelope[T], bool, error) {
+	val, err := r.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var found bool
+	if val, found, err = r.assemble(ctx, r.client, key, val); err != nil || !found {
+		return nil, false, err
+	}
+	env, corrupt := decodeEntry(r.enc, key, val, time.Now(), expire, nil)
+	return env, env != nil, corrupt.errorOrNil()
+}
+
+// MGet 分批读取，部分批次失败时返回BatchError及其他批次的数据
+func (r *redisCacheV2[T]) MGet(ctx context.Context, keys []string, expire time.Duration) (map[string]*Envelope[T], error) {
+	var (
+		mu      sync.Mutex
+		corrupt *CorruptError
+	)
+	result := make(map[string]*Envelope[T], len(keys))
+	err := r.batch.run(ctx, keys, func(ctx context.Context, keys []string) error {
+		vals, err := r.mGetRaw(ctx, keys)
+		if err != nil {
+			return err
+		}
+		if err = r.mAssemble(ctx, vals); err != nil {
+			return err
+		}
+		now := time.Now()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, key := range keys {
+			val, ok := vals[key]
+			if !ok {
+				continue
+			}
+			var env *Envelope[T]
+			if env, corrupt = decodeEntry(r.enc, key, val, now, expire, corrupt); env != nil {
+				result[key] = env
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		return result, corrupt.errorOrNil()
+	}
+	return result, errors.Join(err, corrupt.errorOrNil())
+}
+
+// relatedKeySuffixes 关联key后缀
+var relatedKeySuffixes = []string{":lease", ":version", ":tombstone", ":lock"}
+
+// isRelatedKey 是否为关联key
+func isRelatedKey(key string) bool {
+	if !strings.Contains(key, "}") {
+		return false
+	}
+	for _, suffix := range relatedKeySuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// escapePattern 转义SCAN MATCH通配符
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// parseInfoStats 解析INFO stats中的命中统计并累加
+func parseInfoStats(info string, stats *Stats) {
+	for _, line := range strings.Split(info, "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "keyspace_hits":
+			stats.Hits += n
+		case "keyspace_misses":
+			stats.Misses += n
+		case "evicted_keys":
+			stats.Evictions += n
+		}
+	}
+}
+
+// lockKey 回源锁key
+func lockKey(key string) string {
+	return relatedKey(key, ":lock")
+}
+
+// versionKey 版本key
+func versionKey(key string) string {
+	return relatedKey(key, ":version")
+}
+
+// tombstoneKey 墓碑key，保存墓碑创建时间
+func tombstoneKey(key string) string {
+	return relatedKey(key, ":tombstone")
+}
+
+// setWithVersionResult 条件写入脚本结果，1写入成功，0版本过旧，-1墓碑拒绝，-2已存在更高schema版本的数据
+func setWithVersionResult(res int64) error {
+	switch res {
+	case 0:
+		return ErrStaleVersion
+	case -1:
+		return ErrTombstoned
+	case -2:
+		return ErrSchemaNewer
+	}
+	return nil
+}
@@ -0,0 +1,580 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/kakkk/cachex/internal/json"
+	"github.com/kakkk/cachex/internal/model"
+	"github.com/kakkk/cachex/internal/utils"
+)
+
+// 字段模式的保留字段，以__开头的字段名保留
+const (
+	hashFieldCreateAt = "__c" // 写入时间戳
+	hashFieldDefault  = "__d" // 空值标记
+	hashFieldCodec    = "__n" // 编码名称
+	hashFieldValue    = "__v" // 非结构体数据及nil指针
+)
+
+// hashSetScript 覆盖写入hash并设置过期时间，ARGV[1]为过期时间毫秒，其后为字段及值
+var hashSetScript = redis.NewScript(`
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], unpack(ARGV, 2))
+if tonumber(ARGV[1]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// hashBucketSetScript 桶模式写入字段并刷新桶过期时间，ARGV为字段、数据、过期时间毫秒及schema版本，
+// schema版本不为空且字段中已存在更高schema版本的数据时不写入，返回-2
+var hashBucketSetScript = redis.NewScript(schemaLua + `
+if ARGV[4] ~= '' and newer_schema(redis.call('HGET', KEYS[1], ARGV[1]), ARGV[4]) then
+	return -2
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+if tonumber(ARGV[3]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+return 1
+`)
+
+// HashBucket 桶模式下将key映射为桶hash及字段，如按ID取模分桶
+type HashBucket func(key string) (bucket string, field string)
+
+// WithHashBucket 设置RedisHashCache使用桶模式，多个key保存在同一个桶hash中以减少key数量，
+// 字段值为完整的缓存数据，过期时间作用于整个桶，每次写入及延长时刷新
+func WithHashBucket(bucket HashBucket) Option {
+	return func(o *options) {
+		o.hashBucket = bucket
+	}
+}
+
+// RedisHashCache 使用Redis hash保存数据，默认为字段模式：每个key一个hash，结构体每个导出字段一个hash字段，
+// 字段名依次使用cachex、json标签及字段名，字段值按Codec编码，写入时间等元信息保存在保留字段中，
+// 支持GetFields按字段读取；非结构体数据保存在单个保留字段中。字段模式按字段明文读写，
+// 不支持WithCompression、WithEncryption及schema版本。设置WithHashBucket时为桶模式，字段值为完整编码的缓存数据，
+// 不覆盖更高schema版本的数据
+type RedisHashCache[T any] struct {
+	client redis.UniversalClient
+	ttl    time.Duration
+	codec  Codec
+	layout hashLayout
+	bucket HashBucket // 桶模式映射，nil为字段模式
+	enc    encoder[T] // 桶模式编码
+	batch  batching
+}
+
+// NewRedisHashCache returns a newly initialize RedisHashCache implement Cache by universal client and ttl,
+// returns error if the codec is nil or the WithSchema type mismatch T, field mode returns error if WithCompression,
+// WithEncryption or a non-zero schema version set, or a field name is reserved or duplicated
+//
+// client: redis universal client, e.g. *redis.Client, *redis.ClusterClient
+// ttl: hash expire ttl, if ttl set 0, cache will not expire
+// opts: options, e.g. WithCodec, WithHashBucket, WithBatch
+func NewRedisHashCache[T any](client redis.UniversalClient, ttl time.Duration, opts ...Option) (*RedisHashCache[T], error) {
+	o := newOptions(opts)
+	if o.codec == nil {
+		return nil, errors.New("codec is nil")
+	}
+	enc := newEncoder[T](o)
+	if enc.schemaErr != nil {
+		return nil, enc.schemaErr
+	}
+	var layout hashLayout
+	if o.hashBucket == nil {
+		if o.compressor != nil || o.keyring != nil {
+			return nil, errors.New("compression and encryption require hash bucket mode")
+		}
+		if enc.schema.Version != 0 {
+			return nil, errors.New("schema version requires hash bucket mode")
+		}
+		var err error
+		if layout, err = newHashLayout[T](); err != nil {
+			return nil, err
+		}
+	}
+	return &RedisHashCache[T]{
+		client: client,
+		ttl:    ttl,
+		codec:  o.codec,
+		layout: layout,
+		bucket: o.hashBucket,
+		enc:    enc,
+		batch:  newBatching(o),
+	}, nil
+}
+
+func (h *RedisHashCache[T]) Get(ctx context.Context, key string, expire time.Duration) (T, bool) {
+	var zero T
+	env, found, err := h.V2().Get(ctx, key, expire)
+	if err != nil || !found {
+		return zero, false
+	}
+	return env.Value(time.Now(), expire)
+}
+
+func (h *RedisHashCache[T]) MGet(ctx context.Context, keys []string, expire time.Duration) map[string]T {
+	now := time.Now()
+	envs, _ := h.V2().MGet(ctx, keys, expire)
+	result := make(map[string]T, len(envs))
+	for key, env := range envs {
+		if data, ok := env.Value(now, expire); ok {
+			result[key] = data
+		}
+	}
+	return result
+}
+
+// GetFields 使用HMGET只读取指定hash字段，其他字段为零值；桶模式读取完整数据
+func (h *RedisHashCache[T]) GetFields(ctx context.Context, key string, fields []string, expire time.Duration) (T, bool) {
+	var zero T
+	if h.bucket != nil {
+		return h.Get(ctx, key, expire)
+	}
+	names := append([]string{hashFieldCreateAt, hashFieldDefault, hashFieldCodec, hashFieldValue}, fields...)
+	values, err := h.client.HMGet(ctx, key, names...).Result()
+	if err != nil {
+		return zero, false
+	}
+	m := make(map[string]string, len(names))
+	for i, name := range names {
+		if s, ok := values[i].(string); ok {
+			m[name] = s
+		}
+	}
+	if _, ok := m[hashFieldCreateAt]; !ok {
+		return zero, false
+	}
+	env, err := h.fieldEnvelope(m)
+	if err != nil {
+		return zero, false
+	}
+	return env.Value(time.Now(), expire)
+}
+
+// V2 返回区分未命中与Redis错误的CacheV2实现
+func (h *RedisHashCache[T]) V2() CacheV2[T] {
+	return &redisHashCacheV2[T]{RedisHashCache: h}
+}
+
+// SchemaInfo 构造时通过WithSchema设置的schema，仅桶模式支持schema版本
+func (h *RedisHashCache[T]) SchemaInfo() SchemaInfo {
+	return h.enc.schemaInfo()
+}
+
+// Set 桶模式下已存在更高schema版本的数据时不写入，返回ErrSchemaNewer
+func (h *RedisHashCache[T]) Set(ctx context.Context, key string, data T, createTime time.Time) error {
+	pipe := h.client.Pipeline()
+	cmd, err := h.writeCmd(ctx, pipe, key, &model.CacheData[T]{CreateAt: utils.ConvertTimestamp(createTime), Data: data})
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	if _, err = pipe.Exec(ctx); err != nil {
+		return err
+	}
+	res, _ := cmd.Int64()
+	return newRejectedError(setWithVersionResult(res), []string{key})
+}
+
+// MSet 分批写入，部分批次失败时返回BatchError，其他批次正常写入，桶模式下已存在更高schema版本数据的keys汇总为ErrSchemaNewer
+func (h *RedisHashCache[T]) MSet(ctx context.Context, kvs map[string]T, createTime time.Time) error {
+	createAt := utils.ConvertTimestamp(createTime)
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	var (
+		mu       sync.Mutex
+		rejected []string
+	)
+	err := h.batch.run(ctx, keys, func(ctx context.Context, keys []string) error {
+		pipe := h.client.Pipeline()
+		cmds := make(map[string]*redis.Cmd, len(keys))
+		for _, k := range keys {
+			cmd, err := h.writeCmd(ctx, pipe, k, &model.CacheData[T]{CreateAt: createAt, Data: kvs[k]})
+			if err != nil {
+				return fmt.Errorf("marshal error: %v", err)
+			}
+			cmds[k] = cmd
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for k, cmd := range cmds {
+			if res, _ := cmd.Int64(); setWithVersionResult(res) != nil {
+				rejected = append(rejected, k)
+			}
+		}
+		return nil
+	})
+	return errors.Join(err, newRejectedError(ErrSchemaNewer, rejected))
+}
+
+// SetDefault 分批写入空值，部分批次失败时返回BatchError，其他批次正常写入
+func (h *RedisHashCache[T]) SetDefault(ctx context.Context, keys []string, createTime time.Time) error {
+	createAt := utils.ConvertTimestamp(createTime)
+	return h.batch.run(ctx, keys, func(ctx context.Context, keys []string) error {
+		pipe := h.client.Pipeline()
+		for _, key := range keys {
+			if _, err := h.writeCmd(ctx, pipe, key, &model.CacheData[T]{CreateAt: createAt, Default: 1}); err != nil {
+				return err
+			}
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+}
+
+func (h *RedisHashCache[T]) Delete(ctx context.Context, key string) error {
+	return h.deleteCmd(ctx, h.client, key).Err()
+}
+
+// MDelete 分批删除，部分批次失败时返回BatchError，其他批次正常删除
+func (h *RedisHashCache[T]) MDelete(ctx context.Context, keys []string) error {
+	return h.batch.run(ctx, keys, func(ctx context.Context, keys []string) error {
+		pipe := h.client.Pipeline()
+		for _, key := range keys {
+			h.deleteCmd(ctx, pipe, key)
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+}
+
+func (h *RedisHashCache[T]) Ping(ctx context.Context) (string, error) {
+	if h.client == nil {
+		return "", errors.New("redis client not set")
+	}
+	return h.client.Ping(ctx).Result()
+}
+
+// TTL 剩余存活时间，桶模式为整个桶的剩余存活时间
+func (h *RedisHashCache[T]) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	name, ok, err := h.exists(ctx, key)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	ttl, err := h.client.PTTL(ctx, name).Result()
+	if err != nil {
+		return 0, false, err
+	}
+	// -2: key不存在, -1: 不过期
+	switch ttl {
+	case -2:
+		return 0, false, nil
+	case -1:
+		return 0, true, nil
+	}
+	return ttl, true, nil
+}
+
+// Touch 延长存活时间，桶模式延长整个桶
+func (h *RedisHashCache[T]) Touch(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		ttl = h.ttl
+	}
+	name, ok, err := h.exists(ctx, key)
+	if err != nil || !ok {
+		return false, err
+	}
+	if ttl <= 0 {
+		return true, h.client.Persist(ctx, name).Err()
+	}
+	return h.client.PExpire(ctx, name, ttl).Result()
+}
+
+// exists 检查key是否存在，返回保存数据的hash名称
+func (h *RedisHashCache[T]) exists(ctx context.Context, key string) (string, bool, error) {
+	if h.bucket != nil {
+		bucket, field := h.bucket(key)
+		ok, err := h.client.HExists(ctx, bucket, field).Result()
+		return bucket, ok, err
+	}
+	n, err := h.client.Exists(ctx, key).Result()
+	return key, n > 0, err
+}
+
+// expiration 写入时的过期时间，ttl为0时不过期
+func (h *RedisHashCache[T]) expiration() time.Duration {
+	if h.ttl <= 0 {
+		return 0
+	}
+	return h.ttl + utils.GetRandomTTL()
+}
+
+// writeCmd 写入一个key，字段模式使用脚本覆盖整个hash，桶模式写入桶字段并刷新桶过期时间，
+// 桶模式写入数据时不覆盖更高schema版本的数据，脚本返回-2
+func (h *RedisHashCache[T]) writeCmd(ctx context.Context, pipe redis.Pipeliner, key string, data *model.CacheData[T]) (*redis.Cmd, error) {
+	ttl := h.expiration()
+	if h.bucket != nil {
+		val, err := h.enc.marshal(key, data)
+		if err != nil {
+			return nil, err
+		}
+		var schema string
+		if !data.IsDefault() {
+			schema = strconv.FormatUint(uint64(h.enc.schema.Version), 10)
+		}
+		bucket, field := h.bucket(key)
+		return evalScript(ctx, pipe, hashBucketSetScript, []string{bucket}, field, val, ttl.Milliseconds(), schema), nil
+	}
+	args, err := h.fieldArgs(data)
+	if err != nil {
+		return nil, err
+	}
+	return evalScript(ctx, pipe, hashSetScript, []string{key}, append([]any{ttl.Milliseconds()}, args...)...), nil
+}
+
+// deleteCmd 删除一个key，桶模式删除桶字段
+func (h *RedisHashCache[T]) deleteCmd(ctx context.Context, c redis.Cmdable, key string) *redis.IntCmd {
+	if h.bucket != nil {
+		bucket, field := h.bucket(key)
+		return c.HDel(ctx, bucket, field)
+	}
+	return c.Del(ctx, key)
+}
+
+// fieldArgs 字段模式写入的字段及值
+func (h *RedisHashCache[T]) fieldArgs(data *model.CacheData[T]) ([]any, error) {
+	args := []any{hashFieldCreateAt, data.CreateAt, hashFieldCodec, h.codec.Name()}
+	if data.IsDefault() {
+		return append(args, hashFieldDefault, 1), nil
+	}
+	fields, err := h.layout.encode(h.codec, data.Data)
+	if err != nil {
+		return nil, err
+	}
+	return append(args, fields...), nil
+}
+
+// fieldEnvelope 由字段模式的hash字段生成Envelope，只解码存在的字段
+func (h *RedisHashCache[T]) fieldEnvelope(values map[string]string) (*Envelope[T], error) {
+	createAt, err := strconv.ParseInt(values[hashFieldCreateAt], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid create time", errInvalidEnvelope)
+	}
+	if name := values[hashFieldCodec]; name != h.codec.Name() {
+		return nil, fmt.Errorf("%w: stored %v, expect %v", ErrCodecMismatch, name, h.codec.Name())
+	}
+	env := &Envelope[T]{CreateAt: createAt}
+	if values[hashFieldDefault] == "1" {
+		env.Default = true
+		return env, nil
+	}
+	if err = h.layout.decode(h.codec, values, &env.Data); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// decodeFields 解码字段模式的hash，过期视为未命中，解码失败时以JSON格式的字段记录到corrupt
+func (h *RedisHashCache[T]) decodeFields(key string, values map[string]string, now time.Time, expire time.Duration, corrupt *CorruptError) (*Envelope[T], *CorruptError) {
+	env, err := h.fieldEnvelope(values)
+	if err != nil {
+		raw, _ := json.Marshal(values)
+		return nil, corrupt.add(key, raw, err)
+	}
+	if env.IsExpired(now, expire) {
+		return nil, corrupt
+	}
+	return env, corrupt
+}
+
+// redisHashCacheV2 RedisHashCache的CacheV2实现，redis.Nil视为未命中，解码失败返回CorruptError，其他错误返回
+type redisHashCacheV2[T any] struct {
+	*RedisHashCache[T]
+}
+
+func (r *redisHashCacheV2[T]) Get(ctx context.Context, key string, expire time.Duration) (*Envelope[T], bool, error) {
+	var (
+		env     *Envelope[T]
+		corrupt *CorruptError
+	)
+	if r.bucket != nil {
+		bucket, field := r.bucket(key)
+		val, err := r.client.HGet(ctx, bucket, field).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		env, corrupt = decodeEntry(r.enc, key, val, time.Now(), expire, nil)
+	} else {
+		values, err := r.client.HGetAll(ctx, key).Result()
+		if err != nil {
+			return nil, false, err
+		}
+		if len(values) == 0 {
+			return nil, false, nil
+		}
+		env, corrupt = r.decodeFields(key, values, time.Now(), expire, nil)
+	}
+	return env, env != nil, corrupt.errorOrNil()
+}
+
+// MGet 分批读取，每批一个Pipeline，部分批次失败时返回BatchError及其他批次的数据
+func (r *redisHashCacheV2[T]) MGet(ctx context.Context, keys []string, expire time.Duration) (map[string]*Envelope[T], error) {
+	var (
+		mu      sync.Mutex
+		corrupt *CorruptError
+	)
+	result := make(map[string]*Envelope[T], len(keys))
+	err := r.batch.run(ctx, keys, func(ctx context.Context, keys []string) error {
+		pipe := r.client.Pipeline()
+		cmds := make([]redis.Cmder, len(keys))
+		for i, key := range keys {
+			if r.bucket != nil {
+				bucket, field := r.bucket(key)
+				cmds[i] = pipe.HGet(ctx, bucket, field)
+			} else {
+				cmds[i] = pipe.HGetAll(ctx, key)
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		now := time.Now()
+		mu.Lock()
+		defer mu.Unlock()
+		for i, key := range keys {
+			var env *Envelope[T]
+			switch cmd := cmds[i].(type) {
+			case *redis.StringCmd:
+				val, err := cmd.Bytes()
+				if err != nil {
+					continue
+				}
+				env, corrupt = decodeEntry(r.enc, key, val, now, expire, corrupt)
+			case *redis.MapStringStringCmd:
+				if len(cmd.Val()) == 0 {
+					continue
+				}
+				env, corrupt = r.decodeFields(key, cmd.Val(), now, expire, corrupt)
+			}
+			if env != nil {
+				result[key] = env
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		return result, corrupt.errorOrNil()
+	}
+	return result, errors.Join(err, corrupt.errorOrNil())
+}
+
+// hashLayout 字段模式下结构体字段与hash字段的映射
+type hashLayout struct {
+	ptr    bool        // 数据为结构体指针
+	fields []hashField // 为空时数据保存在__v字段
+}
+
+// hashField 结构体字段
+type hashField struct {
+	name  string
+	index int
+}
+
+// newHashLayout 解析T的导出字段，只映射顶层字段，字段名以__开头时与保留字段冲突，返回错误
+func newHashLayout[T any]() (hashLayout, error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	var layout hashLayout
+	seen := make(map[string]string)
+	if typ.Kind() == reflect.Pointer && typ.Elem().Kind() == reflect.Struct {
+		layout.ptr, typ = true, typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return layout, nil
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := hashFieldName(f)
+		if name == "-" {
+			continue
+		}
+		if strings.HasPrefix(name, "__") {
+			return hashLayout{}, fmt.Errorf("hash field %v of %v is reserved", name, f.Name)
+		}
+		if other, ok := seen[name]; ok {
+			return hashLayout{}, fmt.Errorf("hash field %v of %v is duplicated with %v", name, f.Name, other)
+		}
+		seen[name] = f.Name
+		layout.fields = append(layout.fields, hashField{name: name, index: i})
+	}
+	return layout, nil
+}
+
+// hashFieldName hash字段名，依次使用cachex、json标签及字段名
+func hashFieldName(f reflect.StructField) string {
+	for _, tag := range []string{"cachex", "json"} {
+		if name, _, _ := strings.Cut(f.Tag.Get(tag), ","); name != "" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+// encode 编码为hash字段及值，非结构体数据及nil指针保存在__v字段
+func (l hashLayout) encode(codec Codec, data any) ([]any, error) {
+	v := reflect.ValueOf(data)
+	if len(l.fields) == 0 || (l.ptr && v.IsNil()) {
+		val, err := codec.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		return []any{hashFieldValue, val}, nil
+	}
+	if l.ptr {
+		v = v.Elem()
+	}
+	args := make([]any, 0, 2*len(l.fields))
+	for _, f := range l.fields {
+		val, err := codec.Marshal(v.Field(f.index).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("field %v: %w", f.name, err)
+		}
+		args = append(args, f.name, val)
+	}
+	return args, nil
+}
+
+// decode 解码hash字段到data指向的数据，缺失的字段为零值
+func (l hashLayout) decode(codec Codec, values map[string]string, data any) error {
+	if raw, ok := values[hashFieldValue]; ok {
+		return codec.Unmarshal([]byte(raw), data)
+	}
+	v := reflect.ValueOf(data).Elem()
+	if len(l.fields) == 0 {
+		return nil
+	}
+	if l.ptr {
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+	for _, f := range l.fields {
+		raw, ok := values[f.name]
+		if !ok {
+			continue
+		}
+		if err := codec.Unmarshal([]byte(raw), v.Field(f.index).Addr().Interface()); err != nil {
+			return fmt.Errorf("field %v: %w", f.name, err)
+		}
+	}
+	return nil
+}
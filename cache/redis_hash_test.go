@@ -0,0 +1,332 @@
+package cache
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type hashUser struct {
+	ID     int64    `json:"id"`
+	Name   string   `cachex:"name" json:"nickname"`
+	Tags   []string `json:"tags,omitempty"`
+	Secret string   `json:"-"`
+	Score  float64
+	inner  int
+}
+
+func TestRedisHashCache_Field(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	hc, err := NewRedisHashCache[*hashUser](client, time.Minute)
+	assert.Nil(t, err)
+	user := &hashUser{ID: 1, Name: "a", Tags: []string{"x"}, Secret: "s", Score: 1.5, inner: 1}
+
+	t.Run("set and get", func(tt *testing.T) {
+		assert.Nil(tt, hc.Set(ctx, "user:1", user, time.Now()))
+		fields, err := mr.HKeys("user:1")
+		assert.Nil(tt, err)
+		sort.Strings(fields)
+		assert.Equal(tt, []string{"Score", "__c", "__n", "id", "name", "tags"}, fields)
+		assert.Equal(tt, `"a"`, mr.HGet("user:1", "name"))
+		assert.Greater(tt, mr.TTL("user:1"), 59*time.Second)
+
+		got, ok := hc.Get(ctx, "user:1", time.Minute)
+		assert.True(tt, ok)
+		assert.Equal(tt, &hashUser{ID: 1, Name: "a", Tags: []string{"x"}, Score: 1.5}, got)
+		_, ok = hc.Get(ctx, "missing", time.Minute)
+		assert.False(tt, ok)
+	})
+
+	t.Run("overwrite", func(tt *testing.T) {
+		_ = hc.Set(ctx, "user:2", user, time.Now())
+		assert.Nil(tt, hc.Set(ctx, "user:2", &hashUser{ID: 2}, time.Now()))
+		got, ok := hc.Get(ctx, "user:2", time.Minute)
+		assert.True(tt, ok)
+		assert.Equal(tt, &hashUser{ID: 2}, got)
+		assert.Equal(tt, "null", mr.HGet("user:2", "tags"))
+	})
+
+	t.Run("get fields", func(tt *testing.T) {
+		_ = hc.Set(ctx, "user:1", user, time.Now())
+		got, ok := hc.GetFields(ctx, "user:1", []string{"name", "unknown"}, time.Minute)
+		assert.True(tt, ok)
+		assert.Equal(tt, &hashUser{Name: "a"}, got)
+		_, ok = hc.GetFields(ctx, "missing", []string{"name"}, time.Minute)
+		assert.False(tt, ok)
+
+		_ = hc.SetDefault(ctx, []string{"default"}, time.Now())
+		_, ok = hc.GetFields(ctx, "default", []string{"name"}, time.Minute)
+		assert.False(tt, ok)
+	})
+
+	t.Run("mget", func(tt *testing.T) {
+		assert.Nil(tt, hc.MSet(ctx, map[string]*hashUser{"m1": {ID: 1}, "m2": {ID: 2}}, time.Now()))
+		assert.Nil(tt, hc.SetDefault(ctx, []string{"m3"}, time.Now()))
+		got := hc.MGet(ctx, []string{"m1", "m2", "m3", "m4"}, time.Minute)
+		assert.Equal(tt, map[string]*hashUser{"m1": {ID: 1}, "m2": {ID: 2}}, got)
+
+		envs, err := hc.V2().MGet(ctx, []string{"m1", "m3"}, time.Minute)
+		assert.Nil(tt, err)
+		assert.True(tt, envs["m3"].Default)
+		assert.Equal(tt, int64(1), envs["m1"].Data.ID)
+	})
+
+	t.Run("expired", func(tt *testing.T) {
+		_ = hc.Set(ctx, "old", user, time.Now().Add(-2*time.Minute))
+		_, ok := hc.Get(ctx, "old", time.Minute)
+		assert.False(tt, ok)
+		_, ok = hc.GetFields(ctx, "old", []string{"id"}, time.Minute)
+		assert.False(tt, ok)
+		assert.Empty(tt, hc.MGet(ctx, []string{"old"}, time.Minute))
+	})
+
+	t.Run("nil pointer", func(tt *testing.T) {
+		assert.Nil(tt, hc.Set(ctx, "nil", nil, time.Now()))
+		assert.Equal(tt, "null", mr.HGet("nil", "__v"))
+		got, ok := hc.Get(ctx, "nil", time.Minute)
+		assert.True(tt, ok)
+		assert.Nil(tt, got)
+	})
+
+	t.Run("corrupt", func(tt *testing.T) {
+		mr.HSet("bad", "__c", "x")
+		_, _, err := hc.V2().Get(ctx, "bad", time.Minute)
+		var corrupt *CorruptError
+		assert.ErrorAs(tt, err, &corrupt)
+		assert.Equal(tt, []string{"bad"}, keysOf(corrupt.Entries))
+
+		_ = hc.Set(ctx, "mismatch", user, time.Now())
+		mr.HSet("mismatch", "__n", "msgpack")
+		_, err = hc.V2().MGet(ctx, []string{"mismatch", "user:1"}, time.Minute)
+		assert.ErrorIs(tt, err, ErrCodecMismatch)
+
+		_ = hc.Set(ctx, "field", user, time.Now())
+		mr.HSet("field", "id", "x")
+		_, _, err = hc.V2().Get(ctx, "field", time.Minute)
+		assert.ErrorContains(tt, err, "field id")
+	})
+
+	t.Run("delete", func(tt *testing.T) {
+		_ = hc.MSet(ctx, map[string]*hashUser{"d1": user, "d2": user, "d3": user}, time.Now())
+		assert.Nil(tt, hc.Delete(ctx, "d1"))
+		assert.Nil(tt, hc.MDelete(ctx, []string{"d2", "d3"}))
+		assert.Empty(tt, hc.MGet(ctx, []string{"d1", "d2", "d3"}, time.Minute))
+		assert.False(tt, mr.Exists("d1"))
+	})
+
+	t.Run("ttl and touch", func(tt *testing.T) {
+		_ = hc.Set(ctx, "touch", user, time.Now())
+		mr.SetTTL("touch", time.Second)
+		ok, err := hc.Touch(ctx, "touch", time.Hour)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		ttl, ok, err := hc.TTL(ctx, "touch")
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		assert.Equal(tt, time.Hour, ttl)
+		ok, err = hc.Touch(ctx, "missing", time.Hour)
+		assert.Nil(tt, err)
+		assert.False(tt, ok)
+		_, ok, _ = hc.TTL(ctx, "missing")
+		assert.False(tt, ok)
+	})
+
+	t.Run("redis_error", func(tt *testing.T) {
+		mr.SetError("unit_test")
+		defer mr.SetError("")
+		_, ok := hc.Get(ctx, "user:1", time.Minute)
+		assert.False(tt, ok)
+		_, ok = hc.GetFields(ctx, "user:1", []string{"id"}, time.Minute)
+		assert.False(tt, ok)
+		_, _, err := hc.V2().Get(ctx, "user:1", time.Minute)
+		assert.NotNil(tt, err)
+		_, err = hc.V2().MGet(ctx, []string{"user:1"}, time.Minute)
+		assert.NotNil(tt, err)
+		assert.NotNil(tt, hc.Set(ctx, "user:1", user, time.Now()))
+		_, err = hc.Ping(ctx)
+		assert.NotNil(tt, err)
+	})
+}
+
+func TestRedisHashCache_Value(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	t.Run("string", func(tt *testing.T) {
+		hc, err := NewRedisHashCache[string](client, 0)
+		assert.Nil(tt, err)
+		assert.Nil(tt, hc.Set(ctx, "k", "v", time.Now()))
+		assert.Equal(tt, `"v"`, mr.HGet("k", "__v"))
+		assert.Equal(tt, time.Duration(0), mr.TTL("k"))
+		got, ok := hc.Get(ctx, "k", time.Minute)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v", got)
+	})
+
+	t.Run("struct value", func(tt *testing.T) {
+		hc, err := NewRedisHashCache[hashUser](client, time.Minute, WithCodec(MsgpackCodec))
+		assert.Nil(tt, err)
+		assert.Nil(tt, hc.Set(ctx, "s", hashUser{ID: 1, Name: "a"}, time.Now()))
+		got, ok := hc.GetFields(ctx, "s", []string{"id"}, time.Minute)
+		assert.True(tt, ok)
+		assert.Equal(tt, hashUser{ID: 1}, got)
+		assert.Equal(tt, "msgpack", mr.HGet("s", "__n"))
+	})
+
+	t.Run("invalid options", func(tt *testing.T) {
+		keyring, err := NewKeyring(EncryptionKey{ID: 1, Key: make([]byte, 32)})
+		assert.Nil(tt, err)
+		_, err = NewRedisHashCache[hashUser](client, time.Minute, WithCompression(ZstdCompressor, 0))
+		assert.NotNil(tt, err)
+		_, err = NewRedisHashCache[hashUser](client, time.Minute, WithEncryption(keyring, true))
+		assert.NotNil(tt, err)
+		_, err = NewRedisHashCache[hashUser](client, time.Minute, WithSchema(Schema[hashUser]{Version: 1}))
+		assert.NotNil(tt, err)
+		_, err = NewRedisHashCache[hashUser](client, time.Minute, WithHashBucket(func(key string) (string, string) { return "bucket", key }),
+			WithSchema(Schema[string]{Version: 1}))
+		assert.ErrorIs(tt, err, ErrSchemaType)
+
+		// 桶模式按完整数据编码，支持压缩及加密
+		bucket := func(key string) (string, string) { return "bucket", key }
+		hc, err := NewRedisHashCache[hashUser](client, time.Minute, WithHashBucket(bucket),
+			WithCompression(ZstdCompressor, 0), WithEncryption(keyring, true))
+		assert.Nil(tt, err)
+		assert.Nil(tt, hc.Set(ctx, "e", hashUser{ID: 1}, time.Now()))
+		got, ok := hc.Get(ctx, "e", time.Minute)
+		assert.True(tt, ok)
+		assert.Equal(tt, hashUser{ID: 1}, got)
+	})
+
+	t.Run("reserved field", func(tt *testing.T) {
+		_, err := NewRedisHashCache[struct {
+			Value string `json:"__v"`
+		}](client, time.Minute)
+		assert.NotNil(tt, err)
+		_, err = NewRedisHashCache[*struct {
+			CreateAt int64 `cachex:"__c"`
+		}](client, time.Minute)
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("duplicate field", func(tt *testing.T) {
+		_, err := NewRedisHashCache[struct {
+			Name  string `json:"name"`
+			Alias string `cachex:"name"`
+		}](client, time.Minute)
+		assert.ErrorContains(tt, err, "duplicated")
+		_, err = NewRedisHashCache[struct {
+			Name string
+			Nick string `json:"Name"`
+		}](client, time.Minute)
+		assert.ErrorContains(tt, err, "duplicated")
+	})
+
+	t.Run("nil codec", func(tt *testing.T) {
+		_, err := NewRedisHashCache[hashUser](client, time.Minute, WithCodec(nil))
+		assert.ErrorContains(tt, err, "codec is nil")
+		_, err = NewRedisHashCache[hashUser](client, time.Minute, WithCodec(nil),
+			WithHashBucket(func(key string) (string, string) { return "bucket", key }))
+		assert.ErrorContains(tt, err, "codec is nil")
+	})
+}
+
+func TestRedisHashCache_Bucket(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	bucket := func(key string) (string, string) {
+		return "bucket:" + key[:1], key
+	}
+	hc, err := NewRedisHashCache[string](client, time.Minute, WithHashBucket(bucket), WithBatch(2, 2))
+	assert.Nil(t, err)
+
+	t.Run("set and get", func(tt *testing.T) {
+		assert.Nil(tt, hc.Set(ctx, "a1", "v1", time.Now()))
+		assert.Nil(tt, hc.MSet(ctx, map[string]string{"a2": "v2", "b1": "v3", "b2": "v4", "b3": "v5"}, time.Now()))
+		fields, _ := mr.HKeys("bucket:a")
+		assert.Equal(tt, []string{"a1", "a2"}, fields)
+		assert.Greater(tt, mr.TTL("bucket:b"), 59*time.Second)
+
+		got, ok := hc.Get(ctx, "a1", time.Minute)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v1", got)
+		got, ok = hc.GetFields(ctx, "b1", []string{"unused"}, time.Minute)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v3", got)
+		_, ok = hc.Get(ctx, "a3", time.Minute)
+		assert.False(tt, ok)
+		assert.Equal(tt, map[string]string{"a1": "v1", "a2": "v2", "b3": "v5"}, hc.MGet(ctx, []string{"a1", "a2", "a3", "b3"}, time.Minute))
+	})
+
+	t.Run("default", func(tt *testing.T) {
+		assert.Nil(tt, hc.SetDefault(ctx, []string{"c1"}, time.Now()))
+		env, found, err := hc.V2().Get(ctx, "c1", time.Minute)
+		assert.Nil(tt, err)
+		assert.True(tt, found)
+		assert.True(tt, env.Default)
+	})
+
+	t.Run("corrupt", func(tt *testing.T) {
+		mr.HSet("bucket:x", "x1", "bad")
+		_, _, err := hc.V2().Get(ctx, "x1", time.Minute)
+		var corrupt *CorruptError
+		assert.ErrorAs(tt, err, &corrupt)
+		_, err = hc.V2().MGet(ctx, []string{"x1", "a1"}, time.Minute)
+		assert.ErrorAs(tt, err, &corrupt)
+	})
+
+	t.Run("delete field", func(tt *testing.T) {
+		_ = hc.MSet(ctx, map[string]string{"d1": "v", "d2": "v", "d3": "v"}, time.Now())
+		assert.Nil(tt, hc.Delete(ctx, "d1"))
+		assert.Nil(tt, hc.MDelete(ctx, []string{"d2"}))
+		fields, _ := mr.HKeys("bucket:d")
+		assert.Equal(tt, []string{"d3"}, fields)
+	})
+
+	t.Run("ttl and touch", func(tt *testing.T) {
+		mr.SetTTL("bucket:a", time.Second)
+		ok, err := hc.Touch(ctx, "a1", 0)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		ttl, ok, err := hc.TTL(ctx, "a2")
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		assert.Equal(tt, time.Minute, ttl)
+		ok, _ = hc.Touch(ctx, "a9", time.Hour)
+		assert.False(tt, ok)
+		_, ok, _ = hc.TTL(ctx, "a9")
+		assert.False(tt, ok)
+	})
+
+	t.Run("schema", func(tt *testing.T) {
+		versioned, err := NewRedisHashCache[string](client, time.Minute, WithHashBucket(bucket), WithSchema(Schema[string]{Version: 2}))
+		assert.Nil(tt, err)
+		assert.Equal(tt, uint32(2), versioned.SchemaInfo().Version)
+		_, ok := versioned.Get(ctx, "a1", time.Minute)
+		assert.False(tt, ok)
+
+		// 不覆盖更高schema版本的数据，空值不检查
+		assert.Nil(tt, versioned.Set(ctx, "a1", "v2", time.Now()))
+		assert.ErrorIs(tt, hc.Set(ctx, "a1", "v1", time.Now()), ErrSchemaNewer)
+		err = hc.MSet(ctx, map[string]string{"a1": "v1", "a2": "v1"}, time.Now())
+		assert.ErrorIs(tt, err, ErrSchemaNewer)
+		assert.Contains(tt, err.Error(), "[a1]")
+		got, ok := versioned.Get(ctx, "a1", time.Minute)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v2", got)
+		got, ok = hc.Get(ctx, "a2", time.Minute)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v1", got)
+		assert.Nil(tt, hc.SetDefault(ctx, []string{"a1"}, time.Now()))
+		_, ok = versioned.Get(ctx, "a1", time.Minute)
+		assert.False(tt, ok)
+	})
+}
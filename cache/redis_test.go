@@ -2,6 +2,8 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
@@ -250,8 +252,8 @@ func TestRedisCache_Set(t *testing.T) {
 		err := rc.Set(ctx, "success", "success", now)
 		assert.Nil(tt, err)
 		val, _ := mr.Get("success")
-		want, _ := utils.MarshalData("success", now.UnixMilli())
-		assert.JSONEq(tt, string(want), val)
+		want, _ := rc.enc.marshalData("success", "success", now.UnixMilli(), 0)
+		assert.Equal(tt, string(want), val)
 	})
 
 	t.Run("redis_error", func(tt *testing.T) {
@@ -289,9 +291,9 @@ func TestRedisCache_MSet(t *testing.T) {
 		err := rc.MSet(ctx, kvs, now)
 		assert.Nil(tt, err)
 		for k, v := range kvs {
-			want, _ := utils.MarshalData(v, now.UnixMilli())
+			want, _ := rc.enc.marshalData(k, v, now.UnixMilli(), 0)
 			val, _ := mr.Get(k)
-			assert.JSONEq(tt, string(want), val)
+			assert.Equal(tt, string(want), val)
 		}
 	})
 
@@ -331,16 +333,16 @@ func TestRedisCache_SetDefault(t *testing.T) {
 	t.Run("success", func(tt *testing.T) {
 		err := rc.SetDefault(ctx, []string{"default_1", "default_2", "default_3"}, now)
 		assert.Nil(tt, err)
-		want := utils.NewDefaultDataWithMarshal[string](utils.ConvertTimestamp(now))
+		want := rc.enc.marshalDefault(utils.ConvertTimestamp(now))
 		got, err := mr.Get("default_1")
 		assert.Nil(tt, err)
-		assert.JSONEq(tt, string(want), got)
+		assert.Equal(tt, string(want), got)
 		got, err = mr.Get("default_2")
 		assert.Nil(tt, err)
-		assert.JSONEq(tt, string(want), got)
+		assert.Equal(tt, string(want), got)
 		got, err = mr.Get("default_3")
 		assert.Nil(tt, err)
-		assert.JSONEq(tt, string(want), got)
+		assert.Equal(tt, string(want), got)
 	})
 
 	t.Run("redis error", func(tt *testing.T) {
@@ -447,3 +449,392 @@ func TestRedisCache_Ping(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, "", pong)
 }
+
+func TestRedisCache_Lease(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	ttl := 30 * time.Minute
+	expire := 20 * time.Minute
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	rc := &RedisCache[string]{client: client, ttl: ttl}
+
+	t.Run("set with lease", func(tt *testing.T) {
+		token, ok, err := rc.AcquireLease(ctx, "set_with_lease", time.Second)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		assert.True(tt, mr.Exists("{set_with_lease}:lease"))
+
+		_, ok, err = rc.AcquireLease(ctx, "set_with_lease", time.Second)
+		assert.Nil(tt, err)
+		assert.False(tt, ok)
+
+		set, err := rc.SetWithLease(ctx, "set_with_lease", "value", time.Now(), token, 0)
+		assert.Nil(tt, err)
+		assert.True(tt, set)
+		assert.False(tt, mr.Exists("{set_with_lease}:lease"))
+		got, ok := rc.Get(ctx, "set_with_lease", expire)
+		assert.True(tt, ok)
+		assert.Equal(tt, "value", got)
+	})
+
+	t.Run("delete invalidate lease", func(tt *testing.T) {
+		token, ok, err := rc.AcquireLease(ctx, "delete_invalidate", time.Second)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+
+		err = rc.Delete(ctx, "delete_invalidate")
+		assert.Nil(tt, err)
+
+		set, err := rc.SetWithLease(ctx, "delete_invalidate", "stale", time.Now(), token, 0)
+		assert.Nil(tt, err)
+		assert.False(tt, set)
+		assert.False(tt, mr.Exists("delete_invalidate"))
+	})
+
+	t.Run("mdelete invalidate lease", func(tt *testing.T) {
+		token, _, _ := rc.AcquireLease(ctx, "mdelete_invalidate", time.Second)
+		err := rc.MDelete(ctx, []string{"mdelete_invalidate"})
+		assert.Nil(tt, err)
+		set, err := rc.SetWithLease(ctx, "mdelete_invalidate", "stale", time.Now(), token, 0)
+		assert.Nil(tt, err)
+		assert.False(tt, set)
+	})
+
+	t.Run("release lease", func(tt *testing.T) {
+		token, _, _ := rc.AcquireLease(ctx, "release_lease", time.Second)
+		err := rc.ReleaseLease(ctx, "release_lease", token+1)
+		assert.Nil(tt, err)
+		assert.True(tt, mr.Exists("{release_lease}:lease"))
+		err = rc.ReleaseLease(ctx, "release_lease", token)
+		assert.Nil(tt, err)
+		assert.False(tt, mr.Exists("{release_lease}:lease"))
+	})
+
+	t.Run("lease expired", func(tt *testing.T) {
+		token, _, _ := rc.AcquireLease(ctx, "lease_expired", time.Second)
+		mr.FastForward(2 * time.Second)
+		set, err := rc.SetWithLease(ctx, "lease_expired", "stale", time.Now(), token, 0)
+		assert.Nil(tt, err)
+		assert.False(tt, set)
+	})
+
+	t.Run("redis_error", func(tt *testing.T) {
+		mr.SetError("unit_test")
+		defer mr.SetError("")
+		_, ok, err := rc.AcquireLease(ctx, "redis_error", time.Second)
+		assert.NotNil(tt, err)
+		assert.False(tt, ok)
+	})
+}
+
+func TestRedisCache_V2(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rc := &RedisCache[string]{client: redis.NewClient(&redis.Options{Addr: mr.Addr()}), ttl: 30 * time.Minute}
+	v2 := AsV2[string](rc)
+	createTime := time.Now().Add(-time.Minute)
+	_ = rc.Set(ctx, "a", "v", createTime)
+	_ = rc.SetDefault(ctx, []string{"b"}, time.Now())
+	mr.Set("c", "invalid")
+
+	t.Run("get", func(tt *testing.T) {
+		env, found, err := v2.Get(ctx, "a", time.Hour)
+		assert.Nil(tt, err)
+		assert.True(tt, found)
+		assert.Equal(tt, &Envelope[string]{Data: "v", CreateAt: createTime.UnixMilli()}, env)
+		_, found, err = v2.Get(ctx, "a", time.Second)
+		assert.Nil(tt, err)
+		assert.False(tt, found)
+		env, found, err = v2.Get(ctx, "b", time.Hour)
+		assert.Nil(tt, err)
+		assert.True(tt, found)
+		assert.True(tt, env.Default)
+		_, found, err = v2.Get(ctx, "c", time.Hour)
+		var corrupt *CorruptError
+		assert.ErrorAs(tt, err, &corrupt)
+		assert.Equal(tt, []byte("invalid"), corrupt.Entries["c"])
+		assert.False(tt, found)
+		_, found, err = v2.Get(ctx, "missing", time.Hour)
+		assert.Nil(tt, err)
+		assert.False(tt, found)
+	})
+
+	t.Run("mget", func(tt *testing.T) {
+		envs, err := v2.MGet(ctx, []string{"a", "b", "c", "missing"}, time.Hour)
+		var corrupt *CorruptError
+		assert.ErrorAs(tt, err, &corrupt)
+		assert.Equal(tt, []string{"c"}, keysOf(corrupt.Entries))
+		assert.Len(tt, envs, 2)
+		envs, err = v2.MGet(ctx, []string{"a", "b"}, time.Second)
+		assert.Nil(tt, err)
+		assert.Len(tt, envs, 1)
+	})
+
+	t.Run("redis_error", func(tt *testing.T) {
+		mr.SetError("unit_test")
+		defer mr.SetError("")
+		_, found, err := v2.Get(ctx, "a", time.Hour)
+		assert.NotNil(tt, err)
+		assert.False(tt, found)
+		_, err = v2.MGet(ctx, []string{"a"}, time.Hour)
+		assert.NotNil(tt, err)
+	})
+}
+
+func TestRedisCache_Lock(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	rc := &RedisCache[string]{client: client, ttl: 30 * time.Minute}
+
+	t.Run("lock and unlock", func(tt *testing.T) {
+		token, ok, err := rc.Lock(ctx, "lock", time.Second)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		assert.True(tt, mr.Exists("{lock}:lock"))
+
+		_, ok, err = rc.Lock(ctx, "lock", time.Second)
+		assert.Nil(tt, err)
+		assert.False(tt, ok)
+
+		err = rc.Unlock(ctx, "lock", token+1)
+		assert.Nil(tt, err)
+		assert.True(tt, mr.Exists("{lock}:lock"))
+		err = rc.Unlock(ctx, "lock", token)
+		assert.Nil(tt, err)
+		assert.False(tt, mr.Exists("{lock}:lock"))
+
+		_, ok, err = rc.Lock(ctx, "lock", time.Second)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+	})
+
+	t.Run("lock expired", func(tt *testing.T) {
+		_, ok, _ := rc.Lock(ctx, "lock_expired", time.Second)
+		assert.True(tt, ok)
+		mr.FastForward(2 * time.Second)
+		_, ok, err := rc.Lock(ctx, "lock_expired", time.Second)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+	})
+
+	t.Run("redis_error", func(tt *testing.T) {
+		mr.SetError("unit_test")
+		defer mr.SetError("")
+		_, ok, err := rc.Lock(ctx, "redis_error", time.Second)
+		assert.NotNil(tt, err)
+		assert.False(tt, ok)
+	})
+}
+
+func TestRedisCache_SetWithVersion(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	ttl := 30 * time.Minute
+	expire := 20 * time.Minute
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	rc := &RedisCache[string]{client: client, ttl: ttl}
+
+	t.Run("set with version", func(tt *testing.T) {
+		err := rc.SetWithVersion(ctx, "set_with_version", "v2", time.Now(), 2)
+		assert.Nil(tt, err)
+		assert.True(tt, mr.Exists("{set_with_version}:version"))
+		err = rc.SetWithVersion(ctx, "set_with_version", "v1", time.Now(), 1)
+		assert.True(tt, errors.Is(err, ErrStaleVersion))
+		got, _ := rc.Get(ctx, "set_with_version", expire)
+		assert.Equal(tt, "v2", got)
+		err = rc.SetWithVersion(ctx, "set_with_version", "v3", time.Now(), 3)
+		assert.Nil(tt, err)
+		got, _ = rc.Get(ctx, "set_with_version", expire)
+		assert.Equal(tt, "v3", got)
+	})
+
+	t.Run("large version", func(tt *testing.T) {
+		err := rc.SetWithVersion(ctx, "large_version", "v2", time.Now(), 1697040000000000002)
+		assert.Nil(tt, err)
+		err = rc.SetWithVersion(ctx, "large_version", "v1", time.Now(), 1697040000000000001)
+		assert.True(tt, errors.Is(err, ErrStaleVersion))
+		err = rc.SetWithVersion(ctx, "large_version", "v0", time.Now(), 999)
+		assert.True(tt, errors.Is(err, ErrStaleVersion))
+	})
+
+	t.Run("delete version", func(tt *testing.T) {
+		_ = rc.SetWithVersion(ctx, "delete_version", "v2", time.Now(), 2)
+		err := rc.Delete(ctx, "delete_version")
+		assert.Nil(tt, err)
+		assert.False(tt, mr.Exists("{delete_version}:version"))
+	})
+
+	t.Run("mset with version", func(tt *testing.T) {
+		_ = rc.SetWithVersion(ctx, "mset_1", "v2", time.Now(), 2)
+		err := rc.MSetWithVersion(ctx,
+			map[string]string{"mset_1": "v1", "mset_2": "v1"},
+			map[string]int64{"mset_1": 1, "mset_2": 1},
+			time.Now(),
+		)
+		assert.True(tt, errors.Is(err, ErrStaleVersion))
+		got, _ := rc.Get(ctx, "mset_1", expire)
+		assert.Equal(tt, "v2", got)
+		got, _ = rc.Get(ctx, "mset_2", expire)
+		assert.Equal(tt, "v1", got)
+	})
+
+	t.Run("redis_error", func(tt *testing.T) {
+		mr.SetError("unit_test")
+		defer mr.SetError("")
+		err := rc.SetWithVersion(ctx, "redis_error", "v1", time.Now(), 1)
+		assert.NotNil(tt, err)
+		assert.False(tt, errors.Is(err, ErrStaleVersion))
+	})
+}
+
+func TestRedisCache_SetTombstone(t *testing.T) {
+	ctx := context.Background()
+	expire := 20 * time.Minute
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	rc := &RedisCache[string]{client: client, ttl: 30 * time.Minute}
+
+	t.Run("tombstone read as miss", func(tt *testing.T) {
+		_ = rc.Set(ctx, "tombstone_miss", "value", time.Now())
+		err := rc.SetTombstone(ctx, []string{"tombstone_miss"}, time.Now(), time.Minute)
+		assert.Nil(tt, err)
+		assert.True(tt, mr.Exists("{tombstone_miss}:tombstone"))
+		assert.Equal(tt, time.Minute, mr.TTL("tombstone_miss"))
+		got, ok := rc.Get(ctx, "tombstone_miss", expire)
+		assert.False(tt, ok)
+		assert.Equal(tt, "", got)
+		assert.Empty(tt, rc.MGet(ctx, []string{"tombstone_miss"}, expire))
+	})
+
+	t.Run("reject write started before tombstone", func(tt *testing.T) {
+		start := time.Now().Add(-time.Second)
+		err := rc.SetTombstone(ctx, []string{"tombstone_reject"}, time.Now(), time.Minute)
+		assert.Nil(tt, err)
+		err = rc.SetWithVersion(ctx, "tombstone_reject", "stale", start, 0)
+		assert.True(tt, errors.Is(err, ErrTombstoned))
+		err = rc.MSetWithVersion(ctx, map[string]string{"tombstone_reject": "stale"}, nil, start)
+		assert.True(tt, errors.Is(err, ErrTombstoned))
+		_, ok := rc.Get(ctx, "tombstone_reject", expire)
+		assert.False(tt, ok)
+
+		err = rc.SetWithVersion(ctx, "tombstone_reject", "fresh", time.Now().Add(time.Millisecond), 0)
+		assert.Nil(tt, err)
+		got, ok := rc.Get(ctx, "tombstone_reject", expire)
+		assert.True(tt, ok)
+		assert.Equal(tt, "fresh", got)
+	})
+
+	t.Run("tombstone expired", func(tt *testing.T) {
+		start := time.Now()
+		_ = rc.SetTombstone(ctx, []string{"tombstone_expired"}, time.Now().Add(time.Second), time.Minute)
+		mr.FastForward(2 * time.Minute)
+		assert.False(tt, mr.Exists("{tombstone_expired}:tombstone"))
+		err := rc.SetWithVersion(ctx, "tombstone_expired", "value", start, 0)
+		assert.Nil(tt, err)
+	})
+
+	t.Run("set default keep tombstone", func(tt *testing.T) {
+		_ = rc.SetTombstone(ctx, []string{"tombstone_default"}, time.Now(), time.Minute)
+		err := rc.SetDefault(ctx, []string{"tombstone_default"}, time.Now().Add(time.Millisecond))
+		assert.Nil(tt, err)
+		env, ok := rc.GetEnvelope(ctx, "tombstone_default")
+		assert.True(tt, ok)
+		assert.True(tt, env.Tombstone)
+	})
+
+	t.Run("tombstone invalidate lease", func(tt *testing.T) {
+		token, _, _ := rc.AcquireLease(ctx, "tombstone_lease", time.Second)
+		_ = rc.SetTombstone(ctx, []string{"tombstone_lease"}, time.Now(), time.Minute)
+		set, err := rc.SetWithLease(ctx, "tombstone_lease", "stale", time.Now(), token, 0)
+		assert.Nil(tt, err)
+		assert.False(tt, set)
+	})
+}
+
+func TestRedisCache_Update(t *testing.T) {
+	ctx := context.Background()
+	expire := 20 * time.Minute
+	mr := miniredis.RunT(t)
+	rc := &RedisCache[string]{client: redis.NewClient(&redis.Options{Addr: mr.Addr()}), ttl: 30 * time.Minute}
+
+	t.Run("update missing and existing", func(tt *testing.T) {
+		got, err := rc.Update(ctx, "update", func(old string, found bool) (string, error) {
+			assert.False(tt, found)
+			return "a", nil
+		}, time.Now())
+		assert.Nil(tt, err)
+		assert.Equal(tt, "a", got)
+		got, err = rc.Update(ctx, "update", func(old string, found bool) (string, error) {
+			assert.True(tt, found)
+			return old + "b", nil
+		}, time.Now())
+		assert.Nil(tt, err)
+		assert.Equal(tt, "ab", got)
+		got, _ = rc.Get(ctx, "update", expire)
+		assert.Equal(tt, "ab", got)
+	})
+
+	t.Run("fn error", func(tt *testing.T) {
+		_ = rc.Set(ctx, "update_error", "a", time.Now())
+		_, err := rc.Update(ctx, "update_error", func(old string, found bool) (string, error) {
+			return "b", errors.New("fn error")
+		}, time.Now())
+		assert.EqualError(tt, err, "fn error")
+		got, _ := rc.Get(ctx, "update_error", expire)
+		assert.Equal(tt, "a", got)
+	})
+
+	t.Run("reject during tombstone grace", func(tt *testing.T) {
+		_ = rc.SetTombstone(ctx, []string{"update_tombstone"}, time.Now(), time.Minute)
+		_, err := rc.Update(ctx, "update_tombstone", func(old string, found bool) (string, error) {
+			tt.Fatal("should not call fn")
+			return "a", nil
+		}, time.Now())
+		assert.True(tt, errors.Is(err, ErrTombstoned))
+	})
+
+	t.Run("keep version and invalidate lease", func(tt *testing.T) {
+		_ = rc.SetWithVersion(ctx, "update_version", "a", time.Now(), 5)
+		token, _, _ := rc.AcquireLease(ctx, "update_version", time.Second)
+		_, err := rc.Update(ctx, "update_version", func(old string, found bool) (string, error) {
+			return old + "b", nil
+		}, time.Now())
+		assert.Nil(tt, err)
+		err = rc.SetWithVersion(ctx, "update_version", "stale", time.Now(), 4)
+		assert.True(tt, errors.Is(err, ErrStaleVersion))
+		set, err := rc.SetWithLease(ctx, "update_version", "stale", time.Now(), token, 0)
+		assert.Nil(tt, err)
+		assert.False(tt, set)
+		got, _ := rc.Get(ctx, "update_version", expire)
+		assert.Equal(tt, "ab", got)
+	})
+
+	t.Run("conflict", func(tt *testing.T) {
+		calls := 0
+		_, err := rc.Update(ctx, "update_conflict", func(old string, found bool) (string, error) {
+			calls++
+			_ = rc.client.Set(ctx, "update_conflict", "other", 0).Err()
+			return "a", nil
+		}, time.Now())
+		assert.True(tt, errors.Is(err, ErrUpdateConflict))
+		assert.Equal(tt, maxUpdateRetries, calls)
+	})
+
+	t.Run("concurrent", func(tt *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := rc.Update(ctx, "update_concurrent", func(old string, found bool) (string, error) {
+					return old + "x", nil
+				}, time.Now())
+				assert.Nil(tt, err)
+			}()
+		}
+		wg.Wait()
+		got, _ := rc.Get(ctx, "update_concurrent", expire)
+		assert.Equal(tt, 5, len(got))
+	})
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// ringPointsPerServer 每个节点的虚拟节点数
+const ringPointsPerServer = 160
+
+// hashRing 一致性哈希节点选择，实现memcache.ServerSelector，增删节点时只迁移相邻区间的key
+type hashRing struct {
+	addrs  []net.Addr
+	points []ringPoint // 按hash升序
+}
+
+// ringPoint 虚拟节点
+type ringPoint struct {
+	hash uint32
+	addr net.Addr
+}
+
+// newHashRing 解析节点地址并生成虚拟节点，地址含/时为unix socket
+func newHashRing(servers []string) (*hashRing, error) {
+	r := &hashRing{points: make([]ringPoint, 0, len(servers)*ringPointsPerServer)}
+	for _, server := range servers {
+		addr, err := resolveServer(server)
+		if err != nil {
+			return nil, err
+		}
+		r.addrs = append(r.addrs, addr)
+		// 每个md5摘要生成4个虚拟节点
+		for i := 0; i < ringPointsPerServer/4; i++ {
+			sum := md5.Sum([]byte(server + "-" + strconv.Itoa(i)))
+			for j := 0; j < 4; j++ {
+				r.points = append(r.points, ringPoint{hash: binary.LittleEndian.Uint32(sum[j*4:]), addr: addr})
+			}
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		return r.points[i].hash < r.points[j].hash
+	})
+	return r, nil
+}
+
+// PickServer 选择hash顺时针方向的第一个虚拟节点
+func (r *hashRing) PickServer(key string) (net.Addr, error) {
+	if len(r.points) == 0 {
+		return nil, memcache.ErrNoServers
+	}
+	sum := md5.Sum([]byte(key))
+	hash := binary.LittleEndian.Uint32(sum[:])
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= hash
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].addr, nil
+}
+
+func (r *hashRing) Each(fn func(net.Addr) error) error {
+	for _, addr := range r.addrs {
+		if err := fn(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveServer 解析节点地址
+func resolveServer(server string) (net.Addr, error) {
+	if strings.Contains(server, "/") {
+		return net.ResolveUnixAddr("unix", server)
+	}
+	return net.ResolveTCPAddr("tcp", server)
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashRing(t *testing.T) {
+	servers := []string{"127.0.0.1:11211", "127.0.0.1:11212", "127.0.0.1:11213"}
+
+	t.Run("distribution", func(tt *testing.T) {
+		r, err := newHashRing(servers)
+		assert.Nil(tt, err)
+		counts := make(map[string]int)
+		for i := 0; i < 3000; i++ {
+			addr, err := r.PickServer("key:" + strconv.Itoa(i))
+			assert.Nil(tt, err)
+			counts[addr.String()]++
+		}
+		assert.Len(tt, counts, 3)
+		for _, n := range counts {
+			assert.Greater(tt, n, 700)
+		}
+	})
+
+	t.Run("add server", func(tt *testing.T) {
+		before, _ := newHashRing(servers)
+		after, _ := newHashRing(append(servers, "127.0.0.1:11214"))
+		moved := 0
+		for i := 0; i < 3000; i++ {
+			key := "key:" + strconv.Itoa(i)
+			a, _ := before.PickServer(key)
+			b, _ := after.PickServer(key)
+			if a.String() != b.String() {
+				moved++
+				assert.Equal(tt, "127.0.0.1:11214", b.String())
+			}
+		}
+		assert.Less(tt, moved, 1200)
+	})
+
+	t.Run("each", func(tt *testing.T) {
+		r, _ := newHashRing(append(servers, "/tmp/memcached.sock"))
+		var addrs []string
+		assert.Nil(tt, r.Each(func(addr net.Addr) error {
+			addrs = append(addrs, addr.Network()+":"+addr.String())
+			return nil
+		}))
+		assert.Equal(tt, []string{"tcp:127.0.0.1:11211", "tcp:127.0.0.1:11212", "tcp:127.0.0.1:11213", "unix:/tmp/memcached.sock"}, addrs)
+	})
+
+	t.Run("no servers", func(tt *testing.T) {
+		r, _ := newHashRing(nil)
+		_, err := r.PickServer("key")
+		assert.ErrorIs(tt, err, memcache.ErrNoServers)
+	})
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/kakkk/cachex/internal/model"
+)
+
+var (
+	// ErrSchemaOutdated 缓存数据的schema版本低于当前版本且未注册升级函数，视为未命中
+	ErrSchemaOutdated = errors.New("schema outdated")
+	// ErrSchemaNewer 缓存数据由更高schema版本的实例写入，如滚动发布期间，读取时视为未命中，共享缓存拒绝覆盖写入
+	ErrSchemaNewer = errors.New("schema newer")
+	// ErrSchemaType WithSchema的类型与缓存数据类型不一致
+	ErrSchemaType = errors.New("schema type mismatch")
+)
+
+// Migration 将旧schema版本的缓存数据升级为当前版本，decode将缓存中的原始数据解码到旧版本结构
+type Migration[T any] func(decode func(v any) error) (T, error)
+
+// Schema 缓存数据schema版本，Version为0时与未记录版本的旧数据一致，
+// Migrations的key为旧schema版本，直接升级为当前版本
+type Schema[T any] struct {
+	Version    uint32
+	Migrations map[uint32]Migration[T]
+}
+
+// SchemaInfo 缓存构造时通过WithSchema设置的schema
+type SchemaInfo struct {
+	Version    uint32   // schema版本
+	Migrations []uint32 // 已注册升级函数的旧schema版本，升序
+	Err        error    // schema配置错误，如ErrSchemaType
+}
+
+// SchemaVersioner 支持schema版本的缓存，LRUCache等进程内缓存不序列化数据，无需实现
+type SchemaVersioner interface {
+	SchemaInfo() SchemaInfo
+}
+
+// WithSchema 设置缓存数据schema版本及升级函数，仅序列化数据的缓存生效；T与缓存数据类型不一致时
+// 返回错误的构造函数返回ErrSchemaType，其他构造函数记录在SchemaInfo.Err中，由cachex.Builder检查；
+// from不小于Version的升级函数不会被使用
+func WithSchema[T any](schema Schema[T]) Option {
+	return func(o *options) {
+		o.schema = schema
+	}
+}
+
+// migrate 按schema版本解码数据，旧版本数据使用注册的升级函数
+func (s Schema[T]) migrate(stored uint32, decode func(v any) error, data *T) error {
+	if stored == s.Version {
+		return decode(data)
+	}
+	if stored > s.Version {
+		return fmt.Errorf("%w: stored %v, current %v", ErrSchemaNewer, stored, s.Version)
+	}
+	m, ok := s.Migrations[stored]
+	if !ok {
+		return fmt.Errorf("%w: stored %v, current %v", ErrSchemaOutdated, stored, s.Version)
+	}
+	migrated, err := m(decode)
+	if err != nil {
+		return fmt.Errorf("migrate schema %v to %v: %w", stored, s.Version, err)
+	}
+	*data = migrated
+	return nil
+}
+
+// info 返回schema版本及已注册升级函数的旧版本
+func (s Schema[T]) info() SchemaInfo {
+	info := SchemaInfo{Version: s.Version}
+	for from := range s.Migrations {
+		info.Migrations = append(info.Migrations, from)
+	}
+	sort.Slice(info.Migrations, func(i, j int) bool { return info.Migrations[i] < info.Migrations[j] })
+	return info
+}
+
+// checkSchema 已存在更高schema版本的数据时拒绝写入，避免滚动发布期间旧实例覆盖新实例写入的数据
+func checkSchema(current *model.CacheMeta, version uint32) error {
+	if current.Schema > version {
+		return fmt.Errorf("%w: stored %v, current %v", ErrSchemaNewer, current.Schema, version)
+	}
+	return nil
+}
+
+// isSchemaMismatch 是否为schema版本不一致，此类数据视为未命中并回源刷新
+func isSchemaMismatch(err error) bool {
+	return errors.Is(err, ErrSchemaOutdated) || errors.Is(err, ErrSchemaNewer)
+}
@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/allegro/bigcache/v3"
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type schemaV1 struct {
+	Name string
+}
+
+type schemaV2 struct {
+	FirstName string
+	LastName  string
+}
+
+func TestSchema(t *testing.T) {
+	v1 := encoder[schemaV1]{schema: Schema[schemaV1]{Version: 1}}
+	val, err := v1.marshalData("k", schemaV1{Name: "a b"}, 1017072000000, 0)
+	assert.Nil(t, err)
+	migrateV1 := func(decode func(v any) error) (schemaV2, error) {
+		var old schemaV1
+		if err := decode(&old); err != nil {
+			return schemaV2{}, err
+		}
+		return schemaV2{FirstName: old.Name[:1], LastName: old.Name[2:]}, nil
+	}
+
+	t.Run("same version", func(tt *testing.T) {
+		got, err := v1.unmarshal("k", val)
+		assert.Nil(tt, err)
+		assert.Equal(tt, schemaV1{Name: "a b"}, got.Data)
+		raw, err := decode(val)
+		assert.Nil(tt, err)
+		assert.Equal(tt, uint32(1), raw.schema)
+	})
+
+	t.Run("migrate", func(tt *testing.T) {
+		v2 := encoder[schemaV2]{schema: Schema[schemaV2]{Version: 2, Migrations: map[uint32]Migration[schemaV2]{1: migrateV1}}}
+		got, err := v2.unmarshal("k", val)
+		assert.Nil(tt, err)
+		assert.Equal(tt, schemaV2{FirstName: "a", LastName: "b"}, got.Data)
+		assert.Equal(tt, int64(1017072000000), got.CreateAt)
+	})
+
+	t.Run("outdated", func(tt *testing.T) {
+		v2 := encoder[schemaV2]{schema: Schema[schemaV2]{Version: 2}}
+		_, err := v2.unmarshal("k", val)
+		assert.ErrorIs(tt, err, ErrSchemaOutdated)
+		env, corrupt := decodeEntry(v2, "k", val, time.Now(), 0, nil)
+		assert.Nil(tt, env)
+		assert.Nil(tt, corrupt)
+	})
+
+	t.Run("newer", func(tt *testing.T) {
+		_, err := encoder[schemaV1]{}.unmarshal("k", val)
+		assert.ErrorIs(tt, err, ErrSchemaNewer)
+	})
+
+	t.Run("legacy", func(tt *testing.T) {
+		legacy, _ := encoder[schemaV1]{}.marshalData("k", schemaV1{Name: "a b"}, 1017072000000, 0)
+		v2 := encoder[schemaV2]{schema: Schema[schemaV2]{Version: 2, Migrations: map[uint32]Migration[schemaV2]{0: migrateV1}}}
+		got, err := v2.unmarshal("k", legacy)
+		assert.Nil(tt, err)
+		assert.Equal(tt, schemaV2{FirstName: "a", LastName: "b"}, got.Data)
+	})
+
+	t.Run("migrate error", func(tt *testing.T) {
+		v2 := encoder[schemaV2]{schema: Schema[schemaV2]{Version: 2, Migrations: map[uint32]Migration[schemaV2]{
+			1: func(decode func(v any) error) (schemaV2, error) { return schemaV2{}, errors.New("bad") },
+		}}}
+		_, err := v2.unmarshal("k", val)
+		assert.NotNil(tt, err)
+		assert.False(tt, IsRecoverable(err))
+	})
+
+	t.Run("default without schema", func(tt *testing.T) {
+		got, err := encoder[schemaV2]{schema: Schema[schemaV2]{Version: 2}}.unmarshal("k", v1.marshalDefault(1017072000000))
+		assert.Nil(tt, err)
+		assert.True(tt, got.IsDefault())
+	})
+}
+
+func TestSchema_info(t *testing.T) {
+	migration := func(decode func(v any) error) (schemaV2, error) { return schemaV2{}, nil }
+	rc := NewRedisCacheWithClient[schemaV2](nil, time.Minute, WithSchema(Schema[schemaV2]{
+		Version:    3,
+		Migrations: map[uint32]Migration[schemaV2]{2: migration, 0: migration},
+	}))
+	assert.Equal(t, SchemaInfo{Version: 3, Migrations: []uint32{0, 2}}, rc.SchemaInfo())
+
+	// 类型不一致
+	mismatch := WithSchema(Schema[schemaV1]{Version: 1})
+	assert.ErrorIs(t, NewRedisCacheWithClient[schemaV2](nil, time.Minute, mismatch).SchemaInfo().Err, ErrSchemaType)
+	_, err := NewBigCacheWithConfig[schemaV2](bigcache.DefaultConfig(time.Minute), mismatch)
+	assert.ErrorIs(t, err, ErrSchemaType)
+	_, err = NewDiskCache[schemaV2](filepath.Join(t.TempDir(), "cache.db"), time.Minute, mismatch)
+	assert.ErrorIs(t, err, ErrSchemaType)
+	_, err = NewMemcachedCache[schemaV2]([]string{"127.0.0.1:11211"}, time.Minute, mismatch)
+	assert.ErrorIs(t, err, ErrSchemaType)
+}
+
+func TestSchema_newer(t *testing.T) {
+	ctx := context.Background()
+	v1, v2 := WithSchema(Schema[schemaV1]{Version: 1}), WithSchema(Schema[schemaV1]{Version: 2})
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mcServer := newFakeMemcached(t)
+	mcClient := memcache.New(mcServer.addr())
+	caches := map[string][2]Cache[schemaV1]{
+		"redis": {NewRedisCacheWithClient[schemaV1](client, time.Minute, v1), NewRedisCacheWithClient[schemaV1](client, time.Minute, v2)},
+		"redis chunking": {
+			NewRedisCacheWithClient[schemaV1](client, time.Minute, v1, WithChunking(8, 32)),
+			NewRedisCacheWithClient[schemaV1](client, time.Minute, v2, WithChunking(8, 32)),
+		},
+		"memcached": {NewMemcachedCacheWithClient[schemaV1](mcClient, time.Minute, v1), NewMemcachedCacheWithClient[schemaV1](mcClient, time.Minute, v2)},
+	}
+	for name, pair := range caches {
+		t.Run(name, func(tt *testing.T) {
+			key := "newer:" + name
+			old, current := pair[0], pair[1]
+			assert.Nil(tt, current.Set(ctx, key, schemaV1{Name: "v2"}, time.Now()))
+			assert.ErrorIs(tt, old.Set(ctx, key, schemaV1{Name: "v1"}, time.Now()), ErrSchemaNewer)
+			err := old.MSet(ctx, map[string]schemaV1{key: {Name: "v1"}, key + ":other": {Name: "v1"}}, time.Now())
+			assert.ErrorIs(tt, err, ErrSchemaNewer)
+			assert.Contains(tt, err.Error(), "["+key+"]")
+			assert.ErrorIs(tt, old.(VersionedSetter[schemaV1]).SetWithVersion(ctx, key, schemaV1{Name: "v1"}, time.Now(), 1), ErrSchemaNewer)
+			got, ok := current.Get(ctx, key, 0)
+			assert.True(tt, ok)
+			assert.Equal(tt, schemaV1{Name: "v2"}, got)
+			_, ok = old.Get(ctx, key+":other", 0)
+			assert.True(tt, ok)
+
+			// 新版本覆盖旧版本数据
+			assert.Nil(tt, current.Set(ctx, key+":other", schemaV1{Name: "v2"}, time.Now()))
+		})
+	}
+
+	t.Run("redis lease and update", func(tt *testing.T) {
+		old := NewRedisCacheWithClient[schemaV1](client, time.Minute, v1)
+		current := NewRedisCacheWithClient[schemaV1](client, time.Minute, v2)
+		// 带版本的信封头部
+		assert.Nil(tt, current.SetWithVersion(ctx, "lease", schemaV1{Name: "v2"}, time.Now(), 5))
+		token, ok, err := old.AcquireLease(ctx, "lease", time.Minute)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		set, err := old.SetWithLease(ctx, "lease", schemaV1{Name: "v1"}, time.Now(), token, 6)
+		assert.False(tt, set)
+		assert.ErrorIs(tt, err, ErrSchemaNewer)
+		_, err = old.Update(ctx, "lease", func(old schemaV1, found bool) (schemaV1, error) {
+			return schemaV1{Name: "v1"}, nil
+		}, time.Now())
+		assert.ErrorIs(tt, err, ErrSchemaNewer)
+		got, _ := current.Get(ctx, "lease", 0)
+		assert.Equal(tt, schemaV1{Name: "v2"}, got)
+	})
+}
+
+func TestSchema_backend(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	freeCache := NewFreeCache[schemaV1](1024*1024, time.Minute)
+	bigCache := NewBigCache[schemaV1](time.Minute)
+	schema := WithSchema(Schema[schemaV1]{Version: 1})
+	caches := map[string][2]Cache[schemaV1]{
+		"redis":     {NewRedisCacheWithClient[schemaV1](client, time.Minute), NewRedisCacheWithClient[schemaV1](client, time.Minute, schema)},
+		"freecache": {freeCache, &FreeCache[schemaV1]{cache: freeCache.cache, ttl: time.Minute, enc: newEncoder[schemaV1](newOptions([]Option{schema}))}},
+		"bigcache":  {bigCache, &BigCache[schemaV1]{cache: bigCache.cache, enc: newEncoder[schemaV1](newOptions([]Option{schema}))}},
+	}
+	for name, pair := range caches {
+		t.Run(name, func(tt *testing.T) {
+			assert.Nil(tt, pair[0].Set(ctx, "k", schemaV1{Name: "a"}, time.Now()))
+			c := pair[1]
+			assert.Equal(tt, uint32(1), c.(SchemaVersioner).SchemaInfo().Version)
+			_, ok := c.Get(ctx, "k", 0)
+			assert.False(tt, ok)
+			_, found, err := AsV2[schemaV1](c).Get(ctx, "k", 0)
+			assert.Nil(tt, err)
+			assert.False(tt, found)
+
+			assert.Nil(tt, c.Set(ctx, "k", schemaV1{Name: "b"}, time.Now()))
+			got, ok := c.Get(ctx, "k", 0)
+			assert.True(tt, ok)
+			assert.Equal(tt, schemaV1{Name: "b"}, got)
+		})
+	}
+}
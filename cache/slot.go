@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// clusterSlots Redis Cluster hash slot数量
+const clusterSlots = 16384
+
+// hashTag 返回key中参与分片的部分，包含非空{...}时为第一个{}中的内容
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+// keySlot 计算key的hash slot
+func keySlot(key string) int {
+	return int(crc16([]byte(hashTag(key))) % clusterSlots)
+}
+
+var (
+	slotTagsOnce sync.Once
+	slotTags     []string // 各hash slot对应的最短hash tag
+)
+
+// slotTagChars slotTag使用的字符，不包含'{'及'}'
+const slotTagChars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// slotTag 返回hash slot为slot的最短hash tag，首次调用时按长度递增枚举生成全部slot的tag
+func slotTag(slot int) string {
+	slotTagsOnce.Do(func() {
+		slotTags = make([]string, clusterSlots)
+		remain := clusterSlots
+		candidates := []string{""}
+		for remain > 0 {
+			next := make([]string, 0, len(candidates)*len(slotTagChars))
+			for _, prefix := range candidates {
+				for i := 0; i < len(slotTagChars); i++ {
+					tag := prefix + slotTagChars[i:i+1]
+					next = append(next, tag)
+					if s := crc16([]byte(tag)) % clusterSlots; slotTags[s] == "" {
+						slotTags[s] = tag
+						remain--
+					}
+				}
+			}
+			candidates = next
+		}
+	})
+	return slotTags[slot]
+}
+
+// crc16 CRC16-CCITT(XMODEM)，与Redis Cluster一致
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// groupKeys 按分片分组key，多key命令需在同一分组内执行：Cluster按hash slot，Ring按hash tag，
+// 单节点及Sentinel不分组；分组保持key首次出现的顺序
+func (rc *RedisCache[T]) groupKeys(keys []string) [][]string {
+	switch rc.client.(type) {
+	case *redis.ClusterClient:
+		return groupBy(keys, keySlot)
+	case *redis.Ring:
+		return groupBy(keys, hashTag)
+	}
+	return [][]string{keys}
+}
+
+// groupBy 按fn分组
+func groupBy[G comparable](keys []string, fn func(key string) G) [][]string {
+	index := make(map[G]int)
+	var groups [][]string
+	for _, key := range keys {
+		g := fn(key)
+		i, ok := index[g]
+		if !ok {
+			i = len(groups)
+			index[g] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], key)
+	}
+	return groups
+}
+
+// mGetRaw 批量读取原始数据，跨分片时每个分组一条MGET，由Pipeline按节点并行执行
+func (rc *RedisCache[T]) mGetRaw(ctx context.Context, keys []string) (map[string][]byte, error) {
+	groups := rc.groupKeys(keys)
+	cmds := make([]*redis.SliceCmd, len(groups))
+	if len(groups) == 1 {
+		cmds[0] = rc.client.MGet(ctx, keys...)
+	} else {
+		pipe := rc.client.Pipeline()
+		for i, group := range groups {
+			cmds[i] = pipe.MGet(ctx, group...)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+	vals := make(map[string][]byte, len(keys))
+	for i, group := range groups {
+		values, err := cmds[i].Result()
+		if err != nil {
+			return nil, err
+		}
+		for j, key := range group {
+			if val, ok := values[j].(string); ok {
+				vals[key] = []byte(val)
+			}
+		}
+	}
+	return vals, nil
+}
+
+// nodes 返回所有主节点，用于SCAN、DBSIZE等节点级命令
+func (rc *RedisCache[T]) nodes(ctx context.Context) ([]redis.UniversalClient, error) {
+	var (
+		mu    sync.Mutex
+		nodes []redis.UniversalClient
+	)
+	collect := func(_ context.Context, client *redis.Client) error {
+		mu.Lock()
+		defer mu.Unlock()
+		nodes = append(nodes, client)
+		return nil
+	}
+	switch c := rc.client.(type) {
+	case *redis.ClusterClient:
+		if err := c.ForEachMaster(ctx, collect); err != nil {
+			return nil, err
+		}
+	case *redis.Ring:
+		if err := c.ForEachShard(ctx, collect); err != nil {
+			return nil, err
+		}
+	default:
+		nodes = append(nodes, rc.client)
+	}
+	return nodes, nil
+}
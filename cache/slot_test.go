@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeySlot(t *testing.T) {
+	assert.Equal(t, uint16(0x31C3), crc16([]byte("123456789")))
+	assert.Equal(t, 12182, keySlot("foo"))
+	assert.Equal(t, keySlot("user1000"), keySlot("{user1000}.following"))
+	assert.Equal(t, keySlot("{user1000}.followers"), keySlot("{user1000}.following"))
+	assert.Equal(t, keySlot("k"), keySlot(chunkPrefix("k")+"0"))
+	assert.Equal(t, "{}a", hashTag("{}a"))
+	assert.Equal(t, "a", hashTag("x{a}{b}"))
+}
+
+func TestGroupBy(t *testing.T) {
+	groups := groupBy([]string{"a1", "b1", "a2", "c1"}, func(key string) byte { return key[0] })
+	assert.Equal(t, [][]string{{"a1", "a2"}, {"b1"}, {"c1"}}, groups)
+}
+
+// newTestCluster 两个miniredis各负责一半hash slot的集群客户端，miniredis不返回MOVED，
+// 发往错误节点的命令读不到数据
+func newTestCluster(tb testing.TB) (*redis.ClusterClient, []*miniredis.Miniredis) {
+	nodes := []*miniredis.Miniredis{miniredis.RunT(tb), miniredis.RunT(tb)}
+	client := redis.NewClusterClient(&redis.ClusterOptions{
+		ClusterSlots: func(ctx context.Context) ([]redis.ClusterSlot, error) {
+			return []redis.ClusterSlot{
+				{Start: 0, End: clusterSlots/2 - 1, Nodes: []redis.ClusterNode{{Addr: nodes[0].Addr()}}},
+				{Start: clusterSlots / 2, End: clusterSlots - 1, Nodes: []redis.ClusterNode{{Addr: nodes[1].Addr()}}},
+			}, nil
+		},
+	})
+	tb.Cleanup(func() { _ = client.Close() })
+	return client, nodes
+}
+
+func TestRedisCache_universal(t *testing.T) {
+	ctx := context.Background()
+	cluster, clusterNodes := newTestCluster(t)
+	shards := []*miniredis.Miniredis{miniredis.RunT(t), miniredis.RunT(t)}
+	ring := redis.NewRing(&redis.RingOptions{Addrs: map[string]string{"a": shards[0].Addr(), "b": shards[1].Addr()}})
+	defer ring.Close()
+	clients := map[string]struct {
+		client redis.UniversalClient
+		nodes  []*miniredis.Miniredis
+	}{
+		"cluster": {cluster, clusterNodes},
+		"ring":    {ring, shards},
+	}
+
+	kvs := make(map[string]string)
+	var keys []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key:%v", i)
+		kvs[key] = fmt.Sprintf("v%v", i)
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for name, c := range clients {
+		for _, chunked := range []bool{false, true} {
+			var opts []Option
+			if chunked {
+				opts = append(opts, WithChunking(8, 4))
+			}
+			t.Run(fmt.Sprintf("%v chunked %v", name, chunked), func(tt *testing.T) {
+				for _, node := range c.nodes {
+					node.FlushAll()
+				}
+				rc := NewRedisCacheWithUniversalClient[string](c.client, time.Minute, opts...)
+				assert.Nil(tt, rc.MSet(ctx, kvs, time.Now()))
+				for _, node := range c.nodes {
+					assert.NotEmpty(tt, node.Keys())
+				}
+
+				assert.Equal(tt, kvs, rc.MGet(ctx, append(keys, "missing"), 0))
+				got, ok := rc.Get(ctx, "key:1", 0)
+				assert.True(tt, ok)
+				assert.Equal(tt, "v1", got)
+
+				var scanned []string
+				assert.Nil(tt, rc.Scan(ctx, "key:", func(key string) bool {
+					scanned = append(scanned, key)
+					return true
+				}))
+				sort.Strings(scanned)
+				assert.Equal(tt, keys, scanned)
+				n := 0
+				assert.Nil(tt, rc.Scan(ctx, "", func(key string) bool {
+					n++
+					return false
+				}))
+				assert.Equal(tt, 1, n)
+
+				assert.Nil(tt, rc.SetDefault(ctx, []string{"d:1", "d:2", "d:3"}, time.Now()))
+				envs, err := rc.V2().MGet(ctx, []string{"d:1", "d:2", "d:3"}, 0)
+				assert.Nil(tt, err)
+				assert.Len(tt, envs, 3)
+
+				assert.Nil(tt, rc.MDelete(ctx, keys))
+				assert.Empty(tt, rc.MGet(ctx, keys, 0))
+				if !chunked {
+					stats, err := rc.Stats(ctx)
+					assert.Nil(tt, err)
+					assert.Equal(tt, int64(3), stats.Entries)
+				}
+			})
+		}
+	}
+}
+
+func TestNewRedisCacheWithUniversalOptions(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rc := NewRedisCacheWithUniversalOptions[string](&redis.UniversalOptions{Addrs: []string{mr.Addr()}}, time.Minute)
+	assert.Nil(t, rc.Set(ctx, "k", "v", time.Now()))
+	got, ok := rc.Get(ctx, "k", 0)
+	assert.True(t, ok)
+	assert.Equal(t, "v", got)
+	assert.Nil(t, rc.Close())
+	assert.ErrorIs(t, rc.client.Ping(ctx).Err(), redis.ErrClosed)
+}
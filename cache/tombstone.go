@@ -0,0 +1,22 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrTombstoned 墓碑宽限期内，在墓碑之前开始的写入被拒绝
+var ErrTombstoned = errors.New("tombstoned")
+
+// Tombstoner 墓碑删除，删除时写入短期墓碑，读取时墓碑视为未命中，
+// 宽限期内通过VersionedSetter写入且createTime早于墓碑的数据会被拒绝；
+// 墓碑保留被删除数据的版本，宽限期内旧版本的写入仍返回ErrStaleVersion，Touch视墓碑为不存在且不延长宽限期
+type Tombstoner interface {
+	SetTombstone(ctx context.Context, keys []string, createTime time.Time, grace time.Duration) error
+}
+
+// tombstoneExpireAt 墓碑过期时间
+func tombstoneExpireAt(createTime time.Time, grace time.Duration) int64 {
+	return createTime.Add(grace).UnixMilli()
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kakkk/cachex/internal/model"
+	"github.com/kakkk/cachex/internal/utils"
+)
+
+// maxUpdateRetries 乐观更新冲突最大重试次数
+const maxUpdateRetries = 16
+
+// ErrUpdateConflict 乐观更新冲突且重试次数耗尽
+var ErrUpdateConflict = errors.New("update conflict")
+
+// UpdateFunc 读改写函数，found为false表示缓存不存在，返回error时放弃更新，
+// 乐观更新冲突时会重新读取并再次调用，应避免副作用
+type UpdateFunc[T any] func(old T, found bool) (T, error)
+
+// Updater 原子读改写，本地缓存按key加锁，Redis使用WATCH/MULTI乐观更新；
+// 宽限期内的墓碑拒绝更新并返回ErrTombstoned，写入时保留当前版本并使租约失效，避免更新前开始的回源覆盖更新结果
+type Updater[T any] interface {
+	Update(ctx context.Context, key string, fn UpdateFunc[T], createTime time.Time) (T, error)
+}
+
+// update 本地缓存加锁读改写，宽限期内的墓碑拒绝更新并返回ErrTombstoned，写入时保留当前版本，
+// get读取当前数据，不存在或无法解码时返回false，set写入时不再加锁
+func update[T any](locks *keyLock, key string, get func() (*model.CacheData[T], bool), set func(data T, version int64) error, fn UpdateFunc[T]) (T, error) {
+	var (
+		zero, old T
+		found     bool
+		version   int64
+	)
+	unlock := locks.lock(key)
+	defer unlock()
+	if current, ok := get(); ok {
+		if current.Meta().IsTombstoneActive(utils.ConvertTimestamp(time.Now())) {
+			return zero, ErrTombstoned
+		}
+		version = current.Version
+		if !current.IsDefault() && !current.IsTombstone() {
+			old, found = current.Data, true
+		}
+	}
+	data, err := fn(old, found)
+	if err != nil {
+		return zero, err
+	}
+	if err = set(data, version); err != nil {
+		return zero, err
+	}
+	return data, nil
+}
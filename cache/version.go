@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/kakkk/cachex/internal/model"
+)
+
+// ErrStaleVersion 已存在更新版本，写入被拒绝
+var ErrStaleVersion = errors.New("stale version")
+
+// VersionedSetter 条件写入，已存在更新版本时拒绝写入并返回ErrStaleVersion，
+// 宽限期内的墓碑拒绝在其之前开始的写入并返回ErrTombstoned，version为0时不做版本比较
+type VersionedSetter[T any] interface {
+	SetWithVersion(ctx context.Context, key string, data T, createTime time.Time, version int64) error
+	MSetWithVersion(ctx context.Context, kvs map[string]T, versions map[string]int64, createTime time.Time) error
+}
+
+// keyLockStripes 分段锁数量
+const keyLockStripes = 64
+
+// keyLock 分段key锁，零值可用
+type keyLock struct {
+	stripes [keyLockStripes]sync.Mutex
+}
+
+// lock 锁定key，返回解锁函数
+func (kl *keyLock) lock(key string) func() {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	mu := &kl.stripes[h.Sum32()%keyLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// isStaleVersion 检查写入版本是否比当前版本旧
+func isStaleVersion(current int64, version int64) bool {
+	return version != 0 && current > version
+}
+
+// checkWrite 条件写入检查
+func checkWrite(current *model.CacheMeta, createAt int64, version int64, now int64) error {
+	if current.IsTombstoneActive(now) && createAt < current.CreateAt {
+		return ErrTombstoned
+	}
+	if isStaleVersion(current.Version, version) {
+		return ErrStaleVersion
+	}
+	return nil
+}
+
+// skipDefault 已存在更新的数据或宽限期内的墓碑时不写入空值
+func skipDefault(current *model.CacheMeta, createAt int64, now int64) bool {
+	return current.CreateAt > createAt || current.IsTombstoneActive(now)
+}
+
+// newRejectedError 返回被拒绝写入的keys
+func newRejectedError(target error, keys []string) error {
+	if target == nil || len(keys) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %v", target, keys)
+}
+
+// mSetWithVersion 逐个条件写入，汇总被拒绝写入的keys
+func mSetWithVersion[T any](kvs map[string]T, versions map[string]int64, set func(key string, data T, version int64) error) error {
+	var (
+		stale      []string
+		tombstoned []string
+		newer      []string
+		errs       []error
+	)
+	for k, v := range kvs {
+		err := set(k, v, versions[k])
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrStaleVersion):
+			stale = append(stale, k)
+		case errors.Is(err, ErrTombstoned):
+			tombstoned = append(tombstoned, k)
+		case errors.Is(err, ErrSchemaNewer):
+			newer = append(newer, k)
+		default:
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, newRejectedError(ErrStaleVersion, stale), newRejectedError(ErrTombstoned, tombstoned),
+		newRejectedError(ErrSchemaNewer, newer))
+	return errors.Join(errs...)
+}
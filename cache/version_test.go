@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kakkk/cachex/internal/model"
+)
+
+func TestKeyLock(t *testing.T) {
+	kl := &keyLock{}
+	count := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := kl.lock("k")
+			defer unlock()
+			count++
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 100, count)
+}
+
+func TestIsStaleVersion(t *testing.T) {
+	assert.False(t, isStaleVersion(2, 0))
+	assert.False(t, isStaleVersion(2, 2))
+	assert.False(t, isStaleVersion(2, 3))
+	assert.True(t, isStaleVersion(2, 1))
+}
+
+func TestMSetWithVersion(t *testing.T) {
+	kvs := map[string]string{"k_1": "v_1", "k_2": "v_2", "k_3": "v_3"}
+	versions := map[string]int64{"k_1": 1, "k_2": 2, "k_3": 3}
+	t.Run("success", func(tt *testing.T) {
+		err := mSetWithVersion(kvs, versions, func(key string, data string, version int64) error {
+			return nil
+		})
+		assert.Nil(tt, err)
+	})
+
+	t.Run("rejected and error", func(tt *testing.T) {
+		err := mSetWithVersion(kvs, versions, func(key string, data string, version int64) error {
+			switch key {
+			case "k_1":
+				return newRejectedError(ErrStaleVersion, []string{key})
+			case "k_2":
+				return errors.New("unit_test")
+			case "k_3":
+				return newRejectedError(ErrTombstoned, []string{key})
+			}
+			return nil
+		})
+		assert.True(tt, errors.Is(err, ErrStaleVersion))
+		assert.Contains(tt, err.Error(), "k_1")
+		assert.Contains(tt, err.Error(), "unit_test")
+		assert.True(tt, errors.Is(err, ErrTombstoned))
+	})
+}
+
+func TestCheckWrite(t *testing.T) {
+	now := time.Now().UnixMilli()
+	t.Run("tombstone", func(tt *testing.T) {
+		current := &model.CacheMeta{CreateAt: now, Tombstone: 1, ExpireAt: now + 1000}
+		assert.ErrorIs(tt, checkWrite(current, now-1, 0, now), ErrTombstoned)
+		assert.Nil(tt, checkWrite(current, now, 0, now))
+		assert.Nil(tt, checkWrite(current, now-1, 0, now+1000))
+	})
+
+	t.Run("version", func(tt *testing.T) {
+		current := &model.CacheMeta{CreateAt: now, Version: 2}
+		assert.ErrorIs(tt, checkWrite(current, now, 1, now), ErrStaleVersion)
+		assert.Nil(tt, checkWrite(current, now, 0, now))
+		assert.Nil(tt, checkWrite(current, now, 2, now))
+	})
+}
+
+func TestSkipDefault(t *testing.T) {
+	now := time.Now().UnixMilli()
+	assert.True(t, skipDefault(&model.CacheMeta{CreateAt: now, Tombstone: 1, ExpireAt: now + 1000}, now+1, now))
+	assert.False(t, skipDefault(&model.CacheMeta{CreateAt: now, Tombstone: 1, ExpireAt: now + 1000}, now+1, now+1000))
+	assert.True(t, skipDefault(&model.CacheMeta{CreateAt: now}, now-1, now))
+	assert.False(t, skipDefault(&model.CacheMeta{CreateAt: now}, now, now))
+}
+
+func TestTombstone_backends(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	mc, err := NewMemcachedCache[string]([]string{newFakeMemcached(t).addr()}, time.Hour)
+	assert.Nil(t, err)
+	dc, _ := newTestDiskCache(t, time.Hour)
+	caches := map[string]Cache[string]{
+		"lru":       NewLRUCache[string](10, time.Hour),
+		"freecache": NewFreeCache[string](1024*1024, time.Hour),
+		"bigcache":  NewBigCache[string](time.Hour),
+		"disk":      dc,
+		"memcached": mc,
+		"redis":     &RedisCache[string]{client: redis.NewClient(&redis.Options{Addr: mr.Addr()}), ttl: time.Hour},
+	}
+	for name, c := range caches {
+		t.Run(name, func(tt *testing.T) {
+			setter := c.(VersionedSetter[string])
+			tombstoner := c.(Tombstoner)
+			deleteTime := time.Now()
+			assert.Nil(tt, setter.SetWithVersion(ctx, "k", "v", deleteTime.Add(-time.Second), 3))
+			assert.Nil(tt, tombstoner.SetTombstone(ctx, []string{"k"}, deleteTime, time.Minute))
+
+			// 墓碑保留版本，宽限期内墓碑之后开始的旧版本写入在各后端均被拒绝
+			writeTime := deleteTime.Add(time.Second)
+			assert.ErrorIs(tt, setter.SetWithVersion(ctx, "k", "v2", writeTime, 2), ErrStaleVersion)
+			assert.ErrorIs(tt, setter.SetWithVersion(ctx, "k", "v3", deleteTime.Add(-time.Second), 3), ErrTombstoned)
+
+			// Touch视墓碑为不存在，不延长宽限期
+			touched, err := c.(Toucher).Touch(ctx, "k", time.Hour)
+			assert.Nil(tt, err)
+			assert.False(tt, touched)
+			if r, ok := c.(TTLReader); ok {
+				ttl, found, err := r.TTL(ctx, "k")
+				assert.Nil(tt, err)
+				assert.True(tt, found)
+				assert.LessOrEqual(tt, ttl, time.Minute)
+			}
+
+			assert.Nil(tt, setter.SetWithVersion(ctx, "k", "v3", writeTime, 3))
+			touched, err = c.(Toucher).Touch(ctx, "k", time.Hour)
+			assert.Nil(tt, err)
+			assert.True(tt, touched)
+		})
+	}
+}
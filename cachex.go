@@ -5,14 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kakkk/cachex/cache"
 	"github.com/kakkk/cachex/internal/consts"
 	cachexError "github.com/kakkk/cachex/internal/errors"
+	"github.com/kakkk/cachex/internal/retry"
 	"github.com/kakkk/cachex/internal/utils"
 )
 
+// leasePollInterval 等待租约回填的轮询间隔
+const leasePollInterval = 10 * time.Millisecond
+
 // GetDataKey 获取数据Key函数
 type GetDataKey[K comparable] func(key K) string
 
@@ -22,12 +28,18 @@ type GetRealData[K comparable, V any] func(ctx context.Context, key K) (data V,
 // MGetRealData 批量回源函数
 type MGetRealData[K comparable, V any] func(ctx context.Context, keys []K) (data map[K]V, err error)
 
+// GetVersion 获取数据版本函数，如数据库行版本号或更新时间
+type GetVersion[V any] func(data V) int64
+
 // HitCallback 命中缓存回调函数
 type HitCallback func(name string, level int)
 
 // MHitCallback 批量命中缓存回调函数
 type MHitCallback func(name string, level int, times int)
 
+// ReadErrorCallback 缓存读取错误回调函数，区分未命中与后端错误
+type ReadErrorCallback func(ctx context.Context, name string, level int, err error)
+
 // DowngradeCallBack 降级回调函数
 type DowngradeCallBack[K comparable] func(ctx context.Context, key K, err error)
 
@@ -49,9 +61,34 @@ type CacheX[K comparable, V any] struct {
 	downgradeCallback        DowngradeCallBack[K]  // 降级回调
 	mDowngradeCallback       MDowngradeCallBack[K] // 批量降级回调
 	isSetDefault             bool                  // 设置控制
+	getVersion               GetVersion[V]         // 获取数据版本函数
+	leaseTTL                 time.Duration         // 租约有效期，0为不使用租约
+	leaseWait                time.Duration         // 租约被持有时最大等待时间
+	tombstoneGrace           time.Duration         // 墓碑宽限期，0为直接删除
+	readErrorCallback        ReadErrorCallback     // 缓存读取错误回调
+	readErrors               levelCounter          // 各层级读取错误数
+	loadLockTTL              time.Duration         // 分布式回源锁有效期，0为不加锁
+	loadLockWait             time.Duration         // 回源锁被其他实例持有时最大等待时间
+	retryConfig              *RetryConfig          // 删除失败重试配置，nil为不重试
+	retryGiveUpCallback      RetryGiveUpCallback   // 删除重试放弃回调
+	doubleDeleteDelay        time.Duration         // 延迟双删间隔，0为不双删
+	retry                    *retry.Queue          // 删除重试队列
+	closed                   atomic.Bool           // 是否已关闭
+	sliding                  *sliding              // 滑动过期状态，nil为不滑动
+	corruptCallback          CorruptCallback       // 数据无法解码回调
+	corruptions              levelCounter          // 各层级无法解码的数据数
+	now                      func() time.Time      // 当前时间，nil时使用time.Now，等待超时始终使用真实时间
+}
+
+// clock 当前时间，作为写入、删除、回源的起始时间及业务过期的判断时间
+func (cx *CacheX[K, V]) clock() time.Time {
+	if cx.now != nil {
+		return cx.now()
+	}
+	return time.Now()
 }
 
-// Set 设置缓存
+// Set 设置缓存，返回记录各层级错误的CacheError，全部层级写入成功时不含出错层级
 func (cx *CacheX[K, V]) Set(ctx context.Context, key K, data V) (err error) {
 	defer cx.recover(ctx, func(r any) {
 		if r != nil {
@@ -59,16 +96,26 @@ func (cx *CacheX[K, V]) Set(ctx context.Context, key K, data V) (err error) {
 			return
 		}
 	})()
+	if cx.closed.Load() {
+		return ErrClosed
+	}
 
-	dataKey, now := cx.getDataKey(key), time.Now()
-	setErrors := cachexError.NewCacheSetError()
-	for level := 0; level < len(cx.caches); level++ {
-		err := cx.caches[level].Set(ctx, dataKey, data, now)
-		if err != nil {
-			setErrors = setErrors.AppendError(level, err)
+	return cx.setWithVersion(ctx, key, data, cx.version(data), cx.clock())
+}
+
+// SetWithVersion 按版本设置缓存，已存在更新版本的层级拒绝写入，对应层级返回ErrStaleVersion
+func (cx *CacheX[K, V]) SetWithVersion(ctx context.Context, key K, data V, version int64) (err error) {
+	defer cx.recover(ctx, func(r any) {
+		if r != nil {
+			err = fmt.Errorf("[panic recover] %v", r)
+			return
 		}
+	})()
+	if cx.closed.Load() {
+		return ErrClosed
 	}
-	return setErrors
+
+	return cx.setWithVersion(ctx, key, data, version, cx.clock())
 }
 
 // MSet 批量设置缓存
@@ -79,17 +126,37 @@ func (cx *CacheX[K, V]) MSet(ctx context.Context, kvs map[K]V) (err error) {
 			return
 		}
 	})()
+	if cx.closed.Load() {
+		return ErrClosed
+	}
+	return cx.mSet(ctx, kvs, cx.clock())
+}
+
+// mSet 批量写入各级缓存
+func (cx *CacheX[K, V]) mSet(ctx context.Context, kvs map[K]V, createTime time.Time) error {
 	if kvs == nil || len(kvs) == 0 {
 		return nil
 	}
 	setErrors := cachexError.NewCacheSetError()
-	now := time.Now()
 	data := make(map[string]V, len(kvs))
 	for k, v := range kvs {
 		data[cx.getDataKey(k)] = v
 	}
+	// 设置了版本函数时按版本写入
+	var versions map[string]int64
+	if cx.getVersion != nil {
+		versions = make(map[string]int64, len(data))
+		for k, v := range data {
+			versions[k] = cx.getVersion(v)
+		}
+	}
 	for level := 0; level < len(cx.caches); level++ {
-		err := cx.caches[level].MSet(ctx, data, now)
+		var err error
+		if setter, ok := cx.caches[level].(cache.VersionedSetter[V]); ok && cx.isConditionalWrite(versions != nil) {
+			err = setter.MSetWithVersion(ctx, data, versions, createTime)
+		} else {
+			err = cx.caches[level].MSet(ctx, data, createTime)
+		}
 		if err != nil {
 			setErrors = setErrors.AppendError(level, err)
 		}
@@ -99,6 +166,26 @@ func (cx *CacheX[K, V]) MSet(ctx context.Context, kvs map[K]V) (err error) {
 
 // Get 查询缓存
 func (cx *CacheX[K, V]) Get(ctx context.Context, key K, expire time.Duration) (data V, ok bool) {
+	return cx.get(ctx, key, expire, cx.getRealData)
+}
+
+// GetOrLoad 查询缓存，未命中时使用loader代替配置的回源函数，降级、空值及回调策略与Get一致
+func (cx *CacheX[K, V]) GetOrLoad(ctx context.Context, key K, expire time.Duration, loader GetRealData[K, V]) (data V, ok bool) {
+	return cx.get(ctx, key, expire, loader)
+}
+
+// MGet 批量查询缓存
+func (cx *CacheX[K, V]) MGet(ctx context.Context, keys []K, expire time.Duration) (data map[K]V) {
+	return cx.mGet(ctx, keys, expire, cx.mGetRealData)
+}
+
+// MGetOrLoad 批量查询缓存，未命中时使用loader代替配置的批量回源函数，降级、空值及回调策略与MGet一致
+func (cx *CacheX[K, V]) MGetOrLoad(ctx context.Context, keys []K, expire time.Duration, loader MGetRealData[K, V]) (data map[K]V) {
+	return cx.mGet(ctx, keys, expire, loader)
+}
+
+// get 查询缓存，未命中时使用getRealData回源
+func (cx *CacheX[K, V]) get(ctx context.Context, key K, expire time.Duration, getRealData GetRealData[K, V]) (data V, ok bool) {
 	defer cx.recover(ctx, func(r any) {
 		if r != nil {
 			var zero V
@@ -106,11 +193,14 @@ func (cx *CacheX[K, V]) Get(ctx context.Context, key K, expire time.Duration) (d
 			return
 		}
 	})()
-	dataKey := cx.getDataKey(key)
+	if cx.closed.Load() {
+		return data, false
+	}
+	dataKey, now := cx.getDataKey(key), cx.clock()
 	// 查询缓存
 	for level := len(cx.caches) - 1; level >= 0; level-- {
 		var hit bool
-		data, hit = cx.caches[level].Get(ctx, dataKey, expire)
+		data, _, hit = cx.getLevel(ctx, level, dataKey, expire, now)
 		if hit {
 			// 命中缓存，直接返回
 			cx.hit(ctx, level)
@@ -119,11 +209,11 @@ func (cx *CacheX[K, V]) Get(ctx context.Context, key K, expire time.Duration) (d
 	}
 	// 缓存失效，回源
 	cx.hit(ctx, consts.CacheLevelSource)
-	return cx.getRealDataInternal(ctx, key)
+	return cx.getRealDataInternal(ctx, key, expire, getRealData)
 }
 
-// MGet 批量查询缓存
-func (cx *CacheX[K, V]) MGet(ctx context.Context, keys []K, expire time.Duration) (data map[K]V) {
+// mGet 批量查询缓存，未命中时使用mGetRealData回源
+func (cx *CacheX[K, V]) mGet(ctx context.Context, keys []K, expire time.Duration, mGetRealData MGetRealData[K, V]) (data map[K]V) {
 	defer cx.recover(ctx, func(r any) {
 		if r != nil {
 			data = make(map[K]V)
@@ -131,13 +221,16 @@ func (cx *CacheX[K, V]) MGet(ctx context.Context, keys []K, expire time.Duration
 		}
 	})()
 	data = make(map[K]V)
+	if cx.closed.Load() {
+		return data
+	}
 	// key去重
 	keys = utils.Duplicate(keys)
-	dataKeys := cx.mGetDataKeys(keys)
+	dataKeys, now := cx.mGetDataKeys(keys), cx.clock()
 
 	// 从多级缓存中获取
 	for level := len(cx.caches) - 1; level >= 0; level-- {
-		got := cx.caches[level].MGet(ctx, dataKeys, expire)
+		got, _ := cx.mGetLevel(ctx, level, dataKeys, expire, now)
 		if len(got) != 0 {
 			cx.mHit(ctx, level, len(got))
 		}
@@ -158,13 +251,48 @@ func (cx *CacheX[K, V]) MGet(ctx context.Context, keys []K, expire time.Duration
 
 	// 回源
 	cx.mHit(ctx, consts.CacheLevelSource, len(needGetRealDataKeys))
-	realData := cx.mGetRealDataInternal(ctx, needGetRealDataKeys)
+	realData := cx.mGetRealDataInternal(ctx, needGetRealDataKeys, mGetRealData)
 	for k, v := range realData {
 		data[k] = v
 	}
 	return data
 }
 
+// Update 原子读改写缓存，仅在最外层缓存上原子执行fn，冲突时重试，fn可能被多次调用；
+// 更新成功后删除内层缓存，由下次读取从最外层回填，内层删除失败时返回CacheError。
+// 更新使最外层租约失效，墓碑宽限期内返回ErrTombstoned；写入时保留缓存中的当前版本，
+// 不使用GetVersion比较版本，需要版本检查时使用SetWithVersion
+func (cx *CacheX[K, V]) Update(ctx context.Context, key K, fn func(old V, found bool) (V, error)) (data V, err error) {
+	defer cx.recover(ctx, func(r any) {
+		if r != nil {
+			err = fmt.Errorf("[panic recover] %v", r)
+			return
+		}
+	})()
+	if cx.closed.Load() {
+		return data, ErrClosed
+	}
+	if len(cx.caches) == 0 {
+		return data, ErrUpdateNotSupported
+	}
+	updater, ok := cx.caches[0].(cache.Updater[V])
+	if !ok {
+		return data, ErrUpdateNotSupported
+	}
+	dataKey := cx.getDataKey(key)
+	data, err = updater.Update(ctx, dataKey, fn, cx.clock())
+	if err != nil {
+		return data, err
+	}
+	delErrors := cachexError.NewCacheSetError()
+	for level := 1; level < len(cx.caches); level++ {
+		if err := cx.caches[level].Delete(ctx, dataKey); err != nil {
+			delErrors = delErrors.AppendError(level, err)
+		}
+	}
+	return data, delErrors
+}
+
 // Delete 删除缓存
 func (cx *CacheX[K, V]) Delete(ctx context.Context, key K) (err error) {
 	defer cx.recover(ctx, func(r any) {
@@ -173,14 +301,24 @@ func (cx *CacheX[K, V]) Delete(ctx context.Context, key K) (err error) {
 			return
 		}
 	})()
-	dataKey := cx.getDataKey(key)
+	if cx.closed.Load() {
+		return ErrClosed
+	}
+	dataKey, now := cx.getDataKey(key), cx.clock()
 	delErrors := cachexError.NewCacheSetError()
 	for level := 0; level < len(cx.caches); level++ {
-		err := cx.caches[level].Delete(ctx, dataKey)
+		var err error
+		if tombstoner, ok := cx.caches[level].(cache.Tombstoner); ok && cx.tombstoneGrace > 0 {
+			err = tombstoner.SetTombstone(ctx, []string{dataKey}, now, cx.tombstoneGrace)
+		} else {
+			err = cx.caches[level].Delete(ctx, dataKey)
+		}
 		if err != nil {
 			delErrors = delErrors.AppendError(level, err)
+			cx.enqueueDelete(level, []string{dataKey})
 		}
 	}
+	cx.enqueueDoubleDelete([]string{dataKey})
 	return delErrors
 }
 
@@ -192,18 +330,30 @@ func (cx *CacheX[K, V]) MDelete(ctx context.Context, keys []K) (err error) {
 			return
 		}
 	})()
-	dataKeys := cx.mGetDataKeys(keys)
+	if cx.closed.Load() {
+		return ErrClosed
+	}
+	dataKeys, now := cx.mGetDataKeys(keys), cx.clock()
 	delErrors := cachexError.NewCacheSetError()
 	for level := 0; level < len(cx.caches); level++ {
-		err := cx.caches[level].MDelete(ctx, dataKeys)
-		if err != nil {
+		if err := cx.mDeleteLevel(ctx, level, dataKeys, now); err != nil {
 			delErrors = delErrors.AppendError(level, err)
+			cx.enqueueDelete(level, failedKeys(err, dataKeys))
 		}
 	}
+	cx.enqueueDoubleDelete(dataKeys)
 	return delErrors
 }
 
+// ReadErrors 获取各层级读取错误数
+func (cx *CacheX[K, V]) ReadErrors() map[int]int64 {
+	return cx.readErrors.snapshot()
+}
+
 func (cx *CacheX[K, V]) Ping(ctx context.Context) ([]string, error) {
+	if cx.closed.Load() {
+		return nil, ErrClosed
+	}
 	pongs := make([]string, len(cx.caches))
 	for level := 0; level < len(cx.caches); level++ {
 		pong, err := cx.caches[level].Ping(ctx)
@@ -218,7 +368,13 @@ func (cx *CacheX[K, V]) Ping(ctx context.Context) ([]string, error) {
 }
 
 // getRealDataInternal 回源
-func (cx *CacheX[K, V]) getRealDataInternal(ctx context.Context, key K) (data V, ok bool) {
+func (cx *CacheX[K, V]) getRealDataInternal(ctx context.Context, key K, expire time.Duration, getRealData GetRealData[K, V]) (data V, ok bool) {
+	data, _, ok = cx.loadInternal(ctx, key, expire, getRealData)
+	return data, ok
+}
+
+// loadInternal 回源并返回数据来源信息，expire用于判断等待期间其他请求回填的数据是否有效
+func (cx *CacheX[K, V]) loadInternal(ctx context.Context, key K, expire time.Duration, getRealData GetRealData[K, V]) (data V, meta Meta, ok bool) {
 	var (
 		err  error
 		zero V
@@ -235,42 +391,82 @@ func (cx *CacheX[K, V]) getRealDataInternal(ctx context.Context, key K) (data V,
 			}
 		}()
 		if err != nil && !errors.Is(err, ErrNotFound) {
-			data = zero
-			ok = false
+			data, meta, ok = zero, Meta{}, false
 			// 不允许降级
 			if !cx.allowDowngrade {
 				return
 			}
 			// 降级查询缓存
-			for level := len(cx.caches) - 1; level >= 0; level-- {
-				data, ok = cx.caches[level].Get(ctx, cx.getDataKey(key), cx.downgradeCacheExpireTime)
-				if ok {
-					break
-				}
-			}
+			data, meta, ok = cx.getDowngrade(ctx, cx.getDataKey(key))
 			cx.downgrade(ctx, key, err)
 			return
 		}
 	})()
 
 	// 没有配置回源，直接返回
-	if cx.getRealData == nil {
-		return zero, false
+	if getRealData == nil {
+		return zero, Meta{}, false
 	}
 
-	// 回源查询
-	data, err = cx.getRealData(ctx, key)
+	// 获取租约，租约已被其他请求持有时允许降级则返回旧数据，否则等待回填
+	var leases map[int]int64
+	if cx.leaseTTL > 0 {
+		var held bool
+		dataKey := cx.getDataKey(key)
+		leases, held = cx.acquireLeases(ctx, dataKey)
+		if !held && cx.allowDowngrade {
+			if data, meta, ok = cx.getDowngrade(ctx, dataKey); ok {
+				cx.releaseLeases(ctx, dataKey, leases)
+				cx.downgrade(ctx, key, ErrLeaseHeld)
+				return data, meta, true
+			}
+		}
+		if !held {
+			if data, meta, ok = cx.waitFill(ctx, dataKey, expire, cx.leaseWait); ok {
+				cx.releaseLeases(ctx, dataKey, leases)
+				return data, meta, true
+			}
+		}
+	}
+
+	// 获取分布式回源锁，锁被其他实例持有时等待回填，超时后自行回源
+	if cx.loadLockTTL > 0 {
+		dataKey := cx.getDataKey(key)
+		unlock, held := cx.lockLoad(ctx, dataKey)
+		defer unlock()
+		if !held {
+			if data, meta, ok = cx.waitFill(ctx, dataKey, expire, cx.loadLockWait); ok {
+				cx.releaseLeases(ctx, dataKey, leases)
+				return data, meta, true
+			}
+		}
+	}
+
+	// 回源查询，以回源开始时间作为写入时间
+	start := cx.clock()
+	data, err = getRealData(ctx, key)
 	if err != nil {
+		cx.releaseLeases(ctx, cx.getDataKey(key), leases)
 		return
 	}
 
 	// 写入缓存
-	_ = cx.Set(ctx, key, data)
-	return data, true
+	if leases != nil {
+		_ = cx.setWithLeases(ctx, key, data, leases, start)
+	} else {
+		_ = cx.setWithVersion(ctx, key, data, cx.version(data), start)
+	}
+	return data, newMeta(LevelSource, utils.ConvertTimestamp(start), cx.clock()), true
 }
 
 // mGetRealDataInternal 批量回源
-func (cx *CacheX[K, V]) mGetRealDataInternal(ctx context.Context, keys []K) (data map[K]V) {
+func (cx *CacheX[K, V]) mGetRealDataInternal(ctx context.Context, keys []K, mGetRealData MGetRealData[K, V]) (data map[K]V) {
+	data, _ = cx.mLoadInternal(ctx, keys, mGetRealData)
+	return data
+}
+
+// mLoadInternal 批量回源并返回数据来源信息
+func (cx *CacheX[K, V]) mLoadInternal(ctx context.Context, keys []K, mGetRealData MGetRealData[K, V]) (data map[K]V, metas map[K]Meta) {
 	var err error
 	defer cx.recover(ctx, func(r any) {
 		if r != nil {
@@ -289,15 +485,22 @@ func (cx *CacheX[K, V]) mGetRealDataInternal(ctx context.Context, keys []K) (dat
 			}
 		}()
 		if err != nil && !errors.Is(err, ErrNotFound) {
-			data = make(map[K]V)
+			data, metas = make(map[K]V), make(map[K]Meta)
 			// 不允许降级
 			if !cx.allowDowngrade {
 				return
 			}
 			// 降级查询缓存, 从每一级获取缓存并组装
-			dataKeys := cx.mGetDataKeys(keys)
+			dataKeys, now := cx.mGetDataKeys(keys), cx.clock()
 			for level := len(cx.caches) - 1; level >= 0; level-- {
-				got := cx.caches[level].MGet(ctx, dataKeys, cx.downgradeCacheExpireTime)
+				got, gotMetas := cx.mGetLevel(ctx, level, dataKeys, cx.downgradeCacheExpireTime, now)
+				for key, meta := range utils.ConvertCacheDataMap[K, Meta](keys, gotMetas, cx.getDataKey) {
+					if _, ok := data[key]; ok || meta.Negative {
+						continue
+					}
+					meta.Level, meta.Stale = LevelDowngrade, true
+					metas[key] = meta
+				}
 				data = utils.MergeData(data, utils.ConvertCacheDataMap[K, V](keys, got, cx.getDataKey))
 				if len(data) == len(keys) {
 					break
@@ -310,20 +513,183 @@ func (cx *CacheX[K, V]) mGetRealDataInternal(ctx context.Context, keys []K) (dat
 	})()
 
 	// 没有配置回源，直接返回
-	if cx.mGetRealData == nil {
-		return make(map[K]V)
+	if mGetRealData == nil {
+		return make(map[K]V), make(map[K]Meta)
 	}
 
-	// 回源查询
-	data, err = cx.mGetRealData(ctx, keys)
+	// 回源查询，以回源开始时间作为写入时间
+	start := cx.clock()
+	data, err = mGetRealData(ctx, keys)
 	if err != nil {
 		return
 	}
 
 	// 写入缓存
-	_ = cx.MSet(ctx, data)
-	return data
+	_ = cx.mSet(ctx, data, start)
+	metas = make(map[K]Meta, len(data))
+	meta := newMeta(LevelSource, utils.ConvertTimestamp(start), cx.clock())
+	for key := range data {
+		metas[key] = meta
+	}
+	return data, metas
+
+}
+
+// acquireLeases 获取各级缓存租约，held为false表示租约已被其他请求持有
+func (cx *CacheX[K, V]) acquireLeases(ctx context.Context, dataKey string) (leases map[int]int64, held bool) {
+	leases, held = make(map[int]int64), true
+	for level := 0; level < len(cx.caches); level++ {
+		leaser, ok := cx.caches[level].(cache.Leaser[V])
+		if !ok {
+			continue
+		}
+		token, ok, err := leaser.AcquireLease(ctx, dataKey, cx.leaseTTL)
+		if err != nil {
+			cx.logger.Warnf(ctx, "cache %v level %v acquire lease error: %v", cx.name, level, err)
+			continue
+		}
+		if !ok {
+			held = false
+			continue
+		}
+		leases[level] = token
+	}
+	return leases, held
+}
 
+// getDowngrade 降级查询各级缓存，返回downgradeCacheExpireTime内的旧数据
+func (cx *CacheX[K, V]) getDowngrade(ctx context.Context, dataKey string) (data V, meta Meta, ok bool) {
+	now := cx.clock()
+	for level := len(cx.caches) - 1; level >= 0; level-- {
+		data, meta, ok = cx.getLevel(ctx, level, dataKey, cx.downgradeCacheExpireTime, now)
+		if ok {
+			meta.Level, meta.Stale = LevelDowngrade, true
+			return data, meta, true
+		}
+	}
+	return data, Meta{}, false
+}
+
+// waitFill 等待租约或回源锁持有者回填，只有在expire内的数据才视为已回填，超时返回未命中
+func (cx *CacheX[K, V]) waitFill(ctx context.Context, dataKey string, expire, wait time.Duration) (data V, meta Meta, ok bool) {
+	deadline := time.Now().Add(wait)
+	for {
+		for level := len(cx.caches) - 1; level >= 0; level-- {
+			data, meta, ok = cx.getLevel(ctx, level, dataKey, expire, cx.clock())
+			if ok {
+				return data, meta, true
+			}
+		}
+		if !time.Now().Before(deadline) {
+			return data, Meta{}, false
+		}
+		select {
+		case <-ctx.Done():
+			return data, Meta{}, false
+		case <-time.After(leasePollInterval):
+		}
+	}
+}
+
+// lockLoad 在最外层支持Locker的缓存上获取回源锁，held为false表示锁已被其他实例持有，加锁失败时视为持有
+func (cx *CacheX[K, V]) lockLoad(ctx context.Context, dataKey string) (unlock func(), held bool) {
+	for level := 0; level < len(cx.caches); level++ {
+		locker, ok := cx.caches[level].(cache.Locker)
+		if !ok {
+			continue
+		}
+		token, ok, err := locker.Lock(ctx, dataKey, cx.loadLockTTL)
+		if err != nil {
+			cx.logger.Warnf(ctx, "cache %v level %v lock error: %v", cx.name, level, err)
+			return func() {}, true
+		}
+		if !ok {
+			return func() {}, false
+		}
+		return func() {
+			if err := locker.Unlock(ctx, dataKey, token); err != nil {
+				cx.logger.Warnf(ctx, "cache %v level %v unlock error: %v", cx.name, level, err)
+			}
+		}, true
+	}
+	return func() {}, true
+}
+
+// releaseLeases 释放租约
+func (cx *CacheX[K, V]) releaseLeases(ctx context.Context, dataKey string, leases map[int]int64) {
+	for level, token := range leases {
+		err := cx.caches[level].(cache.Leaser[V]).ReleaseLease(ctx, dataKey, token)
+		if err != nil {
+			cx.logger.Warnf(ctx, "cache %v level %v release lease error: %v", cx.name, level, err)
+		}
+	}
+}
+
+// setWithLeases 回填缓存，支持租约的缓存只有租约仍然有效、且不存在墓碑、更新版本及更高schema版本的数据时才写入
+func (cx *CacheX[K, V]) setWithLeases(ctx context.Context, key K, data V, leases map[int]int64, createTime time.Time) error {
+	dataKey, version := cx.getDataKey(key), cx.version(data)
+	setErrors := cachexError.NewCacheSetError()
+	for level := 0; level < len(cx.caches); level++ {
+		leaser, ok := cx.caches[level].(cache.Leaser[V])
+		if !ok {
+			err := cx.setLevel(ctx, level, dataKey, data, createTime, version)
+			if err != nil {
+				setErrors = setErrors.AppendError(level, err)
+			}
+			continue
+		}
+		token, held := leases[level]
+		if !held {
+			continue
+		}
+		set, err := leaser.SetWithLease(ctx, dataKey, data, createTime, token, version)
+		if errors.Is(err, cache.ErrStaleVersion) || errors.Is(err, cache.ErrTombstoned) || errors.Is(err, cache.ErrSchemaNewer) {
+			cx.logger.Debugf(ctx, "cache %v level %v lease refill rejected, key:%v, err:%v", cx.name, level, dataKey, err)
+			continue
+		}
+		if err != nil {
+			setErrors = setErrors.AppendError(level, err)
+			continue
+		}
+		if !set {
+			cx.logger.Debugf(ctx, "cache %v level %v lease invalidated, key:%v", cx.name, level, dataKey)
+		}
+	}
+	return setErrors
+}
+
+// setWithVersion 按版本写入各级缓存
+func (cx *CacheX[K, V]) setWithVersion(ctx context.Context, key K, data V, version int64, createTime time.Time) error {
+	dataKey := cx.getDataKey(key)
+	setErrors := cachexError.NewCacheSetError()
+	for level := 0; level < len(cx.caches); level++ {
+		err := cx.setLevel(ctx, level, dataKey, data, createTime, version)
+		if err != nil {
+			setErrors = setErrors.AppendError(level, err)
+		}
+	}
+	return setErrors
+}
+
+// setLevel 写入单级缓存，需要条件写入且缓存支持时按条件写入
+func (cx *CacheX[K, V]) setLevel(ctx context.Context, level int, dataKey string, data V, createTime time.Time, version int64) error {
+	if setter, ok := cx.caches[level].(cache.VersionedSetter[V]); ok && cx.isConditionalWrite(version != 0) {
+		return setter.SetWithVersion(ctx, dataKey, data, createTime, version)
+	}
+	return cx.caches[level].Set(ctx, dataKey, data, createTime)
+}
+
+// isConditionalWrite 带版本或开启墓碑删除时需要条件写入
+func (cx *CacheX[K, V]) isConditionalWrite(versioned bool) bool {
+	return versioned || cx.tombstoneGrace > 0
+}
+
+// version 获取数据版本，未设置版本函数时返回0
+func (cx *CacheX[K, V]) version(data V) int64 {
+	if cx.getVersion == nil {
+		return 0
+	}
+	return cx.getVersion(data)
 }
 
 // mGetDataKeys 批量获取DataKey
@@ -357,6 +723,17 @@ func (cx *CacheX[K, V]) mHit(ctx context.Context, level int, times int) {
 	return
 }
 
+// readError 读取错误计数及回调
+func (cx *CacheX[K, V]) readError(ctx context.Context, level int, err error) {
+	defer cx.recover(ctx, nil)()
+	cx.readErrors.add(level)
+	if cx.readErrorCallback != nil {
+		cx.readErrorCallback(ctx, cx.name, level, err)
+		return
+	}
+	cx.logger.Warnf(ctx, "cache %v level %v read error: %v", cx.name, level, err)
+}
+
 // downgrade 降级回调
 func (cx *CacheX[K, V]) downgrade(ctx context.Context, key K, err error) {
 	defer cx.recover(ctx, nil)()
@@ -383,7 +760,7 @@ func (cx *CacheX[K, V]) setDefault(ctx context.Context, keys []string) {
 		return
 	}
 	setErrors := cachexError.NewCacheSetError()
-	now := time.Now()
+	now := cx.clock()
 	for level := 0; level < len(cx.caches); level++ {
 		err := cx.caches[level].SetDefault(ctx, keys, now)
 		if err != nil {
@@ -409,3 +786,30 @@ func (cx *CacheX[K, V]) recover(ctx context.Context, fn func(r any)) func() {
 		return
 	}
 }
+
+// levelCounter 按层级计数，零值可用
+type levelCounter struct {
+	mu     sync.Mutex
+	counts map[int]int64
+}
+
+// add 计数加一
+func (c *levelCounter) add(level int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[int]int64)
+	}
+	c.counts[level]++
+}
+
+// snapshot 获取计数快照
+func (c *levelCounter) snapshot() map[int]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[int]int64, len(c.counts))
+	for level, n := range c.counts {
+		counts[level] = n
+	}
+	return counts
+}
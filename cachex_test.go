@@ -4,9 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/kakkk/cachex/cache"
@@ -321,6 +326,47 @@ func TestCacheX_Get(t *testing.T) {
 		assert.False(tt, ok)
 		assert.Equal(tt, "", got)
 	})
+
+	t.Run("disk level", func(tt *testing.T) {
+		ctx := context.Background()
+		mr := miniredis.RunT(tt)
+		addr := mr.Addr()
+		path := filepath.Join(tt.TempDir(), "cache.db")
+		var loads atomic.Int32
+		newCacheX := func(disk cache.Cache[string]) *CacheX[string, string] {
+			cx, err := NewBuilder[string, string](ctx).
+				AddCache(cache.NewLRUCache[string](10, time.Minute)).
+				AddCache(disk).
+				AddCache(cache.NewRedisCacheWithClient[string](redis.NewClient(&redis.Options{Addr: addr}), time.Minute)).
+				SetGetDataKey(func(key string) string { return key }).
+				SetGetRealData(func(ctx context.Context, key string) (string, error) {
+					loads.Add(1)
+					return value, nil
+				}).
+				SetMGetRealData(func(ctx context.Context, keys []string) (map[string]string, error) {
+					return map[string]string{}, nil
+				}).
+				Build()
+			assert.Nil(tt, err)
+			return cx
+		}
+		disk, err := cache.NewDiskCache[string](path, time.Minute)
+		assert.Nil(tt, err)
+		got, ok := newCacheX(disk).Get(ctx, key, time.Minute)
+		assert.True(tt, ok)
+		assert.Equal(tt, value, got)
+		assert.Nil(tt, disk.Close())
+
+		// 重启后内存缓存为空，Redis不可用时从磁盘读取
+		mr.Close()
+		disk, err = cache.NewDiskCache[string](path, time.Minute)
+		assert.Nil(tt, err)
+		defer disk.Close()
+		got, ok = newCacheX(disk).Get(ctx, key, time.Minute)
+		assert.True(tt, ok)
+		assert.Equal(tt, value, got)
+		assert.Equal(tt, int32(1), loads.Load())
+	})
 }
 
 func TestCacheX_MGet(t *testing.T) {
@@ -678,7 +724,7 @@ func TestCacheX_getRealDataInternal(t *testing.T) {
 
 	t.Run("get real data not set", func(tt *testing.T) {
 		cx := &CacheX[string, string]{}
-		got, ok := cx.getRealDataInternal(ctx, "k")
+		got, ok := cx.getRealDataInternal(ctx, "k", time.Hour, cx.getRealData)
 		assert.False(tt, ok)
 		assert.Equal(tt, "", got)
 	})
@@ -697,7 +743,7 @@ func TestCacheX_getRealDataInternal(t *testing.T) {
 				return "v", nil
 			},
 		}
-		got, ok := cx.getRealDataInternal(ctx, "k")
+		got, ok := cx.getRealDataInternal(ctx, "k", time.Hour, cx.getRealData)
 		assert.True(tt, ok)
 		assert.Equal(tt, "v", got)
 	})
@@ -709,7 +755,7 @@ func TestCacheX_getRealDataInternal(t *testing.T) {
 				return "", errors.New("test")
 			},
 		}
-		got, ok := cx.getRealDataInternal(ctx, "k")
+		got, ok := cx.getRealDataInternal(ctx, "k", time.Hour, cx.getRealData)
 		assert.False(tt, ok)
 		assert.Equal(tt, "", got)
 	})
@@ -722,7 +768,7 @@ func TestCacheX_getRealDataInternal(t *testing.T) {
 			},
 			allowDowngrade: true,
 		}
-		got, ok := cx.getRealDataInternal(ctx, "k")
+		got, ok := cx.getRealDataInternal(ctx, "k", time.Hour, cx.getRealData)
 		assert.False(tt, ok)
 		assert.Equal(tt, "", got)
 	})
@@ -750,7 +796,7 @@ func TestCacheX_getRealDataInternal(t *testing.T) {
 				assert.ErrorIs(tt, err, testErr)
 			},
 		}
-		got, ok := cx.getRealDataInternal(ctx, "k")
+		got, ok := cx.getRealDataInternal(ctx, "k", time.Hour, cx.getRealData)
 		assert.True(tt, ok)
 		assert.Equal(tt, "v", got)
 	})
@@ -778,7 +824,7 @@ func TestCacheX_getRealDataInternal(t *testing.T) {
 				assert.Contains(tt, err.Error(), "[panic recover]")
 			},
 		}
-		got, ok := cx.getRealDataInternal(ctx, "k")
+		got, ok := cx.getRealDataInternal(ctx, "k", time.Hour, cx.getRealData)
 		assert.True(tt, ok)
 		assert.Equal(tt, "v", got)
 	})
@@ -803,7 +849,7 @@ func TestCacheX_getRealDataInternal(t *testing.T) {
 				assert.ErrorIs(tt, err, testErr)
 			},
 		}
-		got, ok := cx.getRealDataInternal(ctx, "k")
+		got, ok := cx.getRealDataInternal(ctx, "k", time.Hour, cx.getRealData)
 		assert.False(tt, ok)
 		assert.Equal(tt, "", got)
 	})
@@ -831,7 +877,7 @@ func TestCacheX_getRealDataInternal(t *testing.T) {
 				assert.ErrorIs(tt, err, testErr)
 			},
 		}
-		got, ok := cx.getRealDataInternal(ctx, "k")
+		got, ok := cx.getRealDataInternal(ctx, "k", time.Hour, cx.getRealData)
 		assert.False(tt, ok)
 		assert.Equal(tt, "", got)
 	})
@@ -843,7 +889,7 @@ func TestCacheX_mGetRealDataInternal(t *testing.T) {
 
 	t.Run("mget real data not set", func(tt *testing.T) {
 		cx := &CacheX[string, string]{}
-		got := cx.mGetRealDataInternal(ctx, keys)
+		got := cx.mGetRealDataInternal(ctx, keys, cx.mGetRealData)
 		assert.Empty(tt, got)
 	})
 
@@ -870,7 +916,7 @@ func TestCacheX_mGetRealDataInternal(t *testing.T) {
 				return data, nil
 			},
 		}
-		got := cx.mGetRealDataInternal(ctx, keys)
+		got := cx.mGetRealDataInternal(ctx, keys, cx.mGetRealData)
 		assert.EqualValues(tt, data, got)
 	})
 
@@ -881,7 +927,7 @@ func TestCacheX_mGetRealDataInternal(t *testing.T) {
 				return nil, errors.New("test")
 			},
 		}
-		got := cx.mGetRealDataInternal(ctx, keys)
+		got := cx.mGetRealDataInternal(ctx, keys, cx.mGetRealData)
 		assert.Empty(tt, got)
 	})
 
@@ -893,7 +939,7 @@ func TestCacheX_mGetRealDataInternal(t *testing.T) {
 			},
 			allowDowngrade: true,
 		}
-		got := cx.mGetRealDataInternal(ctx, keys)
+		got := cx.mGetRealDataInternal(ctx, keys, cx.mGetRealData)
 		assert.Empty(tt, got)
 	})
 
@@ -917,7 +963,7 @@ func TestCacheX_mGetRealDataInternal(t *testing.T) {
 			allowDowngrade: true,
 			isSetDefault:   true,
 		}
-		got := cx.mGetRealDataInternal(ctx, keys)
+		got := cx.mGetRealDataInternal(ctx, keys, cx.mGetRealData)
 		assert.EqualValues(tt, data, got)
 	})
 
@@ -962,7 +1008,7 @@ func TestCacheX_mGetRealDataInternal(t *testing.T) {
 			"k_2": "v_2",
 			"k_3": "v_3",
 		}
-		got := cx.mGetRealDataInternal(ctx, keys)
+		got := cx.mGetRealDataInternal(ctx, keys, cx.mGetRealData)
 		assert.EqualValues(tt, want, got)
 	})
 
@@ -997,7 +1043,7 @@ func TestCacheX_mGetRealDataInternal(t *testing.T) {
 				assert.Contains(tt, err.Error(), "[panic recover]")
 			},
 		}
-		got := cx.mGetRealDataInternal(ctx, keys)
+		got := cx.mGetRealDataInternal(ctx, keys, cx.mGetRealData)
 		assert.EqualValues(tt, want, got)
 	})
 
@@ -1126,6 +1172,62 @@ func TestCacheX_setDefault(t *testing.T) {
 	})
 }
 
+func TestCacheX_writeError(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("all success without error levels", func(tt *testing.T) {
+		cx := &CacheX[string, string]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[string]{cache.NewLRUCache[string](10, time.Hour), cache.NewCacheMocker[string]()},
+		}
+		for _, err := range []error{
+			cx.Set(ctx, "k", "v"),
+			cx.SetWithVersion(ctx, "k", "v", 1),
+			cx.MSet(ctx, map[string]string{"k": "v"}),
+			cx.Delete(ctx, "k"),
+			cx.MDelete(ctx, []string{"k"}),
+		} {
+			var cErr CacheError
+			assert.True(tt, errors.As(err, &cErr))
+			assert.Empty(tt, cErr.GetErrorLevels())
+		}
+	})
+
+	t.Run("level fail return CacheError", func(tt *testing.T) {
+		fail := errors.New("unit_test")
+		mocker := cache.NewCacheMocker[string]().
+			MockSet(func(ctx context.Context, key string, data string, createTime time.Time) error {
+				return fail
+			}).
+			MockMSet(func(ctx context.Context, kvs map[string]string, createTime time.Time) error {
+				return fail
+			}).
+			MockDelete(func(ctx context.Context, key string) error {
+				return fail
+			}).
+			MockMDelete(func(ctx context.Context, keys []string) error {
+				return fail
+			})
+		cx := &CacheX[string, string]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[string]{cache.NewLRUCache[string](10, time.Hour), mocker},
+		}
+		for _, err := range []error{
+			cx.Set(ctx, "k", "v"),
+			cx.MSet(ctx, map[string]string{"k": "v"}),
+			cx.Delete(ctx, "k"),
+			cx.MDelete(ctx, []string{"k"}),
+		} {
+			var cErr CacheError
+			assert.True(tt, errors.As(err, &cErr))
+			assert.Equal(tt, map[int]bool{1: true}, cErr.GetErrorLevels())
+			assert.True(tt, errors.Is(err, fail))
+		}
+	})
+}
+
 func TestCacheX_Ping(t *testing.T) {
 	cx := &CacheX[string, string]{
 		logger:     logger.NewDefaultLogger(),
@@ -1146,3 +1248,744 @@ func TestCacheX_Ping(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, got)
 }
+
+// heldLeaseLRU 租约已被持有时通知held
+type heldLeaseLRU struct {
+	*cache.LRUCache[string]
+	held chan struct{}
+}
+
+func (l *heldLeaseLRU) AcquireLease(ctx context.Context, key string, ttl time.Duration) (int64, bool, error) {
+	token, ok, err := l.LRUCache.AcquireLease(ctx, key, ttl)
+	if !ok {
+		l.held <- struct{}{}
+	}
+	return token, ok, err
+}
+
+func TestCacheX_lease(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("delete invalidate lease", func(tt *testing.T) {
+		lru := cache.NewLRUCache[string](10, time.Hour)
+		loading, done := make(chan struct{}), make(chan struct{})
+		cx := &CacheX[string, string]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[string]{lru},
+			getRealData: func(ctx context.Context, key string) (string, error) {
+				close(loading)
+				<-done
+				return "stale", nil
+			},
+			leaseTTL:  time.Second,
+			leaseWait: time.Second,
+		}
+		go func() {
+			<-loading
+			_ = cx.Delete(ctx, "k")
+			close(done)
+		}()
+		got, ok := cx.Get(ctx, "k", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "stale", got)
+		_, ok = lru.Get(ctx, "k", time.Hour)
+		assert.False(tt, ok)
+	})
+
+	t.Run("refill race with newer version and tombstone", func(tt *testing.T) {
+		mr := miniredis.RunT(tt)
+		lru := cache.NewLRUCache[string](10, time.Hour)
+		rc := cache.NewRedisCacheWithClient[string](redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Hour)
+		loading, done := make(chan struct{}), make(chan struct{})
+		cx := &CacheX[string, string]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[string]{rc, lru},
+			getRealData: func(ctx context.Context, key string) (string, error) {
+				loading <- struct{}{}
+				<-done
+				return "old", nil
+			},
+			getVersion: func(data string) int64 {
+				if data == "new" {
+					return 2
+				}
+				return 1
+			},
+			leaseTTL:       time.Second,
+			leaseWait:      time.Second,
+			tombstoneGrace: time.Minute,
+		}
+		for i, race := range []func(key string){
+			func(key string) { _ = cx.SetWithVersion(ctx, key, "new", 2) },
+			func(key string) { _ = cx.Delete(ctx, key) },
+		} {
+			key := fmt.Sprintf("race%d", i)
+			go func() {
+				<-loading
+				race(key)
+				done <- struct{}{}
+			}()
+			got, ok := cx.Get(ctx, key, time.Hour)
+			assert.True(tt, ok)
+			assert.Equal(tt, "old", got)
+			for _, c := range cx.caches {
+				got, _ = c.Get(ctx, key, time.Hour)
+				assert.NotEqual(tt, "old", got)
+			}
+		}
+	})
+
+	t.Run("concurrent miss wait lease", func(tt *testing.T) {
+		lru := &heldLeaseLRU{LRUCache: cache.NewLRUCache[string](10, time.Hour), held: make(chan struct{})}
+		var loadCount atomic.Int32
+		loading, release := make(chan struct{}), make(chan struct{})
+		cx := &CacheX[string, string]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[string]{lru},
+			getRealData: func(ctx context.Context, key string) (string, error) {
+				if loadCount.Add(1) == 1 {
+					close(loading)
+				}
+				<-release
+				return "v", nil
+			},
+			leaseTTL:  time.Minute,
+			leaseWait: time.Minute,
+		}
+		var wg sync.WaitGroup
+		get := func() {
+			defer wg.Done()
+			got, ok := cx.Get(ctx, "k", time.Hour)
+			assert.True(tt, ok)
+			assert.Equal(tt, "v", got)
+		}
+		wg.Add(1)
+		go get()
+		<-loading
+		// 其余请求均发现租约被持有后再完成回源
+		for i := 0; i < 9; i++ {
+			wg.Add(1)
+			go get()
+		}
+		for i := 0; i < 9; i++ {
+			<-lru.held
+		}
+		close(release)
+		wg.Wait()
+		assert.Equal(tt, int32(1), loadCount.Load())
+	})
+
+	t.Run("lease held expired data not served", func(tt *testing.T) {
+		lru := cache.NewLRUCache[string](10, time.Hour)
+		_ = lru.Set(ctx, "k", "stale", time.Now().Add(-2*time.Hour))
+		_, _, _ = lru.AcquireLease(ctx, "k", time.Second)
+		cx := &CacheX[string, string]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[string]{lru},
+			getRealData: func(ctx context.Context, key string) (string, error) {
+				return "v", nil
+			},
+			leaseTTL:  time.Second,
+			leaseWait: 20 * time.Millisecond,
+		}
+		got, ok := cx.Get(ctx, "k", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v", got)
+	})
+
+	t.Run("lease held not downgrade when disallowed", func(tt *testing.T) {
+		lru := cache.NewLRUCache[string](10, time.Hour)
+		_ = lru.Set(ctx, "k", "stale", time.Now().Add(-2*time.Hour))
+		_, _, _ = lru.AcquireLease(ctx, "k", time.Second)
+		var downgraded bool
+		cx, err := NewBuilder[string, string](ctx).
+			AddCache(lru).
+			SetGetDataKey(func(key string) string { return key }).
+			SetGetRealData(func(ctx context.Context, key string) (string, error) {
+				return "v", nil
+			}).
+			SetLease(time.Second, 20*time.Millisecond).
+			SetAllowDowngrade(false).
+			SetDowngradeCacheExpireTime(24 * time.Hour).
+			SetDowngradeCallBack(func(ctx context.Context, key string, err error) {
+				downgraded = true
+			}).
+			Build()
+		assert.Nil(tt, err)
+		got, meta, ok := cx.GetWithMeta(ctx, "k", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v", got)
+		assert.Equal(tt, LevelSource, meta.Level)
+		assert.False(tt, meta.Stale)
+		assert.False(tt, downgraded)
+	})
+
+	t.Run("lease held downgrade to stale data", func(tt *testing.T) {
+		lru := cache.NewLRUCache[string](10, time.Hour)
+		_ = lru.Set(ctx, "k", "stale", time.Now().Add(-2*time.Hour))
+		_, _, _ = lru.AcquireLease(ctx, "k", time.Second)
+		var downgradeErr error
+		cx := &CacheX[string, string]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[string]{lru},
+			getRealData: func(ctx context.Context, key string) (string, error) {
+				tt.Fatal("should not load")
+				return "", nil
+			},
+			leaseTTL:                 time.Second,
+			leaseWait:                time.Second,
+			allowDowngrade:           true,
+			downgradeCacheExpireTime: 24 * time.Hour,
+			downgradeCallback: func(ctx context.Context, key string, err error) {
+				downgradeErr = err
+			},
+		}
+		got, meta, ok := cx.GetWithMeta(ctx, "k", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "stale", got)
+		assert.Equal(tt, LevelDowngrade, meta.Level)
+		assert.True(tt, meta.Stale)
+		assert.True(tt, errors.Is(downgradeErr, ErrLeaseHeld))
+	})
+
+	t.Run("lease wait timeout", func(tt *testing.T) {
+		lru := cache.NewLRUCache[string](10, time.Hour)
+		_, _, _ = lru.AcquireLease(ctx, "k", time.Second)
+		cx := &CacheX[string, string]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[string]{lru},
+			getRealData: func(ctx context.Context, key string) (string, error) {
+				return "v", nil
+			},
+			leaseTTL:  time.Second,
+			leaseWait: 20 * time.Millisecond,
+		}
+		got, ok := cx.Get(ctx, "k", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v", got)
+		_, ok = lru.Get(ctx, "k", time.Hour)
+		assert.False(tt, ok)
+	})
+
+	t.Run("get real data fail release lease", func(tt *testing.T) {
+		lru := cache.NewLRUCache[string](10, time.Hour)
+		cx := &CacheX[string, string]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[string]{lru},
+			getRealData: func(ctx context.Context, key string) (string, error) {
+				return "", errors.New("unit_test")
+			},
+			leaseTTL:  time.Second,
+			leaseWait: time.Second,
+		}
+		_, ok := cx.Get(ctx, "k", time.Hour)
+		assert.False(tt, ok)
+		_, ok, _ = lru.AcquireLease(ctx, "k", time.Second)
+		assert.True(tt, ok)
+	})
+}
+
+func TestCacheX_SetWithVersion(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reject stale version", func(tt *testing.T) {
+		lru := cache.NewLRUCache[string](10, time.Hour)
+		mocker := cache.NewCacheMocker[string]()
+		cx := &CacheX[string, string]{
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[string]{mocker, lru},
+		}
+		err := cx.SetWithVersion(ctx, "k", "v2", 2)
+		assert.Nil(tt, err)
+		err = cx.SetWithVersion(ctx, "k", "v1", 1)
+		assert.NotNil(tt, err)
+		assert.True(tt, errors.Is(err, ErrStaleVersion))
+		var cErr CacheError
+		errors.As(err, &cErr)
+		assert.False(tt, cErr.GetErrorLevels()[0])
+		assert.True(tt, errors.Is(cErr.GetErrorByLevel(1), ErrStaleVersion))
+		got, _ := lru.Get(ctx, "k", time.Hour)
+		assert.Equal(tt, "v2", got)
+	})
+
+	t.Run("get version from data", func(tt *testing.T) {
+		lru := cache.NewLRUCache[string](10, time.Hour)
+		cx := &CacheX[string, string]{
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[string]{lru},
+			getVersion: func(data string) int64 {
+				return int64(data[1] - '0')
+			},
+		}
+		err := cx.Set(ctx, "k", "v2")
+		assert.Nil(tt, err)
+		err = cx.Set(ctx, "k", "v1")
+		assert.True(tt, errors.Is(err, ErrStaleVersion))
+
+		err = cx.MSet(ctx, map[string]string{"k": "v1", "k_1": "v1"})
+		assert.True(tt, errors.Is(err, ErrStaleVersion))
+		got, _ := lru.Get(ctx, "k", time.Hour)
+		assert.Equal(tt, "v2", got)
+		got, _ = lru.Get(ctx, "k_1", time.Hour)
+		assert.Equal(tt, "v1", got)
+	})
+
+	t.Run("panic recover", func(tt *testing.T) {
+		cx := &CacheX[string, string]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { panic("unit_test") },
+		}
+		err := cx.SetWithVersion(ctx, "k", "v", 1)
+		assert.NotNil(tt, err)
+	})
+}
+
+func TestCacheX_tombstone(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("block in-flight load after delete", func(tt *testing.T) {
+		lru := cache.NewLRUCache[string](10, time.Hour)
+		mocker := cache.NewCacheMocker[string]()
+		loading, done := make(chan struct{}), make(chan struct{})
+		cx := &CacheX[string, string]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[string]{mocker, lru},
+			getRealData: func(ctx context.Context, key string) (string, error) {
+				close(loading)
+				<-done
+				return "stale", nil
+			},
+			tombstoneGrace: time.Minute,
+		}
+		var clock atomic.Int64
+		clock.Store(time.Now().UnixMilli())
+		cx.now = func() time.Time { return time.UnixMilli(clock.Load()) }
+		go func() {
+			<-loading
+			// 删除晚于回源开始
+			clock.Add(1)
+			_ = cx.Delete(ctx, "k")
+			close(done)
+		}()
+		got, ok := cx.Get(ctx, "k", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "stale", got)
+		_, ok = lru.Get(ctx, "k", time.Hour)
+		assert.False(tt, ok)
+
+		err := cx.Set(ctx, "k", "fresh")
+		assert.Nil(tt, err)
+		got, ok = lru.Get(ctx, "k", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "fresh", got)
+	})
+
+	t.Run("mdelete with tombstone", func(tt *testing.T) {
+		lru := cache.NewLRUCache[string](10, time.Hour)
+		deleted := false
+		mocker := cache.NewCacheMocker[string]().MockMDelete(func(ctx context.Context, keys []string) error {
+			deleted = true
+			return nil
+		})
+		cx := &CacheX[string, string]{
+			logger:         logger.NewDefaultLogger(),
+			getDataKey:     func(key string) string { return key },
+			caches:         []cache.Cache[string]{mocker, lru},
+			tombstoneGrace: time.Minute,
+		}
+		start := time.Now().Add(-time.Second)
+		_ = cx.Set(ctx, "k", "v")
+		err := cx.MDelete(ctx, []string{"k"})
+		assert.Nil(tt, err)
+		assert.True(tt, deleted)
+		_, ok := lru.Get(ctx, "k", time.Hour)
+		assert.False(tt, ok)
+
+		err = cx.mSet(ctx, map[string]string{"k": "stale"}, start)
+		assert.True(tt, errors.Is(err, ErrTombstoned))
+		var cErr CacheError
+		errors.As(err, &cErr)
+		assert.False(tt, cErr.GetErrorLevels()[0])
+		assert.True(tt, errors.Is(cErr.GetErrorByLevel(1), ErrTombstoned))
+	})
+}
+
+// heldLockRedis 回源锁已被持有时通知held
+type heldLockRedis struct {
+	*cache.RedisCache[string]
+	held chan struct{}
+}
+
+func (r *heldLockRedis) Lock(ctx context.Context, key string, ttl time.Duration) (int64, bool, error) {
+	token, ok, err := r.RedisCache.Lock(ctx, key, ttl)
+	if !ok {
+		r.held <- struct{}{}
+	}
+	return token, ok, err
+}
+
+func TestCacheX_loadLock(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rc := cache.NewRedisCacheWithClient[string](redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Hour)
+	newCacheX := func(getRealData GetRealData[string, string], wait time.Duration) *CacheX[string, string] {
+		return &CacheX[string, string]{
+			logger:       logger.NewDefaultLogger(),
+			getDataKey:   func(key string) string { return key },
+			caches:       []cache.Cache[string]{rc, cache.NewLRUCache[string](10, time.Hour)},
+			getRealData:  getRealData,
+			loadLockTTL:  time.Second,
+			loadLockWait: wait,
+		}
+	}
+
+	t.Run("single load across instances", func(tt *testing.T) {
+		var loads atomic.Int32
+		loading, release := make(chan struct{}), make(chan struct{})
+		getRealData := func(ctx context.Context, key string) (string, error) {
+			if loads.Add(1) == 1 {
+				close(loading)
+			}
+			<-release
+			return "value", nil
+		}
+		locker := &heldLockRedis{RedisCache: rc, held: make(chan struct{})}
+		instances := []*CacheX[string, string]{newCacheX(getRealData, time.Minute), newCacheX(getRealData, time.Minute)}
+		for _, cx := range instances {
+			cx.caches[0] = locker
+		}
+		var wg sync.WaitGroup
+		get := func(cx *CacheX[string, string]) {
+			defer wg.Done()
+			got, ok := cx.Get(ctx, "single_load", time.Hour)
+			assert.True(tt, ok)
+			assert.Equal(tt, "value", got)
+		}
+		wg.Add(1)
+		go get(instances[0])
+		<-loading
+		// 两个实例的其余请求均发现锁被持有后再完成回源
+		for i := 1; i < 10; i++ {
+			wg.Add(1)
+			go get(instances[i%2])
+		}
+		for i := 1; i < 10; i++ {
+			<-locker.held
+		}
+		close(release)
+		wg.Wait()
+		assert.Equal(tt, int32(1), loads.Load())
+		assert.False(tt, mr.Exists("{single_load}:lock"))
+	})
+
+	t.Run("load after wait timeout", func(tt *testing.T) {
+		token, ok, err := rc.Lock(ctx, "wait_timeout", time.Second)
+		assert.Nil(tt, err)
+		assert.True(tt, ok)
+		defer func() { _ = rc.Unlock(ctx, "wait_timeout", token) }()
+
+		var loads atomic.Int32
+		cx := newCacheX(func(ctx context.Context, key string) (string, error) {
+			loads.Add(1)
+			return "value", nil
+		}, 20*time.Millisecond)
+		start := time.Now()
+		got, ok := cx.Get(ctx, "wait_timeout", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "value", got)
+		assert.Equal(tt, int32(1), loads.Load())
+		assert.GreaterOrEqual(tt, time.Since(start), 20*time.Millisecond)
+	})
+
+	t.Run("expired data not served while locked", func(tt *testing.T) {
+		_ = rc.Set(ctx, "stale", "old", time.Now().Add(-2*time.Hour))
+		mr.Set("{stale}:lock", "1")
+		cx := newCacheX(func(ctx context.Context, key string) (string, error) {
+			return "value", nil
+		}, 20*time.Millisecond)
+		got, ok := cx.Get(ctx, "stale", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "value", got)
+	})
+
+	t.Run("wait for refill while locked", func(tt *testing.T) {
+		_ = rc.Set(ctx, "refill", "old", time.Now().Add(-2*time.Hour))
+		mr.Set("{refill}:lock", "1")
+		cx := newCacheX(func(ctx context.Context, key string) (string, error) {
+			tt.Error("should not load")
+			return "", nil
+		}, time.Minute)
+		locker := &heldLockRedis{RedisCache: rc, held: make(chan struct{})}
+		cx.caches[0] = locker
+		go func() {
+			<-locker.held
+			_ = rc.Set(ctx, "refill", "new", time.Now())
+		}()
+		got, ok := cx.Get(ctx, "refill", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "new", got)
+	})
+
+	t.Run("downgrade to expired data after load fail", func(tt *testing.T) {
+		_ = rc.Set(ctx, "stale_downgrade", "old", time.Now().Add(-2*time.Hour))
+		mr.Set("{stale_downgrade}:lock", "1")
+		cx := newCacheX(func(ctx context.Context, key string) (string, error) {
+			return "", errors.New("load error")
+		}, 20*time.Millisecond)
+		cx.allowDowngrade, cx.downgradeCacheExpireTime = true, 24*time.Hour
+		got, meta, ok := cx.GetWithMeta(ctx, "stale_downgrade", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "old", got)
+		assert.True(tt, meta.Stale)
+		assert.Equal(tt, LevelDowngrade, meta.Level)
+	})
+
+	t.Run("downgrade after wait timeout", func(tt *testing.T) {
+		mr.Set("{downgrade}:lock", "1")
+		cx := newCacheX(func(ctx context.Context, key string) (string, error) {
+			return "", errors.New("load error")
+		}, 20*time.Millisecond)
+		cx.allowDowngrade = true
+		_, ok := cx.Get(ctx, "downgrade", time.Hour)
+		assert.False(tt, ok)
+	})
+}
+
+func TestCacheX_Update(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("update and invalidate inner levels", func(tt *testing.T) {
+		mr := miniredis.RunT(tt)
+		rc := cache.NewRedisCacheWithClient[int](redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Hour)
+		lru := cache.NewLRUCache[int](10, time.Hour)
+		cx := &CacheX[string, int]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[int]{rc, lru},
+		}
+		_ = cx.Set(ctx, "k", 1)
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := cx.Update(ctx, "k", func(old int, found bool) (int, error) {
+					assert.True(tt, found)
+					return old + 1, nil
+				})
+				assert.Nil(tt, err)
+			}()
+		}
+		wg.Wait()
+		_, ok := lru.Get(ctx, "k", time.Hour)
+		assert.False(tt, ok)
+		got, ok := cx.Get(ctx, "k", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, 6, got)
+	})
+
+	t.Run("fn error", func(tt *testing.T) {
+		lru := cache.NewLRUCache[int](10, time.Hour)
+		cx := &CacheX[string, int]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[int]{lru},
+		}
+		_, err := cx.Update(ctx, "k", func(old int, found bool) (int, error) {
+			assert.False(tt, found)
+			return 0, errors.New("fn error")
+		})
+		assert.EqualError(tt, err, "fn error")
+	})
+
+	t.Run("inner delete error", func(tt *testing.T) {
+		mocker := cache.NewCacheMocker[int]().MockDelete(func(ctx context.Context, key string) error {
+			return errors.New("delete error")
+		})
+		cx := &CacheX[string, int]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[int]{cache.NewLRUCache[int](10, time.Hour), mocker},
+		}
+		got, err := cx.Update(ctx, "k", func(old int, found bool) (int, error) {
+			return 1, nil
+		})
+		assert.Equal(tt, 1, got)
+		var cErr CacheError
+		assert.True(tt, errors.As(err, &cErr))
+		assert.NotNil(tt, cErr.GetErrorByLevel(1))
+	})
+
+	t.Run("not supported", func(tt *testing.T) {
+		cx := &CacheX[string, int]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[int]{cache.NewCacheMocker[int]()},
+		}
+		_, err := cx.Update(ctx, "k", func(old int, found bool) (int, error) { return 1, nil })
+		assert.True(tt, errors.Is(err, ErrUpdateNotSupported))
+		cx.caches = nil
+		_, err = cx.Update(ctx, "k", func(old int, found bool) (int, error) { return 1, nil })
+		assert.True(tt, errors.Is(err, ErrUpdateNotSupported))
+	})
+}
+
+func TestCacheX_GetOrLoad(t *testing.T) {
+	ctx := context.Background()
+	newCacheX := func() *CacheX[string, string] {
+		return &CacheX[string, string]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[string]{cache.NewLRUCache[string](10, time.Hour)},
+			getRealData: func(ctx context.Context, key string) (string, error) {
+				return "configured", nil
+			},
+		}
+	}
+
+	t.Run("use loader", func(tt *testing.T) {
+		cx := newCacheX()
+		got, ok := cx.GetOrLoad(ctx, "k", time.Hour, func(ctx context.Context, key string) (string, error) {
+			return "loader", nil
+		})
+		assert.True(tt, ok)
+		assert.Equal(tt, "loader", got)
+		got, ok = cx.Get(ctx, "k", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "loader", got)
+	})
+
+	t.Run("downgrade", func(tt *testing.T) {
+		cx := newCacheX()
+		var downgraded bool
+		cx.allowDowngrade = true
+		cx.downgradeCallback = func(ctx context.Context, key string, err error) { downgraded = true }
+		_ = cx.caches[0].Set(ctx, "k", "old", time.Now().Add(-2*time.Hour))
+		got, ok := cx.GetOrLoad(ctx, "k", time.Hour, func(ctx context.Context, key string) (string, error) {
+			return "", errors.New("load error")
+		})
+		assert.True(tt, ok)
+		assert.Equal(tt, "old", got)
+		assert.True(tt, downgraded)
+	})
+
+	t.Run("set default", func(tt *testing.T) {
+		var defaultKeys []string
+		cx := newCacheX()
+		cx.isSetDefault = true
+		cx.caches = []cache.Cache[string]{cache.NewCacheMocker[string]().MockSetDefault(func(ctx context.Context, keys []string, createTime time.Time) error {
+			defaultKeys = keys
+			return nil
+		})}
+		_, ok := cx.GetOrLoad(ctx, "k", time.Hour, func(ctx context.Context, key string) (string, error) {
+			return "", ErrNotFound
+		})
+		assert.False(tt, ok)
+		assert.Equal(tt, []string{"k"}, defaultKeys)
+	})
+}
+
+func TestCacheX_MGetOrLoad(t *testing.T) {
+	ctx := context.Background()
+	newCacheX := func() *CacheX[string, string] {
+		return &CacheX[string, string]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches:     []cache.Cache[string]{cache.NewLRUCache[string](10, time.Hour)},
+			mGetRealData: func(ctx context.Context, keys []string) (map[string]string, error) {
+				return map[string]string{"a": "configured"}, nil
+			},
+		}
+	}
+
+	t.Run("use loader", func(tt *testing.T) {
+		cx := newCacheX()
+		_ = cx.caches[0].Set(ctx, "a", "cached", time.Now())
+		got := cx.MGetOrLoad(ctx, []string{"a", "b"}, time.Hour, func(ctx context.Context, keys []string) (map[string]string, error) {
+			assert.Equal(tt, []string{"b"}, keys)
+			return map[string]string{"b": "loader"}, nil
+		})
+		assert.Equal(tt, map[string]string{"a": "cached", "b": "loader"}, got)
+		assert.Equal(tt, map[string]string{"a": "cached", "b": "loader"}, cx.MGet(ctx, []string{"a", "b"}, time.Hour))
+	})
+
+	t.Run("downgrade", func(tt *testing.T) {
+		cx := newCacheX()
+		var downgraded []string
+		cx.allowDowngrade = true
+		cx.mDowngradeCallback = func(ctx context.Context, keys []string, err error) { downgraded = keys }
+		_ = cx.caches[0].Set(ctx, "a", "old", time.Now().Add(-2*time.Hour))
+		got := cx.MGetOrLoad(ctx, []string{"a"}, time.Hour, func(ctx context.Context, keys []string) (map[string]string, error) {
+			return nil, errors.New("load error")
+		})
+		assert.Equal(tt, map[string]string{"a": "old"}, got)
+		assert.Equal(tt, []string{"a"}, downgraded)
+	})
+
+	t.Run("set default", func(tt *testing.T) {
+		var defaultKeys []string
+		cx := newCacheX()
+		cx.isSetDefault = true
+		cx.caches = []cache.Cache[string]{cache.NewCacheMocker[string]().MockSetDefault(func(ctx context.Context, keys []string, createTime time.Time) error {
+			defaultKeys = keys
+			return nil
+		})}
+		got := cx.MGetOrLoad(ctx, []string{"a"}, time.Hour, func(ctx context.Context, keys []string) (map[string]string, error) {
+			return map[string]string{}, nil
+		})
+		assert.Empty(tt, got)
+		assert.Equal(tt, []string{"a"}, defaultKeys)
+	})
+}
+
+func TestCacheX_readErrors(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rc := cache.NewRedisCacheWithClient[string](redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Hour)
+	var callbackLevels []int
+	cx := &CacheX[string, string]{
+		name:       "test",
+		logger:     logger.NewDefaultLogger(),
+		getDataKey: func(key string) string { return key },
+		caches:     []cache.Cache[string]{rc, cache.NewLRUCache[string](10, time.Hour)},
+		getRealData: func(ctx context.Context, key string) (string, error) {
+			return "source", nil
+		},
+		mGetRealData: func(ctx context.Context, keys []string) (map[string]string, error) {
+			return map[string]string{"a": "source"}, nil
+		},
+	}
+
+	t.Run("miss is not error", func(tt *testing.T) {
+		got, ok := cx.Get(ctx, "miss", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "source", got)
+		assert.Empty(tt, cx.ReadErrors())
+	})
+
+	t.Run("count backend errors", func(tt *testing.T) {
+		mr.SetError("unit_test")
+		defer mr.SetError("")
+		got, ok := cx.Get(ctx, "k", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "source", got)
+		assert.Equal(tt, map[int]int64{0: 1}, cx.ReadErrors())
+
+		cx.readErrorCallback = func(ctx context.Context, name string, level int, err error) {
+			assert.Equal(tt, "test", name)
+			assert.NotNil(tt, err)
+			callbackLevels = append(callbackLevels, level)
+		}
+		_ = cx.MGet(ctx, []string{"a"}, time.Hour)
+		assert.Equal(tt, map[int]int64{0: 2}, cx.ReadErrors())
+		assert.Equal(tt, []int{0}, callbackLevels)
+	})
+}
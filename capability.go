@@ -0,0 +1,106 @@
+package cachex
+
+import (
+	"context"
+	"time"
+
+	"github.com/kakkk/cachex/cache"
+	cachexError "github.com/kakkk/cachex/internal/errors"
+)
+
+// TTL 查询各层级key剩余存活时间，只包含支持TTLReader且key存在的层级，0表示不过期
+func (cx *CacheX[K, V]) TTL(ctx context.Context, key K) (map[int]time.Duration, error) {
+	if cx.closed.Load() {
+		return nil, ErrClosed
+	}
+	dataKey := cx.getDataKey(key)
+	ttls := make(map[int]time.Duration)
+	ttlErrors := cachexError.NewCacheSetError()
+	for level := 0; level < len(cx.caches); level++ {
+		reader, ok := cx.caches[level].(cache.TTLReader)
+		if !ok {
+			continue
+		}
+		ttl, ok, err := reader.TTL(ctx, dataKey)
+		if err != nil {
+			ttlErrors = ttlErrors.AppendError(level, err)
+			continue
+		}
+		if ok {
+			ttls[level] = ttl
+		}
+	}
+	return ttls, ttlErrors.ErrorOrNil()
+}
+
+// Touch 延长支持Toucher的各层级key存活时间，至少一个层级存在该key时返回true
+func (cx *CacheX[K, V]) Touch(ctx context.Context, key K, ttl time.Duration) (bool, error) {
+	if cx.closed.Load() {
+		return false, ErrClosed
+	}
+	dataKey := cx.getDataKey(key)
+	touched := false
+	touchErrors := cachexError.NewCacheSetError()
+	for level := 0; level < len(cx.caches); level++ {
+		toucher, ok := cx.caches[level].(cache.Toucher)
+		if !ok {
+			continue
+		}
+		ok, err := toucher.Touch(ctx, dataKey, ttl)
+		if err != nil {
+			touchErrors = touchErrors.AppendError(level, err)
+			continue
+		}
+		touched = touched || ok
+	}
+	return touched, touchErrors.ErrorOrNil()
+}
+
+// Keys 遍历支持Scanner的各层级中前缀为prefix的缓存key，去重后返回
+func (cx *CacheX[K, V]) Keys(ctx context.Context, prefix string) ([]string, error) {
+	if cx.closed.Load() {
+		return nil, ErrClosed
+	}
+	var keys []string
+	seen := make(map[string]struct{})
+	scanErrors := cachexError.NewCacheSetError()
+	for level := len(cx.caches) - 1; level >= 0; level-- {
+		scanner, ok := cx.caches[level].(cache.Scanner)
+		if !ok {
+			continue
+		}
+		err := scanner.Scan(ctx, prefix, func(key string) bool {
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				keys = append(keys, key)
+			}
+			return true
+		})
+		if err != nil {
+			scanErrors = scanErrors.AppendError(level, err)
+		}
+	}
+	return keys, scanErrors.ErrorOrNil()
+}
+
+// Stats 获取支持StatsProvider的各层级缓存统计
+func (cx *CacheX[K, V]) Stats(ctx context.Context) (map[int]cache.Stats, error) {
+	if cx.closed.Load() {
+		return nil, ErrClosed
+	}
+	stats := make(map[int]cache.Stats)
+	statsErrors := cachexError.NewCacheSetError()
+	for level := 0; level < len(cx.caches); level++ {
+		provider, ok := cx.caches[level].(cache.StatsProvider)
+		if !ok {
+			continue
+		}
+		s, err := provider.Stats(ctx)
+		if err != nil {
+			statsErrors = statsErrors.AppendError(level, err)
+			continue
+		}
+		stats[level] = s
+	}
+	return stats, statsErrors.ErrorOrNil()
+}
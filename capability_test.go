@@ -0,0 +1,84 @@
+package cachex
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kakkk/cachex/cache"
+	"github.com/kakkk/cachex/internal/logger"
+)
+
+func TestCacheX_capability(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rc := cache.NewRedisCacheWithClient[string](redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Hour)
+	lru := cache.NewLRUCache[string](10, time.Hour)
+	cx := &CacheX[string, string]{
+		logger:     logger.NewDefaultLogger(),
+		getDataKey: func(key string) string { return "user:" + key },
+		caches:     []cache.Cache[string]{cache.NewCacheMocker[string](), rc, lru},
+	}
+	_ = cx.Set(ctx, "1", "a")
+	_ = lru.Set(ctx, "user:2", "b", time.Now())
+
+	t.Run("ttl", func(tt *testing.T) {
+		ttls, err := cx.TTL(ctx, "1")
+		assert.Nil(tt, err)
+		assert.Len(tt, ttls, 2)
+		assert.Greater(tt, ttls[1], 50*time.Minute)
+		assert.Greater(tt, ttls[2], 50*time.Minute)
+		ttls, err = cx.TTL(ctx, "2")
+		assert.Nil(tt, err)
+		assert.Len(tt, ttls, 1)
+	})
+
+	t.Run("touch", func(tt *testing.T) {
+		touched, err := cx.Touch(ctx, "1", 2*time.Hour)
+		assert.Nil(tt, err)
+		assert.True(tt, touched)
+		ttls, _ := cx.TTL(ctx, "1")
+		assert.Greater(tt, ttls[1], time.Hour)
+		touched, err = cx.Touch(ctx, "missing", time.Hour)
+		assert.Nil(tt, err)
+		assert.False(tt, touched)
+	})
+
+	t.Run("keys", func(tt *testing.T) {
+		keys, err := cx.Keys(ctx, "user:")
+		assert.Nil(tt, err)
+		sort.Strings(keys)
+		assert.Equal(tt, []string{"user:1", "user:2"}, keys)
+	})
+
+	t.Run("stats", func(tt *testing.T) {
+		stats, err := cx.Stats(ctx)
+		assert.Nil(tt, err)
+		assert.Len(tt, stats, 2)
+		assert.Equal(tt, int64(1), stats[1].Entries)
+		assert.Equal(tt, int64(2), stats[2].Entries)
+	})
+
+	t.Run("level errors", func(tt *testing.T) {
+		mr.SetError("unit_test")
+		defer mr.SetError("")
+		var cErr CacheError
+		_, err := cx.TTL(ctx, "1")
+		assert.True(tt, errors.As(err, &cErr))
+		assert.NotNil(tt, cErr.GetErrorByLevel(1))
+		_, err = cx.Touch(ctx, "1", time.Hour)
+		assert.NotNil(tt, err)
+		keys, err := cx.Keys(ctx, "user:")
+		assert.NotNil(tt, err)
+		assert.Len(tt, keys, 2)
+		stats, err := cx.Stats(ctx)
+		assert.NotNil(tt, err)
+		assert.Len(tt, stats, 1)
+	})
+}
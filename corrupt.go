@@ -0,0 +1,46 @@
+package cachex
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kakkk/cachex/cache"
+)
+
+// CorruptCallback 缓存数据无法解码回调函数，raw为缓存中的原始数据，用于排查
+type CorruptCallback func(ctx context.Context, name string, level int, key string, raw []byte, err error)
+
+// Corruptions 获取各层级无法解码的数据数
+func (cx *CacheX[K, V]) Corruptions() map[int]int64 {
+	return cx.corruptions.snapshot()
+}
+
+// asCorrupt 判断读取错误是否为数据无法解码
+func asCorrupt(err error) (*cache.CorruptError, bool) {
+	var corrupt *cache.CorruptError
+	ok := errors.As(err, &corrupt)
+	return corrupt, ok
+}
+
+// corrupt 无法解码的数据计数、回调，并从该层级删除，编码不一致、密钥未知等可能由其他实例配置不同引起的数据不删除
+func (cx *CacheX[K, V]) corrupt(ctx context.Context, level int, corrupt *cache.CorruptError) {
+	defer cx.recover(ctx, nil)()
+	var poisoned []string
+	for key, raw := range corrupt.Entries {
+		err := corrupt.Errors[key]
+		cx.corruptions.add(level)
+		cx.logger.Warnf(ctx, "cache %v level %v corrupt data, key:%v, err:%v", cx.name, level, key, err)
+		if cx.corruptCallback != nil {
+			cx.corruptCallback(ctx, cx.name, level, key, raw, err)
+		}
+		if !cache.IsRecoverable(err) {
+			poisoned = append(poisoned, key)
+		}
+	}
+	if len(poisoned) == 0 {
+		return
+	}
+	if err := cx.caches[level].MDelete(ctx, poisoned); err != nil {
+		cx.logger.Warnf(ctx, "cache %v level %v delete corrupt data error: %v", cx.name, level, err)
+	}
+}
@@ -0,0 +1,80 @@
+package cachex
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kakkk/cachex/cache"
+)
+
+func TestCacheX_corrupt(t *testing.T) {
+	ctx := context.Background()
+
+	newCacheX := func(tt *testing.T, rc cache.Cache[string], cb CorruptCallback) *CacheX[string, string] {
+		cx, err := NewBuilder[string, string](ctx).
+			AddCache(rc).
+			SetGetDataKey(func(key string) string { return key }).
+			SetGetRealData(func(ctx context.Context, key string) (string, error) { return "source", nil }).
+			SetMGetRealData(func(ctx context.Context, keys []string) (map[string]string, error) {
+				return map[string]string{}, nil
+			}).
+			SetCorruptCallback(cb).
+			Build()
+		assert.Nil(tt, err)
+		return cx
+	}
+
+	t.Run("get", func(tt *testing.T) {
+		mr := miniredis.RunT(tt)
+		rc := cache.NewRedisCacheWithClient[string](redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Minute)
+		var raws map[string][]byte
+		cx := newCacheX(tt, rc, func(ctx context.Context, name string, level int, key string, raw []byte, err error) {
+			raws = map[string][]byte{key: raw}
+		})
+		mr.Set("k", "invalid")
+		data, ok := cx.Get(ctx, "k", 0)
+		assert.True(tt, ok)
+		assert.Equal(tt, "source", data)
+		assert.Equal(tt, map[string][]byte{"k": []byte("invalid")}, raws)
+		assert.Equal(tt, map[int]int64{0: 1}, cx.Corruptions())
+		assert.Empty(tt, cx.ReadErrors())
+
+		data, ok = cx.Get(ctx, "k", 0)
+		assert.True(tt, ok)
+		assert.Equal(tt, "source", data)
+		assert.Equal(tt, map[int]int64{0: 1}, cx.Corruptions())
+	})
+
+	t.Run("mget delete poisoned", func(tt *testing.T) {
+		mr := miniredis.RunT(tt)
+		rc := cache.NewRedisCacheWithClient[string](redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Minute)
+		var keys []string
+		cx := newCacheX(tt, rc, func(ctx context.Context, name string, level int, key string, raw []byte, err error) {
+			keys = append(keys, key)
+		})
+		assert.Nil(tt, cx.Set(ctx, "a", "1"))
+		mr.Set("b", "invalid")
+		data := cx.MGet(ctx, []string{"a", "b"}, 0)
+		assert.Equal(tt, map[string]string{"a": "1"}, data)
+		assert.Equal(tt, []string{"b"}, keys)
+		assert.False(tt, mr.Exists("b"))
+		assert.Empty(tt, cx.ReadErrors())
+	})
+
+	t.Run("keep recoverable", func(tt *testing.T) {
+		mr := miniredis.RunT(tt)
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		msgpack := cache.NewRedisCacheWithClient[string](client, time.Minute, cache.WithCodec(cache.MsgpackCodec))
+		assert.Nil(tt, msgpack.Set(ctx, "k", "v", time.Now()))
+		cx := newCacheX(tt, cache.NewRedisCacheWithClient[string](client, time.Minute), nil)
+		data := cx.MGet(ctx, []string{"k"}, 0)
+		assert.Empty(tt, data)
+		assert.Equal(tt, map[int]int64{0: 1}, cx.Corruptions())
+		assert.True(tt, mr.Exists("k"))
+	})
+}
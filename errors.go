@@ -1,10 +1,32 @@
 package cachex
 
-import "errors"
+import (
+	"errors"
 
-// ErrNotFound 回源查不到数据返回错误
-var ErrNotFound = errors.New("not found")
+	"github.com/kakkk/cachex/cache"
+)
 
+var (
+	// ErrNotFound 回源查不到数据返回错误
+	ErrNotFound = errors.New("not found")
+	// ErrStaleVersion 已存在更新版本，写入被拒绝
+	ErrStaleVersion = cache.ErrStaleVersion
+	// ErrTombstoned 墓碑宽限期内，删除前开始的写入被拒绝
+	ErrTombstoned = cache.ErrTombstoned
+	// ErrSchemaNewer 共享缓存中已存在更高schema版本实例写入的数据，写入被拒绝
+	ErrSchemaNewer = cache.ErrSchemaNewer
+	// ErrUpdateConflict 乐观更新冲突且重试次数耗尽
+	ErrUpdateConflict = cache.ErrUpdateConflict
+	// ErrUpdateNotSupported 最外层缓存不支持原子读改写
+	ErrUpdateNotSupported = errors.New("update not supported")
+	// ErrLeaseHeld 租约被其他请求持有，返回降级数据时传给降级回调
+	ErrLeaseHeld = errors.New("lease held by another request")
+	// ErrClosed 缓存已关闭
+	ErrClosed = errors.New("cachex closed")
+)
+
+// CacheError 多级缓存写入或删除错误，按层级记录错误；
+// Set、MSet、Delete等全部层级成功时同样返回CacheError，需通过GetErrorLevels判断是否有层级失败
 type CacheError interface {
 	Error() string
 	GetErrorByLevel(level int) error
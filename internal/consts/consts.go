@@ -1,5 +1,6 @@
 package consts
 
 const (
-	CacheLevelSource = -1 // 回源
+	CacheLevelSource    = -1 // 回源
+	CacheLevelDowngrade = -2 // 降级
 )
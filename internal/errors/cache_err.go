@@ -51,6 +51,26 @@ func (e *CacheErrorImpl) GetErrorLevels() map[int]bool {
 	return utils.GetMapKeys(e.errors)
 }
 
+// ErrorOrNil 没有错误时返回nil，避免返回持有nil指针的error
+func (e *CacheErrorImpl) ErrorOrNil() error {
+	if e == nil || len(e.errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Unwrap 返回各层级错误，支持errors.Is/errors.As
+func (e *CacheErrorImpl) Unwrap() []error {
+	if e == nil {
+		return nil
+	}
+	errs := make([]error, 0, len(e.errors))
+	for _, err := range e.errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
 func (e *CacheErrorImpl) AppendError(level int, err error) *CacheErrorImpl {
 	if e == nil {
 		return &CacheErrorImpl{
@@ -98,3 +98,19 @@ func TestCacheErrorImpl_AppendError(t *testing.T) {
 	got = got.AppendError(1, l1Err)
 	assert.ErrorIs(t, got.errors[1], l1Err)
 }
+
+func TestCacheErrorImpl_Unwrap(t *testing.T) {
+	target := errors.New("target")
+	var e *CacheErrorImpl
+	assert.Nil(t, e.Unwrap())
+	e = e.AppendError(0, errors.New("l0_err")).AppendError(1, target)
+	assert.Len(t, e.Unwrap(), 2)
+	assert.True(t, errors.Is(e, target))
+}
+
+func TestCacheErrorImpl_ErrorOrNil(t *testing.T) {
+	var e *CacheErrorImpl
+	assert.True(t, e.ErrorOrNil() == nil)
+	e = e.AppendError(0, errors.New("l0_err"))
+	assert.NotNil(t, e.ErrorOrNil())
+}
@@ -1,11 +1,59 @@
 package model
 
+import "encoding/json"
+
 type CacheData[T any] struct {
-	CreateAt int64 `json:"c"`
-	Data     T     `json:"d"`
-	Default  uint  `json:"z"`
+	CreateAt  int64 `json:"c"`
+	Data      T     `json:"d"`
+	Default   uint  `json:"z"`
+	Version   int64 `json:"v,omitempty"`
+	Tombstone uint  `json:"t,omitempty"`
+	ExpireAt  int64 `json:"e,omitempty"`
 }
 
 func (c *CacheData[T]) IsDefault() bool {
 	return c.Default == 1
 }
+
+// IsTombstone 是否为墓碑
+func (c *CacheData[T]) IsTombstone() bool {
+	return c.Tombstone == 1
+}
+
+// Meta 获取元数据
+func (c *CacheData[T]) Meta() *CacheMeta {
+	return &CacheMeta{
+		CreateAt:  c.CreateAt,
+		Default:   c.Default,
+		Version:   c.Version,
+		Tombstone: c.Tombstone,
+		ExpireAt:  c.ExpireAt,
+	}
+}
+
+// CacheMeta 缓存元数据，解析时忽略数据
+type CacheMeta struct {
+	CreateAt  int64  `json:"c"`
+	Default   uint   `json:"z"`
+	Version   int64  `json:"v,omitempty"`
+	Tombstone uint   `json:"t,omitempty"`
+	ExpireAt  int64  `json:"e,omitempty"`
+	Schema    uint32 `json:"-"` // schema版本，只记录在二进制信封中
+}
+
+// IsTombstoneActive 墓碑是否处于宽限期内
+func (m *CacheMeta) IsTombstoneActive(now int64) bool {
+	return m.Tombstone == 1 && now < m.ExpireAt
+}
+
+// RawCacheData 缓存数据，数据保留编码后的原始字节，JSON编码时写入Data，其他编码时写入Payload并记录编码名称
+type RawCacheData struct {
+	CreateAt  int64           `json:"c"`
+	Data      json.RawMessage `json:"d,omitempty"`
+	Default   uint            `json:"z"`
+	Version   int64           `json:"v,omitempty"`
+	Tombstone uint            `json:"t,omitempty"`
+	ExpireAt  int64           `json:"e,omitempty"`
+	Codec     string          `json:"k,omitempty"`
+	Payload   []byte          `json:"p,omitempty"`
+}
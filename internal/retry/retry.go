@@ -0,0 +1,380 @@
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	maxWait                = time.Second            // 无任务时最大等待时间
+	defaultPersistInterval = 100 * time.Millisecond // 默认持久化最小间隔
+)
+
+// Task 重试任务
+type Task struct {
+	Level   int      `json:"l"`
+	Keys    []string `json:"k"`
+	Attempt int      `json:"a"`
+	NextAt  int64    `json:"n"`
+}
+
+// Config 重试配置
+type Config struct {
+	MaxAttempts int           // 最大重试次数
+	Backoff     time.Duration // 初始重试间隔，每次失败翻倍
+	MaxBackoff  time.Duration // 最大重试间隔
+	File        string        // 持久化文件，为空不持久化
+	// PersistInterval 持久化最小间隔，间隔内Add的任务由后台合并写入，执行任务及Close时立即写入，默认100ms
+	PersistInterval time.Duration
+	// PersistError 持久化失败回调，失败的任务在下次持久化时重新写入
+	PersistError func(err error)
+}
+
+// Stats 重试统计
+type Stats struct {
+	Depth   map[int]int   // 各层级待重试任务数
+	GiveUps map[int]int64 // 各层级放弃重试任务数
+}
+
+// Exec 执行任务
+type Exec func(ctx context.Context, level int, keys []string) error
+
+// GiveUp 放弃重试回调
+type GiveUp func(ctx context.Context, task *Task, err error)
+
+// Queue 按层级排队的重试队列
+type Queue struct {
+	cfg    Config
+	exec   Exec
+	giveUp GiveUp
+
+	mu          sync.Mutex
+	tasks       map[int][]*Task
+	giveUps     map[int]int64
+	dirty       bool      // 存在未持久化的任务
+	persistedAt time.Time // 上次持久化时间
+	now         func() time.Time
+
+	persistMu sync.Mutex // 串行写入持久化文件，写入期间不持有mu
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// New 创建重试队列，配置了持久化文件时加载未完成的任务
+func New(cfg Config, exec Exec, giveUp GiveUp) (*Queue, error) {
+	q := &Queue{
+		cfg:     cfg,
+		exec:    exec,
+		giveUp:  giveUp,
+		tasks:   make(map[int][]*Task),
+		giveUps: make(map[int]int64),
+		now:     time.Now,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if q.cfg.PersistInterval <= 0 {
+		q.cfg.PersistInterval = defaultPersistInterval
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Add 添加任务，delay后执行，任务由后台按持久化间隔合并写入持久化文件
+func (q *Queue) Add(level int, keys []string, delay time.Duration) {
+	if len(keys) == 0 {
+		return
+	}
+	q.mu.Lock()
+	q.tasks[level] = append(q.tasks[level], &Task{
+		Level:  level,
+		Keys:   keys,
+		NextAt: q.now().Add(delay).UnixMilli(),
+	})
+	q.dirty = true
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start 启动后台重试
+func (q *Queue) Start() {
+	go q.run()
+}
+
+// Close 停止后台重试并持久化未完成的任务
+func (q *Queue) Close() {
+	q.once.Do(func() {
+		close(q.stop)
+	})
+	<-q.done
+	q.flush(true)
+}
+
+// Drain 停止后台重试并执行剩余任务直到队列为空，ctx结束时返回ctx错误，未完成的任务保留在持久化文件中
+func (q *Queue) Drain(ctx context.Context) error {
+	q.Close()
+	defer q.flush(true)
+	for {
+		q.Process(ctx)
+		if q.pending() == 0 {
+			return nil
+		}
+		timer := time.NewTimer(q.nextWait())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Process 执行所有到期任务并持久化剩余任务，返回执行的任务数
+func (q *Queue) Process(ctx context.Context) int {
+	now := q.now()
+	var due []*Task
+	q.mu.Lock()
+	for level, tasks := range q.tasks {
+		remain := tasks[:0]
+		for _, task := range tasks {
+			if task.NextAt <= now.UnixMilli() {
+				due = append(due, task)
+				continue
+			}
+			remain = append(remain, task)
+		}
+		q.tasks[level] = remain
+	}
+	q.mu.Unlock()
+	if len(due) == 0 {
+		return 0
+	}
+
+	var failed, gaveUp []*Task
+	errs := make(map[*Task]error)
+	for _, task := range due {
+		err := q.exec(ctx, task.Level, task.Keys)
+		if err == nil {
+			continue
+		}
+		task.Attempt++
+		if task.Attempt >= q.cfg.MaxAttempts {
+			gaveUp = append(gaveUp, task)
+			errs[task] = err
+			continue
+		}
+		task.NextAt = q.now().Add(q.backoff(task.Attempt)).UnixMilli()
+		failed = append(failed, task)
+	}
+
+	q.mu.Lock()
+	for _, task := range failed {
+		q.tasks[task.Level] = append(q.tasks[task.Level], task)
+	}
+	for _, task := range gaveUp {
+		q.giveUps[task.Level]++
+	}
+	q.dirty = true
+	q.mu.Unlock()
+	q.flush(true)
+
+	for _, task := range gaveUp {
+		if q.giveUp != nil {
+			q.giveUp(ctx, task, errs[task])
+		}
+	}
+	return len(due)
+}
+
+// Stats 获取重试统计
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := Stats{
+		Depth:   make(map[int]int, len(q.tasks)),
+		GiveUps: make(map[int]int64, len(q.giveUps)),
+	}
+	for level, tasks := range q.tasks {
+		if len(tasks) > 0 {
+			stats.Depth[level] = len(tasks)
+		}
+	}
+	for level, n := range q.giveUps {
+		stats.GiveUps[level] = n
+	}
+	return stats
+}
+
+// pending 待执行任务数
+func (q *Queue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for _, tasks := range q.tasks {
+		n += len(tasks)
+	}
+	return n
+}
+
+// run 后台重试，等待到最早的任务到期
+func (q *Queue) run() {
+	defer close(q.done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+		q.Process(context.Background())
+		q.flush(false)
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(min(q.nextWait(), q.flushWait()))
+	}
+}
+
+// flush 持久化未写入的任务，force为false时距上次持久化不足间隔则跳过；持有锁时生成快照，
+// 写入文件时不持有锁，避免阻塞Add；写入失败时保留未持久化标记并调用PersistError
+func (q *Queue) flush(force bool) {
+	if q.cfg.File == "" {
+		return
+	}
+	q.persistMu.Lock()
+	defer q.persistMu.Unlock()
+	q.mu.Lock()
+	if !q.dirty || (!force && q.now().Sub(q.persistedAt) < q.cfg.PersistInterval) {
+		q.mu.Unlock()
+		return
+	}
+	bytes, err := q.snapshot()
+	q.dirty, q.persistedAt = false, q.now()
+	q.mu.Unlock()
+
+	if err == nil {
+		err = q.persist(bytes)
+	}
+	if err == nil {
+		return
+	}
+	q.mu.Lock()
+	q.dirty = true
+	q.mu.Unlock()
+	if q.cfg.PersistError != nil {
+		q.cfg.PersistError(err)
+	}
+}
+
+// flushWait 距离下次需要持久化的时间，没有未写入的任务时为maxWait
+func (q *Queue) flushWait() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.dirty {
+		return maxWait
+	}
+	return max(q.cfg.PersistInterval-q.now().Sub(q.persistedAt), 0)
+}
+
+// nextWait 距离最早任务到期的时间
+func (q *Queue) nextWait() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	wait := maxWait
+	now := q.now().UnixMilli()
+	for _, tasks := range q.tasks {
+		for _, task := range tasks {
+			if d := time.Duration(task.NextAt-now) * time.Millisecond; d < wait {
+				wait = d
+			}
+		}
+	}
+	return max(wait, 0)
+}
+
+// backoff 第attempt次失败后的重试间隔
+func (q *Queue) backoff(attempt int) time.Duration {
+	backoff := q.cfg.Backoff
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if q.cfg.MaxBackoff > 0 && backoff >= q.cfg.MaxBackoff {
+			return q.cfg.MaxBackoff
+		}
+	}
+	return backoff
+}
+
+// load 从持久化文件加载任务
+func (q *Queue) load() error {
+	if q.cfg.File == "" {
+		return nil
+	}
+	bytes, err := os.ReadFile(q.cfg.File)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	var tasks []*Task
+	if len(bytes) > 0 {
+		if err = json.Unmarshal(bytes, &tasks); err != nil {
+			return err
+		}
+	}
+	for _, task := range tasks {
+		q.tasks[task.Level] = append(q.tasks[task.Level], task)
+	}
+	return nil
+}
+
+// snapshot 编码当前任务，需持有锁
+func (q *Queue) snapshot() ([]byte, error) {
+	tasks := make([]*Task, 0)
+	for _, levelTasks := range q.tasks {
+		tasks = append(tasks, levelTasks...)
+	}
+	return json.Marshal(tasks)
+}
+
+// persist 写入持久化文件，先写临时文件并fsync后重命名保证文件完整，需持有persistMu
+func (q *Queue) persist(bytes []byte) error {
+	tmp := q.cfg.File + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create retry file error: %w", err)
+	}
+	_, err = f.Write(bytes)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("write retry file error: %w", err)
+	}
+	if err = os.Rename(tmp, q.cfg.File); err != nil {
+		return fmt.Errorf("rename retry file error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("retry until success", func(tt *testing.T) {
+		calls := 0
+		q, err := New(Config{MaxAttempts: 3, Backoff: time.Second}, func(ctx context.Context, level int, keys []string) error {
+			calls++
+			if calls < 2 {
+				return errors.New("fail")
+			}
+			assert.Equal(tt, 1, level)
+			assert.Equal(tt, []string{"a", "b"}, keys)
+			return nil
+		}, nil)
+		assert.Nil(tt, err)
+		clock := time.Now()
+		q.now = func() time.Time { return clock }
+		q.Add(1, []string{"a", "b"}, 0)
+		assert.Equal(tt, map[int]int{1: 1}, q.Stats().Depth)
+
+		assert.Equal(tt, 1, q.Process(ctx))
+		assert.Equal(tt, map[int]int{1: 1}, q.Stats().Depth)
+		assert.Equal(tt, 0, q.Process(ctx))
+		clock = clock.Add(time.Second)
+		assert.Equal(tt, 1, q.Process(ctx))
+		assert.Equal(tt, 2, calls)
+		assert.Empty(tt, q.Stats().Depth)
+		assert.Empty(tt, q.Stats().GiveUps)
+	})
+
+	t.Run("give up", func(tt *testing.T) {
+		var gaveUp *Task
+		q, err := New(Config{MaxAttempts: 2}, func(ctx context.Context, level int, keys []string) error {
+			return errors.New("fail")
+		}, func(ctx context.Context, task *Task, err error) {
+			gaveUp = task
+			assert.EqualError(tt, err, "fail")
+		})
+		assert.Nil(tt, err)
+		q.Add(0, []string{"a"}, 0)
+		q.Add(0, nil, 0)
+		q.Process(ctx)
+		assert.Nil(tt, gaveUp)
+		q.Process(ctx)
+		assert.NotNil(tt, gaveUp)
+		assert.Equal(tt, 2, gaveUp.Attempt)
+		assert.Empty(tt, q.Stats().Depth)
+		assert.Equal(tt, map[int]int64{0: 1}, q.Stats().GiveUps)
+	})
+
+	t.Run("delay", func(tt *testing.T) {
+		q, err := New(Config{MaxAttempts: 1}, func(ctx context.Context, level int, keys []string) error {
+			return nil
+		}, nil)
+		assert.Nil(tt, err)
+		q.Add(0, []string{"a"}, time.Hour)
+		assert.Equal(tt, 0, q.Process(ctx))
+		assert.Equal(tt, map[int]int{0: 1}, q.Stats().Depth)
+	})
+
+	t.Run("backoff", func(tt *testing.T) {
+		q, err := New(Config{Backoff: time.Second, MaxBackoff: 5 * time.Second}, nil, nil)
+		assert.Nil(tt, err)
+		assert.Equal(tt, time.Second, q.backoff(1))
+		assert.Equal(tt, 2*time.Second, q.backoff(2))
+		assert.Equal(tt, 4*time.Second, q.backoff(3))
+		assert.Equal(tt, 5*time.Second, q.backoff(4))
+	})
+
+	t.Run("persist", func(tt *testing.T) {
+		file := filepath.Join(tt.TempDir(), "retry.json")
+		fail := func(ctx context.Context, level int, keys []string) error {
+			return errors.New("fail")
+		}
+		q, err := New(Config{MaxAttempts: 3, Backoff: time.Hour, File: file}, fail, nil)
+		assert.Nil(tt, err)
+		q.Add(0, []string{"a"}, 0)
+		q.Add(1, []string{"b"}, time.Hour)
+		q.Process(ctx)
+
+		var got [][]string
+		q, err = New(Config{MaxAttempts: 3, File: file}, func(ctx context.Context, level int, keys []string) error {
+			got = append(got, keys)
+			return nil
+		}, nil)
+		assert.Nil(tt, err)
+		assert.Equal(tt, map[int]int{0: 1, 1: 1}, q.Stats().Depth)
+		q.mu.Lock()
+		assert.Equal(tt, 1, q.tasks[0][0].Attempt)
+		q.mu.Unlock()
+		assert.Equal(tt, 0, q.Process(ctx))
+		assert.Empty(tt, got)
+	})
+
+	t.Run("debounce persist", func(tt *testing.T) {
+		file := filepath.Join(tt.TempDir(), "retry.json")
+		depth := func() int {
+			q, err := New(Config{File: file}, nil, nil)
+			assert.Nil(tt, err)
+			return q.Stats().Depth[0]
+		}
+		q, err := New(Config{MaxAttempts: 3, File: file, PersistInterval: time.Minute}, nil, nil)
+		assert.Nil(tt, err)
+		now := time.Now()
+		q.now = func() time.Time { return now }
+		q.Add(0, []string{"a"}, time.Hour)
+		q.flush(false)
+		assert.Equal(tt, 1, depth())
+		q.Add(0, []string{"b"}, time.Hour)
+		q.Add(0, []string{"c"}, time.Hour)
+		q.flush(false)
+		assert.Equal(tt, 1, depth())
+		assert.Equal(tt, time.Minute, q.flushWait())
+		now = now.Add(time.Minute)
+		q.flush(false)
+		assert.Equal(tt, 3, depth())
+
+		// 后台按间隔写入，Close时立即写入
+		q.Start()
+		q.Add(0, []string{"d"}, time.Hour)
+		q.Close()
+		assert.Equal(tt, 4, depth())
+	})
+
+	t.Run("persist error", func(tt *testing.T) {
+		dir := filepath.Join(tt.TempDir(), "missing")
+		var errs []error
+		q, err := New(Config{File: filepath.Join(dir, "retry.json"), PersistError: func(err error) {
+			errs = append(errs, err)
+		}}, nil, nil)
+		assert.Nil(tt, err)
+		q.Add(0, []string{"a"}, time.Hour)
+		q.flush(true)
+		assert.Len(tt, errs, 1)
+		assert.True(tt, q.dirty)
+
+		// 目录恢复后重新写入
+		assert.Nil(tt, os.Mkdir(dir, 0700))
+		q.flush(true)
+		assert.Len(tt, errs, 1)
+		assert.False(tt, q.dirty)
+		q, err = New(Config{File: filepath.Join(dir, "retry.json")}, nil, nil)
+		assert.Nil(tt, err)
+		assert.Equal(tt, map[int]int{0: 1}, q.Stats().Depth)
+	})
+
+	t.Run("load invalid file", func(tt *testing.T) {
+		file := filepath.Join(tt.TempDir(), "retry.json")
+		q, err := New(Config{File: file}, nil, nil)
+		assert.Nil(tt, err)
+		assert.Empty(tt, q.Stats().Depth)
+
+		assert.Nil(tt, writeFile(file, "{"))
+		_, err = New(Config{File: file}, nil, nil)
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("background", func(tt *testing.T) {
+		done := make(chan []string, 1)
+		q, err := New(Config{MaxAttempts: 1}, func(ctx context.Context, level int, keys []string) error {
+			done <- keys
+			return nil
+		}, nil)
+		assert.Nil(tt, err)
+		q.Start()
+		q.Add(0, []string{"a"}, time.Millisecond)
+		select {
+		case keys := <-done:
+			assert.Equal(tt, []string{"a"}, keys)
+		case <-time.After(time.Second):
+			tt.Fatal("task not executed")
+		}
+		q.Close()
+		q.Close()
+	})
+
+	t.Run("drain", func(tt *testing.T) {
+		var executed [][]string
+		q, err := New(Config{MaxAttempts: 3, Backoff: time.Millisecond}, func(ctx context.Context, level int, keys []string) error {
+			executed = append(executed, keys)
+			return nil
+		}, nil)
+		assert.Nil(tt, err)
+		q.Start()
+		q.Add(0, []string{"a"}, 20*time.Millisecond)
+		assert.Nil(tt, q.Drain(ctx))
+		assert.Equal(tt, [][]string{{"a"}}, executed)
+		assert.Empty(tt, q.Stats().Depth)
+	})
+
+	t.Run("drain timeout", func(tt *testing.T) {
+		file := filepath.Join(tt.TempDir(), "retry.json")
+		q, err := New(Config{MaxAttempts: 3, Backoff: time.Millisecond, File: file}, func(ctx context.Context, level int, keys []string) error {
+			return nil
+		}, nil)
+		assert.Nil(tt, err)
+		q.Start()
+		q.Add(0, []string{"a"}, time.Hour)
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(tt, q.Drain(timeoutCtx), context.DeadlineExceeded)
+
+		q, err = New(Config{File: file}, nil, nil)
+		assert.Nil(tt, err)
+		assert.Equal(tt, map[int]int{0: 1}, q.Stats().Depth)
+	})
+}
+
+func writeFile(name string, content string) error {
+	return os.WriteFile(name, []byte(content), 0o644)
+}
@@ -62,13 +62,27 @@ func UnmarshalData[T any](val []byte) (*model.CacheData[T], error) {
 }
 
 func MarshalData[T any](data T, createAt int64) ([]byte, error) {
+	return MarshalVersionedData(data, createAt, 0)
+}
+
+func MarshalVersionedData[T any](data T, createAt int64, version int64) ([]byte, error) {
 	cacheData := &model.CacheData[T]{
 		CreateAt: createAt,
 		Data:     data,
+		Version:  version,
 	}
 	return json.Marshal(cacheData)
 }
 
+func UnmarshalMeta(val []byte) (*model.CacheMeta, error) {
+	meta := &model.CacheMeta{}
+	err := json.Unmarshal(val, meta)
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
 func NewData[T any](data T, createAt int64) *model.CacheData[T] {
 	return &model.CacheData[T]{
 		CreateAt: createAt,
@@ -76,6 +90,14 @@ func NewData[T any](data T, createAt int64) *model.CacheData[T] {
 	}
 }
 
+func NewVersionedData[T any](data T, createAt int64, version int64) *model.CacheData[T] {
+	return &model.CacheData[T]{
+		CreateAt: createAt,
+		Data:     data,
+		Version:  version,
+	}
+}
+
 func NewDefaultDataWithMarshal[T any](createAt int64) []byte {
 	data := &model.CacheData[T]{
 		CreateAt: createAt,
@@ -85,6 +107,24 @@ func NewDefaultDataWithMarshal[T any](createAt int64) []byte {
 	return bytes
 }
 
+func NewTombstoneDataWithMarshal[T any](createAt int64, expireAt int64) []byte {
+	data := &model.CacheData[T]{
+		CreateAt:  createAt,
+		Tombstone: 1,
+		ExpireAt:  expireAt,
+	}
+	bytes, _ := json.Marshal(data)
+	return bytes
+}
+
+func NewTombstoneData[T any](createAt int64, expireAt int64) *model.CacheData[T] {
+	return &model.CacheData[T]{
+		CreateAt:  createAt,
+		Tombstone: 1,
+		ExpireAt:  expireAt,
+	}
+}
+
 func NewDefaultData[T any](createAt int64) *model.CacheData[T] {
 	return &model.CacheData[T]{
 		CreateAt: createAt,
@@ -235,3 +235,47 @@ func TestNewDefaultData(t *testing.T) {
 	got := NewDefaultData[string](1017072000000)
 	assert.EqualValues(t, want, got)
 }
+
+func TestMarshalVersionedData(t *testing.T) {
+	got, err := MarshalVersionedData("test", 1017072000000, 3)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"c":1017072000000,"d":"test","z":0,"v":3}`, string(got))
+}
+
+func TestUnmarshalMeta(t *testing.T) {
+	t.Run("success", func(tt *testing.T) {
+		got, err := UnmarshalMeta([]byte(`{"c":1017072000000,"d":{"a":1},"z":1,"v":3}`))
+		assert.Nil(tt, err)
+		assert.EqualValues(tt, &model.CacheMeta{CreateAt: 1017072000000, Default: 1, Version: 3}, got)
+	})
+	t.Run("unmarshal error", func(tt *testing.T) {
+		got, err := UnmarshalMeta([]byte(`{`))
+		assert.NotNil(tt, err)
+		assert.Nil(tt, got)
+	})
+}
+
+func TestNewVersionedData(t *testing.T) {
+	got := NewVersionedData[string]("test", 1017072000000, 3)
+	assert.Equal(t, "test", got.Data)
+	assert.Equal(t, int64(1017072000000), got.CreateAt)
+	assert.Equal(t, int64(3), got.Version)
+}
+
+func TestNewTombstoneDataWithMarshal(t *testing.T) {
+	got := NewTombstoneDataWithMarshal[string](1017072000000, 1017072060000)
+	assert.JSONEq(t, `{"c":1017072000000,"d":"","z":0,"t":1,"e":1017072060000}`, string(got))
+}
+
+func TestNewTombstoneData(t *testing.T) {
+	want := &model.CacheData[string]{
+		CreateAt:  1017072000000,
+		Tombstone: 1,
+		ExpireAt:  1017072060000,
+	}
+	got := NewTombstoneData[string](1017072000000, 1017072060000)
+	assert.EqualValues(t, want, got)
+	assert.True(t, got.IsTombstone())
+	assert.True(t, got.Meta().IsTombstoneActive(1017072000000))
+	assert.False(t, got.Meta().IsTombstoneActive(1017072060000))
+}
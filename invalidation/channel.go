@@ -0,0 +1,54 @@
+package invalidation
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+)
+
+// ChannelSource 基于channel的失效事件源，不支持按checkpoint重放
+type ChannelSource struct {
+	ch  chan Event
+	seq atomic.Int64
+}
+
+// NewChannelSource returns a newly initialize ChannelSource implement Source with buffer size
+func NewChannelSource(size int) *ChannelSource {
+	return &ChannelSource{
+		ch: make(chan Event, size),
+	}
+}
+
+// Publish 发布失效事件，事件ID自动生成
+func (cs *ChannelSource) Publish(ctx context.Context, entity string, key string) error {
+	event := Event{
+		ID:     strconv.FormatInt(cs.seq.Add(1), 10),
+		Entity: entity,
+		Key:    key,
+	}
+	select {
+	case cs.ch <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (cs *ChannelSource) Read(ctx context.Context, _ string, count int) ([]Event, error) {
+	var events []Event
+	select {
+	case event := <-cs.ch:
+		events = append(events, event)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	for len(events) < count {
+		select {
+		case event := <-cs.ch:
+			events = append(events, event)
+		default:
+			return events, nil
+		}
+	}
+	return events, nil
+}
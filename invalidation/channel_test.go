@@ -0,0 +1,44 @@
+package invalidation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelSource(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("read batch", func(tt *testing.T) {
+		cs := NewChannelSource(10)
+		for _, key := range []string{"1", "2", "3"} {
+			err := cs.Publish(ctx, "user", key)
+			assert.Nil(tt, err)
+		}
+		got, err := cs.Read(ctx, "", 2)
+		assert.Nil(tt, err)
+		assert.Equal(tt, []Event{{ID: "1", Entity: "user", Key: "1"}, {ID: "2", Entity: "user", Key: "2"}}, got)
+		got, err = cs.Read(ctx, "", 2)
+		assert.Nil(tt, err)
+		assert.Equal(tt, []Event{{ID: "3", Entity: "user", Key: "3"}}, got)
+	})
+
+	t.Run("read canceled", func(tt *testing.T) {
+		cs := NewChannelSource(10)
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		got, err := cs.Read(cctx, "", 2)
+		assert.NotNil(tt, err)
+		assert.Nil(tt, got)
+	})
+
+	t.Run("publish canceled", func(tt *testing.T) {
+		cs := NewChannelSource(0)
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		err := cs.Publish(cctx, "user", "1")
+		assert.NotNil(tt, err)
+	})
+}
@@ -0,0 +1,55 @@
+package invalidation
+
+import (
+	"context"
+	"sync"
+)
+
+// Event 失效事件
+type Event struct {
+	ID     string // 事件ID，用于checkpoint
+	Entity string // 实体名称
+	Key    string // 实体key
+}
+
+// Source 失效事件源
+type Source interface {
+	// Read 读取checkpoint之后的事件，最多count条，没有事件时阻塞直到超时或ctx取消
+	Read(ctx context.Context, checkpoint string, count int) ([]Event, error)
+}
+
+// Target 失效目标
+type Target interface {
+	// Invalidate 使keys失效
+	Invalidate(ctx context.Context, keys []string) error
+}
+
+// Checkpointer 消费进度存储
+type Checkpointer interface {
+	Load(ctx context.Context) (string, error)
+	Save(ctx context.Context, checkpoint string) error
+}
+
+// MemoryCheckpointer 内存消费进度存储
+type MemoryCheckpointer struct {
+	mu         sync.Mutex
+	checkpoint string
+}
+
+// NewMemoryCheckpointer returns a newly initialize MemoryCheckpointer implement Checkpointer
+func NewMemoryCheckpointer() *MemoryCheckpointer {
+	return &MemoryCheckpointer{}
+}
+
+func (mc *MemoryCheckpointer) Load(_ context.Context) (string, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.checkpoint, nil
+}
+
+func (mc *MemoryCheckpointer) Save(_ context.Context, checkpoint string) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.checkpoint = checkpoint
+	return nil
+}
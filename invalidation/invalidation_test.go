@@ -0,0 +1,21 @@
+package invalidation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryCheckpointer(t *testing.T) {
+	ctx := context.Background()
+	mc := NewMemoryCheckpointer()
+	got, err := mc.Load(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "", got)
+	err = mc.Save(ctx, "1")
+	assert.Nil(t, err)
+	got, err = mc.Load(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", got)
+}
@@ -0,0 +1,97 @@
+package invalidation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	fieldEntity = "entity" // 消息实体字段
+	fieldKey    = "key"    // 消息key字段
+)
+
+// RedisStreamSource 基于Redis Streams的失效事件源，消息包含entity和key字段
+type RedisStreamSource struct {
+	client redis.UniversalClient
+	stream string
+	block  time.Duration
+}
+
+// NewRedisStreamSource returns a newly initialize RedisStreamSource implement Source
+//
+// stream: redis stream key
+//
+// block: max blocking time when no events, 0 means block forever, negative means not block
+func NewRedisStreamSource(client redis.UniversalClient, stream string, block time.Duration) *RedisStreamSource {
+	return &RedisStreamSource{
+		client: client,
+		stream: stream,
+		block:  block,
+	}
+}
+
+// Publish 发布失效事件
+func (rs *RedisStreamSource) Publish(ctx context.Context, entity string, key string) error {
+	return rs.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: rs.stream,
+		Values: map[string]any{fieldEntity: entity, fieldKey: key},
+	}).Err()
+}
+
+func (rs *RedisStreamSource) Read(ctx context.Context, checkpoint string, count int) ([]Event, error) {
+	if checkpoint == "" {
+		checkpoint = "0"
+	}
+	streams, err := rs.client.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{rs.stream, checkpoint},
+		Count:   int64(count),
+		Block:   rs.block,
+	}).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var events []Event
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			entity, _ := msg.Values[fieldEntity].(string)
+			key, _ := msg.Values[fieldKey].(string)
+			events = append(events, Event{ID: msg.ID, Entity: entity, Key: key})
+		}
+	}
+	return events, nil
+}
+
+// RedisCheckpointer 基于Redis的消费进度存储
+type RedisCheckpointer struct {
+	client redis.UniversalClient
+	key    string
+}
+
+// NewRedisCheckpointer returns a newly initialize RedisCheckpointer implement Checkpointer
+func NewRedisCheckpointer(client redis.UniversalClient, key string) *RedisCheckpointer {
+	return &RedisCheckpointer{
+		client: client,
+		key:    key,
+	}
+}
+
+func (rc *RedisCheckpointer) Load(ctx context.Context) (string, error) {
+	checkpoint, err := rc.client.Get(ctx, rc.key).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", nil
+		}
+		return "", err
+	}
+	return checkpoint, nil
+}
+
+func (rc *RedisCheckpointer) Save(ctx context.Context, checkpoint string) error {
+	return rc.client.Set(ctx, rc.key, checkpoint, 0).Err()
+}
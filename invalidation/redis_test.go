@@ -0,0 +1,70 @@
+package invalidation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisStreamSource(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	rs := NewRedisStreamSource(client, "invalidation", 10*time.Millisecond)
+
+	t.Run("empty", func(tt *testing.T) {
+		got, err := rs.Read(ctx, "", 10)
+		assert.Nil(tt, err)
+		assert.Empty(tt, got)
+	})
+
+	t.Run("read from checkpoint", func(tt *testing.T) {
+		for _, key := range []string{"1", "2", "3"} {
+			err := rs.Publish(ctx, "user", key)
+			assert.Nil(tt, err)
+		}
+		got, err := rs.Read(ctx, "", 2)
+		assert.Nil(tt, err)
+		assert.Len(tt, got, 2)
+		assert.Equal(tt, "user", got[0].Entity)
+		assert.Equal(tt, "1", got[0].Key)
+		assert.Equal(tt, "2", got[1].Key)
+
+		got, err = rs.Read(ctx, got[1].ID, 2)
+		assert.Nil(tt, err)
+		assert.Len(tt, got, 1)
+		assert.Equal(tt, "3", got[0].Key)
+	})
+
+	t.Run("redis_error", func(tt *testing.T) {
+		mr.SetError("unit_test")
+		defer mr.SetError("")
+		_, err := rs.Read(ctx, "", 2)
+		assert.NotNil(tt, err)
+	})
+}
+
+func TestRedisCheckpointer(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	rc := NewRedisCheckpointer(client, "checkpoint")
+
+	got, err := rc.Load(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "", got)
+	err = rc.Save(ctx, "1-0")
+	assert.Nil(t, err)
+	got, err = rc.Load(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "1-0", got)
+
+	mr.SetError("unit_test")
+	defer mr.SetError("")
+	_, err = rc.Load(ctx)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,214 @@
+package invalidation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kakkk/cachex"
+	"github.com/kakkk/cachex/internal/logger"
+)
+
+const (
+	defaultBatchSize    = 100                    // 默认每批事件数
+	defaultRetryTimes   = 3                      // 默认失败重试次数
+	defaultRetryBackoff = 100 * time.Millisecond // 默认重试间隔，每次重试翻倍
+	defaultMaxAttempts  = 10                     // 默认每批事件最大处理次数
+)
+
+// DeadLetter 失效目标超过最大处理次数后放弃的事件回调
+type DeadLetter func(ctx context.Context, entity string, keys []string, err error)
+
+// targetKey 实体失效目标标识
+type targetKey struct {
+	entity string
+	index  int
+}
+
+// Runner 失效事件消费，按实体将事件分发到注册的失效目标
+type Runner struct {
+	source       Source              // 事件源
+	checkpointer Checkpointer        // 消费进度存储
+	targets      map[string][]Target // 实体失效目标
+	batchSize    int                 // 每批事件数
+	retryTimes   int                 // 失败重试次数
+	retryBackoff time.Duration       // 重试间隔
+	maxAttempts  int                 // 每批事件最大处理次数，0为不限制
+	deadLetter   DeadLetter          // 放弃的事件回调
+	logger       cachex.Logger       // 自定义日志
+
+	checkpoint string             // 当前消费进度
+	loaded     bool               // 是否已加载消费进度
+	pending    []Event            // 处理失败待重试的事件
+	attempts   int                // 待重试事件已处理次数
+	done       map[targetKey]bool // 待重试事件中已处理成功的失效目标，重试时跳过
+}
+
+// NewRunner returns a newly initialize Runner consume events from source
+func NewRunner(source Source) *Runner {
+	return &Runner{
+		source:       source,
+		checkpointer: NewMemoryCheckpointer(),
+		targets:      make(map[string][]Target),
+		batchSize:    defaultBatchSize,
+		retryTimes:   defaultRetryTimes,
+		retryBackoff: defaultRetryBackoff,
+		maxAttempts:  defaultMaxAttempts,
+		logger:       logger.NewDefaultLogger(),
+	}
+}
+
+// Register 注册实体失效目标
+func (r *Runner) Register(entity string, target Target) *Runner {
+	r.targets[entity] = append(r.targets[entity], target)
+	return r
+}
+
+// SetCheckpointer 设置消费进度存储
+func (r *Runner) SetCheckpointer(checkpointer Checkpointer) *Runner {
+	r.checkpointer = checkpointer
+	return r
+}
+
+// SetBatchSize 设置每批事件数
+func (r *Runner) SetBatchSize(size int) *Runner {
+	r.batchSize = size
+	return r
+}
+
+// SetRetry 设置失败重试次数和初始重试间隔
+func (r *Runner) SetRetry(times int, backoff time.Duration) *Runner {
+	r.retryTimes = times
+	r.retryBackoff = backoff
+	return r
+}
+
+// SetMaxAttempts 设置每批事件最大处理次数及放弃的事件回调，
+// 失效目标处理attempts次仍失败时放弃该目标的事件并继续消费，attempts为0时不限制，deadLetter为nil时打印日志
+func (r *Runner) SetMaxAttempts(attempts int, deadLetter DeadLetter) *Runner {
+	r.maxAttempts = attempts
+	r.deadLetter = deadLetter
+	return r
+}
+
+// SetLogger 设置Logger
+func (r *Runner) SetLogger(logger cachex.Logger) *Runner {
+	r.logger = logger
+	return r
+}
+
+// Run 持续消费失效事件，直到ctx取消
+func (r *Runner) Run(ctx context.Context) error {
+	for ctx.Err() == nil {
+		_, err := r.RunOnce(ctx)
+		if err == nil || ctx.Err() != nil {
+			continue
+		}
+		r.logger.Warnf(ctx, "invalidation run error: %v", err)
+		r.sleep(ctx, r.retryBackoff)
+	}
+	return nil
+}
+
+// RunOnce 消费一批失效事件，全部处理成功后保存消费进度，失败的事件下次重试，重试时跳过已处理成功的失效目标
+func (r *Runner) RunOnce(ctx context.Context) (int, error) {
+	if !r.loaded {
+		checkpoint, err := r.checkpointer.Load(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("load checkpoint error: %w", err)
+		}
+		r.checkpoint, r.loaded = checkpoint, true
+	}
+
+	events := r.pending
+	if len(events) == 0 {
+		var err error
+		events, err = r.source.Read(ctx, r.checkpoint, r.batchSize)
+		if err != nil {
+			return 0, fmt.Errorf("read events error: %w", err)
+		}
+		if len(events) == 0 {
+			return 0, nil
+		}
+	}
+
+	// 按实体分组并去重
+	batches := make(map[string][]string)
+	seen := make(map[Event]bool, len(events))
+	for _, event := range events {
+		key := Event{Entity: event.Entity, Key: event.Key}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		batches[event.Entity] = append(batches[event.Entity], event.Key)
+	}
+	if r.done == nil {
+		r.done = make(map[targetKey]bool)
+	}
+	for entity, keys := range batches {
+		for i, target := range r.targets[entity] {
+			tk := targetKey{entity: entity, index: i}
+			if r.done[tk] {
+				continue
+			}
+			if err := r.invalidate(ctx, target, keys); err != nil {
+				if r.maxAttempts <= 0 || r.attempts+1 < r.maxAttempts {
+					r.pending = events
+					r.attempts++
+					return 0, fmt.Errorf("invalidate entity %v error: %w", entity, err)
+				}
+				r.dropEvents(ctx, entity, keys, err)
+			}
+			r.done[tk] = true
+		}
+	}
+	r.pending, r.attempts, r.done = nil, 0, nil
+
+	// 保存消费进度
+	checkpoint := events[len(events)-1].ID
+	r.checkpoint = checkpoint
+	if err := r.checkpointer.Save(ctx, checkpoint); err != nil {
+		r.logger.Warnf(ctx, "save checkpoint %v error: %v", checkpoint, err)
+	}
+	return len(events), nil
+}
+
+// invalidate 失效并按指数退避重试
+func (r *Runner) invalidate(ctx context.Context, target Target, keys []string) error {
+	var err error
+	backoff := r.retryBackoff
+	for i := 0; i <= r.retryTimes; i++ {
+		if i > 0 {
+			if !r.sleep(ctx, backoff) {
+				return ctx.Err()
+			}
+			backoff *= 2
+		}
+		if err = target.Invalidate(ctx, keys); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// dropEvents 放弃超过最大处理次数的事件
+func (r *Runner) dropEvents(ctx context.Context, entity string, keys []string, err error) {
+	if r.deadLetter != nil {
+		r.deadLetter(ctx, entity, keys, err)
+		return
+	}
+	r.logger.Errorf(ctx, "invalidate entity %v drop keys %v after %v attempts, error: %v", entity, keys, r.maxAttempts, err)
+}
+
+// sleep 等待d，ctx取消时返回false
+func (r *Runner) sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
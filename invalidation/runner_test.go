@@ -0,0 +1,178 @@
+package invalidation
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type targetMocker struct {
+	mu    sync.Mutex
+	calls [][]string
+	fails int
+}
+
+func (m *targetMocker) Invalidate(_ context.Context, keys []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, keys)
+	if m.fails > 0 {
+		m.fails--
+		return errors.New("unit_test")
+	}
+	return nil
+}
+
+func (m *targetMocker) getCalls() [][]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls
+}
+
+func TestRunner_RunOnce(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("dispatch by entity", func(tt *testing.T) {
+		cs := NewChannelSource(10)
+		user, order := &targetMocker{}, &targetMocker{}
+		checkpointer := NewMemoryCheckpointer()
+		r := NewRunner(cs).
+			Register("user", user).
+			Register("order", order).
+			SetCheckpointer(checkpointer)
+		_ = cs.Publish(ctx, "user", "1")
+		_ = cs.Publish(ctx, "order", "2")
+		_ = cs.Publish(ctx, "user", "1")
+		_ = cs.Publish(ctx, "unknown", "3")
+
+		n, err := r.RunOnce(ctx)
+		assert.Nil(tt, err)
+		assert.Equal(tt, 4, n)
+		assert.Equal(tt, [][]string{{"1"}}, user.getCalls())
+		assert.Equal(tt, [][]string{{"2"}}, order.getCalls())
+		got, _ := checkpointer.Load(ctx)
+		assert.Equal(tt, "4", got)
+	})
+
+	t.Run("retry success", func(tt *testing.T) {
+		cs := NewChannelSource(10)
+		target := &targetMocker{fails: 2}
+		r := NewRunner(cs).Register("user", target).SetRetry(2, time.Millisecond)
+		_ = cs.Publish(ctx, "user", "1")
+		n, err := r.RunOnce(ctx)
+		assert.Nil(tt, err)
+		assert.Equal(tt, 1, n)
+		assert.Len(tt, target.getCalls(), 3)
+	})
+
+	t.Run("retry fail keep pending", func(tt *testing.T) {
+		cs := NewChannelSource(10)
+		target := &targetMocker{fails: 2}
+		checkpointer := NewMemoryCheckpointer()
+		r := NewRunner(cs).Register("user", target).SetRetry(1, time.Millisecond).SetCheckpointer(checkpointer)
+		_ = cs.Publish(ctx, "user", "1")
+		n, err := r.RunOnce(ctx)
+		assert.NotNil(tt, err)
+		assert.Equal(tt, 0, n)
+		got, _ := checkpointer.Load(ctx)
+		assert.Equal(tt, "", got)
+
+		n, err = r.RunOnce(ctx)
+		assert.Nil(tt, err)
+		assert.Equal(tt, 1, n)
+		assert.Len(tt, target.getCalls(), 3)
+		got, _ = checkpointer.Load(ctx)
+		assert.Equal(tt, "1", got)
+	})
+
+	t.Run("retry skip succeeded targets", func(tt *testing.T) {
+		cs := NewChannelSource(10)
+		succeeded, failed := &targetMocker{}, &targetMocker{fails: 1}
+		r := NewRunner(cs).Register("user", succeeded).Register("user", failed).SetRetry(0, time.Millisecond)
+		_ = cs.Publish(ctx, "user", "1")
+		_, err := r.RunOnce(ctx)
+		assert.NotNil(tt, err)
+		n, err := r.RunOnce(ctx)
+		assert.Nil(tt, err)
+		assert.Equal(tt, 1, n)
+		assert.Len(tt, succeeded.getCalls(), 1)
+		assert.Len(tt, failed.getCalls(), 2)
+	})
+
+	t.Run("drop events after max attempts", func(tt *testing.T) {
+		cs := NewChannelSource(10)
+		poison := &targetMocker{fails: 3}
+		checkpointer := NewMemoryCheckpointer()
+		var (
+			droppedEntity string
+			droppedKeys   []string
+		)
+		r := NewRunner(cs).Register("user", poison).SetRetry(0, time.Millisecond).SetCheckpointer(checkpointer).
+			SetMaxAttempts(2, func(ctx context.Context, entity string, keys []string, err error) {
+				droppedEntity, droppedKeys = entity, keys
+			})
+		_ = cs.Publish(ctx, "user", "1")
+		_, err := r.RunOnce(ctx)
+		assert.NotNil(tt, err)
+		n, err := r.RunOnce(ctx)
+		assert.Nil(tt, err)
+		assert.Equal(tt, 1, n)
+		assert.Equal(tt, "user", droppedEntity)
+		assert.Equal(tt, []string{"1"}, droppedKeys)
+		got, _ := checkpointer.Load(ctx)
+		assert.Equal(tt, "1", got)
+
+		_ = cs.Publish(ctx, "user", "2")
+		_, err = r.RunOnce(ctx)
+		assert.NotNil(tt, err)
+		n, err = r.RunOnce(ctx)
+		assert.Nil(tt, err)
+		assert.Equal(tt, 1, n)
+		assert.Equal(tt, []string{"2"}, poison.getCalls()[3])
+	})
+
+	t.Run("resume from checkpoint", func(tt *testing.T) {
+		mr := miniredis.RunT(tt)
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		rs := NewRedisStreamSource(client, "invalidation", 10*time.Millisecond)
+		checkpointer := NewRedisCheckpointer(client, "checkpoint")
+		for _, key := range []string{"1", "2", "3"} {
+			_ = rs.Publish(ctx, "user", key)
+		}
+
+		target := &targetMocker{}
+		n, err := NewRunner(rs).Register("user", target).SetBatchSize(2).SetCheckpointer(checkpointer).RunOnce(ctx)
+		assert.Nil(tt, err)
+		assert.Equal(tt, 2, n)
+		assert.Equal(tt, [][]string{{"1", "2"}}, target.getCalls())
+
+		target = &targetMocker{}
+		n, err = NewRunner(rs).Register("user", target).SetBatchSize(2).SetCheckpointer(checkpointer).RunOnce(ctx)
+		assert.Nil(tt, err)
+		assert.Equal(tt, 1, n)
+		assert.Equal(tt, [][]string{{"3"}}, target.getCalls())
+	})
+}
+
+func TestRunner_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cs := NewChannelSource(10)
+	target := &targetMocker{fails: 1}
+	r := NewRunner(cs).Register("user", target).SetRetry(0, time.Millisecond)
+	done := make(chan error)
+	go func() {
+		done <- r.Run(ctx)
+	}()
+	_ = cs.Publish(ctx, "user", "1")
+	assert.Eventually(t, func() bool {
+		return len(target.getCalls()) == 2
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.Nil(t, <-done)
+}
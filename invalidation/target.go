@@ -0,0 +1,57 @@
+package invalidation
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kakkk/cachex"
+)
+
+// ParseKey 将事件key转换为缓存key
+type ParseKey[K comparable] func(key string) (K, error)
+
+type cacheXTarget[K comparable, V any] struct {
+	cx       *cachex.CacheX[K, V]
+	parseKey ParseKey[K]
+	refresh  bool
+}
+
+// NewCacheXTarget returns a Target which calls MDelete on cx,
+// keys that parseKey fails are skipped, if refresh is true keys will be reloaded from source after delete
+func NewCacheXTarget[K comparable, V any](cx *cachex.CacheX[K, V], parseKey ParseKey[K], refresh bool) Target {
+	return &cacheXTarget[K, V]{
+		cx:       cx,
+		parseKey: parseKey,
+		refresh:  refresh,
+	}
+}
+
+func (t *cacheXTarget[K, V]) Invalidate(ctx context.Context, keys []string) error {
+	cacheKeys := make([]K, 0, len(keys))
+	for _, key := range keys {
+		k, err := t.parseKey(key)
+		if err != nil {
+			continue
+		}
+		cacheKeys = append(cacheKeys, k)
+	}
+	if len(cacheKeys) == 0 {
+		return nil
+	}
+	if err := t.cx.MDelete(ctx, cacheKeys); hasError(err) {
+		return err
+	}
+	if t.refresh {
+		_ = t.cx.MGet(ctx, cacheKeys, 0)
+	}
+	return nil
+}
+
+// hasError CacheX写入全部成功时返回持有nil指针的CacheError，按出错层级判断是否失败
+func hasError(err error) bool {
+	var cErr cachex.CacheError
+	if errors.As(err, &cErr) {
+		return len(cErr.GetErrorLevels()) != 0
+	}
+	return err != nil
+}
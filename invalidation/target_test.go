@@ -0,0 +1,57 @@
+package invalidation
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kakkk/cachex"
+	"github.com/kakkk/cachex/cache"
+)
+
+func TestCacheXTarget(t *testing.T) {
+	ctx := context.Background()
+	lru := cache.NewLRUCache[string](10, time.Hour)
+	cx, _ := cachex.NewBuilder[int, string](ctx).
+		AddCache(lru).
+		SetGetDataKey(func(key int) string { return "user_" + strconv.Itoa(key) }).
+		SetMGetRealData(func(ctx context.Context, keys []int) (map[int]string, error) {
+			data := make(map[int]string, len(keys))
+			for _, key := range keys {
+				data[key] = "fresh_" + strconv.Itoa(key)
+			}
+			return data, nil
+		}).
+		Build()
+
+	t.Run("delete", func(tt *testing.T) {
+		_ = cx.MSet(ctx, map[int]string{1: "stale_1", 2: "stale_2"})
+		target := NewCacheXTarget(cx, strconv.Atoi, false)
+		err := target.Invalidate(ctx, []string{"1", "invalid"})
+		assert.Nil(tt, err)
+		_, ok := lru.Get(ctx, "user_1", 0)
+		assert.False(tt, ok)
+		got, ok := lru.Get(ctx, "user_2", 0)
+		assert.True(tt, ok)
+		assert.Equal(tt, "stale_2", got)
+	})
+
+	t.Run("refresh", func(tt *testing.T) {
+		_ = cx.MSet(ctx, map[int]string{1: "stale_1"})
+		target := NewCacheXTarget(cx, strconv.Atoi, true)
+		err := target.Invalidate(ctx, []string{"1"})
+		assert.Nil(tt, err)
+		got, ok := lru.Get(ctx, "user_1", 0)
+		assert.True(tt, ok)
+		assert.Equal(tt, "fresh_1", got)
+	})
+
+	t.Run("all invalid", func(tt *testing.T) {
+		target := NewCacheXTarget(cx, strconv.Atoi, true)
+		err := target.Invalidate(ctx, []string{"invalid"})
+		assert.Nil(tt, err)
+	})
+}
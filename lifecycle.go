@@ -0,0 +1,37 @@
+package cachex
+
+import (
+	"context"
+
+	"github.com/kakkk/cachex/cache"
+	cachexError "github.com/kakkk/cachex/internal/errors"
+)
+
+// Close 关闭缓存，等待删除重试及延迟双删任务执行完成后关闭支持Closer的各级缓存，
+// 调用方传入的客户端由调用方关闭；ctx结束时不再等待，未完成的任务保留在持久化文件中；
+// 关闭后各方法返回ErrClosed或未命中
+func (cx *CacheX[K, V]) Close(ctx context.Context) error {
+	if !cx.closed.CompareAndSwap(false, true) {
+		return ErrClosed
+	}
+	closeErrors := cachexError.NewCacheSetError()
+	var drainErr error
+	if cx.retry != nil {
+		if drainErr = cx.retry.Drain(ctx); drainErr != nil {
+			cx.logger.Errorf(ctx, "cache %v drain delete retry queue error: %v", cx.name, drainErr)
+		}
+	}
+	for level := 0; level < len(cx.caches); level++ {
+		closer, ok := cx.caches[level].(cache.Closer)
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			closeErrors = closeErrors.AppendError(level, err)
+		}
+	}
+	if err := closeErrors.ErrorOrNil(); err != nil {
+		return err
+	}
+	return drainErr
+}
@@ -0,0 +1,113 @@
+package cachex
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kakkk/cachex/cache"
+)
+
+func TestCacheX_Close(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+
+	t.Run("close backends", func(tt *testing.T) {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		defer client.Close()
+		owned := cache.NewRedisCacheWithOptions[string](&redis.Options{Addr: mr.Addr()}, time.Hour)
+		lru := cache.NewLRUCache[string](10, time.Hour)
+		cx, err := NewBuilder[string, string](ctx).
+			AddCache(cache.NewRedisCacheWithClient[string](client, time.Hour)).
+			AddCache(owned).
+			AddCache(lru).
+			SetGetDataKey(func(key string) string { return key }).
+			Build()
+		assert.Nil(tt, err)
+		assert.Nil(tt, cx.Set(ctx, "k", "v"))
+
+		assert.Nil(tt, cx.Close(ctx))
+		assert.Nil(tt, client.Ping(ctx).Err())
+		_, err = owned.Ping(ctx)
+		assert.ErrorIs(tt, err, redis.ErrClosed)
+		_, ok := lru.Get(ctx, "k", time.Hour)
+		assert.False(tt, ok)
+	})
+
+	t.Run("calls after close", func(tt *testing.T) {
+		loads := 0
+		cx, err := NewBuilder[string, string](ctx).
+			AddCache(cache.NewLRUCache[string](10, time.Hour)).
+			SetGetDataKey(func(key string) string { return key }).
+			SetGetRealData(func(ctx context.Context, key string) (string, error) {
+				loads++
+				return "v", nil
+			}).
+			Build()
+		assert.Nil(tt, err)
+		assert.Nil(tt, cx.Close(ctx))
+
+		assert.ErrorIs(tt, cx.Close(ctx), ErrClosed)
+		assert.ErrorIs(tt, cx.Set(ctx, "k", "v"), ErrClosed)
+		assert.ErrorIs(tt, cx.MSet(ctx, map[string]string{"k": "v"}), ErrClosed)
+		assert.ErrorIs(tt, cx.Delete(ctx, "k"), ErrClosed)
+		assert.ErrorIs(tt, cx.MDelete(ctx, []string{"k"}), ErrClosed)
+		_, err = cx.Ping(ctx)
+		assert.ErrorIs(tt, err, ErrClosed)
+		_, err = cx.TTL(ctx, "k")
+		assert.ErrorIs(tt, err, ErrClosed)
+		_, ok := cx.Get(ctx, "k", time.Hour)
+		assert.False(tt, ok)
+		assert.Empty(tt, cx.MGet(ctx, []string{"k"}, time.Hour))
+		_, _, ok = cx.GetWithMeta(ctx, "k", time.Hour)
+		assert.False(tt, ok)
+		assert.Equal(tt, 0, loads)
+	})
+
+	t.Run("drain double delete", func(tt *testing.T) {
+		mocker := cache.NewCacheMocker[string]()
+		deleted := 0
+		mocker.MockDelete(func(ctx context.Context, key string) error {
+			return nil
+		}).MockMDelete(func(ctx context.Context, keys []string) error {
+			deleted++
+			return nil
+		})
+		cx, err := NewBuilder[string, string](ctx).
+			AddCache(mocker).
+			SetGetDataKey(func(key string) string { return key }).
+			SetDoubleDelete(20 * time.Millisecond).
+			Build()
+		assert.Nil(tt, err)
+		assert.Nil(tt, cx.Delete(ctx, "k"))
+		assert.Nil(tt, cx.Close(ctx))
+		assert.Equal(tt, 1, deleted)
+		assert.Empty(tt, cx.RetryStats().Depth)
+	})
+
+	t.Run("drain timeout", func(tt *testing.T) {
+		mocker := cache.NewCacheMocker[string]().
+			MockDelete(func(ctx context.Context, key string) error {
+				return errors.New("delete fail")
+			}).
+			MockMDelete(func(ctx context.Context, keys []string) error {
+				return errors.New("delete fail")
+			})
+		cx, err := NewBuilder[string, string](ctx).
+			AddCache(mocker).
+			SetGetDataKey(func(key string) string { return key }).
+			SetDeleteRetry(RetryConfig{MaxAttempts: 100, Backoff: time.Millisecond}).
+			Build()
+		assert.Nil(tt, err)
+		assert.NotNil(tt, cx.Delete(ctx, "k"))
+		timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(tt, cx.Close(timeoutCtx), context.DeadlineExceeded)
+		assert.Equal(tt, map[int]int{0: 1}, cx.RetryStats().Depth)
+	})
+}
@@ -0,0 +1,204 @@
+package cachex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kakkk/cachex/cache"
+	"github.com/kakkk/cachex/internal/consts"
+	"github.com/kakkk/cachex/internal/utils"
+)
+
+const (
+	LevelSource    = consts.CacheLevelSource    // 回源
+	LevelDowngrade = consts.CacheLevelDowngrade // 降级
+)
+
+// Meta 查询结果元信息
+type Meta struct {
+	Level    int           // 数据来源，缓存层级、LevelSource或LevelDowngrade
+	CreateAt time.Time     // 数据写入时间，写入时间未知时为零值
+	Age      time.Duration // 数据年龄，写入时间未知时为0
+	Stale    bool          // 是否为回源失败或租约被持有时降级返回的数据
+	Negative bool          // 是否命中空值
+}
+
+// GetWithMeta 查询缓存并返回数据来源、写入时间等元信息，回源、降级及空值策略与Get一致；
+// 命中空值时与Get一样回源，回源仍未找到时返回该空值的元信息，Negative为true
+func (cx *CacheX[K, V]) GetWithMeta(ctx context.Context, key K, expire time.Duration) (data V, meta Meta, ok bool) {
+	defer cx.recover(ctx, func(r any) {
+		if r != nil {
+			var zero V
+			data, meta, ok = zero, Meta{}, false
+			return
+		}
+	})()
+	if cx.closed.Load() {
+		return data, meta, false
+	}
+	dataKey, now := cx.getDataKey(key), cx.clock()
+	// 查询缓存，命中空值视为未命中
+	var negative Meta
+	for level := len(cx.caches) - 1; level >= 0; level-- {
+		data, meta, ok = cx.getLevel(ctx, level, dataKey, expire, now)
+		if ok {
+			cx.hit(ctx, level)
+			return data, meta, true
+		}
+		if meta.Negative && !negative.Negative {
+			negative = meta
+		}
+	}
+	// 缓存失效，回源
+	cx.hit(ctx, consts.CacheLevelSource)
+	if data, meta, ok = cx.loadInternal(ctx, key, expire, cx.getRealData); !ok && negative.Negative {
+		meta = negative
+	}
+	return data, meta, ok
+}
+
+// MGetWithMeta 批量查询缓存并返回各key的元信息，命中空值的key与MGet一样回源，
+// 回源仍未找到时只出现在metas中，Negative为true
+func (cx *CacheX[K, V]) MGetWithMeta(ctx context.Context, keys []K, expire time.Duration) (data map[K]V, metas map[K]Meta) {
+	defer cx.recover(ctx, func(r any) {
+		if r != nil {
+			data, metas = make(map[K]V), make(map[K]Meta)
+			return
+		}
+	})()
+	data, metas = make(map[K]V), make(map[K]Meta)
+	if cx.closed.Load() {
+		return data, metas
+	}
+	// key去重
+	keys = utils.Duplicate(keys)
+	now := cx.clock()
+
+	// 从多级缓存中获取，命中空值视为未命中
+	pending, negatives := keys, make(map[K]Meta)
+	for level := len(cx.caches) - 1; level >= 0 && len(pending) > 0; level-- {
+		got, gotMetas := cx.mGetLevel(ctx, level, cx.mGetDataKeys(pending), expire, now)
+		if len(got) != 0 {
+			cx.mHit(ctx, level, len(got))
+		}
+		data = utils.MergeData(data, utils.ConvertCacheDataMap[K, V](pending, got, cx.getDataKey))
+		var remain []K
+		for key, meta := range utils.ConvertCacheDataMap[K, Meta](pending, gotMetas, cx.getDataKey) {
+			if _, ok := data[key]; ok {
+				metas[key] = meta
+			} else if _, ok = negatives[key]; !ok {
+				negatives[key] = meta
+			}
+		}
+		for _, key := range pending {
+			if _, ok := data[key]; !ok {
+				remain = append(remain, key)
+			}
+		}
+		pending = remain
+	}
+	if len(pending) == 0 {
+		return data, metas
+	}
+
+	// 回源，回源仍未找到的key返回空值元信息
+	cx.mHit(ctx, consts.CacheLevelSource, len(pending))
+	realData, realMetas := cx.mLoadInternal(ctx, pending, cx.mGetRealData)
+	for k, v := range realData {
+		data[k] = v
+	}
+	for k, v := range realMetas {
+		metas[k] = v
+	}
+	for _, key := range pending {
+		if _, ok := metas[key]; !ok {
+			if meta, ok := negatives[key]; ok {
+				metas[key] = meta
+			}
+		}
+	}
+	return data, metas
+}
+
+// getLevel 查询单层缓存，读取错误计入该层级，无法解码的数据视为未命中，命中空值时ok为false且meta.Negative为true
+func (cx *CacheX[K, V]) getLevel(ctx context.Context, level int, dataKey string, expire time.Duration, now time.Time) (data V, meta Meta, ok bool) {
+	env, found, err := cache.AsV2(cx.caches[level]).Get(ctx, dataKey, cx.levelExpire(expire))
+	if corrupt, is := asCorrupt(err); is {
+		cx.corrupt(ctx, level, corrupt)
+		return data, Meta{}, false
+	}
+	if err != nil {
+		cx.readError(ctx, level, err)
+		return data, Meta{}, false
+	}
+	if !found || env.Tombstone || cx.isSlidingExpired(dataKey, env.CreateAt, now, expire) {
+		return data, Meta{}, false
+	}
+	meta = newMeta(level, env.CreateAt, now)
+	if env.Default {
+		meta.Negative = true
+		return data, meta, false
+	}
+	cx.slide(ctx, level, []string{dataKey}, now)
+	return env.Data, meta, true
+}
+
+// mGetLevel 批量查询单层缓存，读取错误计入该层级，无法解码的key视为未命中，
+// 部分批次失败时使用其他批次的数据，metas包含命中空值的key
+func (cx *CacheX[K, V]) mGetLevel(ctx context.Context, level int, dataKeys []string, expire time.Duration, now time.Time) (data map[string]V, metas map[string]Meta) {
+	data, metas = make(map[string]V), make(map[string]Meta)
+	envs, err := cache.AsV2(cx.caches[level]).MGet(ctx, dataKeys, cx.levelExpire(expire))
+	corrupt, isCorrupt := asCorrupt(err)
+	if isCorrupt {
+		cx.corrupt(ctx, level, corrupt)
+	}
+	var batch *cache.BatchError
+	switch {
+	case errors.As(err, &batch):
+		cx.readError(ctx, level, batch)
+	case err != nil && !isCorrupt:
+		cx.readError(ctx, level, err)
+		return data, metas
+	}
+	for key, env := range envs {
+		if env.Tombstone || cx.isSlidingExpired(key, env.CreateAt, now, expire) {
+			continue
+		}
+		meta := newMeta(level, env.CreateAt, now)
+		if env.Default {
+			meta.Negative = true
+		} else {
+			data[key] = env.Data
+		}
+		metas[key] = meta
+	}
+	if cx.sliding != nil && len(data) != 0 {
+		hitKeys := make([]string, 0, len(data))
+		for key := range data {
+			hitKeys = append(hitKeys, key)
+		}
+		cx.slide(ctx, level, hitKeys, now)
+	}
+	return data, metas
+}
+
+// newMeta 根据写入时间戳生成元信息，createAt为0表示写入时间未知
+func newMeta(level int, createAt int64, now time.Time) Meta {
+	if createAt == 0 {
+		return Meta{Level: level}
+	}
+	createTime := time.UnixMilli(createAt)
+	return Meta{
+		Level:    level,
+		CreateAt: createTime,
+		Age:      max(now.Sub(createTime), 0),
+	}
+}
+
+// String 元信息描述，用于日志
+func (m Meta) String() string {
+	return fmt.Sprintf("level:%v, create_at:%v, age:%v, stale:%v, negative:%v",
+		m.Level, m.CreateAt.Format(time.RFC3339Nano), m.Age, m.Stale, m.Negative)
+}
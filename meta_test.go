@@ -0,0 +1,216 @@
+package cachex
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kakkk/cachex/cache"
+	"github.com/kakkk/cachex/internal/logger"
+)
+
+func TestCacheX_GetWithMeta(t *testing.T) {
+	ctx := context.Background()
+	newCacheX := func(getRealData GetRealData[string, string]) (*CacheX[string, string], *cache.LRUCache[string]) {
+		lru := cache.NewLRUCache[string](10, time.Hour)
+		return &CacheX[string, string]{
+			logger:      logger.NewDefaultLogger(),
+			getDataKey:  func(key string) string { return key },
+			caches:      []cache.Cache[string]{cache.NewCacheMocker[string](), lru},
+			getRealData: getRealData,
+		}, lru
+	}
+
+	t.Run("hit cache", func(tt *testing.T) {
+		cx, lru := newCacheX(nil)
+		createTime := time.Now().Add(-time.Minute)
+		_ = lru.Set(ctx, "k", "v", createTime)
+		got, meta, ok := cx.GetWithMeta(ctx, "k", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v", got)
+		assert.Equal(tt, 1, meta.Level)
+		assert.Equal(tt, createTime.UnixMilli(), meta.CreateAt.UnixMilli())
+		assert.GreaterOrEqual(tt, meta.Age, time.Minute)
+		assert.False(tt, meta.Stale)
+		assert.False(tt, meta.Negative)
+	})
+
+	t.Run("hit level without envelope", func(tt *testing.T) {
+		cx, _ := newCacheX(nil)
+		cx.caches[0] = cache.NewCacheMocker[string]().MockGet(func(ctx context.Context, key string, expire time.Duration) (string, bool) {
+			return "v", true
+		})
+		got, meta, ok := cx.GetWithMeta(ctx, "k", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v", got)
+		assert.Equal(tt, Meta{Level: 0}, meta)
+	})
+
+	t.Run("negative hit load like get", func(tt *testing.T) {
+		loads := 0
+		cx, lru := newCacheX(func(ctx context.Context, key string) (string, error) {
+			loads++
+			return "", ErrNotFound
+		})
+		_ = lru.SetDefault(ctx, []string{"k"}, time.Now())
+		_, ok := cx.Get(ctx, "k", time.Hour)
+		assert.False(tt, ok)
+		assert.Equal(tt, 1, loads)
+		_, meta, ok := cx.GetWithMeta(ctx, "k", time.Hour)
+		assert.False(tt, ok)
+		assert.Equal(tt, 2, loads)
+		assert.True(tt, meta.Negative)
+		assert.Equal(tt, 1, meta.Level)
+	})
+
+	t.Run("negative hit load found", func(tt *testing.T) {
+		cx, lru := newCacheX(func(ctx context.Context, key string) (string, error) {
+			return "v", nil
+		})
+		_ = lru.SetDefault(ctx, []string{"k1", "k2"}, time.Now())
+		got, ok := cx.Get(ctx, "k1", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v", got)
+		got, meta, ok := cx.GetWithMeta(ctx, "k2", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v", got)
+		assert.Equal(tt, LevelSource, meta.Level)
+		assert.False(tt, meta.Negative)
+	})
+
+	t.Run("load from source", func(tt *testing.T) {
+		cx, _ := newCacheX(func(ctx context.Context, key string) (string, error) {
+			return "v", nil
+		})
+		got, meta, ok := cx.GetWithMeta(ctx, "k", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v", got)
+		assert.Equal(tt, LevelSource, meta.Level)
+		assert.False(tt, meta.CreateAt.IsZero())
+	})
+
+	t.Run("downgrade", func(tt *testing.T) {
+		cx, lru := newCacheX(func(ctx context.Context, key string) (string, error) {
+			return "", errors.New("load error")
+		})
+		cx.allowDowngrade = true
+		createTime := time.Now().Add(-2 * time.Hour)
+		_ = lru.Set(ctx, "k", "old", createTime)
+		got, meta, ok := cx.GetWithMeta(ctx, "k", time.Hour)
+		assert.True(tt, ok)
+		assert.Equal(tt, "old", got)
+		assert.Equal(tt, LevelDowngrade, meta.Level)
+		assert.True(tt, meta.Stale)
+		assert.GreaterOrEqual(tt, meta.Age, 2*time.Hour)
+		assert.Contains(tt, meta.String(), "stale:true")
+	})
+
+	t.Run("downgrade miss", func(tt *testing.T) {
+		cx, _ := newCacheX(func(ctx context.Context, key string) (string, error) {
+			return "", errors.New("load error")
+		})
+		cx.allowDowngrade = true
+		_, meta, ok := cx.GetWithMeta(ctx, "k", time.Hour)
+		assert.False(tt, ok)
+		assert.Equal(tt, Meta{}, meta)
+	})
+}
+
+func TestCacheX_MGetWithMeta(t *testing.T) {
+	ctx := context.Background()
+	newCacheX := func(mGetRealData MGetRealData[string, string]) (*CacheX[string, string], *cache.LRUCache[string], *cache.LRUCache[string]) {
+		lru0 := cache.NewLRUCache[string](10, time.Hour)
+		lru1 := cache.NewLRUCache[string](10, time.Hour)
+		return &CacheX[string, string]{
+			logger:       logger.NewDefaultLogger(),
+			getDataKey:   func(key string) string { return key },
+			caches:       []cache.Cache[string]{lru0, lru1},
+			mGetRealData: mGetRealData,
+		}, lru0, lru1
+	}
+
+	t.Run("mixed sources", func(tt *testing.T) {
+		cx, lru0, lru1 := newCacheX(func(ctx context.Context, keys []string) (map[string]string, error) {
+			assert.ElementsMatch(tt, []string{"c", "d"}, keys)
+			return map[string]string{"d": "source"}, nil
+		})
+		_ = lru1.Set(ctx, "a", "level1", time.Now())
+		_ = lru0.Set(ctx, "b", "level0", time.Now())
+		_ = lru0.SetDefault(ctx, []string{"c"}, time.Now())
+		data, metas := cx.MGetWithMeta(ctx, []string{"a", "b", "c", "d", "a"}, time.Hour)
+		assert.Equal(tt, map[string]string{"a": "level1", "b": "level0", "d": "source"}, data)
+		assert.Len(tt, metas, 4)
+		assert.Equal(tt, 1, metas["a"].Level)
+		assert.Equal(tt, 0, metas["b"].Level)
+		assert.True(tt, metas["c"].Negative)
+		assert.Equal(tt, LevelSource, metas["d"].Level)
+	})
+
+	t.Run("downgrade", func(tt *testing.T) {
+		cx, lru0, _ := newCacheX(func(ctx context.Context, keys []string) (map[string]string, error) {
+			return nil, errors.New("load error")
+		})
+		cx.allowDowngrade = true
+		_ = lru0.Set(ctx, "a", "old", time.Now().Add(-2*time.Hour))
+		data, metas := cx.MGetWithMeta(ctx, []string{"a", "b"}, time.Hour)
+		assert.Equal(tt, map[string]string{"a": "old"}, data)
+		assert.Len(tt, metas, 1)
+		assert.Equal(tt, LevelDowngrade, metas["a"].Level)
+		assert.True(tt, metas["a"].Stale)
+	})
+
+	t.Run("level without envelope", func(tt *testing.T) {
+		cx, _, _ := newCacheX(nil)
+		cx.caches = []cache.Cache[string]{cache.NewCacheMocker[string]().MockMGet(func(ctx context.Context, keys []string, expire time.Duration) map[string]string {
+			return map[string]string{"a": "v"}
+		})}
+		data, metas := cx.MGetWithMeta(ctx, []string{"a"}, time.Hour)
+		assert.Equal(tt, map[string]string{"a": "v"}, data)
+		assert.Equal(tt, map[string]Meta{"a": {Level: 0}}, metas)
+	})
+
+	t.Run("partial batch failure", func(tt *testing.T) {
+		cx, lru0, _ := newCacheX(func(ctx context.Context, keys []string) (map[string]string, error) {
+			assert.Equal(tt, []string{"b"}, keys)
+			return map[string]string{"b": "source"}, nil
+		})
+		_ = lru0.MSet(ctx, map[string]string{"a": "level0", "b": "level0"}, time.Now())
+		cx.caches[0] = &partialCache{LRUCache: lru0, failed: map[string]bool{"b": true}}
+		cx.caches = cx.caches[:1]
+		data, metas := cx.MGetWithMeta(ctx, []string{"a", "b"}, time.Hour)
+		assert.Equal(tt, map[string]string{"a": "level0", "b": "source"}, data)
+		assert.Equal(tt, 0, metas["a"].Level)
+		assert.Equal(tt, map[int]int64{0: 1}, cx.ReadErrors())
+	})
+}
+
+// partialCache MGet时failed中的key所在批次读取失败
+type partialCache struct {
+	*cache.LRUCache[string]
+	failed map[string]bool
+}
+
+func (p *partialCache) V2() cache.CacheV2[string] {
+	return &partialCacheV2{CacheV2: cache.AsV2[string](p.LRUCache), failed: p.failed}
+}
+
+type partialCacheV2 struct {
+	cache.CacheV2[string]
+	failed map[string]bool
+}
+
+func (p *partialCacheV2) MGet(ctx context.Context, keys []string, expire time.Duration) (map[string]*cache.Envelope[string], error) {
+	var ok, failed []string
+	for _, key := range keys {
+		if p.failed[key] {
+			failed = append(failed, key)
+		} else {
+			ok = append(ok, key)
+		}
+	}
+	envs, _ := p.CacheV2.MGet(ctx, ok, expire)
+	return envs, &cache.BatchError{Keys: failed, Err: errors.New("unit_test")}
+}
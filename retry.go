@@ -0,0 +1,135 @@
+package cachex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kakkk/cachex/cache"
+	"github.com/kakkk/cachex/internal/retry"
+)
+
+// RetryConfig 删除失败重试配置
+type RetryConfig struct {
+	MaxAttempts int           // 最大重试次数，超过后放弃
+	Backoff     time.Duration // 初始重试间隔，每次失败翻倍
+	MaxBackoff  time.Duration // 最大重试间隔
+	File        string        // 持久化文件，重启后继续重试，为空不持久化，新增任务按100ms间隔合并写入
+}
+
+// RetryStats 删除重试统计
+type RetryStats struct {
+	Depth   map[int]int   // 各层级待重试任务数
+	GiveUps map[int]int64 // 各层级放弃重试任务数
+}
+
+// RetryGiveUpCallback 删除重试放弃回调
+type RetryGiveUpCallback func(ctx context.Context, name string, level int, keys []string, err error)
+
+// defaultRetryConfig 默认重试配置
+var defaultRetryConfig = RetryConfig{
+	MaxAttempts: 10,
+	Backoff:     100 * time.Millisecond,
+	MaxBackoff:  time.Minute,
+}
+
+// withDefault 未设置的配置项使用默认值
+func (c RetryConfig) withDefault() RetryConfig {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultRetryConfig.MaxAttempts
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = defaultRetryConfig.Backoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultRetryConfig.MaxBackoff
+	}
+	return c
+}
+
+// RetryStats 获取删除重试统计，未开启重试时返回空统计
+func (cx *CacheX[K, V]) RetryStats() RetryStats {
+	if cx.retry == nil {
+		return RetryStats{Depth: map[int]int{}, GiveUps: map[int]int64{}}
+	}
+	stats := cx.retry.Stats()
+	return RetryStats{Depth: stats.Depth, GiveUps: stats.GiveUps}
+}
+
+// newRetryQueue 创建并启动删除重试队列
+func (cx *CacheX[K, V]) newRetryQueue(cfg RetryConfig) (*retry.Queue, error) {
+	q, err := retry.New(retry.Config{
+		MaxAttempts: cfg.MaxAttempts,
+		Backoff:     cfg.Backoff,
+		MaxBackoff:  cfg.MaxBackoff,
+		File:        cfg.File,
+		PersistError: func(err error) {
+			cx.logger.Errorf(context.Background(), "cache %v persist delete retry error: %v", cx.name, err)
+		},
+	}, cx.retryDelete, cx.retryGiveUp)
+	if err != nil {
+		return nil, err
+	}
+	q.Start()
+	return q, nil
+}
+
+// retryDelete 重试删除
+func (cx *CacheX[K, V]) retryDelete(ctx context.Context, level int, keys []string) (err error) {
+	defer cx.recover(ctx, func(r any) {
+		if r != nil {
+			err = fmt.Errorf("[panic recover] %v", r)
+		}
+	})()
+	if level < 0 || level >= len(cx.caches) {
+		return nil
+	}
+	return cx.mDeleteLevel(ctx, level, keys, cx.clock())
+}
+
+// retryGiveUp 放弃重试回调
+func (cx *CacheX[K, V]) retryGiveUp(ctx context.Context, task *retry.Task, err error) {
+	defer cx.recover(ctx, nil)()
+	if cx.retryGiveUpCallback != nil {
+		cx.retryGiveUpCallback(ctx, cx.name, task.Level, task.Keys, err)
+		return
+	}
+	cx.logger.Errorf(ctx, "cache %v level %v delete retry give up, keys:%v, attempts:%v, error:%v",
+		cx.name, task.Level, task.Keys, task.Attempt, err)
+}
+
+// enqueueDelete 删除失败加入重试队列
+func (cx *CacheX[K, V]) enqueueDelete(level int, keys []string) {
+	if cx.retry == nil || cx.retryConfig == nil {
+		return
+	}
+	cx.retry.Add(level, keys, cx.retryConfig.Backoff)
+}
+
+// failedKeys 删除失败的key，部分批次失败时只包含失败批次的key
+func failedKeys(err error, keys []string) []string {
+	var batch *cache.BatchError
+	if errors.As(err, &batch) {
+		return batch.Keys
+	}
+	return keys
+}
+
+// enqueueDoubleDelete 延迟双删加入重试队列
+func (cx *CacheX[K, V]) enqueueDoubleDelete(keys []string) {
+	if cx.retry == nil || cx.doubleDeleteDelay <= 0 {
+		return
+	}
+	for level := 0; level < len(cx.caches); level++ {
+		cx.retry.Add(level, keys, cx.doubleDeleteDelay)
+	}
+}
+
+// mDeleteLevel 删除单层缓存，开启墓碑时写入墓碑
+func (cx *CacheX[K, V]) mDeleteLevel(ctx context.Context, level int, dataKeys []string, now time.Time) error {
+	if tombstoner, ok := cx.caches[level].(cache.Tombstoner); ok && cx.tombstoneGrace > 0 {
+		return tombstoner.SetTombstone(ctx, dataKeys, now, cx.tombstoneGrace)
+	}
+	return cx.caches[level].MDelete(ctx, dataKeys)
+}
@@ -0,0 +1,178 @@
+package cachex
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kakkk/cachex/cache"
+	"github.com/kakkk/cachex/internal/logger"
+)
+
+func TestCacheX_deleteRetry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("retry failed delete", func(tt *testing.T) {
+		var mu sync.Mutex
+		calls := map[string]int{}
+		mocker := cache.NewCacheMocker[string]().
+			MockDelete(func(ctx context.Context, key string) error {
+				return errors.New("delete fail")
+			}).
+			MockMDelete(func(ctx context.Context, keys []string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				calls[keys[0]]++
+				if calls[keys[0]] < 2 {
+					return errors.New("delete fail")
+				}
+				return nil
+			})
+		cx, err := NewBuilder[string, string](ctx).
+			AddCache(mocker).
+			SetGetDataKey(func(key string) string { return key }).
+			SetDeleteRetry(RetryConfig{MaxAttempts: 3, Backoff: time.Millisecond}).
+			Build()
+		assert.Nil(tt, err)
+		defer cx.retry.Close()
+
+		err = cx.Delete(ctx, "k")
+		assert.NotNil(tt, err)
+		assert.Eventually(tt, func() bool {
+			return len(cx.RetryStats().Depth) == 0
+		}, time.Second, time.Millisecond)
+		mu.Lock()
+		assert.Equal(tt, 2, calls["k"])
+		mu.Unlock()
+		assert.Empty(tt, cx.RetryStats().GiveUps)
+	})
+
+	t.Run("retry failed batch", func(tt *testing.T) {
+		var mu sync.Mutex
+		var retried [][]string
+		mocker := cache.NewCacheMocker[string]().
+			MockMDelete(func(ctx context.Context, keys []string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				if len(keys) == 3 {
+					return &cache.BatchError{Keys: []string{"b"}, Err: errors.New("delete fail")}
+				}
+				retried = append(retried, keys)
+				return nil
+			})
+		cx, err := NewBuilder[string, string](ctx).
+			AddCache(mocker).
+			SetGetDataKey(func(key string) string { return key }).
+			SetDeleteRetry(RetryConfig{MaxAttempts: 3, Backoff: time.Millisecond}).
+			Build()
+		assert.Nil(tt, err)
+		defer cx.retry.Close()
+
+		assert.NotNil(tt, cx.MDelete(ctx, []string{"a", "b", "c"}))
+		assert.Eventually(tt, func() bool {
+			return len(cx.RetryStats().Depth) == 0
+		}, time.Second, time.Millisecond)
+		mu.Lock()
+		assert.Equal(tt, [][]string{{"b"}}, retried)
+		mu.Unlock()
+	})
+
+	t.Run("give up", func(tt *testing.T) {
+		lru := cache.NewLRUCache[string](10, time.Hour)
+		mocker := cache.NewCacheMocker[string]().MockMDelete(func(ctx context.Context, keys []string) error {
+			return errors.New("delete fail")
+		})
+		gaveUp := make(chan []string, 1)
+		cx, err := NewBuilder[string, string](ctx).
+			SetName("test").
+			AddCache(mocker).
+			AddCache(lru).
+			SetGetDataKey(func(key string) string { return key }).
+			SetDeleteRetry(RetryConfig{MaxAttempts: 2, Backoff: time.Millisecond}).
+			SetRetryGiveUpCallback(func(ctx context.Context, name string, level int, keys []string, err error) {
+				assert.Equal(tt, "test", name)
+				assert.Equal(tt, 0, level)
+				gaveUp <- keys
+			}).
+			Build()
+		assert.Nil(tt, err)
+		defer cx.retry.Close()
+
+		err = cx.MDelete(ctx, []string{"a", "b"})
+		assert.NotNil(tt, err)
+		select {
+		case keys := <-gaveUp:
+			assert.Equal(tt, []string{"a", "b"}, keys)
+		case <-time.After(time.Second):
+			tt.Fatal("retry not given up")
+		}
+		assert.Eventually(tt, func() bool {
+			return cx.RetryStats().GiveUps[0] == 1
+		}, time.Second, time.Millisecond)
+		assert.Empty(tt, cx.RetryStats().Depth)
+	})
+
+	t.Run("double delete", func(tt *testing.T) {
+		lru := cache.NewLRUCache[string](10, time.Hour)
+		cx, err := NewBuilder[string, string](ctx).
+			AddCache(lru).
+			SetGetDataKey(func(key string) string { return key }).
+			SetDoubleDelete(20 * time.Millisecond).
+			Build()
+		assert.Nil(tt, err)
+		defer cx.retry.Close()
+		assert.Nil(tt, cx.retryConfig)
+
+		err = cx.Delete(ctx, "k")
+		assert.Nil(tt, err)
+		assert.Equal(tt, map[int]int{0: 1}, cx.RetryStats().Depth)
+		// 删除后被旧数据回填，双删后清除
+		_ = lru.Set(ctx, "k", "stale", time.Now())
+		assert.Eventually(tt, func() bool {
+			_, ok := lru.Get(ctx, "k", time.Hour)
+			return !ok
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("persist", func(tt *testing.T) {
+		file := filepath.Join(tt.TempDir(), "retry.json")
+		mocker := cache.NewCacheMocker[string]().MockMDelete(func(ctx context.Context, keys []string) error {
+			return errors.New("delete fail")
+		})
+		cx, err := NewBuilder[string, string](ctx).
+			AddCache(mocker).
+			SetGetDataKey(func(key string) string { return key }).
+			SetDeleteRetry(RetryConfig{Backoff: time.Hour, File: file}).
+			Build()
+		assert.Nil(tt, err)
+		_ = cx.MDelete(ctx, []string{"k"})
+		cx.retry.Close()
+
+		cx, err = NewBuilder[string, string](ctx).
+			AddCache(mocker).
+			SetGetDataKey(func(key string) string { return key }).
+			SetDeleteRetry(RetryConfig{File: file}).
+			Build()
+		assert.Nil(tt, err)
+		defer cx.retry.Close()
+		assert.Equal(tt, map[int]int{0: 1}, cx.RetryStats().Depth)
+	})
+
+	t.Run("not enabled", func(tt *testing.T) {
+		cx := &CacheX[string, string]{
+			logger:     logger.NewDefaultLogger(),
+			getDataKey: func(key string) string { return key },
+			caches: []cache.Cache[string]{cache.NewCacheMocker[string]().MockDelete(func(ctx context.Context, key string) error {
+				return errors.New("delete fail")
+			})},
+		}
+		assert.NotNil(tt, cx.Delete(ctx, "k"))
+		assert.Empty(tt, cx.RetryStats().Depth)
+		assert.Nil(tt, cx.retryDelete(ctx, 1, []string{"k"}))
+	})
+}
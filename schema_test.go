@@ -0,0 +1,118 @@
+package cachex
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kakkk/cachex/cache"
+)
+
+type userV1 struct {
+	Name string
+}
+
+type userV2 struct {
+	Name  string
+	Admin bool
+}
+
+func TestCacheX_schema(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	old := cache.NewRedisCacheWithClient[userV1](client, time.Minute)
+	assert.Nil(t, old.Set(ctx, "u", userV1{Name: "old"}, time.Now()))
+
+	migrateV1 := func(decode func(v any) error) (userV2, error) {
+		var u userV1
+		err := decode(&u)
+		return userV2{Name: u.Name}, err
+	}
+	newBuilder := func(version uint32) *Builder[string, userV2] {
+		return NewBuilder[string, userV2](ctx).
+			SetGetDataKey(func(key string) string { return key }).
+			SetGetRealData(func(ctx context.Context, key string) (userV2, error) {
+				return userV2{Name: "source", Admin: true}, nil
+			}).
+			SetSchemaVersion(version)
+	}
+	newCacheX := func(tt *testing.T, b *Builder[string, userV2]) *CacheX[string, userV2] {
+		cx, err := b.AddCache(cache.NewRedisCacheWithClient[userV2](client, time.Minute, b.SchemaOption())).Build()
+		assert.Nil(tt, err)
+		return cx
+	}
+
+	t.Run("migrate", func(tt *testing.T) {
+		cx := newCacheX(tt, newBuilder(1).RegisterMigration(0, migrateV1))
+		data, meta, ok := cx.GetWithMeta(ctx, "u", 0)
+		assert.True(tt, ok)
+		assert.Equal(tt, userV2{Name: "old"}, data)
+		assert.Equal(tt, 0, meta.Level)
+	})
+
+	t.Run("refresh", func(tt *testing.T) {
+		cx := newCacheX(tt, newBuilder(1))
+		data, meta, ok := cx.GetWithMeta(ctx, "u", 0)
+		assert.True(tt, ok)
+		assert.Equal(tt, userV2{Name: "source", Admin: true}, data)
+		assert.Equal(tt, LevelSource, meta.Level)
+		assert.Empty(tt, cx.Corruptions())
+
+		// 回源后写入当前版本
+		_, meta, _ = cx.GetWithMeta(ctx, "u", 0)
+		assert.Equal(tt, 0, meta.Level)
+		_, ok = old.Get(ctx, "u", 0)
+		assert.False(tt, ok)
+	})
+
+	t.Run("old instance not overwrite newer", func(tt *testing.T) {
+		newer := newCacheX(tt, newBuilder(2).RegisterMigration(1, func(decode func(v any) error) (userV2, error) {
+			var u userV2
+			err := decode(&u)
+			return u, err
+		}))
+		assert.Empty(tt, newer.Set(ctx, "n", userV2{Name: "newer"}).(CacheError).GetErrorLevels())
+		old := newCacheX(tt, newBuilder(1))
+		data, meta, ok := old.GetWithMeta(ctx, "n", 0)
+		assert.True(tt, ok)
+		assert.Equal(tt, LevelSource, meta.Level)
+		assert.Equal(tt, "source", data.Name)
+		err := old.Set(ctx, "n", userV2{Name: "old"})
+		assert.ErrorIs(tt, err, ErrSchemaNewer)
+		data, meta, ok = newer.GetWithMeta(ctx, "n", 0)
+		assert.True(tt, ok)
+		assert.Equal(tt, 0, meta.Level)
+		assert.Equal(tt, "newer", data.Name)
+	})
+
+	t.Run("version mismatch", func(tt *testing.T) {
+		_, err := newBuilder(1).AddCache(cache.NewRedisCacheWithClient[userV2](client, time.Minute)).Build()
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("missing migration", func(tt *testing.T) {
+		b := newBuilder(2)
+		_, err := b.AddCache(cache.NewRedisCacheWithClient[userV2](client, time.Minute, b.SchemaOption())).
+			RegisterMigration(1, migrateV1).
+			Build()
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("invalid migration", func(tt *testing.T) {
+		_, err := newBuilder(1).RegisterMigration(1, migrateV1).Build()
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("schema type mismatch", func(tt *testing.T) {
+		_, err := NewBuilder[string, userV2](ctx).
+			AddCache(cache.NewRedisCacheWithClient[userV2](client, time.Minute, cache.WithSchema(cache.Schema[userV1]{Version: 1}))).
+			SetGetDataKey(func(key string) string { return key }).
+			Build()
+		assert.ErrorIs(tt, err, cache.ErrSchemaType)
+	})
+}
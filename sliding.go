@@ -0,0 +1,130 @@
+package cachex
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"github.com/kakkk/cachex/cache"
+	"github.com/kakkk/cachex/internal/utils"
+)
+
+// SlidingConfig 滑动过期配置
+type SlidingConfig struct {
+	TTL      time.Duration // 命中后各层级缓存延长到的存活时间，LRU、BigCache使用缓存固定ttl
+	Interval time.Duration // 同一key两次延长的最小间隔，避免热点key每次读取都产生写入
+	Size     int           // 记录最近访问时间的key数量上限，超出后淘汰最久未访问的key，被淘汰的key回退为按写入时间过期
+}
+
+// SlidingStats 滑动过期统计
+type SlidingStats struct {
+	Tracked   int   // 记录最近访问时间的key数量
+	Fallbacks int64 // 超出Size被淘汰访问记录、回退为按写入时间过期的key数量
+}
+
+// defaultSlidingConfig 默认滑动过期配置
+var defaultSlidingConfig = SlidingConfig{
+	Interval: time.Second,
+	Size:     10000,
+}
+
+// withDefault 未设置的配置项使用默认值
+func (c SlidingConfig) withDefault() SlidingConfig {
+	if c.Interval <= 0 {
+		c.Interval = defaultSlidingConfig.Interval
+	}
+	if c.Size <= 0 {
+		c.Size = defaultSlidingConfig.Size
+	}
+	return c
+}
+
+// sliding 滑动过期状态，记录各key最近一次延长的时间，同时作为业务过期的起始时间；
+// 访问记录仅保存在本实例内存中，超出Size的key被淘汰后按写入时间过期，淘汰次数记录在fallbacks中
+type sliding struct {
+	cfg       SlidingConfig
+	access    *lru.Cache[string, int64]
+	fallbacks atomic.Int64
+}
+
+// newSliding 创建滑动过期状态
+func newSliding(cfg SlidingConfig) (*sliding, error) {
+	s := &sliding{cfg: cfg}
+	access, err := lru.NewWithEvict[string, int64](cfg.Size, func(string, int64) {
+		s.fallbacks.Add(1)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.access = access
+	return s, nil
+}
+
+// stats 获取滑动过期统计
+func (s *sliding) stats() SlidingStats {
+	return SlidingStats{Tracked: s.access.Len(), Fallbacks: s.fallbacks.Load()}
+}
+
+// isExpired 按写入时间与最近访问时间中较晚者判断业务过期
+func (s *sliding) isExpired(dataKey string, createAt int64, now time.Time, expire time.Duration) bool {
+	if accessAt, ok := s.access.Peek(dataKey); ok && accessAt > createAt {
+		createAt = accessAt
+	}
+	return utils.IsExpired(createAt, now, expire)
+}
+
+// due 距上次延长超过间隔时记录本次访问并返回true
+func (s *sliding) due(dataKey string, now time.Time) bool {
+	if accessAt, ok := s.access.Get(dataKey); ok && now.UnixMilli()-accessAt < s.cfg.Interval.Milliseconds() {
+		return false
+	}
+	s.access.Add(dataKey, now.UnixMilli())
+	return true
+}
+
+// SlidingStats 获取滑动过期统计，未开启滑动过期时返回空统计；Fallbacks持续增长时应调大SlidingConfig.Size
+func (cx *CacheX[K, V]) SlidingStats() SlidingStats {
+	if cx.sliding == nil {
+		return SlidingStats{}
+	}
+	return cx.sliding.stats()
+}
+
+// levelExpire 滑动过期时由CacheX判断业务过期，缓存层不过滤
+func (cx *CacheX[K, V]) levelExpire(expire time.Duration) time.Duration {
+	if cx.sliding != nil {
+		return 0
+	}
+	return expire
+}
+
+// isSlidingExpired 滑动过期时按最近访问时间判断业务过期，未开启时由缓存层判断
+func (cx *CacheX[K, V]) isSlidingExpired(dataKey string, createAt int64, now time.Time, expire time.Duration) bool {
+	return cx.sliding != nil && cx.sliding.isExpired(dataKey, createAt, now, expire)
+}
+
+// slide 命中后延长命中层级及其外层缓存的存活时间并前移业务过期时间，按间隔限流
+func (cx *CacheX[K, V]) slide(ctx context.Context, level int, dataKeys []string, now time.Time) {
+	if cx.sliding == nil || level < 0 {
+		return
+	}
+	keys := make([]string, 0, len(dataKeys))
+	for _, dataKey := range dataKeys {
+		if cx.sliding.due(dataKey, now) {
+			keys = append(keys, dataKey)
+		}
+	}
+	for l := level; l >= 0 && len(keys) > 0; l-- {
+		toucher, ok := cx.caches[l].(cache.Toucher)
+		if !ok {
+			continue
+		}
+		for _, dataKey := range keys {
+			if _, err := toucher.Touch(ctx, dataKey, cx.sliding.cfg.TTL); err != nil {
+				cx.logger.Warnf(ctx, "cache %v level %v touch key %v error: %v", cx.name, l, dataKey, err)
+			}
+		}
+	}
+}
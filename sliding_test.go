@@ -0,0 +1,116 @@
+package cachex
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kakkk/cachex/cache"
+)
+
+func TestCacheX_slidingExpiration(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("extend backend ttl", func(tt *testing.T) {
+		mr := miniredis.RunT(tt)
+		rc := cache.NewRedisCacheWithClient[string](redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Minute)
+		cx, err := NewBuilder[string, string](ctx).
+			AddCache(rc).
+			AddCache(cache.NewLRUCache[string](10, time.Minute)).
+			SetGetDataKey(func(key string) string { return key }).
+			SetSlidingExpiration(SlidingConfig{TTL: time.Hour, Interval: time.Hour}).
+			Build()
+		assert.Nil(tt, err)
+		assert.Nil(tt, cx.Set(ctx, "k", "v"))
+		assert.LessOrEqual(tt, mr.TTL("k"), 2*time.Minute)
+
+		data, ok := cx.Get(ctx, "k", 0)
+		assert.True(tt, ok)
+		assert.Equal(tt, "v", data)
+		assert.Equal(tt, time.Hour, mr.TTL("k"))
+
+		// 间隔内不再延长
+		mr.SetTTL("k", time.Minute)
+		_, ok = cx.Get(ctx, "k", 0)
+		assert.True(tt, ok)
+		assert.Equal(tt, time.Minute, mr.TTL("k"))
+	})
+
+	t.Run("mget extend backend ttl", func(tt *testing.T) {
+		mr := miniredis.RunT(tt)
+		rc := cache.NewRedisCacheWithClient[string](redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Minute)
+		cx, err := NewBuilder[string, string](ctx).
+			AddCache(rc).
+			SetGetDataKey(func(key string) string { return key }).
+			SetSlidingExpiration(SlidingConfig{TTL: time.Hour}).
+			Build()
+		assert.Nil(tt, err)
+		assert.Nil(tt, cx.MSet(ctx, map[string]string{"a": "1", "b": "2"}))
+
+		data := cx.MGet(ctx, []string{"a", "b", "c"}, 0)
+		assert.Equal(tt, map[string]string{"a": "1", "b": "2"}, data)
+		assert.Equal(tt, time.Hour, mr.TTL("a"))
+		assert.Equal(tt, time.Hour, mr.TTL("b"))
+	})
+
+	t.Run("move business expire", func(tt *testing.T) {
+		expire := 200 * time.Millisecond
+		cx, err := NewBuilder[string, string](ctx).
+			AddCache(cache.NewLRUCache[string](10, time.Minute)).
+			SetGetDataKey(func(key string) string { return key }).
+			SetSlidingExpiration(SlidingConfig{Interval: time.Millisecond}).
+			Build()
+		assert.Nil(tt, err)
+		now := time.Now()
+		cx.now = func() time.Time { return now }
+		assert.Nil(tt, cx.MSet(ctx, map[string]string{"a": "1", "b": "2"}))
+
+		for i := 0; i < 3; i++ {
+			now = now.Add(expire / 2)
+			_, ok := cx.Get(ctx, "a", expire)
+			assert.True(tt, ok)
+		}
+		// 未访问的key按写入时间过期
+		_, ok := cx.Get(ctx, "b", expire)
+		assert.False(tt, ok)
+
+		now = now.Add(expire + time.Millisecond)
+		_, ok = cx.Get(ctx, "a", expire)
+		assert.False(tt, ok)
+	})
+
+	t.Run("size limit fallback", func(tt *testing.T) {
+		cx, err := NewBuilder[string, string](ctx).
+			AddCache(cache.NewLRUCache[string](10, time.Minute)).
+			SetGetDataKey(func(key string) string { return key }).
+			SetSlidingExpiration(SlidingConfig{Size: 1}).
+			Build()
+		assert.Nil(tt, err)
+		assert.Nil(tt, cx.MSet(ctx, map[string]string{"a": "1", "b": "2"}))
+		_, _ = cx.Get(ctx, "a", time.Hour)
+		assert.Equal(tt, SlidingStats{Tracked: 1}, cx.SlidingStats())
+		_, _ = cx.Get(ctx, "b", time.Hour)
+		assert.Equal(tt, SlidingStats{Tracked: 1, Fallbacks: 1}, cx.SlidingStats())
+
+		// 被淘汰的key按写入时间过期
+		now := time.Now()
+		createAt := now.Add(-2 * time.Hour).UnixMilli()
+		assert.True(tt, cx.isSlidingExpired("a", createAt, now.Add(time.Minute), time.Hour))
+		assert.False(tt, cx.isSlidingExpired("b", createAt, now.Add(time.Minute), time.Hour))
+	})
+
+	t.Run("disabled", func(tt *testing.T) {
+		cx, err := NewBuilder[string, string](ctx).
+			AddCache(cache.NewLRUCache[string](10, time.Minute)).
+			SetGetDataKey(func(key string) string { return key }).
+			Build()
+		assert.Nil(tt, err)
+		assert.Nil(tt, cx.mSet(ctx, map[string]string{"k": "v"}, time.Now().Add(-time.Minute)))
+		_, ok := cx.Get(ctx, "k", 20*time.Millisecond)
+		assert.False(tt, ok)
+	})
+}